@@ -18,8 +18,11 @@ func CreateInstanceAccount(actorId string, actor *models.Actor) *Account {
 	}
 }
 
-func CreateShigInstanceId(_ string) uuid.UUID {
-	actorId := "test-this-out"
+// LegacyShigInstanceId is the id every instance account had in older versions, the migration replaces it
+var LegacyShigInstanceId = CreateShigInstanceId("test-this-out")
+
+// CreateShigInstanceId derives the id of an instance from its actor id, so every instance knows the ids of the others
+func CreateShigInstanceId(actorId string) uuid.UUID {
 	nameByte := []byte(actorId)
 	md5String := fmt.Sprintf("%x", md5.Sum(nameByte))
 	return uuid.MustParse(md5String)
@@ -1,10 +1,11 @@
 package clients
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
@@ -12,6 +13,29 @@ import (
 	"golang.org/x/exp/slog"
 )
 
+// The data channel of the signalling may lose messages, a lost offer desynchronizes the session.
+// So an offer is sent again until the remote peer answers or acknowledges its id.
+var (
+	ackTimeout      = 3 * time.Second
+	maxSendAttempts = 4
+)
+
+// receivedTypes are the message types the messenger understands, the remote peer learns them by the hello
+var receivedTypes = []message.MsgType{
+	message.OfferMsg,
+	message.AnswerMsg,
+	message.MuteMsg,
+	message.MetadataMsg,
+	message.ChatMsg,
+	message.AppMsg,
+	message.SubscribeMsg,
+	message.UnsubscribeMsg,
+	message.LastNMsg,
+	message.AckMsg,
+	message.HelloMsg,
+	message.EstimateMsg,
+}
+
 type Messenger struct {
 	locker       sync.RWMutex
 	counter      atomic.Uint32
@@ -19,6 +43,25 @@ type Messenger struct {
 	observerList map[uuid.UUID]msgObserver
 	queueChan    chan []byte
 	quit         chan struct{}
+	ackLocker    sync.Mutex
+	ackTimeout   time.Duration
+	unacked      map[uint32]*unackedMsg
+	lastOffer    *receivedOffer
+	protocol     atomic.Pointer[message.Protocol]
+}
+
+// unackedMsg is a sent message that waits for its acknowledgement
+type unackedMsg struct {
+	data     []byte
+	attempts int
+	timer    *time.Timer
+}
+
+// receivedOffer is the last offer of the remote peer, a repeated offer gets the same answer again
+type receivedOffer struct {
+	id     uint32
+	number uint32
+	answer []byte
 }
 
 func NewMessenger(s msgSender) *Messenger {
@@ -28,12 +71,18 @@ func NewMessenger(s msgSender) *Messenger {
 		observerList: make(map[uuid.UUID]msgObserver),
 		queueChan:    make(chan []byte),
 		quit:         make(chan struct{}),
+		ackTimeout:   ackTimeout,
+		unacked:      make(map[uint32]*unackedMsg),
 	}
 	m.counter.Store(0)
+	m.protocol.Store(message.LegacyProtocol())
 	s.OnMessage(m.onMessages)
 	s.OnOpen(func() {
 		slog.Debug("lobby.Messenger: sender is open start sending worker")
 		go func() {
+			if err := m.sendHello(s); err != nil {
+				slog.Error("lobby.Messenger: send hello", "err", err)
+			}
 			for {
 				slog.Debug("lobby.Messenger: sending worker running")
 				select {
@@ -51,17 +100,76 @@ func NewMessenger(s msgSender) *Messenger {
 	return m
 }
 
+// SendOffer sends the offer until the remote peer answers it or acknowledges its id
 func (m *Messenger) SendOffer(offer *webrtc.SessionDescription, number uint32) (uint32, error) {
 	slog.Debug("lobby.Messenger: start to send offer", "number", number)
-	id := m.count()
-	return m.sendSDP(offer, id, number)
+	id := m.nextId()
+	byteMsg, err := m.marshalSDP(offer, id, number)
+	if err != nil {
+		return id, err
+	}
+	m.awaitAck(id, byteMsg)
+	m.enqueue(byteMsg)
+	slog.Debug("lobby.Messenger: sdp is send", "number", number)
+	return id, nil
 }
+
+// SendAnswer answers the offer with the id. If the remote peer sends the offer again, it gets this answer again.
 func (m *Messenger) SendAnswer(sdp *webrtc.SessionDescription, id uint32, number uint32) (uint32, error) {
 	slog.Debug("lobby.Messenger: start to send answer", "number", number)
-	return m.sendSDP(sdp, id, number)
+	byteMsg, err := m.marshalSDP(sdp, id, number)
+	if err != nil {
+		return id, err
+	}
+	m.ackLocker.Lock()
+	if m.lastOffer != nil && m.lastOffer.id == id {
+		m.lastOffer.answer = byteMsg
+	}
+	m.ackLocker.Unlock()
+	m.enqueue(byteMsg)
+	slog.Debug("lobby.Messenger: sdp is send", "number", number)
+	return id, nil
 }
 
-func (m *Messenger) sendSDP(sdp *webrtc.SessionDescription, id uint32, number uint32) (uint32, error) {
+// SendAck acknowledges a message of the remote peer without an answer, for example an ignored offer
+func (m *Messenger) SendAck(id uint32) error {
+	channelMsg := &message.ChannelMsg{
+		Id:   id,
+		Type: message.AckMsg,
+	}
+
+	if err := m.send(channelMsg); err != nil {
+		return fmt.Errorf("marshaling ack message (msgId %d): %w", id, err)
+	}
+	return nil
+}
+
+// sendHello tells the remote peer the protocol version, the encodings and the message types of the messenger.
+// An old remote peer ignores the hello and the messenger keeps the legacy protocol.
+func (m *Messenger) sendHello(s msgSender) error {
+	byteMsg, err := message.Marshal(&message.ChannelMsg{Type: message.HelloMsg, Data: message.NewHello(receivedTypes...)})
+	if err != nil {
+		return fmt.Errorf("marshaling hello message: %w", err)
+	}
+	return s.Send(byteMsg)
+}
+
+// send encodes the message with the negotiated protocol and queues it, a message type the remote peer does not know
+// is skipped
+func (m *Messenger) send(channelMsg *message.ChannelMsg) error {
+	byteMsg, err := m.protocol.Load().Marshal(channelMsg)
+	if errors.Is(err, message.ErrMsgTypeNotSupported) {
+		slog.Debug("lobby.Messenger: skip message type", "type", channelMsg.Type, "dataChannel", m.sender.Label())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.enqueue(byteMsg)
+	return nil
+}
+
+func (m *Messenger) marshalSDP(sdp *webrtc.SessionDescription, id uint32, number uint32) ([]byte, error) {
 	sdpMsg := &message.Sdp{
 		SDP:    sdp,
 		Number: number,
@@ -81,46 +189,113 @@ func (m *Messenger) sendSDP(sdp *webrtc.SessionDescription, id uint32, number ui
 		Data: sdpMsg,
 	}
 
-	byteMsg, err := message.Marshal(channelMsg)
+	byteMsg, err := m.protocol.Load().Marshal(channelMsg)
 	if err != nil {
-		return id, fmt.Errorf("marshaling offer message (msgId %d sdp %d): %w", id, number, err)
+		return nil, fmt.Errorf("marshaling sdp message (msgId %d sdp %d): %w", id, number, err)
 	}
+	return byteMsg, nil
+}
 
+func (m *Messenger) enqueue(byteMsg []byte) {
 	select {
 	case <-m.quit:
 	default:
 		select {
 		case m.queueChan <- byteMsg:
-			slog.Debug("lobby.Messenger: sdp is send", "number", number)
 		case <-m.quit:
 		}
 	}
+}
 
-	return id, nil
+// awaitAck sends the message again, until the remote peer acknowledges the id or the attempts are exhausted
+func (m *Messenger) awaitAck(id uint32, byteMsg []byte) {
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	msg := &unackedMsg{data: byteMsg, attempts: 1}
+	msg.timer = time.AfterFunc(m.ackTimeout, func() { m.resend(id) })
+	m.unacked[id] = msg
 }
 
-func (m *Messenger) SendMute(mute *message.Mute) error {
-	channelMsg := &message.ChannelMsg{
-		Id:   0,
-		Type: message.MuteMsg,
-		Data: mute,
+func (m *Messenger) resend(id uint32) {
+	m.ackLocker.Lock()
+	msg, ok := m.unacked[id]
+	if !ok {
+		m.ackLocker.Unlock()
+		return
+	}
+	if msg.attempts >= maxSendAttempts {
+		delete(m.unacked, id)
+		m.ackLocker.Unlock()
+		slog.Error("lobby.Messenger: message was never acknowledged", "id", id, "attempts", msg.attempts, "dataChannel", m.sender.Label())
+		return
 	}
+	msg.attempts++
+	attempt := msg.attempts
+	msg.timer.Reset(m.ackTimeout)
+	m.ackLocker.Unlock()
 
-	byteMsg, err := message.Marshal(channelMsg)
-	if err != nil {
-		return fmt.Errorf("marshaling mute message: %w", err)
+	slog.Warn("lobby.Messenger: send unacknowledged message again", "id", id, "attempt", attempt, "dataChannel", m.sender.Label())
+	m.enqueue(msg.data)
+}
+
+func (m *Messenger) acknowledge(id uint32) {
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	if msg, ok := m.unacked[id]; ok {
+		msg.timer.Stop()
+		delete(m.unacked, id)
 	}
+}
 
-	select {
-	case <-m.quit:
-	default:
-		select {
-		case m.queueChan <- byteMsg:
-			slog.Debug("lobby.Messenger: mute is send")
-		case <-m.quit:
+// isRepeatedOffer reports whether the offer was received before. A repeated offer that is already answered gets the
+// answer again, because the remote peer has lost it.
+func (m *Messenger) isRepeatedOffer(id uint32, number uint32) bool {
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	if m.lastOffer != nil && m.lastOffer.id == id && m.lastOffer.number == number {
+		if m.lastOffer.answer != nil {
+			go m.enqueue(m.lastOffer.answer)
 		}
+		return true
 	}
+	m.lastOffer = &receivedOffer{id: id, number: number}
+	return false
+}
+
+func (m *Messenger) SendMute(mute *message.Mute) error {
+	return m.sendData(message.MuteMsg, mute)
+}
+
+func (m *Messenger) SendMetadata(metadata *message.Metadata) error {
+	return m.sendData(message.MetadataMsg, metadata)
+}
+
+func (m *Messenger) SendChat(chat *message.Chat) error {
+	return m.sendData(message.ChatMsg, chat)
+}
 
+func (m *Messenger) SendAppMessage(appMessage *message.AppMessage) error {
+	return m.sendData(message.AppMsg, appMessage)
+}
+
+func (m *Messenger) SendActiveSpeaker(activeSpeaker *message.ActiveSpeaker) error {
+	return m.sendData(message.ActiveSpeakerMsg, activeSpeaker)
+}
+
+func (m *Messenger) SendTrackSlots(trackSlots *message.TrackSlots) error {
+	return m.sendData(message.TrackSlotsMsg, trackSlots)
+}
+
+func (m *Messenger) SendEstimate(estimate *message.Estimate) error {
+	return m.sendData(message.EstimateMsg, estimate)
+}
+
+// sendData sends a message without id, it is neither answered nor acknowledged
+func (m *Messenger) sendData(msgType message.MsgType, data any) error {
+	if err := m.send(&message.ChannelMsg{Type: msgType, Data: data}); err != nil {
+		return fmt.Errorf("marshaling %s message: %w", msgType, err)
+	}
+	slog.Debug("lobby.Messenger: message is send", "type", msgType, "dataChannel", m.sender.Label())
 	return nil
 }
 
@@ -132,6 +307,7 @@ func (m *Messenger) onMessages(dcMsg webrtc.DataChannelMessage) {
 		channelMsg, err := message.Unmarshal(dcMsg.Data)
 		if err != nil {
 			slog.Error("lobby.Messenger: unmarshal message ([]byte)", "dataChannel", m.sender.Label(), "length", len(dcMsg.Data))
+			return
 		}
 		m.notifyAll(channelMsg)
 	}
@@ -160,17 +336,53 @@ func (m *Messenger) notifyAll(msg *message.ChannelMsg) {
 	case message.OfferMsg:
 		m.handleOfferMsg(msg)
 	case message.MuteMsg:
-		m.handleMuteMsg(msg)
+		notify(m, msg, msgObserver.OnMute)
+	case message.MetadataMsg:
+		notify(m, msg, msgObserver.OnMetadata)
+	case message.ChatMsg:
+		notify(m, msg, msgObserver.OnChat)
+	case message.AppMsg:
+		notify(m, msg, msgObserver.OnAppMessage)
+	case message.SubscribeMsg:
+		notify(m, msg, msgObserver.OnSubscribe)
+	case message.UnsubscribeMsg:
+		notify(m, msg, msgObserver.OnUnsubscribe)
+	case message.LastNMsg:
+		notify(m, msg, msgObserver.OnLastN)
+	case message.AckMsg:
+		m.acknowledge(msg.Id)
+	case message.HelloMsg:
+		m.handleHelloMsg(msg)
+	case message.EstimateMsg:
+		notify(m, msg, msgObserver.OnEstimate)
 	default:
 		slog.Error("lobby.Messenger: unknown msg type", "err", fmt.Sprintf("unknown msg type: %d", msg.Type), "dataChannel", m.sender.Label())
 	}
 }
 
+// notify converts the data of the message to its type and passes it to every observer
+func notify[T any](m *Messenger, msg *message.ChannelMsg, deliver func(observer msgObserver, data *T)) {
+	data, err := message.DataOf[T](msg)
+	if err != nil {
+		slog.Error("lobby.Messenger: unmarshal message", "err", err, "dataChannel", m.sender.Label())
+		return
+	}
+	slog.Debug("lobby.Messenger: handle incoming message", "type", msg.Type, "dataChannel", m.sender.Label())
+
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+	for _, observer := range m.observerList {
+		deliver(observer, data)
+	}
+}
+
 func (m *Messenger) handleAnswerMsg(msg *message.ChannelMsg) {
-	answer, err := m.unmarshalSdp(msg)
+	answer, err := message.DataOf[message.Sdp](msg)
 	if err != nil {
 		slog.Error("Messenger: handleAnswerMsg", "err", err)
+		return
 	}
+	m.acknowledge(msg.Id)
 	m.locker.RLock()
 	defer m.locker.RUnlock()
 	for _, observer := range m.observerList {
@@ -179,9 +391,14 @@ func (m *Messenger) handleAnswerMsg(msg *message.ChannelMsg) {
 }
 
 func (m *Messenger) handleOfferMsg(msg *message.ChannelMsg) {
-	offer, err := m.unmarshalSdp(msg)
+	offer, err := message.DataOf[message.Sdp](msg)
 	if err != nil {
 		slog.Error("Messenger: handleOfferMsg", "err", err)
+		return
+	}
+	if m.isRepeatedOffer(msg.Id, offer.Number) {
+		slog.Debug("lobby.Messenger: ignore repeated offer", "id", msg.Id, "number", offer.Number)
+		return
 	}
 	m.locker.RLock()
 	defer m.locker.RUnlock()
@@ -190,34 +407,16 @@ func (m *Messenger) handleOfferMsg(msg *message.ChannelMsg) {
 	}
 }
 
-func (m *Messenger) unmarshalSdp(msg *message.ChannelMsg) (*message.Sdp, error) {
-	jsonStr, err := json.Marshal(msg.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal message: %w", err)
-	}
-	sdp, err := message.SdpUnmarshal(jsonStr)
+// handleHelloMsg negotiates the protocol with the hello of the remote peer
+func (m *Messenger) handleHelloMsg(msg *message.ChannelMsg) {
+	hello, err := message.DataOf[message.Hello](msg)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal sdp of mesge: %w", err)
-	}
-	return sdp, nil
-}
-
-func (m *Messenger) handleMuteMsg(msg *message.ChannelMsg) {
-	jsonStr, err := json.Marshal(msg.Data)
-	if err != nil {
-		slog.Error("lobby.Messenger: unmarshal mute", "err", err, "dataChannel", m.sender.Label())
-	}
-	mute, err := message.MuteUnmarshal(jsonStr)
-	if err != nil {
-		slog.Error("lobby.Messenger: unmarshal mute", "err", err, "dataChannel", m.sender.Label())
-	}
-	slog.Debug("lobby.Messenger: handle incoming mute Msg")
-
-	m.locker.RLock()
-	defer m.locker.RUnlock()
-	for _, observer := range m.observerList {
-		observer.OnMute(mute)
+		slog.Error("lobby.Messenger: unmarshal hello", "err", err, "dataChannel", m.sender.Label())
+		return
 	}
+	protocol := message.NewHello(receivedTypes...).Negotiate(hello)
+	m.protocol.Store(protocol)
+	slog.Debug("lobby.Messenger: protocol negotiated", "version", protocol.Version(), "encoding", protocol.Encoding(), "dataChannel", m.sender.Label())
 }
 
 func (m *Messenger) close() {
@@ -227,9 +426,17 @@ func (m *Messenger) close() {
 		close(m.quit)
 		<-m.quit
 	}
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	for id, msg := range m.unacked {
+		msg.timer.Stop()
+		delete(m.unacked, id)
+	}
 }
-func (m *Messenger) count() uint32 {
-	return m.counter.Load()
+
+// nextId returns the id of a new offer, the answer of the remote peer refers to it
+func (m *Messenger) nextId() uint32 {
+	return m.counter.Add(1) - 1
 }
 
 // -------------- Interfaces ---------- //
@@ -244,5 +451,12 @@ type msgObserver interface {
 	OnAnswer(sdp *webrtc.SessionDescription, number uint32)
 	OnOffer(sdp *webrtc.SessionDescription, responseId uint32, responseMsgNumber uint32)
 	OnMute(mute *message.Mute)
+	OnMetadata(metadata *message.Metadata)
+	OnChat(chat *message.Chat)
+	OnAppMessage(appMessage *message.AppMessage)
+	OnSubscribe(subscription *message.Subscription)
+	OnUnsubscribe(subscription *message.Subscription)
+	OnLastN(lastN *message.LastN)
+	OnEstimate(estimate *message.Estimate)
 	GetId() uuid.UUID
 }
@@ -3,6 +3,7 @@ package clients
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
@@ -21,9 +22,18 @@ func testMessengerSetup(t *testing.T) (*Messenger, *senderMock, *msgObserverMock
 	o := newMsgObserverMock(t)
 	m.Register(o)
 	s.start()
+	hello, _ := message.Unmarshal(<-s.testSendData)
+	assert.Equal(t, message.HelloMsg, hello.Type)
 	return m, s, o
 }
 
+func testRemoteHello(t *testing.T, sender *senderMock, hello *message.Hello) {
+	t.Helper()
+	raw, err := message.Marshal(&message.ChannelMsg{Type: message.HelloMsg, Data: hello})
+	assert.NoError(t, err)
+	sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: raw})
+}
+
 func TestMessenger(t *testing.T) {
 	t.Run("send Offer", func(t *testing.T) {
 		m, sender, _ := testMessengerSetup(t)
@@ -31,6 +41,134 @@ func TestMessenger(t *testing.T) {
 		assert.Equal(t, rawOffer, <-sender.testSendData)
 	})
 
+	t.Run("give every offer its own id", func(t *testing.T) {
+		m, sender, _ := testMessengerSetup(t)
+		first, _ := m.SendOffer(mocks.Offer, 1)
+		firstMsg, _ := message.Unmarshal(<-sender.testSendData)
+		second, _ := m.SendOffer(mocks.Offer, 2)
+		secondMsg, _ := message.Unmarshal(<-sender.testSendData)
+
+		assert.NotEqual(t, first, second)
+		assert.Equal(t, first, firstMsg.Id)
+		assert.Equal(t, second, secondMsg.Id)
+	})
+
+	t.Run("ignore broken messages", func(t *testing.T) {
+		_, sender, o := testMessengerSetup(t)
+		o.onAnswerCallback = func(_ *webrtc.SessionDescription, _ uint32) {
+			t.Error("broken answer was delivered")
+		}
+
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: []byte(`{"id":1,"data":{"number":"x"},"type":2}`)})
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: []byte(`--no json--`)})
+	})
+
+	t.Run("send offer again until it is answered", func(t *testing.T) {
+		m, sender, o := testMessengerSetup(t)
+		m.ackTimeout = 10 * time.Millisecond
+		o.onAnswerCallback = func(_ *webrtc.SessionDescription, _ uint32) {}
+		id, _ := m.SendOffer(mocks.Offer, 2)
+		first := <-sender.testSendData
+
+		assert.Equal(t, first, <-sender.testSendData)
+		answer, _ := message.Marshal(&message.ChannelMsg{Id: id, Type: message.AnswerMsg, Data: &message.Sdp{SDP: mocks.Answer, Number: 2}})
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: answer})
+		testNoMessage(t, sender)
+	})
+
+	t.Run("stop sending offer when it is acknowledged", func(t *testing.T) {
+		m, sender, _ := testMessengerSetup(t)
+		m.ackTimeout = 10 * time.Millisecond
+		id, _ := m.SendOffer(mocks.Offer, 2)
+		<-sender.testSendData
+
+		ack, _ := message.Marshal(&message.ChannelMsg{Id: id, Type: message.AckMsg})
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: ack})
+		testNoMessage(t, sender)
+	})
+
+	t.Run("give up sending an offer that is never acknowledged", func(t *testing.T) {
+		m, sender, _ := testMessengerSetup(t)
+		m.ackTimeout = 10 * time.Millisecond
+		_, _ = m.SendOffer(mocks.Offer, 2)
+
+		for attempt := 0; attempt < maxSendAttempts; attempt++ {
+			assert.Equal(t, rawOffer, <-sender.testSendData)
+		}
+		testNoMessage(t, sender)
+	})
+
+	t.Run("answer a repeated offer again", func(t *testing.T) {
+		m, sender, o := testMessengerSetup(t)
+		offers := 0
+		o.onOfferCbk = func(_ *webrtc.SessionDescription, responseId uint32, number uint32) {
+			offers++
+			_, _ = m.SendAnswer(mocks.Answer, responseId, number)
+		}
+
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: rawOffer})
+		answer := <-sender.testSendData
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: rawOffer})
+
+		assert.Equal(t, answer, <-sender.testSendData)
+		assert.Equal(t, 1, offers)
+	})
+
+	t.Run("send hello when the channel opens", func(t *testing.T) {
+		s := newSendMock(t)
+		NewMessenger(s)
+		s.start()
+
+		msg, err := message.Unmarshal(<-s.testSendData)
+		assert.NoError(t, err)
+		hello, err := message.DataOf[message.Hello](msg)
+		assert.NoError(t, err)
+		assert.Equal(t, message.ProtocolVersion, hello.Version)
+		assert.Equal(t, []message.Encoding{message.CborEncoding, message.JsonEncoding}, hello.Encodings)
+		assert.Contains(t, hello.Types, message.MetadataMsg)
+	})
+
+	t.Run("encode messages as cbor after the hello", func(t *testing.T) {
+		m, sender, o := testMessengerSetup(t)
+		testRemoteHello(t, sender, message.NewHello(message.MetadataMsg))
+		metadata := &message.Metadata{MediaStreamId: "stream", DisplayName: "Alice", Role: "host", HandRaised: true}
+		_ = m.SendMetadata(metadata)
+		raw := <-sender.testSendData
+
+		var received *message.Metadata
+		o.onMetadataCbk = func(metadata *message.Metadata) {
+			received = metadata
+		}
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: raw})
+
+		assert.NotEqual(t, byte('{'), raw[0])
+		assert.Equal(t, metadata, received)
+	})
+
+	t.Run("encode messages as json for a peer without cbor", func(t *testing.T) {
+		m, sender, _ := testMessengerSetup(t)
+		testRemoteHello(t, sender, &message.Hello{Version: message.ProtocolVersion, Encodings: []message.Encoding{message.JsonEncoding}})
+		_, _ = m.SendOffer(mocks.Offer, 2)
+
+		assert.Equal(t, rawOffer, <-sender.testSendData)
+	})
+
+	t.Run("skip message types the remote peer does not know", func(t *testing.T) {
+		m, sender, o := testMessengerSetup(t)
+		testRemoteHello(t, sender, message.NewHello(message.OfferMsg, message.AnswerMsg))
+
+		assert.NoError(t, m.SendMetadata(&message.Metadata{MediaStreamId: "stream"}))
+		testNoMessage(t, sender)
+		_, _ = m.SendOffer(mocks.Offer, 2)
+
+		var received *webrtc.SessionDescription
+		o.onOfferCbk = func(sdp *webrtc.SessionDescription, _ uint32, _ uint32) {
+			received = sdp
+		}
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: <-sender.testSendData})
+		assert.Equal(t, mocks.Offer, received)
+	})
+
 	t.Run("receive Answer", func(t *testing.T) {
 		_, sender, o := testMessengerSetup(t)
 
@@ -50,6 +188,46 @@ func TestMessenger(t *testing.T) {
 		assert.Equal(t, mocks.Answer, answer)
 		assert.Equal(t, uint32(3), index)
 	})
+
+	t.Run("send and receive Metadata", func(t *testing.T) {
+		m, sender, o := testMessengerSetup(t)
+		metadata := &message.Metadata{MediaStreamId: "stream", DisplayName: "Alice", Role: "host", HandRaised: true}
+		_ = m.SendMetadata(metadata)
+		raw := <-sender.testSendData
+
+		var received *message.Metadata
+		var wg sync.WaitGroup
+		wg.Add(1)
+		o.onMetadataCbk = func(metadata *message.Metadata) {
+			defer wg.Done()
+			received = metadata
+		}
+
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: raw})
+		wg.Wait()
+
+		assert.Equal(t, metadata, received)
+	})
+
+	t.Run("send and receive Estimate", func(t *testing.T) {
+		m, sender, o := testMessengerSetup(t)
+		estimate := &message.Estimate{Bitrate: 800_000, Hops: 2, Trace: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+		assert.NoError(t, m.SendEstimate(estimate))
+		raw := <-sender.testSendData
+
+		var received *message.Estimate
+		var wg sync.WaitGroup
+		wg.Add(1)
+		o.onEstimateCbk = func(estimate *message.Estimate) {
+			defer wg.Done()
+			received = estimate
+		}
+
+		sender.updateOnmessageListener(webrtc.DataChannelMessage{Data: raw})
+		wg.Wait()
+
+		assert.Equal(t, estimate, received)
+	})
 }
 
 type senderMock struct {
@@ -85,6 +263,12 @@ type msgObserverMock struct {
 	id               uuid.UUID
 	onAnswerCallback func(sdp *webrtc.SessionDescription, number uint32)
 	onMuteCallback   func(mute *message.Mute)
+	onMetadataCbk    func(metadata *message.Metadata)
+	onChatCbk        func(chat *message.Chat)
+	onAppMessageCbk  func(appMessage *message.AppMessage)
+	onSubscribeCbk   func(subscription *message.Subscription)
+	onOfferCbk       func(sdp *webrtc.SessionDescription, responseId uint32, number uint32)
+	onEstimateCbk    func(estimate *message.Estimate)
 }
 
 func newMsgObserverMock(t *testing.T) *msgObserverMock {
@@ -106,13 +290,57 @@ func (o *msgObserverMock) OnMute(mute *message.Mute) {
 	}
 }
 
+func (o *msgObserverMock) OnMetadata(metadata *message.Metadata) {
+	if o.onMetadataCbk != nil {
+		o.onMetadataCbk(metadata)
+	}
+}
+
+func (o *msgObserverMock) OnChat(chat *message.Chat) {
+	if o.onChatCbk != nil {
+		o.onChatCbk(chat)
+	}
+}
+
+func (o *msgObserverMock) OnAppMessage(appMessage *message.AppMessage) {
+	if o.onAppMessageCbk != nil {
+		o.onAppMessageCbk(appMessage)
+	}
+}
+
+func (o *msgObserverMock) OnSubscribe(subscription *message.Subscription) {
+	if o.onSubscribeCbk != nil {
+		o.onSubscribeCbk(subscription)
+	}
+}
+
+func (o *msgObserverMock) OnUnsubscribe(_ *message.Subscription) {}
+
+func (o *msgObserverMock) OnLastN(_ *message.LastN) {}
+
+func (o *msgObserverMock) OnEstimate(estimate *message.Estimate) {
+	if o.onEstimateCbk != nil {
+		o.onEstimateCbk(estimate)
+	}
+}
+
 func (o *msgObserverMock) GetId() uuid.UUID {
 	return o.id
 }
 
 func (o *msgObserverMock) OnOffer(sdp *webrtc.SessionDescription, responseId uint32, responseMsgNumber uint32) {
-	//TODO implement me
-	panic("implement me")
+	if o.onOfferCbk != nil {
+		o.onOfferCbk(sdp, responseId, responseMsgNumber)
+	}
+}
+
+func testNoMessage(t *testing.T, sender *senderMock) {
+	t.Helper()
+	select {
+	case msg := <-sender.testSendData:
+		t.Errorf("unexpected message: %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
 }
 
 func newMockedMessenger(t *testing.T) *Messenger {
@@ -120,5 +348,6 @@ func newMockedMessenger(t *testing.T) *Messenger {
 	s := newSendMock(t)
 	m := NewMessenger(s)
 	s.start()
+	<-s.testSendData
 	return m
 }
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/internal/rtp"
+)
+
+type ChangePurpose struct {
+	*Command
+	mediaStreamId string
+	purpose       rtp.Purpose
+}
+
+func NewChangePurpose(ctx context.Context, user uuid.UUID, mediaStreamId string, purpose rtp.Purpose) *ChangePurpose {
+	command := NewCommand(ctx, user)
+	return &ChangePurpose{
+		Command:       command,
+		mediaStreamId: mediaStreamId,
+		purpose:       purpose,
+	}
+}
+
+func (c *ChangePurpose) Execute(session *sessions.Session) {
+	if err := session.ChangeMediaStreamPurpose(c.ParentCtx, c.mediaStreamId, c.purpose); err != nil {
+		c.SetError(err)
+		return
+	}
+	c.SetDone()
+}
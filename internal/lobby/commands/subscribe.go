@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/internal/rtp"
+)
+
+type Subscribe struct {
+	*Command
+	mediaStreamIds []string
+	maxQuality     rtp.VideoQuality
+	unsubscribe    bool
+}
+
+func NewSubscribe(ctx context.Context, user uuid.UUID, mediaStreamIds []string, maxQuality rtp.VideoQuality) *Subscribe {
+	command := NewCommand(ctx, user)
+	return &Subscribe{
+		Command:        command,
+		mediaStreamIds: mediaStreamIds,
+		maxQuality:     maxQuality,
+	}
+}
+
+func NewUnsubscribe(ctx context.Context, user uuid.UUID, mediaStreamIds []string) *Subscribe {
+	command := NewCommand(ctx, user)
+	return &Subscribe{
+		Command:        command,
+		mediaStreamIds: mediaStreamIds,
+		unsubscribe:    true,
+	}
+}
+
+func (c *Subscribe) Execute(session *sessions.Session) {
+	var err error
+	if c.unsubscribe {
+		err = session.Unsubscribe(c.ParentCtx, c.mediaStreamIds)
+	} else {
+		err = session.Subscribe(c.ParentCtx, c.mediaStreamIds, c.maxQuality)
+	}
+	if err != nil {
+		c.SetError(err)
+		return
+	}
+	c.SetDone()
+}
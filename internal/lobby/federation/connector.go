@@ -5,25 +5,88 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/shigde/sfu/internal/lobby/clients"
 	"github.com/shigde/sfu/internal/lobby/commands"
 	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/internal/metric"
 	"golang.org/x/exp/slog"
 )
 
 var (
-	LoginError = errors.New("login to remote instance failed")
+	LoginError        = errors.New("login to remote instance failed")
+	ErrConnectionLost = errors.New("connection to host instance lost")
 )
 
+// The connection to the host instance is supervised. A failed or lost connection is established again, the waiting
+// time between the attempts doubles up to the maximum.
+var (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+	healthCheckInterval = 5 * time.Second
+)
+
+type ConnectorState int
+
+const (
+	ConnectorIdle ConnectorState = iota
+	ConnectorConnecting
+	ConnectorConnected
+	ConnectorWaiting
+	ConnectorStopped
+)
+
+func (s ConnectorState) String() string {
+	switch s {
+	case ConnectorConnecting:
+		return "connecting"
+	case ConnectorConnected:
+		return "connected"
+	case ConnectorWaiting:
+		return "waiting"
+	case ConnectorStopped:
+		return "stopped"
+	default:
+		return "idle"
+	}
+}
+
+// ConnectorStatus is the state of the connection to the host instance. The attempts are the failed attempts since
+// the connection was established the last time.
+type ConnectorStatus struct {
+	Host       string    `json:"host"`
+	State      string    `json:"state"`
+	Attempts   int       `json:"attempts"`
+	Reconnects int       `json:"reconnects"`
+	LastError  string    `json:"lastError,omitempty"`
+	Since      time.Time `json:"since"`
+}
+
+// InstanceConnection is the ingress and egress endpoint pair of a lobby to the lobby of the host instance
+type InstanceConnection interface {
+	Connect(ctx context.Context) error
+	IsConnected() bool
+	Disconnect()
+}
+
 type Connector struct {
 	ctx          context.Context
 	homeActorIri url.URL
+	homeInstance uuid.UUID
 	api          *clients.ApiClient
 	host         *host
 	space        string
 	liveStream   string
+
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	healthInterval time.Duration
+
+	locker sync.RWMutex
+	status ConnectorStatus
 }
 
 func NewConnector(
@@ -37,58 +100,121 @@ func NewConnector(
 	host := newHost(hostActorIri, token)
 	api := clients.NewApiClient(host, hostActorIri.Host, space, liveStream)
 	return &Connector{
-		ctx:          ctx,
-		homeActorIri: homeActorIri,
-		api:          api,
-		host:         host,
-		space:        space,
-		liveStream:   liveStream,
+		ctx:            ctx,
+		homeActorIri:   homeActorIri,
+		homeInstance:   newHost(homeActorIri, "").instanceId,
+		api:            api,
+		host:           host,
+		space:          space,
+		liveStream:     liveStream,
+		minBackoff:     reconnectMinBackoff,
+		maxBackoff:     reconnectMaxBackoff,
+		healthInterval: healthCheckInterval,
+		status:         ConnectorStatus{Host: host.actorId, State: ConnectorIdle.String(), Since: time.Now()},
 	}
 }
 
-func (c *Connector) BuildIngress() (*commands.OfferIngress, error) {
+// Supervise connects the lobby to the host instance and keeps the connection until the lobby stops
+func (c *Connector) Supervise(conn InstanceConnection) {
+	defer c.stop(conn)
+	backoff := c.minBackoff
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+
+		c.setState(ConnectorConnecting, nil)
+		err := conn.Connect(c.ctx)
+		if err == nil {
+			c.setState(ConnectorConnected, nil)
+			backoff = c.minBackoff
+			c.watch(conn)
+			if c.ctx.Err() != nil {
+				return
+			}
+			err = ErrConnectionLost
+			c.reconnected()
+		}
+
+		conn.Disconnect()
+		c.setState(ConnectorWaiting, err)
+		slog.Warn("federation.Connector: connect to host instance again", "err", err, "host", c.host.actorId, "backoff", backoff)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.maxBackoff)
+	}
+}
+
+// watch checks the health of the connection, it returns when the connection is lost or the lobby stops
+func (c *Connector) watch(conn InstanceConnection) {
+	ticker := time.NewTicker(c.healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if !conn.IsConnected() {
+				return
+			}
+		}
+	}
+}
+
+func (c *Connector) stop(conn InstanceConnection) {
+	conn.Disconnect()
+	c.setState(ConnectorStopped, nil)
+	metric.FederationConnectionDelete(c.liveStream, c.host.actorId)
+}
+
+func (c *Connector) setState(state ConnectorState, err error) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.status.State = state.String()
+	c.status.Since = time.Now()
+	switch {
+	case err != nil:
+		c.status.Attempts++
+		c.status.LastError = err.Error()
+	case state == ConnectorConnected:
+		c.status.Attempts = 0
+	}
+	metric.FederationConnectionState(c.liveStream, c.host.actorId, int(state))
+}
+
+func (c *Connector) reconnected() {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.status.Reconnects++
+	metric.FederationReconnectInc(c.liveStream, c.host.actorId)
+}
+
+// Status returns the state of the connection, a lobby of the host instance has no connection
+func (c *Connector) Status() ConnectorStatus {
+	c.locker.RLock()
+	defer c.locker.RUnlock()
+	return c.status
+}
+
+func (c *Connector) BuildIngress(ctx context.Context) (*commands.OfferIngress, error) {
 	slog.Debug("lobby.HostController. connect to live stream host instance", "instanceId", c.host.instanceId)
 	if _, err := c.api.Login(); err != nil {
 		return nil, fmt.Errorf("login to remote host: %w", err)
 	}
+	return commands.NewOfferIngress(ctx, c.api, c.host.instanceId, sessions.BidirectionalSignalChannel), nil
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	cmd := commands.NewOfferIngress(ctx, c.api, c.host.instanceId, sessions.BidirectionalSignalChannel)
-
-	return cmd, nil
-	//
-	//	request := lobby2.newLobbyRequest(ctx, instanceId)
-	//	data := lobby2.newHostGetPipeOfferData()
-	//	request.data = data
-	//	go c.lobby.runRequest(request)
-	//
-	//	var answer *webrtc.SessionDescription
-	//	select {
-	//	case <-c.ctx.Done():
-	//		return lobby2.errSessionAlreadyClosed
-	//	case err := <-request.err:
-	//		return fmt.Errorf("requesting pipe offer: %w", err)
-	//	case res := <-data.response:
-	//		var err error
-	//		if answer, err = c.hostApi.PostHostPipeOffer(c.settings.space, c.settings.stream, res.offer); err != nil {
-	//			return fmt.Errorf("remote host answer request: %w", err)
-	//		}
-	//	}
-	//	return c.onHostPipeAnswerResponse(answer, instanceId)
-}
-
-func (c *Connector) BuildEgress() (*commands.OfferEgress, error) {
+func (c *Connector) BuildEgress(ctx context.Context) (*commands.OfferEgress, error) {
 	slog.Debug("lobby.HostController. connect to live stream host instance", "instanceId", c.host.instanceId)
 	if _, err := c.api.Login(); err != nil {
 		return nil, fmt.Errorf("login to remote host: %w", err)
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	cmd := commands.NewOfferEgress(ctx, c.api, c.host.instanceId, sessions.BidirectionalSignalChannel)
-
-	return cmd, nil
+	return commands.NewOfferEgress(ctx, c.api, c.host.instanceId, sessions.BidirectionalSignalChannel), nil
 }
 
 func (c *Connector) IsThisInstanceLiveSteamHost() bool {
@@ -98,3 +224,8 @@ func (c *Connector) IsThisInstanceLiveSteamHost() bool {
 func (c *Connector) GetInstanceId() uuid.UUID {
 	return c.host.instanceId
 }
+
+// GetHomeInstanceId returns the id of this instance, like the other instances know it
+func (c *Connector) GetHomeInstanceId() uuid.UUID {
+	return c.homeInstance
+}
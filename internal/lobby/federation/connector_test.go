@@ -0,0 +1,139 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testInstanceConnection struct {
+	mutex       sync.Mutex
+	failures    int
+	connected   bool
+	connects    chan struct{}
+	disconnects int
+}
+
+func (c *testInstanceConnection) Connect(_ context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	defer func() {
+		select {
+		case c.connects <- struct{}{}:
+		default:
+		}
+	}()
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("host not reachable")
+	}
+	c.connected = true
+	return nil
+}
+
+func (c *testInstanceConnection) IsConnected() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.connected
+}
+
+func (c *testInstanceConnection) Disconnect() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connected = false
+	c.disconnects++
+}
+
+func (c *testInstanceConnection) lose() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connected = false
+}
+
+func testConnectorSetup(t *testing.T, failures int) (*Connector, *testInstanceConnection, context.CancelFunc, chan struct{}) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	home, _ := url.Parse("https://home.org/federation/accounts/shig")
+	host, _ := url.Parse("https://host.org/federation/accounts/shig")
+	connector := NewConnector(ctx, *home, *host, "space", "stream", "token")
+	connector.minBackoff = time.Millisecond
+	connector.maxBackoff = 4 * time.Millisecond
+	connector.healthInterval = time.Millisecond
+	conn := &testInstanceConnection{failures: failures, connects: make(chan struct{}, 10)}
+
+	stopped := make(chan struct{})
+	go func() {
+		connector.Supervise(conn)
+		close(stopped)
+	}()
+	return connector, conn, cancel, stopped
+}
+
+func waitForConnects(t *testing.T, conn *testInstanceConnection, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		select {
+		case <-conn.connects:
+		case <-time.After(time.Second):
+			t.Fatalf("connect %d not called", i+1)
+		}
+	}
+}
+
+func TestConnector(t *testing.T) {
+	t.Run("connect again after failed attempts", func(t *testing.T) {
+		connector, conn, _, _ := testConnectorSetup(t, 3)
+
+		waitForConnects(t, conn, 4)
+
+		assert.Eventually(t, func() bool {
+			return connector.Status().State == ConnectorConnected.String()
+		}, time.Second, time.Millisecond)
+		status := connector.Status()
+		assert.Equal(t, 0, status.Attempts)
+		assert.Equal(t, "host not reachable", status.LastError)
+		assert.Equal(t, "shig@host.org", status.Host)
+	})
+
+	t.Run("reconnect after the connection is lost", func(t *testing.T) {
+		connector, conn, _, _ := testConnectorSetup(t, 0)
+		waitForConnects(t, conn, 1)
+
+		conn.lose()
+		waitForConnects(t, conn, 1)
+
+		assert.Eventually(t, func() bool {
+			status := connector.Status()
+			return status.State == ConnectorConnected.String() && status.Reconnects == 1
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, ErrConnectionLost.Error(), connector.Status().LastError)
+	})
+
+	t.Run("disconnect when the lobby stops", func(t *testing.T) {
+		connector, conn, cancel, stopped := testConnectorSetup(t, 0)
+		waitForConnects(t, conn, 1)
+
+		cancel()
+		<-stopped
+
+		assert.False(t, conn.IsConnected())
+		assert.Equal(t, ConnectorStopped.String(), connector.Status().State)
+	})
+
+	t.Run("stop while waiting to connect again", func(t *testing.T) {
+		connector, conn, cancel, stopped := testConnectorSetup(t, 100)
+		waitForConnects(t, conn, 1)
+
+		cancel()
+		<-stopped
+
+		assert.Equal(t, ConnectorStopped.String(), connector.Status().State)
+		assert.Greater(t, connector.Status().Attempts, 0)
+	})
+}
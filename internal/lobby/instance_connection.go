@@ -0,0 +1,58 @@
+package lobby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shigde/sfu/internal/lobby/sessions"
+)
+
+var errNoInstanceSession = errors.New("no session for instance connection")
+
+// instanceConnection connects the lobby to the lobby of the live stream host instance, it is supervised by the
+// federation.Connector
+type instanceConnection struct {
+	lobby *lobby
+}
+
+func (c *instanceConnection) Connect(ctx context.Context) error {
+	l := c.lobby
+	if ok := l.newSession(l.connector.GetInstanceId(), sessions.InstanceSession); !ok {
+		return errNoInstanceSession
+	}
+
+	cmdIngress, err := l.connector.BuildIngress(ctx)
+	if err != nil {
+		return fmt.Errorf("build ingress connection: %w", err)
+	}
+	l.runCommand(cmdIngress)
+	if err = cmdIngress.WaitForDone(); err != nil {
+		return fmt.Errorf("run ingress connection cmd: %w", err)
+	}
+
+	cmdEgress, err := l.connector.BuildEgress(ctx)
+	if err != nil {
+		return fmt.Errorf("build egress connection: %w", err)
+	}
+	l.runCommand(cmdEgress)
+	if err = cmdEgress.WaitForDone(); err != nil {
+		return fmt.Errorf("run egress connection cmd: %w", err)
+	}
+	return nil
+}
+
+func (c *instanceConnection) IsConnected() bool {
+	session, found := c.lobby.sessions.FindByUserId(c.lobby.connector.GetInstanceId())
+	return found && session.IsConnected()
+}
+
+// Disconnect closes the endpoints to the host instance and removes the session, a lost connection removes the
+// session by itself
+func (c *instanceConnection) Disconnect() {
+	instanceId := c.lobby.connector.GetInstanceId()
+	if session, found := c.lobby.sessions.FindByUserId(instanceId); found {
+		session.Stop()
+		c.lobby.removeInstanceSession(instanceId)
+	}
+}
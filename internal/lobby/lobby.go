@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/shigde/sfu/internal/lobby/federation"
 	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/pkg/message"
 	"golang.org/x/exp/slog"
 )
 
@@ -22,6 +23,7 @@ var (
 	ErrNoSession            = errors.New("no session exists")
 	ErrSessionAlreadyExists = errors.New("session already exists")
 	ErrLobbyClosed          = errors.New("lobby already closed")
+	ErrLobbyNotActive       = errors.New("lobby not active")
 )
 
 // lobby, is a container for all sessions of a stream
@@ -34,6 +36,7 @@ type lobby struct {
 	hub      *sessions.Hub
 	sessions *sessions.SessionRepository
 	rtp      sessions.RtpEngine
+	audience *sessions.Audience
 
 	sessionCreator chan<- sessions.Item
 	sessionGarbage chan<- sessions.Item
@@ -43,16 +46,21 @@ type lobby struct {
 	connector *federation.Connector
 }
 
-func newLobby(entity *LobbyEntity, rtp sessions.RtpEngine, homeActorIri *url.URL, registerToken string, lobbyGarbage chan<- lobbyItem) *lobby {
+func newLobby(entity *LobbyEntity, owner uuid.UUID, rtp sessions.RtpEngine, homeActorIri *url.URL, registerToken string, lobbyGarbage chan<- lobbyItem) *lobby {
 	ctx, stop := context.WithCancel(context.Background())
 	sessRep := sessions.NewSessionRepository()
-	hub := sessions.NewHub(ctx, sessRep, entity.LiveStreamId, nil)
 	hostActorIri, _ := url.Parse(entity.Host)
+	connector := federation.NewConnector(ctx, *homeActorIri, *hostActorIri, entity.Space, entity.LiveStreamId.String(), registerToken)
+
+	hubOptions := []sessions.HubOption{sessions.HubWithInstanceId(connector.GetHomeInstanceId()), sessions.HubWithOwner(owner)}
+	if engine, ok := rtp.(sessions.TranscodingEngine); ok {
+		hubOptions = append(hubOptions, sessions.HubWithTranscoding(engine.NewTranscodingPool(ctx)))
+	}
+	hub := sessions.NewHub(ctx, sessRep, entity.LiveStreamId, nil, hubOptions...)
 
 	garbage := make(chan sessions.Item)
 	creator := make(chan sessions.Item)
 	runner := make(chan command)
-	connector := federation.NewConnector(ctx, *homeActorIri, *hostActorIri, entity.Space, entity.LiveStreamId.String(), registerToken)
 
 	lobObj := &lobby{
 		Id:   entity.UUID,
@@ -63,6 +71,7 @@ func newLobby(entity *LobbyEntity, rtp sessions.RtpEngine, homeActorIri *url.URL
 		entity:   entity,
 		sessions: sessRep,
 		rtp:      rtp,
+		audience: sessions.NewAudience(ctx, hub, rtp),
 
 		sessionGarbage: garbage,
 		sessionCreator: creator,
@@ -88,7 +97,8 @@ func newLobby(entity *LobbyEntity, rtp sessions.RtpEngine, homeActorIri *url.URL
 			case item := <-sessionGarbage:
 				ok := l.sessions.DeleteByUser(item.UserId)
 				item.Done <- ok
-				if l.sessions.LenUserSession() == 0 {
+				// the connection to the host instance is not a reason to keep or close the lobby
+				if item.SessionType != sessions.InstanceSession && l.sessions.LenUserSession() == 0 {
 					item := newLobbyItem(l.Id)
 					go func() {
 						l.lobbyGarbage <- item
@@ -115,9 +125,7 @@ func newLobby(entity *LobbyEntity, rtp sessions.RtpEngine, homeActorIri *url.URL
 	}(lobObj, creator, garbage, runner)
 
 	if !connector.IsThisInstanceLiveSteamHost() {
-		go func(l *lobby) {
-			l.connectToLiveStreamHostInstance()
-		}(lobObj)
+		go connector.Supervise(&instanceConnection{lobby: lobObj})
 	}
 
 	return lobObj
@@ -152,6 +160,19 @@ func (l *lobby) removeSession(userId uuid.UUID) bool {
 	}
 }
 
+func (l *lobby) removeInstanceSession(instanceId uuid.UUID) bool {
+	item := sessions.NewItem(instanceId)
+	item.SessionType = sessions.InstanceSession
+	select {
+	case l.sessionGarbage <- item:
+		return <-item.Done
+	case <-l.ctx.Done():
+		return false
+	case <-time.After(10 * time.Second):
+		return false
+	}
+}
+
 func (l *lobby) runCommand(cmd command) {
 	select {
 	case l.cmdRunner <- cmd:
@@ -160,6 +181,15 @@ func (l *lobby) runCommand(cmd command) {
 	}
 }
 
+// getChatHistory, returns the last chat messages of the lobby
+func (l *lobby) getChatHistory(ctx context.Context) ([]*message.Chat, error) {
+	return l.hub.GetChatHistory(ctx)
+}
+
+func (l *lobby) setLastN(ctx context.Context, lastN int) error {
+	return l.hub.DispatchLastN(ctx, lastN)
+}
+
 // handle, run session commands on existing sessions
 func (l *lobby) handle(cmd command) {
 	if session, found := l.sessions.FindByUserId(cmd.GetUserId()); found {
@@ -168,31 +198,7 @@ func (l *lobby) handle(cmd command) {
 	cmd.SetError(ErrNoSession)
 }
 
-func (l *lobby) connectToLiveStreamHostInstance() {
-	if ok := l.newSession(l.connector.GetInstanceId(), sessions.InstanceSession); !ok {
-		slog.Error("no session found for instance connection")
-		return
-	}
-
-	cmdIngress, err := l.connector.BuildIngress()
-	if err != nil {
-		slog.Error("build Ingress connection", "err", err)
-		return
-	}
-	l.runCommand(cmdIngress)
-	if err = cmdIngress.WaitForDone(); err != nil {
-		slog.Error("run ingress build connection cmd", "err", err)
-		return
-	}
-
-	cmdEgress, err := l.connector.BuildEgress()
-	if err != nil {
-		slog.Error("build Egress connection", "err", err)
-		return
-	}
-	l.runCommand(cmdEgress)
-	if err = cmdEgress.WaitForDone(); err != nil {
-		slog.Error("run egress build connection cmd", "err", err)
-		return
-	}
+// federationStatus, returns the state of the connection to the host instance of the live stream
+func (l *lobby) federationStatus() federation.ConnectorStatus {
+	return l.connector.Status()
 }
@@ -8,9 +8,12 @@ import (
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
 	"github.com/shigde/sfu/internal/lobby/commands"
+	"github.com/shigde/sfu/internal/lobby/federation"
 	"github.com/shigde/sfu/internal/lobby/resources"
 	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/internal/rtp"
 	"github.com/shigde/sfu/internal/storage"
+	"github.com/shigde/sfu/pkg/message"
 	"golang.org/x/exp/slog"
 )
 
@@ -73,6 +76,132 @@ func (m *LobbyManager) NewEgressResource(ctx context.Context, lobbyId uuid.UUID,
 	}
 }
 
+// NewViewerResource creates a viewer session with an egress endpoint only. The data channel of the egress endpoint
+// is the signal channel of the viewer, so the viewer needs no ingress endpoint.
+func (m *LobbyManager) NewViewerResource(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, offer *webrtc.SessionDescription, option ...resources.Option) (*resources.WebRTC, error) {
+	lobbyObj, err := m.lobbies.getOrCreateLobby(ctx, lobbyId, m.lobbyGarbage)
+	if err != nil {
+		return nil, fmt.Errorf("getting or creating lobby: %w", err)
+	}
+	if ok := lobbyObj.newSession(user, sessions.ViewerSession); !ok {
+		return nil, fmt.Errorf("creating new viewer session failed")
+	}
+
+	cmd := commands.NewCreateEgress(ctx, user, offer, sessions.UnidirectionalSignalChannel)
+	lobbyObj.runCommand(cmd)
+
+	select {
+	case <-cmd.Done():
+		return cmd.Response, cmd.Err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("time out")
+	}
+}
+
+// NewAudienceResource adds a viewer to the audience of an active lobby. The viewer receives the main program only,
+// it gets no session and no signal channel.
+func (m *LobbyManager) NewAudienceResource(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, offer *webrtc.SessionDescription) (*resources.WebRTC, error) {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return nil, ErrLobbyNotActive
+	}
+	viewerId, answer, err := lobbyObj.audience.Join(ctx, user, offer)
+	if err != nil {
+		return nil, fmt.Errorf("joining audience: %w", err)
+	}
+	slog.Debug("lobby.LobbyManager: audience viewer joined", "lobbyId", lobbyId, "userId", user, "viewerId", viewerId)
+	return &resources.WebRTC{Id: viewerId.String(), SDP: answer}, nil
+}
+
+// RemoveAudienceResource closes the egress endpoint of an audience viewer, it returns false if the viewer is unknown.
+func (m *LobbyManager) RemoveAudienceResource(_ context.Context, lobbyId uuid.UUID, user uuid.UUID, viewerId uuid.UUID) (bool, error) {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return false, ErrLobbyNotActive
+	}
+	left := lobbyObj.audience.Leave(viewerId)
+	slog.Debug("lobby.LobbyManager: audience viewer removed", "lobbyId", lobbyId, "userId", user, "viewerId", viewerId, "left", left)
+	return left, nil
+}
+
+func (m *LobbyManager) ChangeMediaStreamPurpose(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, mediaStreamId string, purpose rtp.Purpose) error {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return ErrLobbyNotActive
+	}
+
+	cmd := commands.NewChangePurpose(ctx, user, mediaStreamId, purpose)
+	lobbyObj.runCommand(cmd)
+
+	select {
+	case <-cmd.Done():
+		return cmd.Err
+	case <-ctx.Done():
+		return fmt.Errorf("time out")
+	}
+}
+
+func (m *LobbyManager) Subscribe(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, mediaStreamIds []string, maxQuality rtp.VideoQuality) error {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return ErrLobbyNotActive
+	}
+
+	cmd := commands.NewSubscribe(ctx, user, mediaStreamIds, maxQuality)
+	lobbyObj.runCommand(cmd)
+
+	select {
+	case <-cmd.Done():
+		return cmd.Err
+	case <-ctx.Done():
+		return fmt.Errorf("time out")
+	}
+}
+
+func (m *LobbyManager) Unsubscribe(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, mediaStreamIds []string) error {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return ErrLobbyNotActive
+	}
+
+	cmd := commands.NewUnsubscribe(ctx, user, mediaStreamIds)
+	lobbyObj.runCommand(cmd)
+
+	select {
+	case <-cmd.Done():
+		return cmd.Err
+	case <-ctx.Done():
+		return fmt.Errorf("time out")
+	}
+}
+
+func (m *LobbyManager) GetChatHistory(ctx context.Context, lobbyId uuid.UUID) ([]*message.Chat, error) {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return nil, ErrLobbyNotActive
+	}
+	return lobbyObj.getChatHistory(ctx)
+}
+
+// GetFederationStatus returns the state of the connection to the host instance of the live stream
+func (m *LobbyManager) GetFederationStatus(_ context.Context, lobbyId uuid.UUID) (*federation.ConnectorStatus, error) {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return nil, ErrLobbyNotActive
+	}
+	status := lobbyObj.federationStatus()
+	return &status, nil
+}
+
+// SetLastN limits the video of all sessions in the lobby to the N most recently active speakers
+func (m *LobbyManager) SetLastN(ctx context.Context, lobbyId uuid.UUID, lastN int) error {
+	lobbyObj, ok := m.lobbies.getLobby(lobbyId)
+	if !ok {
+		return ErrLobbyNotActive
+	}
+	return lobbyObj.setLastN(ctx, lastN)
+}
+
 func (m *LobbyManager) LeaveLobby(ctx context.Context, lobbyId uuid.UUID, userId uuid.UUID) (bool, error) {
 	return false, nil
 }
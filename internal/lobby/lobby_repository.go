@@ -53,7 +53,12 @@ func (r *lobbyRepository) getOrCreateLobby(ctx context.Context, lobbyId uuid.UUI
 			return nil, fmt.Errorf("updating lobby entity as running: %w", err)
 		}
 
-		lobby := newLobby(entity, r.rtpEngine, r.homeActorIri, r.registerToken, lobbyGarbage)
+		owner, err := r.queryLobbyOwner(ctx, entity)
+		if err != nil {
+			slog.Warn("lobby.lobbyRepository: lobby without host role", "lobbyId", lobbyId, "err", err)
+		}
+
+		lobby := newLobby(entity, owner, r.rtpEngine, r.homeActorIri, r.registerToken, lobbyGarbage)
 		r.lobbies[lobbyId] = lobby
 		metric.RunningLobbyInc(lobby.entity.LiveStreamId.String(), lobbyId.String())
 		return lobby, nil
@@ -124,6 +129,27 @@ func (r *lobbyRepository) queryLobbyEntity(ctx context.Context, lobbyId string)
 	return lobby, nil
 }
 
+// queryLobbyOwner returns the user of the account owning the live stream of the lobby
+func (r *lobbyRepository) queryLobbyOwner(ctx context.Context, lobby *LobbyEntity) (uuid.UUID, error) {
+	tx, cancel := r.store.GetDatabaseWithContext(ctx)
+	defer cancel()
+
+	var owner string
+	result := tx.Table("live_streams").
+		Select("accounts.uuid").
+		Joins("join accounts on accounts.id = live_streams.account_id").
+		Where("live_streams.lobby_id=?", lobby.ID).
+		Limit(1).
+		Scan(&owner)
+	if result.Error != nil {
+		return uuid.Nil, fmt.Errorf("finding owner of lobby %s: %w", lobby.UUID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return uuid.Nil, fmt.Errorf("finding owner of lobby %s: %w", lobby.UUID, gorm.ErrRecordNotFound)
+	}
+	return uuid.Parse(owner)
+}
+
 func (r *lobbyRepository) updateLobbyEntity(ctx context.Context, lobby *LobbyEntity) (*LobbyEntity, error) {
 	tx, cancel := r.store.GetDatabaseWithContext(ctx)
 	defer cancel()
@@ -29,7 +29,7 @@ func testLobbySetup(t *testing.T) (*lobby, uuid.UUID) {
 		Host:         hostActorIri.String(),
 	}
 
-	lobby := newLobby(entity, nil, homeActorIri, "token", make(chan<- lobbyItem, 1))
+	lobby := newLobby(entity, uuid.New(), nil, homeActorIri, "token", make(chan<- lobbyItem, 1))
 	user := uuid.New()
 	lobby.newSession(user, sessions.UserSession)
 	return lobby, user
@@ -1,9 +1,15 @@
 package mocks
 
-import "github.com/pion/webrtc/v3"
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
 
 type LiveSenderMock struct {
-	Tracks map[string]webrtc.TrackLocal
+	Tracks        map[string]webrtc.TrackLocal
+	mu            sync.RWMutex
+	activeSpeaker string
 }
 
 func NewLiveSender() *LiveSenderMock {
@@ -26,3 +32,15 @@ func (sf *LiveSenderMock) GetTracks() []webrtc.TrackLocal {
 	}
 	return tracks
 }
+
+func (sf *LiveSenderMock) SetActiveSpeaker(mediaStreamId string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.activeSpeaker = mediaStreamId
+}
+
+func (sf *LiveSenderMock) ActiveSpeaker() string {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.activeSpeaker
+}
@@ -0,0 +1,57 @@
+package sessions
+
+import (
+	"github.com/shigde/sfu/pkg/message"
+)
+
+// appAggregator collects high-volume app messages like reactions. Instead of relaying every single message,
+// the Hub sends one message per namespace and payload with the count of the collected messages.
+type appAggregator struct {
+	namespaces map[string]struct{}
+	order      []string
+	aggregates map[string]*message.AppMessage // namespace + payload --> aggregated message
+}
+
+func newAppAggregator(namespaces ...string) *appAggregator {
+	aggregator := &appAggregator{
+		namespaces: make(map[string]struct{}),
+		order:      make([]string, 0),
+		aggregates: make(map[string]*message.AppMessage),
+	}
+	for _, namespace := range namespaces {
+		aggregator.namespaces[namespace] = struct{}{}
+	}
+	return aggregator
+}
+
+// add collects the message, if the namespace of the message is aggregated and the message is sent to all.
+func (a *appAggregator) add(appMessage *message.AppMessage) bool {
+	if _, ok := a.namespaces[appMessage.Namespace]; !ok || appMessage.Target != nil {
+		return false
+	}
+
+	key := appMessage.Namespace + ":" + string(appMessage.Payload)
+	if aggregate, ok := a.aggregates[key]; ok {
+		aggregate.Count++
+		return true
+	}
+
+	a.aggregates[key] = &message.AppMessage{
+		Namespace: appMessage.Namespace,
+		Payload:   appMessage.Payload,
+		Count:     1,
+	}
+	a.order = append(a.order, key)
+	return true
+}
+
+// flush returns the collected messages in the order of their first occurrence and resets the aggregator.
+func (a *appAggregator) flush() []*message.AppMessage {
+	list := make([]*message.AppMessage, 0, len(a.order))
+	for _, key := range a.order {
+		list = append(list, a.aggregates[key])
+	}
+	a.order = a.order[:0]
+	a.aggregates = make(map[string]*message.AppMessage)
+	return list
+}
@@ -0,0 +1,36 @@
+package sessions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shigde/sfu/pkg/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppAggregator(t *testing.T) {
+	t.Run("aggregate messages of the same namespace and payload", func(t *testing.T) {
+		aggregator := newAppAggregator("reaction")
+		heart := json.RawMessage(`{"emoji":"heart"}`)
+		clap := json.RawMessage(`{"emoji":"clap"}`)
+
+		assert.True(t, aggregator.add(&message.AppMessage{Namespace: "reaction", Payload: heart, Sender: "a"}))
+		assert.True(t, aggregator.add(&message.AppMessage{Namespace: "reaction", Payload: clap, Sender: "b"}))
+		assert.True(t, aggregator.add(&message.AppMessage{Namespace: "reaction", Payload: heart, Sender: "c"}))
+
+		list := aggregator.flush()
+		assert.Len(t, list, 2)
+		assert.Equal(t, &message.AppMessage{Namespace: "reaction", Payload: heart, Count: 2}, list[0])
+		assert.Equal(t, &message.AppMessage{Namespace: "reaction", Payload: clap, Count: 1}, list[1])
+		assert.Empty(t, aggregator.flush())
+	})
+
+	t.Run("do not aggregate other namespaces or targeted messages", func(t *testing.T) {
+		aggregator := newAppAggregator("reaction")
+		payload := json.RawMessage(`{"vote":1}`)
+
+		assert.False(t, aggregator.add(&message.AppMessage{Namespace: "poll", Payload: payload}))
+		assert.False(t, aggregator.add(&message.AppMessage{Namespace: "reaction", Payload: payload, Target: &message.AppTarget{Role: "host"}}))
+		assert.Empty(t, aggregator.flush())
+	})
+}
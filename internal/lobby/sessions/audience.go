@@ -0,0 +1,101 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/internal/telemetry"
+	"golang.org/x/exp/slog"
+)
+
+// maxAudienceViewers limits the egress endpoints of one audience, every viewer costs a peer connection and a send queue
+const maxAudienceViewers = 1000
+
+var ErrAudienceFull = errors.New("audience is full")
+
+// Audience is the large audience of a lobby. Every viewer receives the main program of the Hub with its own egress endpoint.
+// The viewers have no data channel signalling, they are neither sessions of the lobby nor part of the track list of the Hub.
+type Audience struct {
+	ctx        context.Context
+	hub        *Hub
+	rtpEngine  RtpEngine
+	mutex      sync.Mutex
+	viewers    map[uuid.UUID]context.CancelFunc
+	maxViewers int
+}
+
+func NewAudience(ctx context.Context, hub *Hub, rtpEngine RtpEngine) *Audience {
+	return &Audience{
+		ctx:        ctx,
+		hub:        hub,
+		rtpEngine:  rtpEngine,
+		viewers:    make(map[uuid.UUID]context.CancelFunc),
+		maxViewers: maxAudienceViewers,
+	}
+}
+
+// Join receives the offer of a new viewer and returns the id of the viewer and the answer.
+// The viewer leaves the audience when its connection is lost or by Leave.
+func (a *Audience) Join(ctx context.Context, user uuid.UUID, offer *webrtc.SessionDescription) (uuid.UUID, *webrtc.SessionDescription, error) {
+	viewerId := uuid.New()
+	// like the context of a session, the endpoint traces the viewer with the values of the context
+	viewerCtx, cancel := context.WithCancel(telemetry.ContextWithSessionValue(a.ctx, viewerId.String(), a.hub.LiveStreamId.String(), user.String()))
+	// the place is reserved before the endpoint is created, so concurrent joins cannot exceed the limit
+	a.mutex.Lock()
+	if len(a.viewers) >= a.maxViewers {
+		a.mutex.Unlock()
+		cancel()
+		return uuid.Nil, nil, ErrAudienceFull
+	}
+	a.viewers[viewerId] = cancel
+	a.mutex.Unlock()
+
+	program, err := a.hub.GetProgram(ctx)
+	if err != nil {
+		a.Leave(viewerId)
+		return uuid.Nil, nil, fmt.Errorf("getting program: %w", err)
+	}
+
+	endpoint, err := a.rtpEngine.EstablishEndpoint(ctx, viewerCtx, viewerId, a.hub.LiveStreamId, *offer, rtp.EgressEndpoint,
+		rtp.EndpointWithProgram(program),
+		rtp.EndpointWithLostConnectionListener(func() { a.Leave(viewerId) }),
+	)
+	if err != nil {
+		a.Leave(viewerId)
+		return uuid.Nil, nil, fmt.Errorf("create rtp endpoint: %w", err)
+	}
+
+	ctxTimeout, cancelTimeout := context.WithTimeout(ctx, processWaitingTimeout)
+	defer cancelTimeout()
+	answer, err := endpoint.GetLocalDescription(ctxTimeout)
+	if err != nil {
+		a.Leave(viewerId)
+		return uuid.Nil, nil, fmt.Errorf("create audience answer: %w", err)
+	}
+	return viewerId, answer, nil
+}
+
+// Len returns the number of viewers
+func (a *Audience) Len() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return len(a.viewers)
+}
+
+// Leave closes the egress endpoint of the viewer, it returns false if the viewer is not part of the audience
+func (a *Audience) Leave(viewerId uuid.UUID) bool {
+	a.mutex.Lock()
+	cancel, ok := a.viewers[viewerId]
+	delete(a.viewers, viewerId)
+	a.mutex.Unlock()
+	if ok {
+		slog.Debug("lobby.Audience: viewer left", "viewerId", viewerId, "liveStream", a.hub.LiveStreamId)
+		cancel()
+	}
+	return ok
+}
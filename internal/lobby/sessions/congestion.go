@@ -0,0 +1,72 @@
+package sessions
+
+import (
+	"github.com/google/uuid"
+	"github.com/shigde/sfu/pkg/message"
+)
+
+// pathEstimate is the bitrate the receivers behind a session can take. The hops count the links to the receiver the
+// estimate belongs to, the trace carries the context of the estimate of the next instance downstream.
+type pathEstimate struct {
+	bitrate uint64
+	hops    int
+	trace   map[string]string
+}
+
+// combinePath combines the estimate of the own link with the estimate a downstream instance reported for its
+// receivers. The slowest link limits the path, an estimate of 0 is unknown.
+func combinePath(own uint64, downstream *message.Estimate) (pathEstimate, bool) {
+	estimate := pathEstimate{bitrate: own, hops: 1}
+	if downstream != nil && downstream.Bitrate > 0 {
+		if own == 0 || downstream.Bitrate < own {
+			estimate.bitrate = downstream.Bitrate
+		}
+		estimate.hops = downstream.Hops + 1
+		estimate.trace = downstream.Trace
+	}
+	return estimate, estimate.bitrate > 0
+}
+
+// congestionFeedback selects the estimate that is sent upstream to every session. A session gets the best estimate of
+// the other sessions, the worse receivers are served with lower layers by their egress endpoints.
+// Only changed estimates are sent again.
+type congestionFeedback struct {
+	sent map[uuid.UUID]uint64 // sessionId --> last sent bitrate
+}
+
+func newCongestionFeedback() *congestionFeedback {
+	return &congestionFeedback{sent: make(map[uuid.UUID]uint64)}
+}
+
+// update returns the changed estimates for the sessions, sessions that left are forgotten
+func (c *congestionFeedback) update(estimates map[uuid.UUID]pathEstimate, sessions []uuid.UUID) map[uuid.UUID]pathEstimate {
+	changed := make(map[uuid.UUID]pathEstimate)
+	sent := make(map[uuid.UUID]uint64, len(sessions))
+	for _, session := range sessions {
+		best, found := bestPathEstimate(estimates, session)
+		if !found {
+			continue
+		}
+		sent[session] = best.bitrate
+		if c.sent[session] != best.bitrate {
+			changed[session] = best
+		}
+	}
+	c.sent = sent
+	return changed
+}
+
+func bestPathEstimate(estimates map[uuid.UUID]pathEstimate, session uuid.UUID) (pathEstimate, bool) {
+	var best pathEstimate
+	found := false
+	for id, estimate := range estimates {
+		if id == session {
+			continue
+		}
+		if !found || estimate.bitrate > best.bitrate || (estimate.bitrate == best.bitrate && estimate.hops > best.hops) {
+			best = estimate
+			found = true
+		}
+	}
+	return best, found
+}
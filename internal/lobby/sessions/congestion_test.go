@@ -0,0 +1,107 @@
+package sessions
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shigde/sfu/pkg/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCombinePath(t *testing.T) {
+	t.Run("own link without downstream estimate", func(t *testing.T) {
+		estimate, ok := combinePath(2_000_000, nil)
+
+		assert.True(t, ok)
+		assert.Equal(t, uint64(2_000_000), estimate.bitrate)
+		assert.Equal(t, 1, estimate.hops)
+	})
+
+	t.Run("slower downstream limits the path", func(t *testing.T) {
+		trace := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+		estimate, ok := combinePath(2_000_000, &message.Estimate{Bitrate: 500_000, Hops: 2, Trace: trace})
+
+		assert.True(t, ok)
+		assert.Equal(t, uint64(500_000), estimate.bitrate)
+		assert.Equal(t, 3, estimate.hops)
+		assert.Equal(t, trace, estimate.trace)
+	})
+
+	t.Run("slower own link limits the path", func(t *testing.T) {
+		estimate, ok := combinePath(300_000, &message.Estimate{Bitrate: 500_000, Hops: 1})
+
+		assert.True(t, ok)
+		assert.Equal(t, uint64(300_000), estimate.bitrate)
+		assert.Equal(t, 2, estimate.hops)
+	})
+
+	t.Run("unknown own link takes the downstream estimate", func(t *testing.T) {
+		estimate, ok := combinePath(0, &message.Estimate{Bitrate: 500_000, Hops: 1})
+
+		assert.True(t, ok)
+		assert.Equal(t, uint64(500_000), estimate.bitrate)
+	})
+
+	t.Run("no estimate at all", func(t *testing.T) {
+		_, ok := combinePath(0, &message.Estimate{Bitrate: 0, Hops: 1})
+
+		assert.False(t, ok)
+	})
+}
+
+func TestCongestionFeedback(t *testing.T) {
+	upstream, fast, slow := uuid.New(), uuid.New(), uuid.New()
+	sessions := []uuid.UUID{upstream, fast, slow}
+
+	t.Run("best other receiver decides", func(t *testing.T) {
+		c := newCongestionFeedback()
+		estimates := map[uuid.UUID]pathEstimate{
+			fast: {bitrate: 2_000_000, hops: 1},
+			slow: {bitrate: 300_000, hops: 3},
+		}
+
+		changed := c.update(estimates, sessions)
+
+		assert.Equal(t, uint64(2_000_000), changed[upstream].bitrate)
+		assert.Equal(t, uint64(300_000), changed[fast].bitrate)
+		assert.Equal(t, uint64(2_000_000), changed[slow].bitrate)
+	})
+
+	t.Run("unchanged estimates are not sent again", func(t *testing.T) {
+		c := newCongestionFeedback()
+		estimates := map[uuid.UUID]pathEstimate{
+			fast: {bitrate: 2_000_000, hops: 1},
+			slow: {bitrate: 300_000, hops: 3},
+		}
+		_ = c.update(estimates, sessions)
+
+		estimates[slow] = pathEstimate{bitrate: 200_000, hops: 3}
+		changed := c.update(estimates, sessions)
+
+		assert.Len(t, changed, 1)
+		assert.Equal(t, uint64(200_000), changed[fast].bitrate)
+	})
+
+	t.Run("session without other receivers gets no estimate", func(t *testing.T) {
+		c := newCongestionFeedback()
+
+		changed := c.update(map[uuid.UUID]pathEstimate{fast: {bitrate: 2_000_000, hops: 1}}, []uuid.UUID{fast})
+
+		assert.Empty(t, changed)
+	})
+
+	t.Run("left sessions are forgotten", func(t *testing.T) {
+		c := newCongestionFeedback()
+		estimates := map[uuid.UUID]pathEstimate{
+			fast: {bitrate: 2_000_000, hops: 1},
+			slow: {bitrate: 300_000, hops: 3},
+		}
+		_ = c.update(estimates, sessions)
+
+		_ = c.update(estimates, []uuid.UUID{fast, slow})
+		changed := c.update(estimates, sessions)
+
+		assert.Len(t, changed, 1)
+		assert.Equal(t, uint64(2_000_000), changed[upstream].bitrate)
+	})
+}
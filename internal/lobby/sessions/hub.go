@@ -3,19 +3,38 @@ package sessions
 import (
 	"context"
 	"errors"
+	"slices"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
 	"github.com/shigde/sfu/internal/metric"
 	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/pkg/message"
 	"golang.org/x/exp/slog"
 )
 
 var (
-	errHubAlreadyClosed   = errors.New("Hub was already closed")
-	errHubDispatchTimeOut = errors.New("Hub dispatch timeout")
-	hubDispatchTimeout    = 3 * time.Second
+	ErrMediaStreamNotFound   = errors.New("media stream not found in Hub")
+	ErrScreenShareLimit      = errors.New("session shares already a screen")
+	ErrInvalidLastN          = errors.New("invalid Last-N count")
+	ErrNoProgram             = errors.New("program of the audience not available")
+	errHubAlreadyClosed      = errors.New("Hub was already closed")
+	errHubDispatchTimeOut    = errors.New("Hub dispatch timeout")
+	hubDispatchTimeout       = 3 * time.Second
+	chatHistorySize          = 100
+	chatRateBurst            = 5
+	chatRateInterval         = 2 * time.Second
+	appAggregationInterval   = 500 * time.Millisecond
+	speakerDetectionInterval = 300 * time.Millisecond
+	// congestionFeedbackInterval is the interval the estimates of the receivers are carried upstream
+	congestionFeedbackInterval = 2 * time.Second
+	// maxLastN limits the video slots of an egress endpoint
+	maxLastN = 25
+	// aggregatedAppNamespaces are namespaces of app messages with a high volume, like reactions
+	aggregatedAppNamespaces = []string{"reaction"}
 )
 
 type liveStreamSender interface {
@@ -23,6 +42,28 @@ type liveStreamSender interface {
 	RemoveTrack(track webrtc.TrackLocal)
 }
 
+// codecAcceptor can be implemented additionally by a live stream sender, video tracks with a codec it does not accept
+// are transcoded for the live stream
+type codecAcceptor interface {
+	AcceptsCodec(codec webrtc.RTPCodecCapability) bool
+}
+
+// liveStreamSubscriber is the subscriber of the transcoded tracks of the live stream sender
+const liveStreamSubscriber = "liveStream"
+
+// programSubscriber is the subscriber of the transcoded tracks of the program of the audience
+const programSubscriber = "program"
+
+// TranscodingEngine can be implemented additionally by the rtp engine, to transcode tracks for the subscribers of a Hub
+type TranscodingEngine interface {
+	NewTranscodingPool(ctx context.Context) *rtp.TranscodingPool
+}
+
+// activeSpeakerListener can be implemented additionally by a live stream sender, to arrange a speaker layout
+type activeSpeakerListener interface {
+	SetActiveSpeaker(mediaStreamId string)
+}
+
 type Hub struct {
 	ctx           context.Context
 	LiveStreamId  uuid.UUID
@@ -32,12 +73,49 @@ type Hub struct {
 	tracks        map[string]*rtp.TrackInfo   // trackID --> TrackInfo
 	metricNodes   map[string]metric.GraphNode // sessionId --> metric Node
 	hubMetricNode metric.GraphNode
+	metadata      map[string]*message.Metadata // mediaStreamId --> participant metadata
+	purposes      map[string]rtp.Purpose       // mediaStreamId --> purpose changed at runtime, it outlasts renegotiations of the publisher
+	chatHistory   []*message.Chat              // the last chat messages, the oldest first
+	chatLimiters  map[string]*rateLimiter      // userId --> chat rate limit, shared by all sessions of the user
+	appAggregator *appAggregator
+	speakers      *speakerDetector
+	lastN         atomic.Int32         // Last-N setting of the lobby, with 0 every session receives the video of all participants
+	videoRanking  []string             // track ids of the video tracks in the Last-N order
+	transcoding   *rtp.TranscodingPool // transcodes video tracks for subscribers without support of their codec
+	program       *rtp.ProgramOutput   // main program of the audience, created with the first audience viewer
+	instanceId    uuid.UUID            // this instance, the origin of the tracks published in the lobby
+	owner         uuid.UUID            // user of the live stream owner, the host of the lobby
+	congestion    *congestionFeedback
+}
+
+type HubOption func(hub *Hub)
+
+// HubWithTranscoding transcodes the video tracks for egress endpoints and the live stream sender, that do not support the codec of a track
+func HubWithTranscoding(pool *rtp.TranscodingPool) HubOption {
+	return func(hub *Hub) {
+		hub.transcoding = pool
+	}
+}
+
+// HubWithInstanceId tags the tracks published in the lobby with this instance as origin
+func HubWithInstanceId(instanceId uuid.UUID) HubOption {
+	return func(hub *Hub) {
+		hub.instanceId = instanceId
+	}
 }
 
-func NewHub(ctx context.Context, sessionRepo *SessionRepository, liveStream uuid.UUID, sender liveStreamSender) *Hub {
+// HubWithOwner sets the user of the live stream owner, the sessions of this user get the host role
+func HubWithOwner(owner uuid.UUID) HubOption {
+	return func(hub *Hub) {
+		hub.owner = owner
+	}
+}
+
+func NewHub(ctx context.Context, sessionRepo *SessionRepository, liveStream uuid.UUID, sender liveStreamSender, options ...HubOption) *Hub {
 	tracks := make(map[string]*rtp.TrackInfo)
 	metricNodes := make(map[string]metric.GraphNode)
 	requests := make(chan *hubRequest)
+	metadata := make(map[string]*message.Metadata)
 	hubMetricNode := metric.GraphNodeUpdate(metric.BuildNode(liveStream.String(), liveStream.String(), "Hub"))
 	hub := &Hub{
 		ctx,
@@ -48,6 +126,22 @@ func NewHub(ctx context.Context, sessionRepo *SessionRepository, liveStream uuid
 		tracks,
 		metricNodes,
 		hubMetricNode,
+		metadata,
+		make(map[string]rtp.Purpose),
+		make([]*message.Chat, 0, chatHistorySize),
+		make(map[string]*rateLimiter),
+		newAppAggregator(aggregatedAppNamespaces...),
+		newSpeakerDetector(),
+		atomic.Int32{},
+		nil,
+		nil,
+		nil,
+		uuid.Nil,
+		uuid.Nil,
+		newCongestionFeedback(),
+	}
+	for _, option := range options {
+		option(hub)
 	}
 	go hub.run()
 
@@ -61,6 +155,12 @@ func NewHub(ctx context.Context, sessionRepo *SessionRepository, liveStream uuid
 
 func (h *Hub) run() {
 	slog.Info("lobby.Hub: run")
+	appTicker := time.NewTicker(appAggregationInterval)
+	defer appTicker.Stop()
+	speakerTicker := time.NewTicker(speakerDetectionInterval)
+	defer speakerTicker.Stop()
+	congestionTicker := time.NewTicker(congestionFeedbackInterval)
+	defer congestionTicker.Stop()
 	for {
 		select {
 		case trackEvent := <-h.reqChan:
@@ -73,8 +173,33 @@ func (h *Hub) run() {
 				h.onGetTrackList(trackEvent)
 			case muteTrack:
 				h.onMuteTrack(trackEvent)
+			case changePurpose:
+				h.onChangePurpose(trackEvent)
+			case updateMetadata:
+				h.onUpdateMetadata(trackEvent)
+			case sendChat:
+				h.onSendChat(trackEvent)
+			case getChatHistory:
+				h.onGetChatHistory(trackEvent)
+			case sendAppMessage:
+				h.onSendAppMessage(trackEvent)
+			case changeSubscription:
+				h.onChangeSubscription(trackEvent)
+			case changeLastN:
+				h.onChangeLastN(trackEvent)
+			case refreshVideoSlots:
+				h.onRefreshVideoSlots(trackEvent)
+			case getProgram:
+				h.onGetProgram(trackEvent)
 			}
+		case <-appTicker.C:
+			h.onFlushAppMessages()
+		case <-speakerTicker.C:
+			h.onDetectSpeaker()
+		case <-congestionTicker.C:
+			h.onCongestionFeedback()
 		case <-h.ctx.Done():
+			h.closeProgram()
 			slog.Info("lobby.Hub: closed Hub")
 			return
 		}
@@ -82,9 +207,11 @@ func (h *Hub) run() {
 }
 
 func (h *Hub) DispatchAddTrack(ctx context.Context, track *rtp.TrackInfo) {
+	// the Hub could change the track info after the dispatch, so we read the purpose before
+	purpose := track.Purpose.ToString()
 	select {
 	case h.reqChan <- &hubRequest{ctx: ctx, kind: addTrack, track: track}:
-		slog.Debug("lobby.Hub: dispatch add track", "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID(), "kind", track.GetTrackLocal().Kind(), "purpose", track.Purpose.ToString())
+		slog.Debug("lobby.Hub: dispatch add track", "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID(), "kind", track.GetTrackLocal().Kind(), "purpose", purpose)
 	case <-h.ctx.Done():
 		slog.Warn("lobby.Hub: dispatch add track even on closed Hub")
 	case <-time.After(hubDispatchTimeout):
@@ -93,9 +220,11 @@ func (h *Hub) DispatchAddTrack(ctx context.Context, track *rtp.TrackInfo) {
 }
 
 func (h *Hub) DispatchRemoveTrack(ctx context.Context, track *rtp.TrackInfo) {
+	// the Hub could change the track info after the dispatch, so we read the purpose before
+	purpose := track.Purpose.ToString()
 	select {
 	case h.reqChan <- &hubRequest{ctx: ctx, kind: removeTrack, track: track}:
-		slog.Debug("lobby.Hub: dispatch remove track", "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID(), "kind", track.GetTrackLocal().Kind(), "purpose", track.Purpose.ToString())
+		slog.Debug("lobby.Hub: dispatch remove track", "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID(), "kind", track.GetTrackLocal().Kind(), "purpose", purpose)
 	case <-h.ctx.Done():
 		slog.Warn("lobby.Hub: dispatch remove track even on closed Hub")
 	case <-time.After(hubDispatchTimeout):
@@ -114,6 +243,169 @@ func (h *Hub) DispatchMuteTrack(ctx context.Context, track *rtp.TrackInfo) {
 	}
 }
 
+// DispatchChangePurpose changes the purpose of all tracks of a media stream.
+// If a media stream becomes main, the current main media stream is demoted to guest,
+// because the live output can only follow one main media stream.
+func (h *Hub) DispatchChangePurpose(ctx context.Context, mediaStreamId string, purpose rtp.Purpose) error {
+	errChan := make(chan error)
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: changePurpose, mediaStreamId: mediaStreamId, purpose: purpose, errChan: errChan}:
+		slog.Debug("lobby.Hub: dispatch change purpose", "mediaStreamId", mediaStreamId, "purpose", purpose.ToString())
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: dispatch change purpose even on closed Hub")
+		return errHubAlreadyClosed
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: dispatch change purpose - interrupted because dispatch timeout")
+		return errHubDispatchTimeOut
+	}
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-h.ctx.Done():
+		return errHubAlreadyClosed
+	case <-time.After(hubDispatchTimeout):
+		return errHubDispatchTimeOut
+	}
+}
+
+// DispatchMetadata updates the participant metadata of a media stream and broadcasts it to all egress sessions.
+// Only the session that owns the media stream is allowed to update the metadata.
+func (h *Hub) DispatchMetadata(ctx context.Context, sessionId uuid.UUID, metadata *message.Metadata) {
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: updateMetadata, sessionId: sessionId, metadata: metadata}:
+		slog.Debug("lobby.Hub: dispatch metadata", "sessionId", sessionId, "mediaStreamId", metadata.MediaStreamId)
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: dispatch metadata even on closed Hub")
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: dispatch metadata - interrupted because dispatch timeout")
+	}
+}
+
+// DispatchChat stores a chat message in the history and sends it to all sessions of the lobby.
+func (h *Hub) DispatchChat(ctx context.Context, chat *message.Chat) {
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: sendChat, chat: chat}:
+		slog.Debug("lobby.Hub: dispatch chat", "chatId", chat.Id, "user", chat.User)
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: dispatch chat even on closed Hub")
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: dispatch chat - interrupted because dispatch timeout")
+	}
+}
+
+// GetChatHistory returns the last chat messages of the lobby, the oldest first.
+func (h *Hub) GetChatHistory(ctx context.Context) ([]*message.Chat, error) {
+	chatListChan := make(chan []*message.Chat)
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: getChatHistory, chatListChan: chatListChan}:
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: get chat history on closed Hub")
+		return nil, errHubAlreadyClosed
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: get chat history - interrupted because dispatch timeout")
+		return nil, errHubDispatchTimeOut
+	}
+
+	select {
+	case chatList := <-chatListChan:
+		return chatList, nil
+	case <-h.ctx.Done():
+		return nil, errHubAlreadyClosed
+	case <-time.After(hubDispatchTimeout):
+		return nil, errHubDispatchTimeOut
+	}
+}
+
+// GetProgram returns the main program of the audience. The program is created with the first call and follows the main tracks.
+func (h *Hub) GetProgram(ctx context.Context) (*rtp.ProgramOutput, error) {
+	programChan := make(chan *rtp.ProgramOutput)
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: getProgram, programChan: programChan}:
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: get program on closed Hub")
+		return nil, errHubAlreadyClosed
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: get program - interrupted because dispatch timeout")
+		return nil, errHubDispatchTimeOut
+	}
+
+	select {
+	case program := <-programChan:
+		if program == nil {
+			return nil, ErrNoProgram
+		}
+		return program, nil
+	case <-h.ctx.Done():
+		return nil, errHubAlreadyClosed
+	case <-time.After(hubDispatchTimeout):
+		return nil, errHubDispatchTimeOut
+	}
+}
+
+// DispatchAppMessage relays an app message to the sessions of the target.
+// App messages with a high volume are aggregated and sent periodically.
+func (h *Hub) DispatchAppMessage(ctx context.Context, sessionId uuid.UUID, appMessage *message.AppMessage) {
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: sendAppMessage, sessionId: sessionId, appMessage: appMessage}:
+		slog.Debug("lobby.Hub: dispatch app message", "sessionId", sessionId, "namespace", appMessage.Namespace)
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: dispatch app message even on closed Hub")
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: dispatch app message - interrupted because dispatch timeout")
+	}
+}
+
+// DispatchSubscriptionChanged adds the newly subscribed tracks to the egress of the session
+// and removes the unsubscribed tracks from it.
+func (h *Hub) DispatchSubscriptionChanged(ctx context.Context, sessionId uuid.UUID) {
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: changeSubscription, sessionId: sessionId}:
+		slog.Debug("lobby.Hub: dispatch subscription changed", "sessionId", sessionId)
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: dispatch subscription changed even on closed Hub")
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: dispatch subscription changed - interrupted because dispatch timeout")
+	}
+}
+
+// DispatchLastN
+// Limits the video of every session in the lobby to the N most recently active speakers, the audio is always sent.
+// A session can override this setting. With 0 all sessions receive the video of all participants.
+func (h *Hub) DispatchLastN(ctx context.Context, lastN int) error {
+	if lastN < 0 || lastN > maxLastN {
+		return ErrInvalidLastN
+	}
+	h.lastN.Store(int32(lastN))
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: changeLastN}:
+		slog.Debug("lobby.Hub: dispatch last-n", "lastN", lastN)
+	case <-h.ctx.Done():
+		return errHubAlreadyClosed
+	case <-time.After(hubDispatchTimeout):
+		return errHubDispatchTimeOut
+	}
+	return nil
+}
+
+func (h *Hub) dispatchVideoSlotsRefresh(ctx context.Context, sessionId uuid.UUID) {
+	select {
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: refreshVideoSlots, sessionId: sessionId}:
+		slog.Debug("lobby.Hub: dispatch video slots refresh", "sessionId", sessionId)
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: dispatch video slots refresh on closed Hub", "sessionId", sessionId)
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: dispatch video slots refresh - interrupted because dispatch timeout", "sessionId", sessionId)
+	}
+}
+
+// DispatchAudioLevel
+// Is called for every ingress audio packet with an audio level. To keep the request channel free,
+// the level goes directly to the speaker detection, which is evaluated periodically by the Hub.
+func (h *Hub) DispatchAudioLevel(_ uuid.UUID, mediaStreamId string, level uint8) {
+	h.speakers.observe(mediaStreamId, level)
+}
+
 // getTrackList Is called from the Egress endpoints when the connection is established.
 // In ths wax the egress endpoints can receive the current tracks of the lobby
 // The session set this methode as callback to the egress egress
@@ -121,7 +413,7 @@ func (h *Hub) getTrackList(ctx context.Context, sessionId uuid.UUID, filters ...
 	var hubList []*rtp.TrackInfo
 	trackListChan := make(chan []*rtp.TrackInfo)
 	select {
-	case h.reqChan <- &hubRequest{ctx: ctx, kind: getTrackList, trackListChan: trackListChan}:
+	case h.reqChan <- &hubRequest{ctx: ctx, kind: getTrackList, trackListChan: trackListChan, sessionId: sessionId}:
 	case <-h.ctx.Done():
 		slog.Warn("lobby.Hub: get track list on closed Hub")
 		return nil, errHubAlreadyClosed
@@ -167,11 +459,23 @@ func (h *Hub) getTrackList(ctx context.Context, sessionId uuid.UUID, filters ...
 func (h *Hub) onAddTrack(event *hubRequest) {
 	slog.Debug("lobby.Hub: add track", "sourceSessionId", event.track.SessionId, "streamId", event.track.GetTrackLocal().StreamID(), "track", event.track.GetTrackLocal().ID(), "kind", event.track.GetTrackLocal().Kind(), "purpose", event.track.Purpose.ToString())
 
+	// The purpose of the publisher sdp is overruled by a purpose changed at runtime
+	if purpose, ok := h.purposes[event.track.GetTrackLocal().StreamID()]; ok {
+		event.track.Purpose = purpose
+	}
+
+	// A participant can share only one screen at the same time, every further screen stream is handled as guest
+	if event.track.GetPurpose() == rtp.PurposeScreen && h.hasOtherScreenStream(event.track.SessionId, event.track.GetTrackLocal().StreamID()) {
+		slog.Warn("lobby.Hub: session shares already a screen, track is handled as guest", "sourceSessionId", event.track.SessionId, "streamId", event.track.GetTrackLocal().StreamID())
+		event.track.Purpose = rtp.PurposeGuest
+	}
+
+	h.tagOrigin(event.track)
+
 	h.increaseNodeGraphStats(event.track.SessionId.String(), rtp.IngressEndpoint, event.track.Purpose)
 	h.hubMetricNode = metric.GraphNodeUpdateInc(h.hubMetricNode, event.track.Purpose.ToString())
 	if event.track.GetPurpose() == rtp.PurposeMain {
-		slog.Debug("lobby.Hub: add live track ro sender", "streamId", event.track.GetTrackLocal().StreamID(), "track", event.track.GetTrackLocal().ID(), "kind", event.track.GetTrackLocal().Kind(), "purpose", event.track.Purpose.ToString())
-		h.sender.AddTrack(event.track.GetTrackLocal())
+		h.addLiveTrack(event.track)
 	}
 
 	h.tracks[event.track.GetTrackLocal().ID()] = event.track
@@ -183,40 +487,58 @@ func (h *Hub) onAddTrack(event *hubRequest) {
 		}
 		slog.Debug("bug-1: hub-add", "session", s.Id, "trackId", event.track.GetTrackLocal().ID(), "kind", event.track.GetTrackLocal().Kind())
 
-		if filterForSession(s.Id)(event.track) {
+		if filterForSession(s.Id)(event.track) && filterForInstance(s)(event.track) && filterForSubscription(s.subscription)(event.track) && filterForLastN(h, s)(event.track) {
 			slog.Debug("lobby.Hub: add egress track to session", "sessionId", s.Id, "sourceSessionId", event.track.SessionId, "streamId", event.track.GetTrackLocal().StreamID(), "track", event.track.GetTrackLocal().ID(), "kind", event.track.GetTrackLocal().Kind(), "purpose", event.track.Purpose.ToString())
 			s.addTrack(event.ctx, event.track)
 		}
 	})
+
+	if event.track.GetTrackLocal().Kind() == webrtc.RTPCodecTypeVideo {
+		h.refreshVideoSlots(event.ctx, true)
+	}
 }
 
 func (h *Hub) onRemoveTrack(event *hubRequest) {
+	// The purpose could be changed at runtime, so the purpose known by the Hub is the current one
+	if track, ok := h.tracks[event.track.GetTrackLocal().ID()]; ok {
+		event.track.Purpose = track.Purpose
+	}
 	slog.Debug("lobby.Hub: remove track", "sourceSessionId", event.track.SessionId, "streamId", event.track.GetTrackLocal().StreamID(), "track", event.track.GetTrackLocal().ID(), "kind", event.track.GetTrackLocal().Kind(), "purpose", event.track.Purpose.ToString())
 
 	h.hubMetricNode = metric.GraphNodeUpdateDec(h.hubMetricNode, event.track.Purpose.ToString())
 	h.decreaseNodeGraphStats(event.track.SessionId.String(), rtp.IngressEndpoint, event.track.Purpose)
 
 	if event.track.GetPurpose() == rtp.PurposeMain {
-		h.sender.RemoveTrack(event.track.GetTrackLocal())
+		h.removeLiveTrack(event.track)
 	}
 
 	if _, ok := h.tracks[event.track.GetTrackLocal().ID()]; ok {
 		delete(h.tracks, event.track.GetTrackLocal().ID())
 	}
 
+	if !h.hasMediaStream(event.track.GetTrackLocal().StreamID()) {
+		delete(h.metadata, event.track.GetTrackLocal().StreamID())
+		delete(h.purposes, event.track.GetTrackLocal().StreamID())
+		h.speakers.remove(event.track.GetTrackLocal().StreamID())
+	}
+
 	h.sessionRepo.Iter(func(s *Session) {
 		// If a session has just been created, this call blocks for seconds.
 		// This is because the ice gathering sometimes takes seconds. That's why we don't block the call
 		if !s.initComplete() {
 			return
 		}
-		if filterForSession(s.Id)(event.track) {
+		if filterForSession(s.Id)(event.track) && filterForInstance(s)(event.track) && filterForSubscription(s.subscription)(event.track) && filterForLastN(h, s)(event.track) {
 			slog.Debug("lobby.Hub: remove egress track from session", "sessionId", s.Id, "sourceSessionId", event.track.SessionId, "streamId", event.track.GetTrackLocal().StreamID(), "track", event.track.GetTrackLocal().ID(), "kind", event.track.GetTrackLocal().Kind(), "purpose", event.track.Purpose.ToString())
 			slog.Debug("bug-1: hub-remove", "session", s.Id, "trackId", event.track.GetTrackLocal().ID(), "kind", event.track.GetTrackLocal().Kind())
 			s.removeTrack(event.ctx, event.track)
 			h.decreaseNodeGraphStats(s.Id.String(), rtp.EgressEndpoint, event.track.Purpose)
 		}
 	})
+
+	if event.track.GetTrackLocal().Kind() == webrtc.RTPCodecTypeVideo {
+		h.refreshVideoSlots(event.ctx, true)
+	}
 }
 
 func (h *Hub) onGetTrackList(event *hubRequest) {
@@ -224,6 +546,10 @@ func (h *Hub) onGetTrackList(event *hubRequest) {
 	for _, track := range h.tracks {
 		list = append(list, track)
 	}
+	// Screen shares come first, so that the egress endpoints negotiate them before the cameras
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Purpose.Priority() > list[j].Purpose.Priority()
+	})
 
 	select {
 	case event.trackListChan <- list:
@@ -232,6 +558,28 @@ func (h *Hub) onGetTrackList(event *hubRequest) {
 	case <-time.After(hubDispatchTimeout):
 		slog.Error("lobby.Hub: onGetTrackList - interrupted because dispatch timeout")
 	}
+
+	// A new egress session receives the tracks of the lobby, so it also needs to know who is behind this tracks
+	metadataList := make([]*message.Metadata, 0, len(h.metadata))
+	for mediaStreamId, metadata := range h.metadata {
+		if !h.isMediaStreamOfSession(event.sessionId, mediaStreamId) {
+			metadataList = append(metadataList, metadata)
+		}
+	}
+	session, ok := h.sessionRepo.FindById(event.sessionId)
+	if !ok {
+		return
+	}
+	if len(metadataList) > 0 {
+		go session.sendMetadata(event.ctx, metadataList)
+	}
+	// New joiners should see what was written before they came
+	if len(h.chatHistory) > 0 {
+		go session.sendChat(event.ctx, h.copyChatHistory())
+	}
+	if speaker := h.speakers.dominant(); len(speaker) > 0 {
+		go session.sendActiveSpeaker(event.ctx, &message.ActiveSpeaker{MediaStreamId: speaker})
+	}
 }
 
 func (h *Hub) onMuteTrack(event *hubRequest) {
@@ -248,6 +596,535 @@ func (h *Hub) onMuteTrack(event *hubRequest) {
 	})
 }
 
+func (h *Hub) onChangePurpose(event *hubRequest) {
+	slog.Debug("lobby.Hub: change purpose", "mediaStreamId", event.mediaStreamId, "purpose", event.purpose.ToString())
+	var target *rtp.TrackInfo
+	for _, track := range h.tracks {
+		if track.GetTrackLocal().StreamID() == event.mediaStreamId {
+			target = track
+			break
+		}
+	}
+
+	if target == nil {
+		h.respond(event.errChan, ErrMediaStreamNotFound)
+		return
+	}
+
+	if event.purpose == rtp.PurposeScreen && h.hasOtherScreenStream(target.SessionId, event.mediaStreamId) {
+		h.respond(event.errChan, ErrScreenShareLimit)
+		return
+	}
+
+	changed := make([]*rtp.TrackInfo, 0)
+	for _, track := range h.tracks {
+		isTarget := track.GetTrackLocal().StreamID() == event.mediaStreamId
+		newPurpose := track.Purpose
+		switch {
+		case isTarget:
+			newPurpose = event.purpose
+		case event.purpose == rtp.PurposeMain && track.Purpose == rtp.PurposeMain:
+			newPurpose = rtp.PurposeGuest
+		}
+
+		if newPurpose != track.Purpose {
+			changedTrack := h.setTrackPurpose(track, newPurpose)
+			h.purposes[track.GetTrackLocal().StreamID()] = newPurpose
+			changed = append(changed, changedTrack)
+		}
+	}
+
+	h.respond(event.errChan, nil)
+
+	if len(changed) == 0 {
+		return
+	}
+
+	h.sessionRepo.Iter(func(s *Session) {
+		go func(session *Session) {
+			// If a session has just been created, this call blocks for seconds.
+			// This is because the ice gathering sometimes takes seconds. That's why we don't block the call
+			session.changeTrackPurpose(event.ctx, changed)
+		}(s)
+	})
+}
+
+func (h *Hub) onUpdateMetadata(event *hubRequest) {
+	slog.Debug("lobby.Hub: update metadata", "sessionId", event.sessionId, "mediaStreamId", event.metadata.MediaStreamId)
+	if !h.isMediaStreamOfSession(event.sessionId, event.metadata.MediaStreamId) {
+		slog.Warn("lobby.Hub: session is not allowed to update the metadata of this media stream", "sessionId", event.sessionId, "mediaStreamId", event.metadata.MediaStreamId)
+		return
+	}
+	if session, found := h.sessionRepo.FindById(event.sessionId); found {
+		event.metadata.Role = h.sessionRole(session)
+	}
+	h.metadata[event.metadata.MediaStreamId] = event.metadata
+
+	metadataList := []*message.Metadata{event.metadata}
+	h.sessionRepo.Iter(func(s *Session) {
+		if s.Id == event.sessionId {
+			return
+		}
+		go func(session *Session) {
+			session.sendMetadata(event.ctx, metadataList)
+		}(s)
+	})
+}
+
+func (h *Hub) onSendChat(event *hubRequest) {
+	slog.Debug("lobby.Hub: send chat", "chatId", event.chat.Id, "user", event.chat.User)
+	if !h.allowChat(event.chat.User) {
+		slog.Warn("lobby.Hub: drop chat message because of rate limit", "chatId", event.chat.Id, "user", event.chat.User)
+		return
+	}
+	if len(h.chatHistory) == chatHistorySize {
+		h.chatHistory = append(h.chatHistory[:0], h.chatHistory[1:]...)
+	}
+	h.chatHistory = append(h.chatHistory, event.chat)
+
+	chatList := []*message.Chat{event.chat}
+	h.sessionRepo.Iter(func(s *Session) {
+		go func(session *Session) {
+			session.sendChat(event.ctx, chatList)
+		}(s)
+	})
+}
+
+// allowChat limits the chat messages of a user, whatever session the user sends them with
+func (h *Hub) allowChat(user string) bool {
+	for id, limiter := range h.chatLimiters {
+		// a refilled limiter is created again, when the user sends the next message
+		if id != user && limiter.idle() {
+			delete(h.chatLimiters, id)
+		}
+	}
+	limiter, ok := h.chatLimiters[user]
+	if !ok {
+		limiter = newRateLimiter(chatRateBurst, chatRateInterval)
+		h.chatLimiters[user] = limiter
+	}
+	return limiter.allow()
+}
+
+func (h *Hub) onGetChatHistory(event *hubRequest) {
+	select {
+	case event.chatListChan <- h.copyChatHistory():
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: onGetChatHistory on closed Hub")
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: onGetChatHistory - interrupted because dispatch timeout")
+	}
+}
+
+func (h *Hub) onGetProgram(event *hubRequest) {
+	if h.program == nil {
+		program, err := rtp.NewProgramOutput()
+		if err != nil {
+			slog.Error("lobby.Hub: create program", "err", err)
+		} else {
+			h.program = program
+			for _, track := range h.tracks {
+				if track.Purpose == rtp.PurposeMain {
+					h.showOnProgram(track)
+				}
+			}
+		}
+	}
+	select {
+	case event.programChan <- h.program:
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: onGetProgram on closed Hub")
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: onGetProgram - interrupted because dispatch timeout")
+	}
+}
+
+func (h *Hub) onChangeSubscription(event *hubRequest) {
+	session, ok := h.sessionRepo.FindById(event.sessionId)
+	// If the egress is not established, the subscription is applied when the egress gets the track list
+	if !ok || !session.initComplete() {
+		return
+	}
+	h.reconcileEgress(event.ctx, session)
+}
+
+func (h *Hub) onChangeLastN(event *hubRequest) {
+	h.sessionRepo.Iter(func(s *Session) {
+		if s.initComplete() {
+			h.reconcileEgress(event.ctx, s)
+		}
+	})
+}
+
+func (h *Hub) onRefreshVideoSlots(event *hubRequest) {
+	session, ok := h.sessionRepo.FindById(event.sessionId)
+	if !ok || h.lastNOf(session) == 0 || !session.initComplete() {
+		return
+	}
+	h.assignVideoSlots(event.ctx, session, h.rankVideoTracks())
+}
+
+// reconcileEgress adds and removes the egress tracks of a session after its subscription or Last-N setting has changed
+func (h *Hub) reconcileEgress(ctx context.Context, session *Session) {
+	lastN := h.lastNOf(session)
+	// free the video slots first, so the slot pool can show the video tracks that are sent directly again
+	if lastN == 0 {
+		session.releaseVideoSlots(ctx)
+	}
+	for _, track := range h.tracks {
+		if !filterForSession(session.Id)(track) || !filterForInstance(session)(track) {
+			continue
+		}
+		wanted := session.subscription.accepts(track) && filterForLastN(h, session)(track)
+		has := session.egressHasTrack(track)
+		switch {
+		case wanted && !has:
+			slog.Debug("lobby.Hub: add subscribed track to session", "sessionId", session.Id, "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID())
+			session.addTrack(ctx, track)
+			h.increaseNodeGraphStats(session.Id.String(), rtp.EgressEndpoint, track.Purpose)
+		case !wanted && has:
+			slog.Debug("lobby.Hub: remove unsubscribed track from session", "sessionId", session.Id, "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID())
+			session.removeTrack(ctx, track)
+			h.decreaseNodeGraphStats(session.Id.String(), rtp.EgressEndpoint, track.Purpose)
+		}
+	}
+
+	if lastN > 0 {
+		h.assignVideoSlots(ctx, session, h.rankVideoTracks())
+	}
+	session.updateVideoQuality(ctx)
+}
+
+func (h *Hub) onSendAppMessage(event *hubRequest) {
+	slog.Debug("lobby.Hub: send app message", "sessionId", event.sessionId, "namespace", event.appMessage.Namespace)
+	if h.appAggregator.add(event.appMessage) {
+		return
+	}
+
+	appMessageList := []*message.AppMessage{event.appMessage}
+	h.sessionRepo.Iter(func(s *Session) {
+		if s.Id == event.sessionId || !h.isAppMessageTarget(s, event.appMessage.Target) {
+			return
+		}
+		go func(session *Session) {
+			session.sendAppMessage(event.ctx, appMessageList)
+		}(s)
+	})
+}
+
+func (h *Hub) onFlushAppMessages() {
+	appMessageList := h.appAggregator.flush()
+	if len(appMessageList) == 0 {
+		return
+	}
+	h.sessionRepo.Iter(func(s *Session) {
+		go func(session *Session) {
+			session.sendAppMessage(h.ctx, appMessageList)
+		}(s)
+	})
+}
+
+func (h *Hub) onDetectSpeaker() {
+	speaker, changed := h.speakers.detect(time.Now())
+	// the speaker activity changes the Last-N ranking, even if the dominant speaker stays the same
+	h.refreshVideoSlots(h.ctx, false)
+	if !changed {
+		return
+	}
+	slog.Debug("lobby.Hub: active speaker changed", "mediaStreamId", speaker)
+	if listener, ok := h.sender.(activeSpeakerListener); ok {
+		listener.SetActiveSpeaker(speaker)
+	}
+	h.showSpeakerOnProgram(speaker)
+	activeSpeaker := &message.ActiveSpeaker{MediaStreamId: speaker}
+	h.sessionRepo.Iter(func(s *Session) {
+		go func(session *Session) {
+			session.sendActiveSpeaker(h.ctx, activeSpeaker)
+		}(s)
+	})
+}
+
+// onCongestionFeedback carries the estimates of the receivers upstream. The ingress endpoints are asked to receive not
+// more than the best other receiver can take, instance sessions get the estimate also to pass it on to their publishers.
+func (h *Hub) onCongestionFeedback() {
+	estimates := make(map[uuid.UUID]pathEstimate)
+	sessions := make([]uuid.UUID, 0)
+	h.sessionRepo.Iter(func(s *Session) {
+		sessions = append(sessions, s.Id)
+		if estimate, ok := s.receiveEstimate(); ok {
+			estimates[s.Id] = estimate
+		}
+	})
+	changed := h.congestion.update(estimates, sessions)
+	if len(changed) == 0 {
+		return
+	}
+	h.sessionRepo.Iter(func(s *Session) {
+		if estimate, ok := changed[s.Id]; ok {
+			go s.sendCongestionFeedback(h.ctx, estimate)
+		}
+	})
+}
+
+// lastNOf returns the Last-N count of a session, with 0 the session receives the video of all participants
+func (h *Hub) lastNOf(session *Session) int {
+	if lastN, ok := session.subscription.getLastN(); ok {
+		return lastN
+	}
+	return int(h.lastN.Load())
+}
+
+// rankVideoTracks orders the video tracks for Last-N, screen shares first and then the most recently active speakers
+func (h *Hub) rankVideoTracks() []*rtp.TrackInfo {
+	activity := h.speakers.activity()
+	ranking := make([]*rtp.TrackInfo, 0, len(h.tracks))
+	for _, track := range h.tracks {
+		if track.GetTrackLocal().Kind() == webrtc.RTPCodecTypeVideo {
+			ranking = append(ranking, track)
+		}
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		iScreen, jScreen := ranking[i].Purpose == rtp.PurposeScreen, ranking[j].Purpose == rtp.PurposeScreen
+		if iScreen != jScreen {
+			return iScreen
+		}
+		iActive, jActive := activity[ranking[i].GetTrackLocal().StreamID()], activity[ranking[j].GetTrackLocal().StreamID()]
+		if !iActive.Equal(jActive) {
+			return iActive.After(jActive)
+		}
+		return ranking[i].GetTrackLocal().ID() < ranking[j].GetTrackLocal().ID()
+	})
+	return ranking
+}
+
+// refreshVideoSlots refills the video slots of the Last-N sessions.
+// Without force, the slots are only refilled if the ranking of the video tracks has changed.
+func (h *Hub) refreshVideoSlots(ctx context.Context, force bool) {
+	ranking := h.rankVideoTracks()
+	trackIds := make([]string, 0, len(ranking))
+	for _, track := range ranking {
+		trackIds = append(trackIds, track.GetTrackLocal().ID())
+	}
+	if !force && slices.Equal(trackIds, h.videoRanking) {
+		return
+	}
+	h.videoRanking = trackIds
+	h.sessionRepo.Iter(func(s *Session) {
+		if h.lastNOf(s) > 0 && s.initComplete() {
+			h.assignVideoSlots(ctx, s, ranking)
+		}
+	})
+}
+
+func (h *Hub) assignVideoSlots(ctx context.Context, session *Session, ranking []*rtp.TrackInfo) {
+	lastN := h.lastNOf(session)
+	tracks := make([]*rtp.TrackInfo, 0, lastN)
+	for _, track := range ranking {
+		if len(tracks) == lastN {
+			break
+		}
+		if filterForSession(session.Id)(track) && filterForInstance(session)(track) && session.subscription.accepts(track) {
+			tracks = append(tracks, track)
+		}
+	}
+	session.assignVideoSlots(ctx, tracks)
+}
+
+// isAppMessageTarget checks if the session belongs to the receivers of an app message
+func (h *Hub) isAppMessageTarget(session *Session, target *message.AppTarget) bool {
+	if target == nil {
+		return true
+	}
+	if len(target.User) > 0 && target.User != session.user.String() {
+		return false
+	}
+	if len(target.Role) > 0 && target.Role != h.sessionRole(session) {
+		return false
+	}
+	return true
+}
+
+// sessionRole returns the role of a session. The role is given by the server, never by the client.
+func (h *Hub) sessionRole(session *Session) string {
+	switch {
+	case session.sessionType == InstanceSession || session.sessionType == RemoteInstanceSession:
+		return RoleInstance
+	case session.sessionType == ViewerSession:
+		return RoleViewer
+	case h.owner != uuid.Nil && session.user == h.owner:
+		return RoleHost
+	default:
+		return RoleGuest
+	}
+}
+
+func (h *Hub) copyChatHistory() []*message.Chat {
+	chatList := make([]*message.Chat, len(h.chatHistory))
+	copy(chatList, h.chatHistory)
+	return chatList
+}
+
+// setTrackPurpose replaces the track by a copy with the new purpose. The sessions read the tracks they got from the Hub
+// in their own goroutines, so the Hub never changes the purpose of a track it has handed out.
+func (h *Hub) setTrackPurpose(track *rtp.TrackInfo, purpose rtp.Purpose) *rtp.TrackInfo {
+	slog.Debug("lobby.Hub: set track purpose", "track", track.GetTrackLocal().ID(), "from", track.Purpose.ToString(), "to", purpose.ToString())
+	if track.Purpose == rtp.PurposeMain {
+		h.removeLiveTrack(track)
+	}
+
+	h.hubMetricNode = metric.GraphNodeUpdateDec(h.hubMetricNode, track.Purpose.ToString())
+	h.decreaseNodeGraphStats(track.SessionId.String(), rtp.IngressEndpoint, track.Purpose)
+	h.sessionRepo.Iter(func(s *Session) {
+		if _, ok := h.metricNodes[rtp.EgressEndpoint.ToString()+s.Id.String()]; ok && filterForSession(s.Id)(track) {
+			h.decreaseNodeGraphStats(s.Id.String(), rtp.EgressEndpoint, track.Purpose)
+			h.increaseNodeGraphStats(s.Id.String(), rtp.EgressEndpoint, purpose)
+		}
+	})
+	changed := track.WithPurpose(purpose)
+	h.tracks[changed.GetTrackLocal().ID()] = changed
+	h.hubMetricNode = metric.GraphNodeUpdateInc(h.hubMetricNode, changed.Purpose.ToString())
+	h.increaseNodeGraphStats(changed.SessionId.String(), rtp.IngressEndpoint, changed.Purpose)
+
+	if changed.Purpose == rtp.PurposeMain {
+		h.addLiveTrack(changed)
+	}
+	return changed
+}
+
+// tagOrigin records where a track comes from. A track of an instance session was relayed by its instance,
+// every other track was published on this instance.
+func (h *Hub) tagOrigin(track *rtp.TrackInfo) {
+	source, found := h.sessionRepo.FindById(track.SessionId)
+	if found && (source.sessionType == InstanceSession || source.sessionType == RemoteInstanceSession) {
+		track.RelayedBy(source.user)
+		return
+	}
+	if track.Origin == uuid.Nil {
+		track.Origin = h.instanceId
+	}
+}
+
+func (h *Hub) hasMediaStream(mediaStreamId string) bool {
+	for _, track := range h.tracks {
+		if track.GetTrackLocal().StreamID() == mediaStreamId {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) isMediaStreamOfSession(sessionId uuid.UUID, mediaStreamId string) bool {
+	for _, track := range h.tracks {
+		if track.SessionId == sessionId && track.GetTrackLocal().StreamID() == mediaStreamId {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOtherScreenStream checks if a session shares already a screen with another media stream
+func (h *Hub) hasOtherScreenStream(sessionId uuid.UUID, mediaStreamId string) bool {
+	for _, track := range h.tracks {
+		if track.SessionId == sessionId && track.Purpose == rtp.PurposeScreen && track.GetTrackLocal().StreamID() != mediaStreamId {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) addLiveTrack(track *rtp.TrackInfo) {
+	h.showOnProgram(track)
+	if h.sender == nil {
+		return
+	}
+	if acceptor, ok := h.sender.(codecAcceptor); ok && h.transcoding != nil {
+		if transcoded, ok := h.transcoding.Acquire(track, liveStreamSubscriber, acceptor.AcceptsCodec); ok {
+			track = transcoded
+		}
+	}
+	slog.Debug("lobby.Hub: add live track to sender", "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID(), "kind", track.GetTrackLocal().Kind(), "purpose", track.Purpose.ToString())
+	h.sender.AddTrack(track.GetTrackLocal())
+}
+
+func (h *Hub) removeLiveTrack(track *rtp.TrackInfo) {
+	h.hideOnProgram(track)
+	if h.sender == nil {
+		return
+	}
+	if h.transcoding != nil {
+		if transcoded, ok := h.transcoding.Release(track.GetTrackLocal().ID(), liveStreamSubscriber); ok {
+			track = transcoded
+		}
+	}
+	slog.Debug("lobby.Hub: remove live track from sender", "streamId", track.GetTrackLocal().StreamID(), "track", track.GetTrackLocal().ID(), "kind", track.GetTrackLocal().Kind(), "purpose", track.Purpose.ToString())
+	h.sender.RemoveTrack(track.GetTrackLocal())
+}
+
+// showOnProgram shows a main track in the program of the audience, the last added main track of a kind is shown
+func (h *Hub) showOnProgram(track *rtp.TrackInfo) {
+	if h.program == nil {
+		return
+	}
+	if h.transcoding != nil {
+		if transcoded, ok := h.transcoding.Acquire(track, programSubscriber, h.program.AcceptsCodec); ok {
+			track = transcoded
+		}
+	}
+	if err := h.program.Show(track); err != nil {
+		slog.Warn("lobby.Hub: show track on program", "err", err, "track", track.GetTrackLocal().ID(), "kind", track.GetTrackLocal().Kind())
+	}
+}
+
+// hideOnProgram removes a main track from the program of the audience, the program continues with another main track of the same kind
+func (h *Hub) hideOnProgram(track *rtp.TrackInfo) {
+	if h.program == nil {
+		return
+	}
+	shown := track
+	if h.transcoding != nil {
+		if transcoded, ok := h.transcoding.Release(track.GetTrackLocal().ID(), programSubscriber); ok {
+			shown = transcoded
+		}
+	}
+	if !h.program.Hide(shown) {
+		return
+	}
+	for id, other := range h.tracks {
+		if id != track.GetTrackLocal().ID() && other.Purpose == rtp.PurposeMain && other.GetTrackLocal().Kind() == track.GetTrackLocal().Kind() {
+			h.showOnProgram(other)
+			return
+		}
+	}
+}
+
+// showSpeakerOnProgram switches the program to the main tracks of the dominant speaker, guests are never shown
+func (h *Hub) showSpeakerOnProgram(speaker string) {
+	if h.program == nil || len(speaker) == 0 {
+		return
+	}
+	for _, track := range h.tracks {
+		if track.Purpose == rtp.PurposeMain && track.GetTrackLocal().StreamID() == speaker {
+			h.showOnProgram(track)
+		}
+	}
+}
+
+func (h *Hub) closeProgram() {
+	if h.program != nil {
+		h.program.Close()
+	}
+}
+
+func (h *Hub) respond(errChan chan<- error, err error) {
+	select {
+	case errChan <- err:
+	case <-h.ctx.Done():
+		slog.Warn("lobby.Hub: respond on closed Hub")
+	case <-time.After(hubDispatchTimeout):
+		slog.Error("lobby.Hub: respond - interrupted because dispatch timeout")
+	}
+}
+
 func (h *Hub) increaseNodeGraphStats(sessionId string, endpointType rtp.EndpointType, purpose rtp.Purpose) {
 	index := endpointType.ToString() + sessionId
 	metricNode, ok := h.metricNodes[index]
@@ -280,8 +1157,32 @@ func filterForSession(sessionId uuid.UUID) filterHubTracks {
 	}
 }
 
+// filterForInstance filters the tracks an instance session has already seen, the tracks published on or relayed by
+// its instance. Otherwise tracks would be sent back and loop between the federated instances.
+func filterForInstance(session *Session) filterHubTracks {
+	return func(track *rtp.TrackInfo) bool {
+		if session.sessionType != InstanceSession && session.sessionType != RemoteInstanceSession {
+			return true
+		}
+		return !track.PassedThrough(session.user)
+	}
+}
+
 func filterForNotMain() filterHubTracks {
 	return func(track *rtp.TrackInfo) bool {
 		return track.Purpose != rtp.PurposeMain
 	}
 }
+
+func filterForNotScreen() filterHubTracks {
+	return func(track *rtp.TrackInfo) bool {
+		return track.Purpose != rtp.PurposeScreen
+	}
+}
+
+// filterForLastN filters the video tracks of sessions with Last-N, because their video is sent by the video slots
+func filterForLastN(h *Hub, session *Session) filterHubTracks {
+	return func(track *rtp.TrackInfo) bool {
+		return track.GetTrackLocal().Kind() != webrtc.RTPCodecTypeVideo || h.lastNOf(session) == 0
+	}
+}
@@ -3,7 +3,9 @@ package sessions
 import (
 	"context"
 
+	"github.com/google/uuid"
 	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/pkg/message"
 )
 
 type hubRequest struct {
@@ -11,6 +13,15 @@ type hubRequest struct {
 	kind          hubRequestKind
 	track         *rtp.TrackInfo
 	trackListChan chan<- []*rtp.TrackInfo
+	mediaStreamId string
+	purpose       rtp.Purpose
+	errChan       chan<- error
+	sessionId     uuid.UUID
+	metadata      *message.Metadata
+	chat          *message.Chat
+	chatListChan  chan<- []*message.Chat
+	appMessage    *message.AppMessage
+	programChan   chan<- *rtp.ProgramOutput
 }
 
 type hubRequestKind int
@@ -20,4 +31,13 @@ const (
 	removeTrack
 	getTrackList
 	muteTrack
+	changePurpose
+	updateMetadata
+	sendChat
+	getChatHistory
+	sendAppMessage
+	changeSubscription
+	changeLastN
+	refreshVideoSlots
+	getProgram
 )
@@ -2,10 +2,15 @@ package sessions
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
 	"github.com/shigde/sfu/internal/lobby/mocks"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/pkg/message"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,3 +43,572 @@ func TestHub(t *testing.T) {
 		assert.NotNil(t, hub)
 	})
 }
+
+func testHubTrackSetup(t *testing.T, hub *Hub, purpose rtp.Purpose) *rtp.TrackInfo {
+	t.Helper()
+	return testHubSessionTrackSetup(t, hub, uuid.New(), purpose)
+}
+
+func testHubSessionTrackSetup(t *testing.T, hub *Hub, sessionId uuid.UUID, purpose rtp.Purpose) *rtp.TrackInfo {
+	t.Helper()
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, uuid.NewString(), uuid.NewString())
+	assert.NoError(t, err)
+	info := &rtp.TrackInfo{Track: track}
+	info.Id = uuid.New()
+	info.SessionId = sessionId
+	info.Purpose = purpose
+	hub.DispatchAddTrack(context.Background(), info)
+	return info
+}
+
+// testHubPurpose reads the purpose of a track from the Hub, the Hub replaces a track when its purpose changes
+func testHubPurpose(t *testing.T, hub *Hub, track *rtp.TrackInfo) rtp.Purpose {
+	t.Helper()
+	list, err := hub.getTrackList(context.Background(), uuid.New())
+	assert.NoError(t, err)
+	for _, info := range list {
+		if info.GetId() == track.GetId() {
+			return info.GetPurpose()
+		}
+	}
+	t.Fatalf("track %s not found in the Hub", track.GetId())
+	return rtp.PurposeGuest
+}
+
+func TestHub_ChangePurpose(t *testing.T) {
+	t.Run("promote guest stream to main", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		sender := hub.sender.(*mocks.LiveSenderMock)
+		main := testHubTrackSetup(t, hub, rtp.PurposeMain)
+		guest := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+
+		err := hub.DispatchChangePurpose(context.Background(), guest.GetTrackLocal().StreamID(), rtp.PurposeMain)
+
+		assert.NoError(t, err)
+		assert.Equal(t, rtp.PurposeMain, testHubPurpose(t, hub, guest))
+		assert.Equal(t, rtp.PurposeGuest, testHubPurpose(t, hub, main))
+		assert.Contains(t, sender.Tracks, guest.GetTrackLocal().ID())
+		assert.NotContains(t, sender.Tracks, main.GetTrackLocal().ID())
+	})
+
+	t.Run("demote main stream to guest", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		sender := hub.sender.(*mocks.LiveSenderMock)
+		main := testHubTrackSetup(t, hub, rtp.PurposeMain)
+
+		err := hub.DispatchChangePurpose(context.Background(), main.GetTrackLocal().StreamID(), rtp.PurposeGuest)
+
+		assert.NoError(t, err)
+		assert.Equal(t, rtp.PurposeGuest, testHubPurpose(t, hub, main))
+		assert.Empty(t, sender.Tracks)
+	})
+
+	t.Run("media stream not found", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+
+		err := hub.DispatchChangePurpose(context.Background(), uuid.NewString(), rtp.PurposeMain)
+		assert.ErrorIs(t, err, ErrMediaStreamNotFound)
+	})
+
+	t.Run("promoted purpose outlasts renegotiation of the publisher", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		guest := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		err := hub.DispatchChangePurpose(context.Background(), guest.GetTrackLocal().StreamID(), rtp.PurposeMain)
+		assert.NoError(t, err)
+
+		// the publisher adds a track to the stream, its sdp still labels the stream as guest
+		track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, uuid.NewString(), guest.GetTrackLocal().StreamID())
+		assert.NoError(t, err)
+		audio := &rtp.TrackInfo{Track: track}
+		audio.Id = uuid.New()
+		audio.SessionId = guest.SessionId
+		audio.Purpose = rtp.PurposeGuest
+		hub.DispatchAddTrack(context.Background(), audio)
+		_, _ = hub.getTrackList(context.Background(), uuid.New())
+
+		assert.Equal(t, rtp.PurposeMain, audio.GetPurpose())
+	})
+}
+
+func TestHub_Program(t *testing.T) {
+	t.Run("program shows the main tracks", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		main := testHubTrackSetup(t, hub, rtp.PurposeMain)
+		guest := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+
+		program, err := hub.GetProgram(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, program.Shows(main))
+		assert.False(t, program.Shows(guest))
+	})
+
+	t.Run("program follows the main track", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		program, err := hub.GetProgram(context.Background())
+		assert.NoError(t, err)
+		main := testHubTrackSetup(t, hub, rtp.PurposeMain)
+		guest := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+
+		err = hub.DispatchChangePurpose(context.Background(), guest.GetTrackLocal().StreamID(), rtp.PurposeMain)
+
+		assert.NoError(t, err)
+		assert.True(t, program.Shows(guest))
+		assert.False(t, program.Shows(main))
+	})
+
+	t.Run("program continues with another main track", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		program, err := hub.GetProgram(context.Background())
+		assert.NoError(t, err)
+		first := testHubTrackSetup(t, hub, rtp.PurposeMain)
+		second := testHubTrackSetup(t, hub, rtp.PurposeMain)
+
+		hub.DispatchRemoveTrack(context.Background(), second)
+		_, err = hub.GetProgram(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, program.Shows(first))
+	})
+
+	t.Run("audience is not part of the sessions", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		sessions := hub.sessionRepo.All()
+		audience := NewAudience(hub.ctx, hub, mocks.NewRtpEngineForOffer(mocks.Answer))
+
+		_, answer, err := audience.Join(context.Background(), uuid.New(), mocks.Offer)
+
+		assert.NoError(t, err)
+		assert.Equal(t, mocks.Answer, answer)
+		assert.Equal(t, 1, audience.Len())
+		assert.Len(t, hub.sessionRepo.All(), len(sessions))
+	})
+
+	t.Run("audience viewer leaves by its id", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		audience := NewAudience(hub.ctx, hub, mocks.NewRtpEngineForOffer(mocks.Answer))
+		viewerId, _, err := audience.Join(context.Background(), uuid.New(), mocks.Offer)
+		assert.NoError(t, err)
+
+		assert.False(t, audience.Leave(uuid.New()))
+		assert.True(t, audience.Leave(viewerId))
+		assert.False(t, audience.Leave(viewerId))
+		assert.Equal(t, 0, audience.Len())
+	})
+
+	t.Run("full audience rejects viewers", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		audience := NewAudience(hub.ctx, hub, mocks.NewRtpEngineForOffer(mocks.Answer))
+		audience.maxViewers = 1
+		_, _, err := audience.Join(context.Background(), uuid.New(), mocks.Offer)
+		assert.NoError(t, err)
+
+		_, _, err = audience.Join(context.Background(), uuid.New(), mocks.Offer)
+
+		assert.ErrorIs(t, err, ErrAudienceFull)
+		assert.Equal(t, 1, audience.Len())
+	})
+}
+
+func TestHub_ScreenShare(t *testing.T) {
+	t.Run("only one screen stream per session", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		sessionId := uuid.New()
+		screen := testHubSessionTrackSetup(t, hub, sessionId, rtp.PurposeScreen)
+		secondScreen := testHubSessionTrackSetup(t, hub, sessionId, rtp.PurposeScreen)
+		otherScreen := testHubTrackSetup(t, hub, rtp.PurposeScreen)
+
+		_, _ = hub.getTrackList(context.Background(), uuid.New())
+
+		assert.Equal(t, rtp.PurposeScreen, screen.GetPurpose())
+		assert.Equal(t, rtp.PurposeGuest, secondScreen.GetPurpose())
+		assert.Equal(t, rtp.PurposeScreen, otherScreen.GetPurpose())
+	})
+
+	t.Run("change purpose to screen when session shares already a screen", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		sessionId := uuid.New()
+		_ = testHubSessionTrackSetup(t, hub, sessionId, rtp.PurposeScreen)
+		guest := testHubSessionTrackSetup(t, hub, sessionId, rtp.PurposeGuest)
+
+		err := hub.DispatchChangePurpose(context.Background(), guest.GetTrackLocal().StreamID(), rtp.PurposeScreen)
+
+		assert.ErrorIs(t, err, ErrScreenShareLimit)
+		assert.Equal(t, rtp.PurposeGuest, guest.GetPurpose())
+	})
+
+	t.Run("screen tracks are listed first and can be filtered", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		_ = testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		_ = testHubTrackSetup(t, hub, rtp.PurposeMain)
+		screen := testHubTrackSetup(t, hub, rtp.PurposeScreen)
+
+		list, err := hub.getTrackList(context.Background(), uuid.New())
+		assert.NoError(t, err)
+		assert.Len(t, list, 3)
+		assert.Equal(t, screen, list[0])
+
+		list, err = hub.getTrackList(context.Background(), uuid.New(), filterForNotScreen())
+		assert.NoError(t, err)
+		assert.Len(t, list, 2)
+		assert.NotContains(t, list, screen)
+	})
+}
+
+func TestHub_Metadata(t *testing.T) {
+	t.Run("owner of media stream updates metadata", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		track := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		metadata := &message.Metadata{MediaStreamId: track.GetTrackLocal().StreamID(), DisplayName: "Alice", HandRaised: true}
+
+		hub.DispatchMetadata(context.Background(), track.GetSessionId(), metadata)
+		_, _ = hub.getTrackList(context.Background(), uuid.New())
+
+		assert.Equal(t, metadata, hub.metadata[metadata.MediaStreamId])
+	})
+
+	t.Run("foreign session can not update metadata", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		track := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		metadata := &message.Metadata{MediaStreamId: track.GetTrackLocal().StreamID(), DisplayName: "Mallory"}
+
+		hub.DispatchMetadata(context.Background(), uuid.New(), metadata)
+		_, _ = hub.getTrackList(context.Background(), uuid.New())
+
+		assert.NotContains(t, hub.metadata, metadata.MediaStreamId)
+	})
+
+	t.Run("metadata is removed with the media stream", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		track := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		metadata := &message.Metadata{MediaStreamId: track.GetTrackLocal().StreamID(), DisplayName: "Alice"}
+
+		hub.DispatchMetadata(context.Background(), track.GetSessionId(), metadata)
+		hub.DispatchRemoveTrack(context.Background(), track)
+		_, _ = hub.getTrackList(context.Background(), uuid.New())
+
+		assert.NotContains(t, hub.metadata, metadata.MediaStreamId)
+	})
+}
+
+func TestHub_Chat(t *testing.T) {
+	t.Run("chat messages are stored in the history", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		first := &message.Chat{Id: uuid.NewString(), Text: "first"}
+		second := &message.Chat{Id: uuid.NewString(), Text: "second"}
+
+		hub.DispatchChat(context.Background(), first)
+		hub.DispatchChat(context.Background(), second)
+		history, err := hub.GetChatHistory(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, []*message.Chat{first, second}, history)
+	})
+
+	t.Run("chat history is bounded", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		var last *message.Chat
+		for i := 0; i < chatHistorySize+10; i++ {
+			last = &message.Chat{Id: uuid.NewString(), User: uuid.NewString(), Text: fmt.Sprintf("chat %d", i)}
+			hub.DispatchChat(context.Background(), last)
+		}
+		history, err := hub.GetChatHistory(context.Background())
+
+		assert.NoError(t, err)
+		assert.Len(t, history, chatHistorySize)
+		assert.Equal(t, "chat 10", history[0].Text)
+		assert.Equal(t, last, history[chatHistorySize-1])
+	})
+
+	t.Run("chat messages are limited per user", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		user, other := uuid.NewString(), uuid.NewString()
+		// the sessions of a user share the limit, so it does not matter which session sends the message
+		for i := 0; i < chatRateBurst+3; i++ {
+			hub.DispatchChat(context.Background(), &message.Chat{Id: uuid.NewString(), User: user, Text: fmt.Sprintf("chat %d", i)})
+		}
+		hub.DispatchChat(context.Background(), &message.Chat{Id: uuid.NewString(), User: other, Text: "other"})
+		history, err := hub.GetChatHistory(context.Background())
+
+		assert.NoError(t, err)
+		assert.Len(t, history, chatRateBurst+1)
+		assert.Equal(t, other, history[chatRateBurst].User)
+	})
+}
+
+func TestHub_AppMessageTarget(t *testing.T) {
+	hub, stop := testHubSetup(t)
+	defer stop()
+	host := testHubSessionSetup(t, hub)
+	guest := testHubSessionSetup(t, hub)
+	viewer := NewSession(hub.ctx, uuid.New(), hub, mocks.NewRtpEngine(), ViewerSession, nil)
+	hub.sessionRepo.Add(viewer)
+	hub.owner = host.user
+	track := testHubSessionTrackSetup(t, hub, guest.Id, rtp.PurposeGuest)
+	mediaStreamId := track.GetTrackLocal().StreamID()
+	hub.DispatchMetadata(context.Background(), guest.Id, &message.Metadata{MediaStreamId: mediaStreamId, Role: RoleHost})
+	_, _ = hub.getTrackList(context.Background(), uuid.New())
+
+	t.Run("without target all sessions receive the message", func(t *testing.T) {
+		assert.True(t, hub.isAppMessageTarget(host, nil))
+		assert.True(t, hub.isAppMessageTarget(guest, nil))
+	})
+
+	t.Run("role target", func(t *testing.T) {
+		target := &message.AppTarget{Role: RoleHost}
+		assert.True(t, hub.isAppMessageTarget(host, target))
+		assert.False(t, hub.isAppMessageTarget(guest, target))
+		assert.False(t, hub.isAppMessageTarget(viewer, target))
+		assert.True(t, hub.isAppMessageTarget(viewer, &message.AppTarget{Role: RoleViewer}))
+	})
+
+	t.Run("role of the client metadata is replaced by the server role", func(t *testing.T) {
+		assert.Equal(t, RoleGuest, hub.metadata[mediaStreamId].Role)
+		assert.False(t, hub.isAppMessageTarget(guest, &message.AppTarget{Role: RoleHost}))
+	})
+
+	t.Run("user target", func(t *testing.T) {
+		target := &message.AppTarget{User: guest.user.String()}
+		assert.False(t, hub.isAppMessageTarget(host, target))
+		assert.True(t, hub.isAppMessageTarget(guest, target))
+	})
+}
+
+func TestHub_ActiveSpeaker(t *testing.T) {
+	t.Run("live output receives the dominant speaker until the media stream is removed", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		sender := hub.sender.(*mocks.LiveSenderMock)
+		track := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		mediaStreamId := track.GetTrackLocal().StreamID()
+
+		for i := 0; i < 50; i++ {
+			hub.DispatchAudioLevel(track.GetSessionId(), mediaStreamId, 20)
+		}
+		assert.Eventually(t, func() bool {
+			return sender.ActiveSpeaker() == mediaStreamId
+		}, time.Second, 50*time.Millisecond)
+
+		hub.DispatchRemoveTrack(context.Background(), track)
+		assert.Eventually(t, func() bool {
+			return sender.ActiveSpeaker() == ""
+		}, time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("program shows the main tracks of the dominant speaker", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		program, err := hub.GetProgram(context.Background())
+		assert.NoError(t, err)
+		speaker := testHubTrackSetup(t, hub, rtp.PurposeMain)
+		other := testHubTrackSetup(t, hub, rtp.PurposeMain)
+		_, _ = hub.getTrackList(context.Background(), uuid.New())
+		assert.True(t, program.Shows(other))
+
+		for i := 0; i < 50; i++ {
+			hub.DispatchAudioLevel(speaker.GetSessionId(), speaker.GetTrackLocal().StreamID(), 20)
+		}
+
+		assert.Eventually(t, func() bool {
+			return program.Shows(speaker)
+		}, time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("guest speaker is not shown on the program", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		program, err := hub.GetProgram(context.Background())
+		assert.NoError(t, err)
+		main := testHubTrackSetup(t, hub, rtp.PurposeMain)
+		guest := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+
+		for i := 0; i < 50; i++ {
+			hub.DispatchAudioLevel(guest.GetSessionId(), guest.GetTrackLocal().StreamID(), 20)
+		}
+		time.Sleep(2 * speakerDetectionInterval)
+		_, _ = hub.getTrackList(context.Background(), uuid.New())
+
+		assert.True(t, program.Shows(main))
+		assert.False(t, program.Shows(guest))
+	})
+}
+
+func TestHub_LastN(t *testing.T) {
+	t.Run("lobby Last-N is validated", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		assert.ErrorIs(t, hub.DispatchLastN(context.Background(), -1), ErrInvalidLastN)
+		assert.ErrorIs(t, hub.DispatchLastN(context.Background(), maxLastN+1), ErrInvalidLastN)
+		assert.NoError(t, hub.DispatchLastN(context.Background(), 3))
+	})
+
+	t.Run("video is not forwarded directly with Last-N", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		session := testHubSessionSetup(t, hub)
+		_ = testHubTrackSetup(t, hub, rtp.PurposeGuest)
+
+		list, err := hub.getTrackList(context.Background(), session.Id, filterForLastN(hub, session))
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+
+		assert.NoError(t, hub.DispatchLastN(context.Background(), 3))
+		list, err = hub.getTrackList(context.Background(), session.Id, filterForLastN(hub, session))
+		assert.NoError(t, err)
+		assert.Empty(t, list)
+
+		// the subscriber disables Last-N for itself
+		session.subscription.setLastN(0)
+		list, err = hub.getTrackList(context.Background(), session.Id, filterForLastN(hub, session))
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+	})
+
+	t.Run("video tracks are ranked by screen share and speaker activity", func(t *testing.T) {
+		hub, stop := testHubSetup(t)
+		defer stop()
+		silent := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		speaker := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+		screen := testHubTrackSetup(t, hub, rtp.PurposeScreen)
+		hub.speakers.observe(speaker.GetTrackLocal().StreamID(), 10)
+		hub.speakers.detect(time.Now())
+
+		ranking := hub.rankVideoTracks()
+
+		assert.Equal(t, []*rtp.TrackInfo{screen, speaker, silent}, ranking)
+	})
+}
+
+func testFederatedHubSetup(t *testing.T, instanceId uuid.UUID) *Hub {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return NewHub(ctx, NewSessionRepository(), uuid.New(), mocks.NewLiveSender(), HubWithInstanceId(instanceId))
+}
+
+func testHubInstanceSessionSetup(t *testing.T, hub *Hub, instanceId uuid.UUID, sType SessionType) *Session {
+	t.Helper()
+	s := NewSession(hub.ctx, instanceId, hub, mocks.NewRtpEngine(), sType, nil)
+	hub.sessionRepo.Add(s)
+	return s
+}
+
+// testHubRelayTrack receives a track over the ingress of an instance session, like the sdp carries it
+func testHubRelayTrack(t *testing.T, hub *Hub, source *Session, track *rtp.TrackInfo) *rtp.TrackInfo {
+	t.Helper()
+	info := &rtp.TrackInfo{Track: track.Track}
+	info.Id = uuid.New()
+	info.SessionId = source.Id
+	info.Purpose = track.Purpose
+	info.Origin = track.Origin
+	info.Path = track.Path
+	hub.DispatchAddTrack(context.Background(), info)
+	// the track list is requested after the track is added
+	_, err := hub.getTrackList(context.Background(), uuid.New())
+	assert.NoError(t, err)
+	return info
+}
+
+func testHubEgressTracks(t *testing.T, hub *Hub, session *Session) []*rtp.TrackInfo {
+	t.Helper()
+	list, err := hub.getTrackList(context.Background(), session.Id, filterForSession(session.Id), filterForInstance(session))
+	assert.NoError(t, err)
+	return list
+}
+
+func TestHub_Federation(t *testing.T) {
+	instanceA, instanceB, instanceC := uuid.New(), uuid.New(), uuid.New()
+
+	t.Run("tracks of this instance are tagged with its origin", func(t *testing.T) {
+		hub := testFederatedHubSetup(t, instanceA)
+		track := testHubTrackSetup(t, hub, rtp.PurposeGuest)
+
+		list, err := hub.getTrackList(context.Background(), uuid.New())
+		assert.NoError(t, err)
+
+		assert.Equal(t, []*rtp.TrackInfo{track}, list)
+		assert.Equal(t, instanceA, track.Origin)
+		assert.Empty(t, track.Path)
+	})
+
+	t.Run("two instances do not send tracks back", func(t *testing.T) {
+		hubA, hubB := testFederatedHubSetup(t, instanceA), testFederatedHubSetup(t, instanceB)
+		toB := testHubInstanceSessionSetup(t, hubA, instanceB, RemoteInstanceSession)
+		toA := testHubInstanceSessionSetup(t, hubB, instanceA, InstanceSession)
+		trackA := testHubTrackSetup(t, hubA, rtp.PurposeGuest)
+		trackB := testHubTrackSetup(t, hubB, rtp.PurposeGuest)
+
+		// A sends its track to B and B sends its track to A
+		assert.Equal(t, []*rtp.TrackInfo{trackA}, testHubEgressTracks(t, hubA, toB))
+		assert.Equal(t, []*rtp.TrackInfo{trackB}, testHubEgressTracks(t, hubB, toA))
+		relayedA := testHubRelayTrack(t, hubB, toA, trackA)
+		relayedB := testHubRelayTrack(t, hubA, toB, trackB)
+
+		// the received tracks are not sent back
+		assert.Equal(t, []*rtp.TrackInfo{trackA}, testHubEgressTracks(t, hubA, toB))
+		assert.Equal(t, []*rtp.TrackInfo{trackB}, testHubEgressTracks(t, hubB, toA))
+		assert.Equal(t, instanceA, relayedA.Origin)
+		assert.Equal(t, instanceB, relayedB.Origin)
+
+		// users of the instances receive all tracks
+		user := testHubSessionSetup(t, hubB)
+		assert.Len(t, testHubEgressTracks(t, hubB, user), 2)
+	})
+
+	t.Run("track of an instance without origin tag is not sent back", func(t *testing.T) {
+		hubB := testFederatedHubSetup(t, instanceB)
+		toA := testHubInstanceSessionSetup(t, hubB, instanceA, InstanceSession)
+		track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, uuid.NewString(), uuid.NewString())
+		assert.NoError(t, err)
+
+		relayed := testHubRelayTrack(t, hubB, toA, &rtp.TrackInfo{Track: track})
+
+		assert.Empty(t, testHubEgressTracks(t, hubB, toA))
+		assert.Equal(t, instanceA, relayed.Origin)
+	})
+
+	t.Run("three instances in a ring do not send tracks around", func(t *testing.T) {
+		hubA, hubB, hubC := testFederatedHubSetup(t, instanceA), testFederatedHubSetup(t, instanceB), testFederatedHubSetup(t, instanceC)
+		// A -> B -> C -> A
+		aToB := testHubInstanceSessionSetup(t, hubA, instanceB, RemoteInstanceSession)
+		aFromC := testHubInstanceSessionSetup(t, hubA, instanceC, InstanceSession)
+		bFromA := testHubInstanceSessionSetup(t, hubB, instanceA, InstanceSession)
+		bToC := testHubInstanceSessionSetup(t, hubB, instanceC, RemoteInstanceSession)
+		cFromB := testHubInstanceSessionSetup(t, hubC, instanceB, InstanceSession)
+		cToA := testHubInstanceSessionSetup(t, hubC, instanceA, RemoteInstanceSession)
+		trackA := testHubTrackSetup(t, hubA, rtp.PurposeGuest)
+
+		assert.Equal(t, []*rtp.TrackInfo{trackA}, testHubEgressTracks(t, hubA, aToB))
+		atB := testHubRelayTrack(t, hubB, bFromA, trackA)
+		assert.Equal(t, []*rtp.TrackInfo{atB}, testHubEgressTracks(t, hubB, bToC))
+		atC := testHubRelayTrack(t, hubC, cFromB, atB)
+
+		// C received the track of A over B, so A has it already
+		assert.Equal(t, instanceA, atC.Origin)
+		assert.Equal(t, []uuid.UUID{instanceB}, atC.Path)
+		assert.Empty(t, testHubEgressTracks(t, hubC, cToA))
+		assert.Empty(t, testHubEgressTracks(t, hubC, cFromB))
+		assert.Empty(t, testHubEgressTracks(t, hubB, bFromA))
+		// A sends its own track to C directly, that is no loop
+		assert.Equal(t, []*rtp.TrackInfo{trackA}, testHubEgressTracks(t, hubA, aFromC))
+	})
+}
@@ -0,0 +1,48 @@
+package sessions
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a simple token bucket. It allows bursts of up to burst events and refills one event per interval.
+type rateLimiter struct {
+	mutex    sync.Mutex
+	burst    int
+	interval time.Duration
+	tokens   int
+	last     time.Time
+}
+
+func newRateLimiter(burst int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		burst:    burst,
+		interval: interval,
+		tokens:   burst,
+		last:     time.Now(),
+	}
+}
+
+func (r *rateLimiter) allow() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if refill := int(now.Sub(r.last) / r.interval); refill > 0 {
+		r.tokens = min(r.burst, r.tokens+refill)
+		r.last = r.last.Add(time.Duration(refill) * r.interval)
+	}
+
+	if r.tokens == 0 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// idle reports whether the bucket is full again, an idle limiter behaves like a new one
+func (r *rateLimiter) idle() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.tokens+int(time.Since(r.last)/r.interval) >= r.burst
+}
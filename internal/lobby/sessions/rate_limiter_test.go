@@ -0,0 +1,35 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("allow burst and deny more", func(t *testing.T) {
+		limiter := newRateLimiter(3, time.Hour)
+		assert.True(t, limiter.allow())
+		assert.True(t, limiter.allow())
+		assert.True(t, limiter.allow())
+		assert.False(t, limiter.allow())
+	})
+
+	t.Run("refill after interval", func(t *testing.T) {
+		limiter := newRateLimiter(1, 10*time.Millisecond)
+		assert.True(t, limiter.allow())
+		assert.False(t, limiter.allow())
+		time.Sleep(15 * time.Millisecond)
+		assert.True(t, limiter.allow())
+	})
+
+	t.Run("idle after the bucket is refilled", func(t *testing.T) {
+		limiter := newRateLimiter(1, 10*time.Millisecond)
+		assert.True(t, limiter.idle())
+		assert.True(t, limiter.allow())
+		assert.False(t, limiter.idle())
+		time.Sleep(15 * time.Millisecond)
+		assert.True(t, limiter.idle())
+	})
+}
@@ -4,16 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
 	"github.com/shigde/sfu/internal/rtp"
 	"github.com/shigde/sfu/internal/telemetry"
 	"github.com/shigde/sfu/pkg/message"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
@@ -32,7 +38,13 @@ var (
 	ErrNoSignalChannel              = errors.New("no signal channel connection exists in session")
 	ErrSessionProcessWaitingTimeout = errors.New("session process waiting timeout")
 	processWaitingTimeout           = 10 * time.Second // Ice gathering could take a long tine :-(
-
+	maxChatMessageLength            = 1000
+	maxAppNamespaceLength           = 64
+	maxAppPayloadSize               = 4096
+	appRateBurst                    = 20
+	appRateInterval                 = 100 * time.Millisecond
+	maxDisplayNameLength            = 100
+	maxMetadataUrlLength            = 2048
 )
 
 type Session struct {
@@ -49,6 +61,10 @@ type Session struct {
 	egress        *rtp.Endpoint
 	signalChannel *rtp.Endpoint
 	signal        *signal
+	appLimiter    *rateLimiter
+	subscription  *subscription
+	// the estimate an instance reported for the receivers behind it
+	downstream atomic.Pointer[message.Estimate]
 
 	stop    context.CancelFunc
 	garbage chan<- Item
@@ -74,9 +90,20 @@ func NewSession(ctx context.Context, user uuid.UUID, hub *Hub, engine RtpEngine,
 		signal:    signal,
 		stop:      cancel,
 		garbage:   garbage,
+
+		appLimiter: newRateLimiter(appRateBurst, appRateInterval),
+
+		subscription: newSubscription(),
 	}
 
 	signal.onMuteCbk = session.onMuteTrack
+	signal.onMetadataCbk = session.onMetadata
+	signal.onChatCbk = session.onChat
+	signal.onAppMessageCbk = session.onAppMessage
+	signal.onSubscribeCbk = session.onSubscribe
+	signal.onUnsubscribeCbk = session.onUnsubscribe
+	signal.onLastNCbk = session.onLastN
+	signal.onEstimateCbk = session.onEstimate
 
 	return session
 }
@@ -135,10 +162,15 @@ func (s *Session) OfferIngressEndpoint(ctx context.Context, signalKind SignalCha
 		return nil, telemetry.RecordError(span, ErrIngressAlreadyExists)
 	}
 
+	if signalKind == BidirectionalSignalChannel {
+		s.signal.setPolite()
+	}
+
 	option := make([]rtp.EndpointOption, 0)
 	option = append(option, rtp.EndpointWithDataChannel(buildSignalDataChannelCbk(s, signalKind)))
 	option = append(option, rtp.EndpointWithLostConnectionListener(s.onLostConnection))
 	option = append(option, rtp.EndpointWithTrackDispatcher(s.hub))
+	option = append(option, s.signal.negotiationOptions()...)
 
 	endpoint, err := s.rtpEngine.OfferEndpoint(ctx, s.ctx, s.Id, s.hub.LiveStreamId, rtp.IngressEndpoint, option...)
 	if err != nil {
@@ -177,16 +209,18 @@ func (s *Session) CreateEgressEndpoint(ctx context.Context, offer *webrtc.Sessio
 		return nil, telemetry.RecordErrorf(span, "waiting for signal channel", err)
 	}
 
-	hub := s.hub
-	withTrackCbk := rtp.EndpointWithGetCurrentTrackCbk(func(ctx context.Context, sessionId uuid.UUID) ([]*rtp.TrackInfo, error) {
-		return hub.getTrackList(ctx, sessionId, filterForSession(sessionId))
-	})
+	withTrackCbk := rtp.EndpointWithGetCurrentTrackCbk(s.getEgressTrackList)
 
 	option := make([]rtp.EndpointOption, 0)
 	option = append(option, withTrackCbk)
 	option = append(option, rtp.EndpointWithDataChannel(buildSignalDataChannelCbk(s, signalKind))) // silent
 	option = append(option, rtp.EndpointWithNegotiationNeededListener(s.signal.OnNegotiationNeeded))
 	option = append(option, rtp.EndpointWithLostConnectionListener(s.onLostConnection))
+	option = append(option, rtp.EndpointWithSlotMappingListener(s.onSlotMapping))
+	option = append(option, rtp.EndpointWithVideoQuality(s.subscription.maxQuality))
+	if s.hub.transcoding != nil {
+		option = append(option, rtp.EndpointWithTranscoding(s.hub.transcoding))
+	}
 
 	endpoint, err := s.rtpEngine.EstablishEndpoint(ctx, s.ctx, s.Id, s.hub.LiveStreamId, *offer, rtp.EgressEndpoint, option...)
 	if err != nil {
@@ -226,16 +260,22 @@ func (s *Session) OfferEgressEndpoint(ctx context.Context, signalKind SignalChan
 		return nil, telemetry.RecordErrorf(span, "waiting for signal channel", err)
 	}
 
-	hub := s.hub
-	withTrackCbk := rtp.EndpointWithGetCurrentTrackCbk(func(ctx context.Context, sessionId uuid.UUID) ([]*rtp.TrackInfo, error) {
-		return hub.getTrackList(ctx, sessionId, filterForSession(sessionId))
-	})
+	withTrackCbk := rtp.EndpointWithGetCurrentTrackCbk(s.getEgressTrackList)
 
 	option := make([]rtp.EndpointOption, 0)
 	option = append(option, withTrackCbk)
 	option = append(option, rtp.EndpointWithDataChannel(buildSignalDataChannelCbk(s, signalKind))) // silent
 	option = append(option, rtp.EndpointWithNegotiationNeededListener(s.signal.OnNegotiationNeeded))
 	option = append(option, rtp.EndpointWithLostConnectionListener(s.onLostConnection))
+	option = append(option, rtp.EndpointWithSlotMappingListener(s.onSlotMapping))
+	option = append(option, rtp.EndpointWithVideoQuality(s.subscription.maxQuality))
+	if s.hub.transcoding != nil {
+		option = append(option, rtp.EndpointWithTranscoding(s.hub.transcoding))
+	}
+	if signalKind == BidirectionalSignalChannel {
+		s.signal.setPolite()
+	}
+	option = append(option, s.signal.negotiationOptions()...)
 
 	endpoint, err := s.rtpEngine.OfferEndpoint(ctx, s.ctx, s.Id, s.hub.LiveStreamId, rtp.EgressEndpoint, option...)
 	if err != nil {
@@ -258,8 +298,12 @@ func (s *Session) OfferEgressEndpoint(ctx context.Context, signalKind SignalChan
 
 // waitForSignalChannel
 // For an egress endpoint we need a data channel. The data channel is used for media update signaling.
-// That's why we're waiting until it's built
+// That's why we're waiting until it's built. A viewer session has no ingress endpoint, the data channel of its
+// egress endpoint becomes the signal channel, the offers of the egress endpoint wait for it.
 func (s *Session) waitForSignalChannel() error {
+	if s.ingress == nil && s.sessionType == ViewerSession {
+		return nil
+	}
 
 	if s.ingress == nil {
 		return ErrNoSignalChannel
@@ -286,6 +330,7 @@ func (s *Session) onLostConnection() {
 			slog.Debug("sessions: internally quit interrupted because session already closed", "session id", session.Id, "user", session.user)
 		default:
 			item := NewItem(s.user)
+			item.SessionType = session.sessionType
 			select {
 			case session.garbage <- item:
 				session.stop()
@@ -375,6 +420,416 @@ func (s *Session) onMuteTrack(mute *message.Mute) {
 	}
 }
 
+func (s *Session) onMetadata(metadata *message.Metadata) {
+	ctx, span := s.trace(context.Background(), "ingress_metadata_event")
+	defer span.End()
+	span.SetAttributes(attribute.String("mediaStreamId", metadata.MediaStreamId))
+	if s.isDone() {
+		return
+	}
+
+	if !validMetadata(metadata) {
+		slog.Warn("sessions: drop invalid metadata", "sessionId", s.Id, "user", s.user, "mediaStreamId", metadata.MediaStreamId)
+		span.AddEvent("Invalid Metadata")
+		return
+	}
+	// the role is always given by the server, whatever the client sends
+	metadata.Role = ""
+	go s.hub.DispatchMetadata(ctx, s.Id, metadata)
+	span.AddEvent("Dispatch Metadata to Sessions")
+}
+
+// validMetadata limits the length of the fields a client sends, the avatar and the actor have to be web urls
+func validMetadata(metadata *message.Metadata) bool {
+	if len(metadata.MediaStreamId) == 0 || utf8.RuneCountInString(metadata.DisplayName) > maxDisplayNameLength {
+		return false
+	}
+	return isWebUrl(metadata.AvatarUrl) && isWebUrl(metadata.ActorIri)
+}
+
+// isWebUrl accepts an empty value or an absolute http or https url
+func isWebUrl(value string) bool {
+	if len(value) == 0 {
+		return true
+	}
+	if len(value) > maxMetadataUrlLength {
+		return false
+	}
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && len(u.Host) > 0
+}
+
+func (s *Session) sendMetadata(ctx context.Context, metadataList []*message.Metadata) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, span := s.trace(ctx, "egress_metadata_event")
+	defer span.End()
+
+	if s.egress == nil || s.signal.messenger == nil {
+		return
+	}
+	for _, metadata := range metadataList {
+		if err := s.signal.messenger.SendMetadata(metadata); err != nil {
+			slog.Error("sessions: send metadata", "err", err, "sessionId", s.Id, "user", s.user)
+		}
+	}
+	span.AddEvent("Send Egress Metadata to Client")
+}
+
+func (s *Session) onChat(chat *message.Chat) {
+	ctx, span := s.trace(context.Background(), "ingress_chat_event")
+	defer span.End()
+	if s.isDone() {
+		return
+	}
+
+	text := strings.TrimSpace(chat.Text)
+	if len(text) == 0 || utf8.RuneCountInString(text) > maxChatMessageLength {
+		slog.Warn("sessions: drop invalid chat message", "sessionId", s.Id, "user", s.user, "length", len(text))
+		return
+	}
+
+	// the sender identity is always the user of this session, whatever the client sends
+	newChat := &message.Chat{
+		Id:   uuid.NewString(),
+		User: s.user.String(),
+		Text: text,
+		Time: time.Now().UTC(),
+	}
+	go s.hub.DispatchChat(ctx, newChat)
+	span.AddEvent("Dispatch Chat to Sessions")
+}
+
+func (s *Session) sendChat(ctx context.Context, chatList []*message.Chat) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, span := s.trace(ctx, "egress_chat_event")
+	defer span.End()
+
+	if s.signal.messenger == nil {
+		return
+	}
+	for _, chat := range chatList {
+		if err := s.signal.messenger.SendChat(chat); err != nil {
+			slog.Error("sessions: send chat", "err", err, "sessionId", s.Id, "user", s.user)
+		}
+	}
+	span.AddEvent("Send Chat to Client")
+}
+
+func (s *Session) onAppMessage(appMessage *message.AppMessage) {
+	ctx, span := s.trace(context.Background(), "ingress_app_message_event")
+	defer span.End()
+	span.SetAttributes(attribute.String("namespace", appMessage.Namespace))
+	if s.isDone() {
+		return
+	}
+
+	if len(appMessage.Namespace) == 0 || len(appMessage.Namespace) > maxAppNamespaceLength || len(appMessage.Payload) > maxAppPayloadSize {
+		slog.Warn("sessions: drop invalid app message", "sessionId", s.Id, "user", s.user, "namespace", appMessage.Namespace, "size", len(appMessage.Payload))
+		return
+	}
+
+	if !s.appLimiter.allow() {
+		slog.Warn("sessions: drop app message because of rate limit", "sessionId", s.Id, "user", s.user, "namespace", appMessage.Namespace)
+		span.AddEvent("App Message Rate Limit Exceeded")
+		return
+	}
+
+	// the sender identity is always the user of this session, whatever the client sends
+	newAppMessage := &message.AppMessage{
+		Namespace: appMessage.Namespace,
+		Payload:   appMessage.Payload,
+		Target:    appMessage.Target,
+		Sender:    s.user.String(),
+	}
+	go s.hub.DispatchAppMessage(ctx, s.Id, newAppMessage)
+	span.AddEvent("Dispatch App Message to Sessions")
+}
+
+func (s *Session) sendAppMessage(ctx context.Context, appMessageList []*message.AppMessage) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, span := s.trace(ctx, "egress_app_message_event")
+	defer span.End()
+
+	if s.signal.messenger == nil {
+		return
+	}
+	for _, appMessage := range appMessageList {
+		if err := s.signal.messenger.SendAppMessage(appMessage); err != nil {
+			slog.Error("sessions: send app message", "err", err, "sessionId", s.Id, "user", s.user)
+		}
+	}
+	span.AddEvent("Send App Message to Client")
+}
+
+func (s *Session) sendActiveSpeaker(ctx context.Context, activeSpeaker *message.ActiveSpeaker) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, span := s.trace(ctx, "egress_active_speaker_event")
+	defer span.End()
+
+	if s.signal.messenger == nil {
+		return
+	}
+	if err := s.signal.messenger.SendActiveSpeaker(activeSpeaker); err != nil {
+		slog.Error("sessions: send active speaker", "err", err, "sessionId", s.Id, "user", s.user)
+	}
+	span.AddEvent("Send Active Speaker to Client")
+}
+
+// receiveEstimate returns the estimate of the receivers behind the egress endpoint of the session
+func (s *Session) receiveEstimate() (pathEstimate, bool) {
+	if looked := s.mutex.TryRLock(); !looked {
+		return pathEstimate{}, false
+	}
+	defer s.mutex.RUnlock()
+
+	if s.egress == nil || !s.egress.IsInitComplete() {
+		return pathEstimate{}, false
+	}
+	var downstream *message.Estimate
+	if s.sessionType == InstanceSession || s.sessionType == RemoteInstanceSession {
+		downstream = s.downstream.Load()
+	}
+	return combinePath(s.egress.RemoteEstimate(), downstream)
+}
+
+func (s *Session) onEstimate(estimate *message.Estimate) {
+	s.downstream.Store(estimate)
+}
+
+// sendCongestionFeedback asks the publisher of the ingress endpoint to send not more than the estimate. An instance
+// session gets the estimate also by the signal channel, so the instance carries it on to its publishers.
+// The span continues the trace of the downstream instance, the whole chain ends up in one trace.
+func (s *Session) sendCongestionFeedback(ctx context.Context, estimate pathEstimate) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(estimate.trace))
+	ctx, span := s.trace(ctx, "congestion_feedback")
+	defer span.End()
+	span.SetAttributes(attribute.Int64("bitrate", int64(estimate.bitrate)), attribute.Int("hops", estimate.hops))
+
+	if s.ingress != nil {
+		if err := s.ingress.RequestBitrate(ctx, estimate.bitrate); err != nil {
+			slog.Warn("sessions: request bitrate", "err", err, "sessionId", s.Id, "user", s.user)
+		}
+	}
+	if s.signal.messenger == nil || (s.sessionType != InstanceSession && s.sessionType != RemoteInstanceSession) {
+		return
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if err := s.signal.messenger.SendEstimate(&message.Estimate{Bitrate: estimate.bitrate, Hops: estimate.hops, Trace: carrier}); err != nil {
+		slog.Error("sessions: send estimate", "err", err, "sessionId", s.Id, "user", s.user)
+	}
+	span.AddEvent("Send Estimate to Instance")
+}
+
+// Subscribe
+// Selects media streams the egress client wants to receive. After the first subscription,
+// the client only receives the subscribed media streams instead of all media streams of the lobby.
+func (s *Session) Subscribe(ctx context.Context, mediaStreamIds []string, maxQuality rtp.VideoQuality) error {
+	ctx, span := s.trace(ctx, "subscribe")
+	defer span.End()
+	span.SetAttributes(attribute.StringSlice("mediaStreamIds", mediaStreamIds), attribute.String("maxQuality", maxQuality.ToString()))
+	if s.isDone() {
+		return telemetry.RecordError(span, ErrSessionAlreadyClosed)
+	}
+	s.subscription.subscribe(mediaStreamIds, maxQuality)
+	s.hub.DispatchSubscriptionChanged(ctx, s.Id)
+	return nil
+}
+
+// Unsubscribe
+// Stops sending the media streams to the egress client.
+func (s *Session) Unsubscribe(ctx context.Context, mediaStreamIds []string) error {
+	ctx, span := s.trace(ctx, "unsubscribe")
+	defer span.End()
+	span.SetAttributes(attribute.StringSlice("mediaStreamIds", mediaStreamIds))
+	if s.isDone() {
+		return telemetry.RecordError(span, ErrSessionAlreadyClosed)
+	}
+	s.subscription.unsubscribe(mediaStreamIds)
+	s.hub.DispatchSubscriptionChanged(ctx, s.Id)
+	return nil
+}
+
+func (s *Session) onSubscribe(subscription *message.Subscription) {
+	maxQuality, err := rtp.ParseVideoQuality(subscription.MaxQuality)
+	if err != nil {
+		slog.Warn("sessions: drop subscription", "err", err, "sessionId", s.Id, "user", s.user, "maxQuality", subscription.MaxQuality)
+		return
+	}
+	if err := s.Subscribe(context.Background(), subscription.MediaStreamIds, maxQuality); err != nil {
+		slog.Error("sessions: subscribe", "err", err, "sessionId", s.Id, "user", s.user)
+	}
+}
+
+func (s *Session) onUnsubscribe(subscription *message.Subscription) {
+	if err := s.Unsubscribe(context.Background(), subscription.MediaStreamIds); err != nil {
+		slog.Error("sessions: unsubscribe", "err", err, "sessionId", s.Id, "user", s.user)
+	}
+}
+
+// SetLastN
+// Limits the video of the egress client to the count most recently active speakers, the audio is always sent.
+// A count of 0 disables Last-N for this client, a negative count uses the setting of the lobby.
+func (s *Session) SetLastN(ctx context.Context, count int) error {
+	ctx, span := s.trace(ctx, "set_last_n")
+	defer span.End()
+	span.SetAttributes(attribute.Int("lastN", count))
+	if s.isDone() {
+		return telemetry.RecordError(span, ErrSessionAlreadyClosed)
+	}
+	if count > maxLastN {
+		return telemetry.RecordError(span, ErrInvalidLastN)
+	}
+	s.subscription.setLastN(count)
+	s.hub.DispatchSubscriptionChanged(ctx, s.Id)
+	return nil
+}
+
+func (s *Session) onLastN(lastN *message.LastN) {
+	if err := s.SetLastN(context.Background(), lastN.Count); err != nil {
+		slog.Warn("sessions: set last-n", "err", err, "sessionId", s.Id, "user", s.user, "count", lastN.Count)
+	}
+}
+
+// getEgressTrackList returns the tracks an egress endpoint sends directly after it is established.
+// With Last-N the video tracks are sent by the video slots, they are filled afterwards.
+func (s *Session) getEgressTrackList(ctx context.Context, sessionId uuid.UUID) ([]*rtp.TrackInfo, error) {
+	hub := s.hub
+	list, err := hub.getTrackList(ctx, sessionId, filterForSession(sessionId), filterForInstance(s), filterForSubscription(s.subscription), filterForLastN(hub, s))
+	if err == nil && hub.lastNOf(s) > 0 {
+		go func() {
+			// the session is locked until the egress endpoint is established, the Hub skips sessions in this state
+			s.mutex.RLock()
+			s.mutex.RUnlock()
+			hub.dispatchVideoSlotsRefresh(context.Background(), sessionId)
+		}()
+	}
+	return list, err
+}
+
+func (s *Session) assignVideoSlots(ctx context.Context, tracks []*rtp.TrackInfo) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.egress == nil {
+		return
+	}
+	ctx, span := s.trace(ctx, "egress_assign_video_slots")
+	defer span.End()
+	s.egress.AssignVideoSlots(ctx, tracks)
+}
+
+func (s *Session) releaseVideoSlots(ctx context.Context) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.egress == nil {
+		return
+	}
+	s.egress.ReleaseVideoSlots(ctx)
+}
+
+// onSlotMapping is called by the egress endpoint, while its slots are locked
+func (s *Session) onSlotMapping(mapping rtp.TrackSlotMapping) {
+	go s.sendTrackSlots(context.Background(), mapping)
+}
+
+func (s *Session) sendTrackSlots(ctx context.Context, mapping rtp.TrackSlotMapping) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, span := s.trace(ctx, "egress_track_slots_event")
+	defer span.End()
+
+	if s.signal.messenger == nil {
+		return
+	}
+	trackSlots := &message.TrackSlots{Revision: mapping.Revision, Slots: make([]*message.TrackSlot, 0, len(mapping.Slots))}
+	for _, slot := range mapping.Slots {
+		trackSlots.Slots = append(trackSlots.Slots, toTrackSlotMessage(slot))
+	}
+	if err := s.signal.messenger.SendTrackSlots(trackSlots); err != nil {
+		slog.Error("sessions: send track slots", "err", err, "sessionId", s.Id, "user", s.user)
+	}
+	span.AddEvent("Send Track Slots to Client")
+}
+
+func toTrackSlotMessage(slot rtp.TrackSlotInfo) *message.TrackSlot {
+	trackSlot := &message.TrackSlot{TrackId: slot.TrackId, Kind: slot.Kind, MediaStreamId: slot.MediaStreamId, Mute: slot.Mute}
+	if len(slot.MediaStreamId) > 0 {
+		trackSlot.Purpose = slot.Purpose.ToString()
+	}
+	return trackSlot
+}
+
+// updateVideoQuality applies the max video quality of the subscription to the layers of the egress tracks
+func (s *Session) updateVideoQuality(ctx context.Context) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.egress != nil {
+		s.egress.UpdateVideoQuality(ctx)
+	}
+}
+
+func (s *Session) egressHasTrack(trackInfo *rtp.TrackInfo) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.egress != nil && s.egress.HasTrack(trackInfo.GetTrackLocal())
+}
+
+// ChangeMediaStreamPurpose
+// Changes the purpose of a media stream in the lobby, for example to promote a guest stream to the main stream.
+func (s *Session) ChangeMediaStreamPurpose(ctx context.Context, mediaStreamId string, purpose rtp.Purpose) error {
+	ctx, span := s.trace(ctx, "change_media_stream_purpose")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("mediaStreamId", mediaStreamId),
+		attribute.String("purpose", purpose.ToString()),
+	)
+	if s.isDone() {
+		return telemetry.RecordError(span, ErrSessionAlreadyClosed)
+	}
+
+	if err := s.hub.DispatchChangePurpose(ctx, mediaStreamId, purpose); err != nil {
+		return telemetry.RecordErrorf(span, "dispatch change purpose", err)
+	}
+	return nil
+}
+
+func (s *Session) changeTrackPurpose(ctx context.Context, trackInfos []*rtp.TrackInfo) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ctx, span := s.trace(ctx, "change_track_purpose_event")
+	defer span.End()
+
+	if s.egress == nil {
+		return
+	}
+	// the Hub keeps the purpose of the published tracks, only the egress sdp has to follow
+	updateEgress := false
+	for _, trackInfo := range trackInfos {
+		if _, ok := s.egress.SetPurpose(trackInfo.GetId(), trackInfo.GetPurpose()); ok {
+			updateEgress = true
+		}
+	}
+
+	// the purpose is part of the egress sdp, so the client needs a new offer
+	if updateEgress {
+		s.egress.Renegotiate()
+		span.AddEvent("Renegotiate Egress")
+	}
+}
+
 func (s *Session) isDone() bool {
 	select {
 	case <-s.ctx.Done():
@@ -384,6 +839,21 @@ func (s *Session) isDone() bool {
 	}
 }
 
+// Stop closes the session and its endpoints, the session is not removed from the lobby
+func (s *Session) Stop() {
+	s.stop()
+}
+
+// IsConnected reports whether ICE and DTLS of the ingress and the egress endpoint of the session are connected
+func (s *Session) IsConnected() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.isDone() || s.ingress == nil || s.egress == nil {
+		return false
+	}
+	return s.ingress.IsConnected() && s.egress.IsConnected()
+}
+
 func (s *Session) getType() SessionType {
 	return s.sessionType
 }
@@ -404,10 +874,38 @@ func (s *Session) initComplete() bool {
 	return false
 }
 
+// SetEgressAnswer sets the answer of the other server to the offer of the egress endpoint.
+// The returned channel is closed when the answer is set.
 func (s *Session) SetEgressAnswer(answer *webrtc.SessionDescription) chan struct{} {
-	return make(chan struct{})
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	done := make(chan struct{})
+	defer close(done)
+	if s.egress == nil {
+		return done
+	}
+	if err := s.egress.SetAnswer(answer); err != nil {
+		slog.Error("sessions: set egress answer", "err", err, "sessionId", s.Id, "user", s.user)
+		return done
+	}
+	s.egress.SetInitComplete()
+	return done
 }
 
+// SetIngressAnswer sets the answer of the other server to the offer of the ingress endpoint.
+// The returned channel is closed when the answer is set.
 func (s *Session) SetIngressAnswer(answer *webrtc.SessionDescription) chan struct{} {
-	return make(chan struct{})
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	done := make(chan struct{})
+	defer close(done)
+	if s.ingress == nil {
+		return done
+	}
+	if err := s.ingress.SetAnswer(answer); err != nil {
+		slog.Error("sessions: set ingress answer", "err", err, "sessionId", s.Id, "user", s.user)
+		return done
+	}
+	s.ingress.SetInitComplete()
+	return done
 }
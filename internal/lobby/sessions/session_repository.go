@@ -97,12 +97,13 @@ func (r *SessionRepository) Len() int {
 	return len(r.sessions)
 }
 
+// LenUserSession counts the sessions of users directly connected to this instance, publishers and viewers
 func (r *SessionRepository) LenUserSession() int {
 	r.locker.Lock()
 	defer r.locker.Unlock()
 	count := 0
 	for _, session := range r.sessions {
-		if session.sessionType == UserSession {
+		if session.sessionType == UserSession || session.sessionType == ViewerSession {
 			count = count + 1
 		}
 	}
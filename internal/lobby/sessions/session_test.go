@@ -3,11 +3,13 @@ package sessions
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/shigde/sfu/internal/lobby/mocks"
 	"github.com/shigde/sfu/internal/logging"
+	"github.com/shigde/sfu/pkg/message"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -101,6 +103,15 @@ func TestSession_CreateEgressEndpoint(t *testing.T) {
 		assert.ErrorIs(t, err, ErrNoSignalChannel)
 	})
 
+	t.Run("viewer session without ingress endpoint", func(t *testing.T) {
+		session, _ := testSessionSetup(t)
+		session.sessionType = ViewerSession
+
+		answer, err := session.CreateEgressEndpoint(context.Background(), mocks.Offer, UnidirectionalSignalChannel)
+		assert.NoError(t, err)
+		assert.Equal(t, mocks.Answer, answer)
+	})
+
 	t.Run("if no signal messanger", func(t *testing.T) {
 		session, engine := testSessionSetup(t)
 		session.ingress = mocks.NewEndpoint(nil)
@@ -140,3 +151,61 @@ func TestSession_CreateEgressEndpoint(t *testing.T) {
 		assert.Equal(t, mocks.Answer, answer)
 	})
 }
+
+func TestSession_OfferEndpoint(t *testing.T) {
+	t.Run("bidirectional signal channel makes the connecting session polite", func(t *testing.T) {
+		session, _ := testSessionSetup(t)
+
+		_, err := session.OfferIngressEndpoint(context.Background(), BidirectionalSignalChannel)
+		assert.NoError(t, err)
+		assert.True(t, session.signal.polite.Load())
+		assert.Len(t, session.signal.negotiationOptions(), 1)
+	})
+
+	t.Run("unidirectional signal channel keeps the session impolite", func(t *testing.T) {
+		session, _ := testSessionSetup(t)
+
+		_, err := session.OfferIngressEndpoint(context.Background(), UnidirectionalSignalChannel)
+		assert.NoError(t, err)
+		assert.False(t, session.signal.polite.Load())
+		assert.Empty(t, session.signal.negotiationOptions())
+	})
+
+	t.Run("setting the answer does not block", func(t *testing.T) {
+		session, _ := testSessionSetup(t)
+		session.ingress = mocks.NewEndpoint(mocks.Answer)
+
+		<-session.SetIngressAnswer(mocks.Answer)
+		<-session.SetEgressAnswer(mocks.Answer)
+	})
+}
+
+func TestSession_ValidMetadata(t *testing.T) {
+	t.Run("accept metadata with web urls", func(t *testing.T) {
+		metadata := &message.Metadata{MediaStreamId: "stream", DisplayName: "Alice", AvatarUrl: "https://example.org/alice.png", ActorIri: "https://example.org/users/alice"}
+		assert.True(t, validMetadata(metadata))
+	})
+
+	t.Run("accept metadata without urls", func(t *testing.T) {
+		assert.True(t, validMetadata(&message.Metadata{MediaStreamId: "stream", DisplayName: "Alice"}))
+	})
+
+	t.Run("drop too long display name", func(t *testing.T) {
+		metadata := &message.Metadata{MediaStreamId: "stream", DisplayName: strings.Repeat("a", maxDisplayNameLength+1)}
+		assert.False(t, validMetadata(metadata))
+	})
+
+	t.Run("drop urls that are no web urls", func(t *testing.T) {
+		assert.False(t, validMetadata(&message.Metadata{MediaStreamId: "stream", AvatarUrl: "javascript:alert(1)"}))
+		assert.False(t, validMetadata(&message.Metadata{MediaStreamId: "stream", ActorIri: "alice"}))
+	})
+
+	t.Run("drop too long url", func(t *testing.T) {
+		metadata := &message.Metadata{MediaStreamId: "stream", AvatarUrl: "https://example.org/" + strings.Repeat("a", maxMetadataUrlLength)}
+		assert.False(t, validMetadata(metadata))
+	})
+
+	t.Run("drop metadata without media stream", func(t *testing.T) {
+		assert.False(t, validMetadata(&message.Metadata{DisplayName: "Alice"}))
+	})
+}
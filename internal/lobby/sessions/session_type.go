@@ -10,4 +10,16 @@ const (
 	InstanceSession
 	// RemoteInstanceSession represents the connection of another Shig instance.
 	RemoteInstanceSession
+	// ViewerSession represents a user directly connected to this instance, who only watches the live stream.
+	// The session has no ingress endpoint, the egress endpoint brings its own signal channel.
+	ViewerSession
+)
+
+// Roles of the sessions, app messages can target them. The server derives the role from the session type and the
+// owner of the live stream.
+const (
+	RoleHost     = "host"
+	RoleGuest    = "guest"
+	RoleViewer   = "viewer"
+	RoleInstance = "instance"
 )
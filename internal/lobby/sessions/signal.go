@@ -26,9 +26,18 @@ type signal struct {
 	offerer           *rtp.Endpoint // The offerer is always an egress endpoint or nil
 	answerer          *rtp.Endpoint // The answerer is always an ingress endpoint or nil
 	onMuteCbk         func(_ *message.Mute)
+	onMetadataCbk     func(_ *message.Metadata)
+	onChatCbk         func(_ *message.Chat)
+	onAppMessageCbk   func(_ *message.AppMessage)
+	onSubscribeCbk    func(_ *message.Subscription)
+	onUnsubscribeCbk  func(_ *message.Subscription)
+	onLastNCbk        func(_ *message.LastN)
+	onEstimateCbk     func(_ *message.Estimate)
 	messenger         *clients.Messenger
 	offerNumber       atomic.Uint32
 	receivedMessenger chan struct{}
+	// on a bidirectional signal channel both peers offer, the polite peer gives way to the offers of the other peer
+	polite atomic.Bool
 }
 
 func newSignal(sessionCtx context.Context, session uuid.UUID, user uuid.UUID) *signal {
@@ -71,7 +80,25 @@ func (s *signal) setOfferer(endpoint *rtp.Endpoint) {
 	s.offerNumber.Store(0)
 }
 
+// setPolite makes this side the polite peer of the negotiation. The peer that connects to the other server is polite.
+func (s *signal) setPolite() {
+	s.polite.Store(true)
+}
+
+// negotiationOptions returns the options for the negotiation role of the endpoints
+func (s *signal) negotiationOptions() []rtp.EndpointOption {
+	if s.polite.Load() {
+		return []rtp.EndpointOption{rtp.EndpointWithPoliteNegotiation()}
+	}
+	return nil
+}
+
 func (s *signal) OnNegotiationNeeded(offer webrtc.SessionDescription) {
+	// the messenger of a viewer session is set up with the data channel of the egress endpoint, after the first offer
+	if err := <-s.waitForMessengerSetupFinished(); err != nil {
+		slog.Error("lobby.sessionEgressHandler: on negotiated without messenger", "err", err, "sessionId", s.session, "user", s.user)
+		return
+	}
 	if _, err := s.messenger.SendOffer(&offer, s.nextOffer()); err != nil {
 		slog.Error("lobby.sessionEgressHandler: on negotiated was trigger with error", "err", err, "sessionId", s.session, "user", s.user)
 	}
@@ -92,34 +119,102 @@ func (s *signal) OnAnswer(sdp *webrtc.SessionDescription, number uint32) {
 	slog.Debug("lobby.signal: onAnswer set", "number", number, "currentNumber", current, "sessionId", s.session, "user", s.user)
 
 	if err := s.offerer.SetAnswer(sdp); err != nil {
+		if errors.Is(err, rtp.ErrNoPendingOffer) {
+			// the polite peer dropped the offer because of an offer collision
+			slog.Debug("lobby.signal: onAnswer ignore answer without offer", "number", number, "sessionId", s.session, "userId", s.user)
+			return
+		}
 		slog.Error("lobby.signal: on answer was trigger with error", "err", err, "sessionId", s.session, "userId", s.user)
 	}
 	s.offerer.SetInitComplete()
 }
 
 func (s *signal) OnOffer(sdp *webrtc.SessionDescription, responseId uint32, number uint32) {
-	slog.Debug("lobby.signal: onAnswer set", "number", number, "sessionId", s.session, "user", s.user)
+	slog.Debug("lobby.signal: onOffer set", "number", number, "sessionId", s.session, "user", s.user)
 
-	if s.answerer == nil {
+	// an endpoint that offers and answers on its own can receive an offer that collides with its own offer
+	answerer := s.answerer
+	if answerer == nil {
+		answerer = s.offerer
+	}
+	if answerer == nil {
 		slog.Warn("lobby.signal: no answerer exists to answer this offer onOffer", "number", number, "sessionId", s.session, "user", s.user)
 		return
 	}
 
-	answer, err := s.answerer.SetNewOffer(sdp)
+	answer, err := answerer.SetNewOffer(sdp)
+	if errors.Is(err, rtp.ErrOfferCollision) {
+		// the impolite peer waits for the answer to its own offer, the polite peer offers its changes again
+		slog.Debug("lobby.signal: onOffer ignore colliding offer", "number", number, "sessionId", s.session, "user", s.user)
+		s.acknowledge(responseId)
+		return
+	}
 	if err != nil {
-		slog.Error("lobby.signal: on answer was trigger with error", "err", err, "sessionId", s.session, "userId", s.user)
+		slog.Error("lobby.signal: on offer was trigger with error", "err", err, "sessionId", s.session, "userId", s.user)
+		// sending the offer again does not help
+		s.acknowledge(responseId)
+		return
 	}
 	if _, err := s.messenger.SendAnswer(answer, responseId, number); err != nil {
 		slog.Error("lobby.signal: on answer was trigger with error", "err", err, "sessionId", s.session, "userId", s.user)
 	}
 }
 
+// acknowledge stops the remote peer from sending an offer again that gets no answer
+func (s *signal) acknowledge(id uint32) {
+	if err := s.messenger.SendAck(id); err != nil {
+		slog.Error("lobby.signal: acknowledge offer", "err", err, "sessionId", s.session, "userId", s.user)
+	}
+}
+
 func (s *signal) OnMute(mute *message.Mute) {
 	if s.onMuteCbk != nil {
 		s.onMuteCbk(mute)
 	}
 }
 
+func (s *signal) OnMetadata(metadata *message.Metadata) {
+	if s.onMetadataCbk != nil {
+		s.onMetadataCbk(metadata)
+	}
+}
+
+func (s *signal) OnChat(chat *message.Chat) {
+	if s.onChatCbk != nil {
+		s.onChatCbk(chat)
+	}
+}
+
+func (s *signal) OnAppMessage(appMessage *message.AppMessage) {
+	if s.onAppMessageCbk != nil {
+		s.onAppMessageCbk(appMessage)
+	}
+}
+
+func (s *signal) OnSubscribe(subscription *message.Subscription) {
+	if s.onSubscribeCbk != nil {
+		s.onSubscribeCbk(subscription)
+	}
+}
+
+func (s *signal) OnUnsubscribe(subscription *message.Subscription) {
+	if s.onUnsubscribeCbk != nil {
+		s.onUnsubscribeCbk(subscription)
+	}
+}
+
+func (s *signal) OnLastN(lastN *message.LastN) {
+	if s.onLastNCbk != nil {
+		s.onLastNCbk(lastN)
+	}
+}
+
+func (s *signal) OnEstimate(estimate *message.Estimate) {
+	if s.onEstimateCbk != nil {
+		s.onEstimateCbk(estimate)
+	}
+}
+
 func (s *signal) nextOffer() uint32 {
 	return s.offerNumber.Add(1)
 }
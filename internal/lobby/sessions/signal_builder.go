@@ -17,7 +17,9 @@ and will renegotiate changes. For this, the egress endpoint needs a signal chann
 
 Additionally, in a user-server connection, the user is always static. The user will never change their
 connection status. If a user changes their media, they reconnect. It's different in a server-server connection.
-Here, both parties renegotiate their connection.
+Here, both parties renegotiate their connection. If both offers cross, the peers follow the perfect negotiation:
+the server that connects to the other one is polite. It drops its own offer, answers the remote offer and offers its
+changes again. The other server is impolite and ignores the colliding offer.
 
 A) User - Server Scenario:
 ==========================
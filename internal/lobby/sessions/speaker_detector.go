@@ -0,0 +1,134 @@
+package sessions
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// audio levels above the noise level (quieter than -70 dBov) are treated as silence
+	speakerNoiseLevel uint8 = 70
+	// weight of the previous intervals in the smoothed speaker score
+	speakerScoreSmoothing = 0.6
+	// a speaker needs at least this score to become the dominant speaker
+	minSpeakerScore = 5.0
+	// the challenger has to be clearly louder than the current speaker
+	speakerSwitchRatio = 1.3
+	// holds the current speaker for a while, so short interjections do not switch the speaker
+	minSpeakerSwitchInterval = time.Second
+)
+
+// speakerDetector finds the dominant speaker of a lobby by the audio levels of the ingress audio tracks.
+// The audio levels arrive with every rtp packet, that's why the detector is synchronized by itself
+// and not by the request channel of the Hub.
+type speakerDetector struct {
+	mu      sync.Mutex
+	streams map[string]*speakerStats // mediaStreamId --> audio level statistics
+	// the last time a media stream had a speaker score, used for the Last-N ranking
+	lastActive map[string]time.Time
+	current    string
+	changed    time.Time
+	// the current speaker was removed and the change is not announced yet
+	removed bool
+}
+
+type speakerStats struct {
+	loudness int // sum of the loudness of the current interval
+	packets  int
+	score    float64
+}
+
+func newSpeakerDetector() *speakerDetector {
+	return &speakerDetector{
+		streams:    make(map[string]*speakerStats),
+		lastActive: make(map[string]time.Time),
+	}
+}
+
+// observe adds the audio level of a rtp packet, 0 is the loudest and 127 the quietest level (-dBov)
+func (d *speakerDetector) observe(mediaStreamId string, level uint8) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats, ok := d.streams[mediaStreamId]
+	if !ok {
+		stats = &speakerStats{}
+		d.streams[mediaStreamId] = stats
+	}
+	stats.packets++
+	if level < speakerNoiseLevel {
+		stats.loudness += int(speakerNoiseLevel - level)
+	}
+}
+
+// remove forgets a media stream, if it was the current speaker the next detection announces the change
+func (d *speakerDetector) remove(mediaStreamId string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.streams, mediaStreamId)
+	delete(d.lastActive, mediaStreamId)
+	if d.current == mediaStreamId && len(d.current) > 0 {
+		d.current = ""
+		d.removed = true
+	}
+}
+
+// detect closes the current interval and returns the dominant speaker. Changed is true if the speaker has switched.
+// The last speaker stays dominant during silence, so the layout of the lobby does not jump around.
+func (d *speakerDetector) detect(now time.Time) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed := d.removed
+	d.removed = false
+
+	candidate := ""
+	candidateScore := 0.0
+	for mediaStreamId, stats := range d.streams {
+		average := 0.0
+		if stats.packets > 0 {
+			average = float64(stats.loudness) / float64(stats.packets)
+		}
+		stats.score = stats.score*speakerScoreSmoothing + average*(1-speakerScoreSmoothing)
+		// streams without packets, like muted ones, fade out and are forgotten
+		if stats.packets == 0 && stats.score < minSpeakerScore && mediaStreamId != d.current {
+			delete(d.streams, mediaStreamId)
+			continue
+		}
+		stats.loudness, stats.packets = 0, 0
+		if stats.score >= minSpeakerScore {
+			d.lastActive[mediaStreamId] = now
+		}
+		if stats.score > candidateScore {
+			candidate, candidateScore = mediaStreamId, stats.score
+		}
+	}
+
+	if candidate == "" || candidate == d.current || candidateScore < minSpeakerScore {
+		return d.current, changed
+	}
+
+	if current, ok := d.streams[d.current]; ok && current.score >= minSpeakerScore {
+		if candidateScore < current.score*speakerSwitchRatio || now.Sub(d.changed) < minSpeakerSwitchInterval {
+			return d.current, changed
+		}
+	}
+	d.current = candidate
+	d.changed = now
+	return d.current, true
+}
+
+// activity returns when the media streams have been speaking the last time
+func (d *speakerDetector) activity() map[string]time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	activity := make(map[string]time.Time, len(d.lastActive))
+	for mediaStreamId, lastActive := range d.lastActive {
+		activity[mediaStreamId] = lastActive
+	}
+	return activity
+}
+
+func (d *speakerDetector) dominant() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.current
+}
@@ -0,0 +1,90 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSpeakerInterval(d *speakerDetector, levels map[string]uint8) {
+	for mediaStreamId, level := range levels {
+		for i := 0; i < 15; i++ {
+			d.observe(mediaStreamId, level)
+		}
+	}
+}
+
+func TestSpeakerDetector(t *testing.T) {
+	t.Run("loudest stream becomes the dominant speaker", func(t *testing.T) {
+		d := newSpeakerDetector()
+		testSpeakerInterval(d, map[string]uint8{"alice": 30, "bob": 60})
+
+		speaker, changed := d.detect(time.Now())
+
+		assert.True(t, changed)
+		assert.Equal(t, "alice", speaker)
+	})
+
+	t.Run("silence does not make a speaker", func(t *testing.T) {
+		d := newSpeakerDetector()
+		testSpeakerInterval(d, map[string]uint8{"alice": 127, "bob": 90})
+
+		speaker, changed := d.detect(time.Now())
+
+		assert.False(t, changed)
+		assert.Empty(t, speaker)
+	})
+
+	t.Run("short interjection does not switch the speaker", func(t *testing.T) {
+		d := newSpeakerDetector()
+		now := time.Now()
+		testSpeakerInterval(d, map[string]uint8{"alice": 30, "bob": 127})
+		_, _ = d.detect(now)
+
+		testSpeakerInterval(d, map[string]uint8{"alice": 30, "bob": 5})
+		speaker, changed := d.detect(now.Add(300 * time.Millisecond))
+
+		assert.False(t, changed)
+		assert.Equal(t, "alice", speaker)
+	})
+
+	t.Run("switch speaker when the other one talks for a while", func(t *testing.T) {
+		d := newSpeakerDetector()
+		now := time.Now()
+		testSpeakerInterval(d, map[string]uint8{"alice": 30, "bob": 127})
+		_, _ = d.detect(now)
+
+		var speaker string
+		for i := 1; i <= 5; i++ {
+			testSpeakerInterval(d, map[string]uint8{"alice": 127, "bob": 30})
+			speaker, _ = d.detect(now.Add(time.Duration(i) * 300 * time.Millisecond))
+		}
+
+		assert.Equal(t, "bob", speaker)
+	})
+
+	t.Run("last speaker stays during silence", func(t *testing.T) {
+		d := newSpeakerDetector()
+		now := time.Now()
+		testSpeakerInterval(d, map[string]uint8{"alice": 30})
+		_, _ = d.detect(now)
+
+		speaker, changed := d.detect(now.Add(5 * time.Second))
+
+		assert.False(t, changed)
+		assert.Equal(t, "alice", speaker)
+	})
+
+	t.Run("removed speaker is announced", func(t *testing.T) {
+		d := newSpeakerDetector()
+		testSpeakerInterval(d, map[string]uint8{"alice": 30})
+		_, _ = d.detect(time.Now())
+
+		d.remove("alice")
+		speaker, changed := d.detect(time.Now())
+
+		assert.True(t, changed)
+		assert.Empty(t, speaker)
+	})
+}
@@ -0,0 +1,90 @@
+package sessions
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/rtp"
+)
+
+// subscription is the set of media streams an egress client wants to receive.
+// As long as a client has never subscribed, it receives all media streams of the lobby.
+type subscription struct {
+	mutex     sync.RWMutex
+	selective bool
+	streams   map[string]rtp.VideoQuality // mediaStreamId --> max quality
+	lastN     int                         // video of the N most recently active speakers, negative for the lobby setting
+}
+
+func newSubscription() *subscription {
+	return &subscription{
+		streams: make(map[string]rtp.VideoQuality),
+		lastN:   -1,
+	}
+}
+
+func (s *subscription) subscribe(mediaStreamIds []string, maxQuality rtp.VideoQuality) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.selective = true
+	for _, id := range mediaStreamIds {
+		s.streams[id] = maxQuality
+	}
+}
+
+func (s *subscription) unsubscribe(mediaStreamIds []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.selective = true
+	for _, id := range mediaStreamIds {
+		delete(s.streams, id)
+	}
+}
+
+// setLastN overrides the Last-N setting of the lobby for this client, a negative count resets the override
+func (s *subscription) setLastN(count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastN = max(count, -1)
+}
+
+// getLastN returns the Last-N count of the client and false if the client uses the setting of the lobby
+func (s *subscription) getLastN() (int, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.lastN, s.lastN >= 0
+}
+
+// maxQuality returns the max video quality of a media stream, that the client wants to receive
+func (s *subscription) maxQuality(mediaStreamId string) rtp.VideoQuality {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if !s.selective {
+		return rtp.VideoQuality_HIGH
+	}
+	if quality, ok := s.streams[mediaStreamId]; ok {
+		return quality
+	}
+	return rtp.VideoQuality_OFF
+}
+
+// accepts checks if the client wants to receive the track.
+// Audio tracks are received for each subscribed media stream, video tracks only if the max quality is not off.
+func (s *subscription) accepts(track *rtp.TrackInfo) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if !s.selective {
+		return true
+	}
+	quality, ok := s.streams[track.GetTrackLocal().StreamID()]
+	if !ok {
+		return false
+	}
+	return track.GetTrackLocal().Kind() != webrtc.RTPCodecTypeVideo || quality != rtp.VideoQuality_OFF
+}
+
+func filterForSubscription(sub *subscription) filterHubTracks {
+	return func(track *rtp.TrackInfo) bool {
+		return sub.accepts(track)
+	}
+}
@@ -0,0 +1,65 @@
+package sessions
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSubscriptionTrackSetup(t *testing.T, mimeType string, streamId string) *rtp.TrackInfo {
+	t.Helper()
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: mimeType}, uuid.NewString(), streamId)
+	assert.NoError(t, err)
+	return &rtp.TrackInfo{Track: track}
+}
+
+func TestSubscription(t *testing.T) {
+	t.Run("accept all tracks without subscription", func(t *testing.T) {
+		sub := newSubscription()
+		video := testSubscriptionTrackSetup(t, webrtc.MimeTypeVP8, "stream")
+		assert.True(t, sub.accepts(video))
+		assert.Equal(t, rtp.VideoQuality_HIGH, sub.maxQuality("stream"))
+	})
+
+	t.Run("accept only subscribed media streams", func(t *testing.T) {
+		sub := newSubscription()
+		sub.subscribe([]string{"a"}, rtp.VideoQuality_LOW)
+		assert.True(t, sub.accepts(testSubscriptionTrackSetup(t, webrtc.MimeTypeVP8, "a")))
+		assert.False(t, sub.accepts(testSubscriptionTrackSetup(t, webrtc.MimeTypeVP8, "b")))
+		assert.Equal(t, rtp.VideoQuality_LOW, sub.maxQuality("a"))
+		assert.Equal(t, rtp.VideoQuality_OFF, sub.maxQuality("b"))
+	})
+
+	t.Run("accept only audio if video quality is off", func(t *testing.T) {
+		sub := newSubscription()
+		sub.subscribe([]string{"a"}, rtp.VideoQuality_OFF)
+		assert.True(t, sub.accepts(testSubscriptionTrackSetup(t, webrtc.MimeTypeOpus, "a")))
+		assert.False(t, sub.accepts(testSubscriptionTrackSetup(t, webrtc.MimeTypeVP8, "a")))
+	})
+
+	t.Run("unsubscribe media stream", func(t *testing.T) {
+		sub := newSubscription()
+		sub.subscribe([]string{"a", "b"}, rtp.VideoQuality_HIGH)
+		sub.unsubscribe([]string{"a"})
+		assert.False(t, sub.accepts(testSubscriptionTrackSetup(t, webrtc.MimeTypeOpus, "a")))
+		assert.True(t, sub.accepts(testSubscriptionTrackSetup(t, webrtc.MimeTypeOpus, "b")))
+	})
+
+	t.Run("Last-N falls back to the lobby default", func(t *testing.T) {
+		sub := newSubscription()
+		_, ok := sub.getLastN()
+		assert.False(t, ok)
+
+		sub.setLastN(4)
+		lastN, ok := sub.getLastN()
+		assert.True(t, ok)
+		assert.Equal(t, 4, lastN)
+
+		sub.setLastN(-5)
+		_, ok = sub.getLastN()
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,37 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/shigde/sfu/internal/lobby"
+	"github.com/shigde/sfu/internal/stream"
+	"github.com/shigde/sfu/pkg/message"
+)
+
+func getChatHistory(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		liveStream, _, err := getLiveStream(r, streamService)
+		if err != nil {
+			handleResourceError(w, err)
+			return
+		}
+
+		chatList, err := liveService.GetChatHistory(r.Context(), liveStream)
+		// If nobody is in the lobby, there is no chat
+		if errors.Is(err, lobby.ErrLobbyNotActive) {
+			chatList = make([]*message.Chat, 0)
+			err = nil
+		}
+		if err != nil {
+			httpError(w, "error get chat history", http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(chatList); err != nil {
+			httpError(w, "chat history invalid", http.StatusInternalServerError, err)
+		}
+	}
+}
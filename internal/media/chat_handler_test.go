@@ -0,0 +1,22 @@
+package media
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetChatHistoryReq(t *testing.T) {
+	th, space, liveStream, _, bearer := testRouterSetup(t)
+
+	req := newJsonContentRequest("GET", fmt.Sprintf("/space/%s/stream/%s/chat", space.Identifier, liveStream.UUID.String()), nil, bearer)
+	rr := httptest.NewRecorder()
+	th.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	wanted := `[{"id":"d8c1a5f2-0a55-4d7a-9d52-2f1b9f1b5c11","user":"a64365db-174d-4d11-8cb1-eb2a3639ffe6","text":"Hello","time":"2024-01-01T12:00:00Z"}]` + "\n"
+	assert.Equal(t, wanted, rr.Body.String())
+}
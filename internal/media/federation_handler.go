@@ -0,0 +1,35 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/shigde/sfu/internal/lobby"
+	"github.com/shigde/sfu/internal/stream"
+)
+
+func getFederationStatus(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// the federation status shows the host instance of the live stream, only the owner may see it
+		liveStream, _, err := readingRequestData(w, r, streamService)
+		if err != nil {
+			return
+		}
+
+		status, err := liveService.GetFederationStatus(r.Context(), liveStream)
+		if errors.Is(err, lobby.ErrLobbyNotActive) {
+			httpError(w, "lobby not active", http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			httpError(w, "error get federation status", http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			httpError(w, "federation status invalid", http.StatusInternalServerError, err)
+		}
+	}
+}
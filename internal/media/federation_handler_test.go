@@ -0,0 +1,38 @@
+package media
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shigde/sfu/internal/media/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFederationStatusReq(t *testing.T) {
+	t.Run("Request federation status, but have no active web session", func(t *testing.T) {
+		th, space, liveStream, _, bearer := testRouterSetup(t)
+
+		req := newJsonContentRequest("GET", fmt.Sprintf("/space/%s/stream/%s/federation", space.Identifier, liveStream.UUID.String()), nil, bearer)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Request federation status", func(t *testing.T) {
+		th, space, liveStream, _, bearer := testRouterSetup(t)
+		sessionCookie, reqToken := runWhipRequest(t, th.router, space.Identifier, liveStream.UUID.String(), bearer)
+
+		req := newJsonContentRequest("GET", fmt.Sprintf("/space/%s/stream/%s/federation", space.Identifier, liveStream.UUID.String()), nil, bearer)
+		req.AddCookie(sessionCookie)
+		req.Header.Set(mocks.ReqTokenHeaderName, reqToken)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		wanted := `{"host":"shig@host.org","state":"connected","attempts":0,"reconnects":1,"since":"2024-01-01T12:00:00Z"}` + "\n"
+		assert.Equal(t, wanted, rr.Body.String())
+	})
+}
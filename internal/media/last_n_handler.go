@@ -0,0 +1,54 @@
+package media
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shigde/sfu/internal/lobby"
+	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/internal/stream"
+)
+
+func setLastN(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		liveStream, _, err := readingRequestData(w, r, streamService)
+		if err != nil {
+			return
+		}
+
+		lobbyLastN, err := getLobbyLastNPayload(w, r)
+		if err != nil {
+			httpError(w, "invalid payload", http.StatusBadRequest, err)
+			return
+		}
+
+		if err := liveService.SetLastN(r.Context(), liveStream, lobbyLastN); err != nil {
+			switch {
+			case errors.Is(err, sessions.ErrInvalidLastN):
+				httpError(w, "invalid last-n", http.StatusBadRequest, err)
+			case errors.Is(err, lobby.ErrLobbyNotActive):
+				httpError(w, "lobby not active", http.StatusNotFound, err)
+			default:
+				httpError(w, "error set last-n", http.StatusInternalServerError, err)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func getLobbyLastNPayload(w http.ResponseWriter, r *http.Request) (*stream.LobbyLastN, error) {
+	dec, err := getJsonPayload(w, r)
+	if err != nil {
+		return nil, err
+	}
+	lobbyLastN := &stream.LobbyLastN{}
+	if err := dec.Decode(lobbyLastN); err != nil {
+		return nil, invalidPayload
+	}
+	if lobbyLastN.LastN < 0 {
+		return nil, invalidPayload
+	}
+	return lobbyLastN, nil
+}
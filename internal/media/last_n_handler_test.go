@@ -0,0 +1,53 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shigde/sfu/internal/media/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLastNReq(t *testing.T) {
+	t.Run("Request to set last-n, but have no active web session", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		body := bytes.NewBuffer([]byte(`{"lastN":4}`))
+
+		req := newJsonContentRequest("PUT", fmt.Sprintf("/space/%s/stream/%s/last-n", space.Identifier, stream.UUID.String()), body, bearer)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Request with negative last-n", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		sessionCookie, reqToken := runWhipRequest(t, th.router, space.Identifier, stream.UUID.String(), bearer)
+		body := bytes.NewBuffer([]byte(`{"lastN":-1}`))
+
+		req := newJsonContentRequest("PUT", fmt.Sprintf("/space/%s/stream/%s/last-n", space.Identifier, stream.UUID.String()), body, bearer)
+		req.AddCookie(sessionCookie)
+		req.Header.Set(mocks.ReqTokenHeaderName, reqToken)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Request to set last-n", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		sessionCookie, reqToken := runWhipRequest(t, th.router, space.Identifier, stream.UUID.String(), bearer)
+		body := bytes.NewBuffer([]byte(`{"lastN":4}`))
+
+		req := newJsonContentRequest("PUT", fmt.Sprintf("/space/%s/stream/%s/last-n", space.Identifier, stream.UUID.String()), body, bearer)
+		req.AddCookie(sessionCookie)
+		req.Header.Set(mocks.ReqTokenHeaderName, reqToken)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
@@ -108,3 +108,25 @@ func readingRequestData(w http.ResponseWriter, r *http.Request, streamService *s
 	}
 	return liveStream, userId, nil
 }
+
+// readingParticipantRequestData reads the live stream and the user, but unlike readingRequestData,
+// the user does not need to be the owner of the live stream.
+func readingParticipantRequestData(w http.ResponseWriter, r *http.Request, streamService *stream.LiveStreamService) (*stream.LiveStream, uuid.UUID, error) {
+	liveStream, _, err := getLiveStream(r, streamService)
+	if err != nil {
+		handleResourceError(w, err)
+		return nil, uuid.Nil, err
+	}
+
+	user, err := getUserFromSession(w, r)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	userId, err := user.GetUuid()
+	if err != nil {
+		httpError(w, "internal error", http.StatusInternalServerError, err)
+		return nil, uuid.Nil, err
+	}
+	return liveStream, userId, nil
+}
@@ -40,6 +40,18 @@ func (l *testLobbyManager) NewEgressResource(_ context.Context, _ uuid.UUID, _ u
 	return nil, nil
 }
 
+func (l *testLobbyManager) NewViewerResource(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ *webrtc.SessionDescription, _ ...resources.Option) (*resources.WebRTC, error) {
+	return nil, nil
+}
+
+func (l *testLobbyManager) NewAudienceResource(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ *webrtc.SessionDescription) (*resources.WebRTC, error) {
+	return nil, nil
+}
+
+func (l *testLobbyManager) RemoveAudienceResource(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ uuid.UUID) (bool, error) {
+	return false, nil
+}
+
 // old API
 func (l *testLobbyManager) CreateLobbyIngressEndpoint(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ *webrtc.SessionDescription) (struct {
 	Answer       *webrtc.SessionDescription
@@ -6,7 +6,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
 
+	"github.com/shigde/sfu/internal/lobby/federation"
 	"github.com/shigde/sfu/internal/lobby/resources"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/pkg/message"
 )
 
 type LobbyManagerMock struct {
@@ -30,6 +33,24 @@ func (l *LobbyManagerMock) NewEgressResource(_ context.Context, _ uuid.UUID, _ u
 	}, nil
 }
 
+func (l *LobbyManagerMock) NewViewerResource(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ *webrtc.SessionDescription, _ ...resources.Option) (*resources.WebRTC, error) {
+	return &resources.WebRTC{
+		Id:  ResourceID,
+		SDP: &webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: Answer},
+	}, nil
+}
+
+func (l *LobbyManagerMock) NewAudienceResource(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ *webrtc.SessionDescription) (*resources.WebRTC, error) {
+	return &resources.WebRTC{
+		Id:  ResourceID,
+		SDP: &webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: Answer},
+	}, nil
+}
+
+func (l *LobbyManagerMock) RemoveAudienceResource(_ context.Context, _ uuid.UUID, _ uuid.UUID, viewerId uuid.UUID) (bool, error) {
+	return viewerId.String() == ResourceID, nil
+}
+
 // old API
 func (l *LobbyManagerMock) CreateLobbyIngressEndpoint(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ *webrtc.SessionDescription) (struct {
 	Answer       *webrtc.SessionDescription
@@ -97,6 +118,30 @@ func (l *LobbyManagerMock) LeaveLobby(ctx context.Context, liveStreamId uuid.UUI
 	return true, nil
 }
 
+func (l *LobbyManagerMock) ChangeMediaStreamPurpose(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ string, _ rtp.Purpose) error {
+	return nil
+}
+
+func (l *LobbyManagerMock) Subscribe(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ []string, _ rtp.VideoQuality) error {
+	return nil
+}
+
+func (l *LobbyManagerMock) Unsubscribe(_ context.Context, _ uuid.UUID, _ uuid.UUID, _ []string) error {
+	return nil
+}
+
+func (l *LobbyManagerMock) GetChatHistory(_ context.Context, _ uuid.UUID) ([]*message.Chat, error) {
+	return []*message.Chat{ChatMessage}, nil
+}
+
+func (l *LobbyManagerMock) GetFederationStatus(_ context.Context, _ uuid.UUID) (*federation.ConnectorStatus, error) {
+	return FederationStatus, nil
+}
+
+func (l *LobbyManagerMock) SetLastN(_ context.Context, _ uuid.UUID, _ int) error {
+	return nil
+}
+
 func (l *LobbyManagerMock) StartLiveStream(
 	ctx context.Context,
 	liveStreamId uuid.UUID,
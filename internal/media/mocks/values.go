@@ -1,8 +1,12 @@
 package mocks
 
 import (
+	"time"
+
 	"github.com/shigde/sfu/internal/auth"
+	"github.com/shigde/sfu/internal/lobby/federation"
 	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/pkg/message"
 )
 
 const (
@@ -18,7 +22,9 @@ const (
 )
 
 var (
-	SecurityConfig = &auth.SecurityConfig{JWT: JWT, TrustedOrigins: []string{"*"}}
-	RtpConfig      = &rtp.RtpConfig{ICEServer: []rtp.ICEServer{{Urls: []string{"stun:stun.l.google.com:19302"}}}}
-	JWT            = &auth.JwtToken{Enabled: true, Key: "SecretValueReplaceThis", DefaultExpireTime: 604800}
+	SecurityConfig   = &auth.SecurityConfig{JWT: JWT, TrustedOrigins: []string{"*"}}
+	RtpConfig        = &rtp.RtpConfig{ICEServer: []rtp.ICEServer{{Urls: []string{"stun:stun.l.google.com:19302"}}}}
+	JWT              = &auth.JwtToken{Enabled: true, Key: "SecretValueReplaceThis", DefaultExpireTime: 604800}
+	ChatMessage      = &message.Chat{Id: "d8c1a5f2-0a55-4d7a-9d52-2f1b9f1b5c11", User: "a64365db-174d-4d11-8cb1-eb2a3639ffe6", Text: "Hello", Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	FederationStatus = &federation.ConnectorStatus{Host: "shig@host.org", State: "connected", Reconnects: 1, Since: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
 )
@@ -0,0 +1,59 @@
+package media
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shigde/sfu/internal/lobby"
+	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/internal/stream"
+)
+
+func changeMediaStreamPurpose(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		liveStream, userId, err := readingRequestData(w, r, streamService)
+		if err != nil {
+			return
+		}
+
+		streamPurpose, err := getMediaStreamPurposePayload(w, r)
+		if err != nil {
+			httpError(w, "invalid payload", http.StatusBadRequest, err)
+			return
+		}
+
+		if err := liveService.ChangeMediaStreamPurpose(r.Context(), liveStream, streamPurpose, userId); err != nil {
+			switch {
+			case errors.Is(err, rtp.ErrUnknownPurpose):
+				httpError(w, "invalid purpose", http.StatusBadRequest, err)
+			case errors.Is(err, lobby.ErrLobbyNotActive), errors.Is(err, sessions.ErrMediaStreamNotFound):
+				httpError(w, "media stream not found", http.StatusNotFound, err)
+			case errors.Is(err, sessions.ErrScreenShareLimit):
+				httpError(w, "screen already shared", http.StatusConflict, err)
+			case errors.Is(err, lobby.ErrNoSession):
+				httpError(w, "no lobby session", http.StatusForbidden, err)
+			default:
+				httpError(w, "error change media stream purpose", http.StatusInternalServerError, err)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func getMediaStreamPurposePayload(w http.ResponseWriter, r *http.Request) (*stream.MediaStreamPurpose, error) {
+	dec, err := getJsonPayload(w, r)
+	if err != nil {
+		return nil, err
+	}
+	streamPurpose := &stream.MediaStreamPurpose{}
+	if err := dec.Decode(streamPurpose); err != nil {
+		return nil, invalidPayload
+	}
+	if streamPurpose.MediaStreamId == "" {
+		return nil, invalidPayload
+	}
+	return streamPurpose, nil
+}
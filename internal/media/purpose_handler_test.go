@@ -0,0 +1,53 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shigde/sfu/internal/media/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeMediaStreamPurposeReq(t *testing.T) {
+	t.Run("Request to change purpose, but have no active web session", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		body := bytes.NewBuffer([]byte(`{"mediaStreamId":"abc","purpose":"main"}`))
+
+		req := newJsonContentRequest("PUT", fmt.Sprintf("/space/%s/stream/%s/purpose", space.Identifier, stream.UUID.String()), body, bearer)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Request with unknown purpose", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		sessionCookie, reqToken := runWhipRequest(t, th.router, space.Identifier, stream.UUID.String(), bearer)
+		body := bytes.NewBuffer([]byte(`{"mediaStreamId":"abc","purpose":"unknown"}`))
+
+		req := newJsonContentRequest("PUT", fmt.Sprintf("/space/%s/stream/%s/purpose", space.Identifier, stream.UUID.String()), body, bearer)
+		req.AddCookie(sessionCookie)
+		req.Header.Set(mocks.ReqTokenHeaderName, reqToken)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Request to change purpose", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		sessionCookie, reqToken := runWhipRequest(t, th.router, space.Identifier, stream.UUID.String(), bearer)
+		body := bytes.NewBuffer([]byte(`{"mediaStreamId":"abc","purpose":"main"}`))
+
+		req := newJsonContentRequest("PUT", fmt.Sprintf("/space/%s/stream/%s/purpose", space.Identifier, stream.UUID.String()), body, bearer)
+		req.AddCookie(sessionCookie)
+		req.Header.Set(mocks.ReqTokenHeaderName, reqToken)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
@@ -41,12 +41,21 @@ func NewRouter(
 	router.HandleFunc("/space/setting", auth.Csrf(auth.HttpMiddleware(securityConfig, getSettings(rtpConfig)))).Methods("GET")
 	router.HandleFunc("/space/{space}/stream/{id}/whip", auth.HttpMiddleware(securityConfig, whip(streamService, liveLobbyService))).Methods("POST")
 	router.HandleFunc("/space/{space}/stream/{id}/whep", auth.TokenMiddleware(whep(streamService, liveLobbyService))).Methods("POST")
+	router.HandleFunc("/space/{space}/stream/{id}/view", auth.HttpMiddleware(securityConfig, whepViewer(streamService, liveLobbyService))).Methods("POST")
+	router.HandleFunc("/space/{space}/stream/{id}/audience", auth.HttpMiddleware(securityConfig, whepAudience(streamService, liveLobbyService))).Methods("POST")
+	router.HandleFunc("/space/{space}/stream/{id}/resource/{resourceId}", auth.HttpMiddleware(securityConfig, whepAudienceDelete(streamService, liveLobbyService))).Methods("DELETE")
 	router.HandleFunc("/space/{space}/stream/{id}/res", auth.TokenMiddleware(whipDelete(streamService, liveLobbyService))).Methods("DELETE")
 
 	// RTMP Live Endpoints
 	router.HandleFunc("/space/{space}/stream/{id}/live", auth.TokenMiddleware(publishLiveStream(streamService, liveLobbyService))).Methods("POST")
 	router.HandleFunc("/space/{space}/stream/{id}/live", auth.TokenMiddleware(getStatusOfLiveStream(streamService))).Methods("GET")
 	router.HandleFunc("/space/{space}/stream/{id}/live", auth.TokenMiddleware(stopLiveStream(streamService, liveLobbyService))).Methods("DELETE")
+	router.HandleFunc("/space/{space}/stream/{id}/purpose", auth.TokenMiddleware(changeMediaStreamPurpose(streamService, liveLobbyService))).Methods("PUT")
+	router.HandleFunc("/space/{space}/stream/{id}/subscribe", auth.TokenMiddleware(subscribe(streamService, liveLobbyService))).Methods("POST")
+	router.HandleFunc("/space/{space}/stream/{id}/unsubscribe", auth.TokenMiddleware(unsubscribe(streamService, liveLobbyService))).Methods("POST")
+	router.HandleFunc("/space/{space}/stream/{id}/last-n", auth.TokenMiddleware(setLastN(streamService, liveLobbyService))).Methods("PUT")
+	router.HandleFunc("/space/{space}/stream/{id}/chat", auth.HttpMiddleware(securityConfig, getChatHistory(streamService, liveLobbyService))).Methods("GET")
+	router.HandleFunc("/space/{space}/stream/{id}/federation", auth.TokenMiddleware(getFederationStatus(streamService, liveLobbyService))).Methods("GET")
 
 	// Federartion api endpoints
 	router.HandleFunc("/fed/space/{space}/stream/{id}/whep", auth.HttpMiddleware(securityConfig, fedWhep(streamService, liveLobbyService))).Methods("POST")
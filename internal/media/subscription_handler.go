@@ -0,0 +1,82 @@
+package media
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shigde/sfu/internal/lobby"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/internal/stream"
+)
+
+func subscribe(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		liveStream, userId, err := readingParticipantRequestData(w, r, streamService)
+		if err != nil {
+			return
+		}
+
+		subscription, err := getMediaStreamSubscriptionPayload(w, r)
+		if err != nil {
+			httpError(w, "invalid payload", http.StatusBadRequest, err)
+			return
+		}
+
+		if err := liveService.Subscribe(r.Context(), liveStream, subscription, userId); err != nil {
+			handleSubscriptionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func unsubscribe(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		liveStream, userId, err := readingParticipantRequestData(w, r, streamService)
+		if err != nil {
+			return
+		}
+
+		subscription, err := getMediaStreamSubscriptionPayload(w, r)
+		if err != nil {
+			httpError(w, "invalid payload", http.StatusBadRequest, err)
+			return
+		}
+
+		if err := liveService.Unsubscribe(r.Context(), liveStream, subscription, userId); err != nil {
+			handleSubscriptionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func handleSubscriptionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rtp.ErrUnknownVideoQuality):
+		httpError(w, "invalid max quality", http.StatusBadRequest, err)
+	case errors.Is(err, lobby.ErrLobbyNotActive):
+		httpError(w, "lobby not found", http.StatusNotFound, err)
+	case errors.Is(err, lobby.ErrNoSession):
+		httpError(w, "no lobby session", http.StatusForbidden, err)
+	default:
+		httpError(w, "error change subscription", http.StatusInternalServerError, err)
+	}
+}
+
+func getMediaStreamSubscriptionPayload(w http.ResponseWriter, r *http.Request) (*stream.MediaStreamSubscription, error) {
+	dec, err := getJsonPayload(w, r)
+	if err != nil {
+		return nil, err
+	}
+	subscription := &stream.MediaStreamSubscription{}
+	if err := dec.Decode(subscription); err != nil {
+		return nil, invalidPayload
+	}
+	if len(subscription.MediaStreamIds) == 0 {
+		return nil, invalidPayload
+	}
+	return subscription, nil
+}
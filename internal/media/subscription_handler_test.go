@@ -0,0 +1,55 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shigde/sfu/internal/media/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionReq(t *testing.T) {
+	t.Run("Request to subscribe, but have no active web session", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		body := bytes.NewBuffer([]byte(`{"mediaStreamIds":["abc"],"maxQuality":"LOW"}`))
+
+		req := newJsonContentRequest("POST", fmt.Sprintf("/space/%s/stream/%s/subscribe", space.Identifier, stream.UUID.String()), body, bearer)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Request to subscribe with unknown quality", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		sessionCookie, reqToken := runWhipRequest(t, th.router, space.Identifier, stream.UUID.String(), bearer)
+		body := bytes.NewBuffer([]byte(`{"mediaStreamIds":["abc"],"maxQuality":"ULTRA"}`))
+
+		req := newJsonContentRequest("POST", fmt.Sprintf("/space/%s/stream/%s/subscribe", space.Identifier, stream.UUID.String()), body, bearer)
+		req.AddCookie(sessionCookie)
+		req.Header.Set(mocks.ReqTokenHeaderName, reqToken)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	for _, action := range []string{"subscribe", "unsubscribe"} {
+		t.Run(fmt.Sprintf("Request to %s", action), func(t *testing.T) {
+			th, space, stream, _, bearer := testRouterSetup(t)
+			sessionCookie, reqToken := runWhipRequest(t, th.router, space.Identifier, stream.UUID.String(), bearer)
+			body := bytes.NewBuffer([]byte(`{"mediaStreamIds":["abc"],"maxQuality":"LOW"}`))
+
+			req := newJsonContentRequest("POST", fmt.Sprintf("/space/%s/stream/%s/%s", space.Identifier, stream.UUID.String(), action), body, bearer)
+			req.AddCookie(sessionCookie)
+			req.Header.Set(mocks.ReqTokenHeaderName, reqToken)
+			rr := httptest.NewRecorder()
+			th.router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+}
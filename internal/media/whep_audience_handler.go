@@ -0,0 +1,155 @@
+package media
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/auth"
+	"github.com/shigde/sfu/internal/lobby"
+	"github.com/shigde/sfu/internal/lobby/sessions"
+	"github.com/shigde/sfu/internal/stream"
+	"github.com/shigde/sfu/internal/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// whepAudience adds a viewer to the audience of an active lobby. The viewer receives the main program only and sends no
+// further requests, so unlike the viewer session it needs no web session and no request token.
+func whepAudience(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer(tracerName).Start(r.Context(), "api: whep_audience_create")
+		defer span.End()
+
+		w.Header().Set("Content-Type", "application/sdp")
+
+		liveStream, _, err := getLiveStream(r, streamService)
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			handleResourceError(w, err)
+			return
+		}
+
+		offer, err := getSdpPayload(w, r, webrtc.SDPTypeOffer)
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		user, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			_ = telemetry.RecordError(span, errors.New("no user"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		userId, err := user.GetUuid()
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "error user", http.StatusBadRequest, err)
+			return
+		}
+		// track request meta by otel
+		span.SetAttributes(
+			attribute.String("streamId", liveStream.UUID.String()),
+			attribute.String("userId", userId.String()),
+		)
+
+		answer, resourceId, err := liveService.CreateLobbyAudienceEndpoint(ctx, offer, liveStream, userId)
+		if err != nil && errors.Is(err, lobby.ErrLobbyNotActive) {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "lobby not active", http.StatusNotFound, err)
+			return
+		}
+
+		if err != nil && errors.Is(err, sessions.ErrAudienceFull) {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "audience full", http.StatusServiceUnavailable, err)
+			return
+		}
+
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "error build whep", http.StatusInternalServerError, err)
+			return
+		}
+		span.SetAttributes(attribute.String("viewerId", resourceId))
+
+		response := []byte(answer.SDP)
+		hash := md5.Sum(response)
+
+		w.Header().Set("etag", fmt.Sprintf("%x", hash))
+		w.Header().Set("Location", "resource/"+resourceId)
+		w.Header().Set("Content-Length", strconv.Itoa(len(response)))
+		w.WriteHeader(http.StatusCreated)
+		if _, err = w.Write(response); err != nil {
+			_ = telemetry.RecordError(span, err)
+		}
+	}
+}
+
+// whepAudienceDelete removes a viewer from the audience, the resource is given by the location of the whepAudience response
+func whepAudienceDelete(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer(tracerName).Start(r.Context(), "api: whep_audience_delete")
+		defer span.End()
+
+		liveStream, _, err := getLiveStream(r, streamService)
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			handleResourceError(w, err)
+			return
+		}
+
+		resourceId, ok := mux.Vars(r)["resourceId"]
+		if !ok {
+			_ = telemetry.RecordError(span, errors.New("no resource id"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		user, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			_ = telemetry.RecordError(span, errors.New("no user"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		userId, err := user.GetUuid()
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "error user", http.StatusBadRequest, err)
+			return
+		}
+		span.SetAttributes(
+			attribute.String("streamId", liveStream.UUID.String()),
+			attribute.String("userId", userId.String()),
+			attribute.String("viewerId", resourceId),
+		)
+
+		left, err := liveService.LeaveLobbyAudience(ctx, liveStream, userId, resourceId)
+		if err != nil && errors.Is(err, lobby.ErrLobbyNotActive) {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "lobby not active", http.StatusNotFound, err)
+			return
+		}
+
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "error leave audience", http.StatusBadRequest, err)
+			return
+		}
+
+		if !left {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/shigde/sfu/internal/media/mocks"
 	"github.com/stretchr/testify/assert"
 )
@@ -43,6 +44,55 @@ func TestWhepReq(t *testing.T) {
 	})
 }
 
+func TestWhepViewerReq(t *testing.T) {
+	t.Run("Request WHEP resource as viewer without WHIP", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		offer := []byte(mocks.Offer)
+		body := bytes.NewBuffer(offer)
+
+		req := newSDPContentRequest("POST", fmt.Sprintf("/space/%s/stream/%s/view", space.Identifier, stream.UUID.String()), body, bearer, len(offer))
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, mocks.Answer, rr.Body.String())
+		assert.Equal(t, strconv.Itoa(len([]byte(mocks.Answer))), rr.Header().Get("Content-Length"))
+		assert.Regexp(t, "^session.id=[a-zA-z0-9]+", rr.Header().Get("Set-Cookie"))
+		assert.NotEmpty(t, rr.Header().Get(mocks.ReqTokenHeaderName))
+	})
+}
+
+func TestWhepAudienceReq(t *testing.T) {
+	t.Run("Request WHEP resource as audience viewer", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+		offer := []byte(mocks.Offer)
+		body := bytes.NewBuffer(offer)
+
+		req := newSDPContentRequest("POST", fmt.Sprintf("/space/%s/stream/%s/audience", space.Identifier, stream.UUID.String()), body, bearer, len(offer))
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, mocks.Answer, rr.Body.String())
+		assert.Equal(t, "resource/"+mocks.ResourceID, rr.Header().Get("Location"))
+		assert.Empty(t, rr.Header().Get(mocks.ReqTokenHeaderName))
+	})
+
+	t.Run("Delete the WHEP resource of an audience viewer", func(t *testing.T) {
+		th, space, stream, _, bearer := testRouterSetup(t)
+
+		req := newSDPContentRequest("DELETE", fmt.Sprintf("/space/%s/stream/%s/resource/%s", space.Identifier, stream.UUID.String(), mocks.ResourceID), nil, bearer, 0)
+		rr := httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req = newSDPContentRequest("DELETE", fmt.Sprintf("/space/%s/stream/%s/resource/%s", space.Identifier, stream.UUID.String(), uuid.NewString()), nil, bearer, 0)
+		rr = httptest.NewRecorder()
+		th.router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
 //func TestWhepStaticOfferReq(t *testing.T) {
 //	t.Run("Static WHEP Request without offer", func(t *testing.T) {
 //		th, space, stream, _, bearer := testRouterSetup(t)
@@ -0,0 +1,94 @@
+package media
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/auth"
+	"github.com/shigde/sfu/internal/lobby"
+	"github.com/shigde/sfu/internal/stream"
+	"github.com/shigde/sfu/internal/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// whepViewer starts a viewer session, the viewer only receives the live stream and needs no WHIP connection.
+// Like WHIP, it starts the web session and returns the request token for the following requests of the viewer.
+func whepViewer(streamService *stream.LiveStreamService, liveService *stream.LiveLobbyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer(tracerName).Start(r.Context(), "api: whep_viewer_create")
+		defer span.End()
+
+		w.Header().Set("Content-Type", "application/sdp")
+
+		if err := auth.StartSession(w, r); err != nil {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "error", http.StatusInternalServerError, err)
+			return
+		}
+
+		liveStream, _, err := getLiveStream(r, streamService)
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			handleResourceError(w, err)
+			return
+		}
+
+		offer, err := getSdpPayload(w, r, webrtc.SDPTypeOffer)
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		user, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			_ = telemetry.RecordError(span, errors.New("no user"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		userId, err := user.GetUuid()
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "error user", http.StatusBadRequest, err)
+			return
+		}
+		// track request meta by otel
+		span.SetAttributes(
+			attribute.String("streamId", liveStream.UUID.String()),
+			attribute.String("userId", userId.String()),
+		)
+		auth.SetNewRequestToken(w, user.UUID)
+
+		answer, resourceId, err := liveService.CreateLobbyViewerEndpoint(ctx, offer, liveStream, userId)
+		if err != nil && errors.Is(err, lobby.ErrSessionAlreadyExists) {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "session already exists", http.StatusConflict, err)
+			return
+		}
+
+		if err != nil {
+			_ = telemetry.RecordError(span, err)
+			httpError(w, "error build whep", http.StatusInternalServerError, err)
+			return
+		}
+		span.SetAttributes(attribute.String("sessionId", resourceId))
+
+		response := []byte(answer.SDP)
+		hash := md5.Sum(response)
+
+		w.Header().Set("etag", fmt.Sprintf("%x", hash))
+		w.Header().Set("Location", "resource/"+resourceId)
+		w.Header().Set("Content-Length", strconv.Itoa(len(response)))
+		w.WriteHeader(http.StatusCreated)
+		if _, err = w.Write(response); err != nil {
+			_ = telemetry.RecordError(span, err)
+		}
+	}
+}
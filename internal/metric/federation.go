@@ -0,0 +1,61 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var federationMetric *FederationMetric
+
+// FederationMetric shows the connections of the lobbies to the instances that host their live streams
+type FederationMetric struct {
+	connectionState *prometheus.GaugeVec
+	reconnects      *prometheus.CounterVec
+}
+
+func FederationConnectionState(stream string, host string, state int) {
+	if federationMetric != nil {
+		federationMetric.connectionState.With(prometheus.Labels{"stream": stream, "host": host}).Set(float64(state))
+	}
+}
+
+func FederationReconnectInc(stream string, host string) {
+	if federationMetric != nil {
+		federationMetric.reconnects.With(prometheus.Labels{"stream": stream, "host": host}).Inc()
+	}
+}
+
+func FederationConnectionDelete(stream string, host string) {
+	if federationMetric != nil {
+		federationMetric.connectionState.Delete(prometheus.Labels{"stream": stream, "host": host})
+		federationMetric.reconnects.Delete(prometheus.Labels{"stream": stream, "host": host})
+	}
+}
+
+func NewFederationMetrics() (*FederationMetric, error) {
+	if federationMetric != nil {
+		return nil, errors.New("federation metric already exists")
+	}
+
+	federationMetric = &FederationMetric{
+		connectionState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "shig",
+			Name:      "federation_connection_state",
+			Help:      "state of the connection to the host instance: 1 connecting, 2 connected, 3 waiting to reconnect, 4 stopped",
+		}, []string{"stream", "host"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "shig",
+			Name:      "federation_reconnects_total",
+			Help:      "lost connections to the host instance",
+		}, []string{"stream", "host"}),
+	}
+	if err := prometheus.Register(federationMetric.connectionState); err != nil {
+		return nil, fmt.Errorf("register federation connection state metric: %w", err)
+	}
+	if err := prometheus.Register(federationMetric.reconnects); err != nil {
+		return nil, fmt.Errorf("register federation reconnects metric: %w", err)
+	}
+	return federationMetric, nil
+}
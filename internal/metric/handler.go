@@ -33,6 +33,9 @@ func ExtendRouter(router *mux.Router, config *MetricConfig) error {
 		if _, err = NewServiceGraphMetrics(); err != nil {
 			return fmt.Errorf("creating service graph metric setup: %w", err)
 		}
+		if _, err = NewFederationMetrics(); err != nil {
+			return fmt.Errorf("creating federation metric setup: %w", err)
+		}
 
 		router.Path(endpoint).Handler(promhttp.Handler())
 	}
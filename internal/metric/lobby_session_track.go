@@ -18,7 +18,7 @@ const (
 	TrackId      LabelType = "track"
 	SSRC         LabelType = "ssrc"
 	TrackKind    LabelType = "kind"      // values: video | audio
-	TrackPurpose LabelType = "purpose"   // values: guest | main
+	TrackPurpose LabelType = "purpose"   // values: guest | main | screen
 	Direction    LabelType = "direction" // values: ingress | egress
 )
 
@@ -83,7 +83,7 @@ func PacketInc(labels Labels, pkg uint64) {
 	if lobbySessionTrackMetric != nil {
 		lobbySessionTrackMetric.tracks.packet.With(toPromLabels(labels)).Set(float64(pkg))
 
-		//if metric, err := lobbySessionTrackMetric.tracks.packet.GetMetricWith(toPromLabels(labels)); err != nil {
+		//if metric, err := lobbySessionTrackMetric.tracks.packet.GetMetricWith(toPromLabels(labels)); err == nil {
 		//	metric.Set(float64(pkg))
 		//}
 	}
@@ -97,7 +97,7 @@ func PacketDel(labels Labels) {
 func PacketBytesInc(labels Labels, pkg uint64) {
 	if lobbySessionTrackMetric != nil {
 		lobbySessionTrackMetric.tracks.packetBytes.With(toPromLabels(labels)).Set(float64(pkg))
-		//if metric, err := lobbySessionTrackMetric.tracks.packetBytes.GetMetricWith(toPromLabels(labels)); err != nil {
+		//if metric, err := lobbySessionTrackMetric.tracks.packetBytes.GetMetricWith(toPromLabels(labels)); err == nil {
 		//	metric.Set(float64(pkg))
 		//}
 	}
@@ -113,7 +113,7 @@ func NackInc(labels Labels, nack uint32) {
 	//	return
 	//}
 	if lobbySessionTrackMetric != nil {
-		if metric, err := lobbySessionTrackMetric.tracks.nack.GetMetricWith(toPromLabels(labels)); err != nil {
+		if metric, err := lobbySessionTrackMetric.tracks.nack.GetMetricWith(toPromLabels(labels)); err == nil {
 			metric.Set(float64(nack))
 		}
 	}
@@ -129,7 +129,7 @@ func PliInc(labels Labels, pli uint32) {
 	//	return
 	//}
 	if lobbySessionTrackMetric != nil {
-		if metric, err := lobbySessionTrackMetric.tracks.pli.GetMetricWith(toPromLabels(labels)); err != nil {
+		if metric, err := lobbySessionTrackMetric.tracks.pli.GetMetricWith(toPromLabels(labels)); err == nil {
 			metric.Set(float64(pli))
 		}
 
@@ -146,7 +146,7 @@ func FirInc(labels Labels, fir uint32) {
 	//	return
 	//}
 	if lobbySessionTrackMetric != nil {
-		if metric, err := lobbySessionTrackMetric.tracks.fir.GetMetricWith(toPromLabels(labels)); err != nil {
+		if metric, err := lobbySessionTrackMetric.tracks.fir.GetMetricWith(toPromLabels(labels)); err == nil {
 			metric.Set(float64(fir))
 		}
 	}
@@ -161,7 +161,7 @@ func PacketLossTotalInc(labels Labels, pkg int64) {
 	//	return
 	//}
 	if lobbySessionTrackMetric != nil {
-		if metric, err := lobbySessionTrackMetric.tracks.packetLossTotal.GetMetricWith(toPromLabels(labels)); err != nil {
+		if metric, err := lobbySessionTrackMetric.tracks.packetLossTotal.GetMetricWith(toPromLabels(labels)); err == nil {
 			metric.Set(float64(pkg))
 		}
 	}
@@ -176,7 +176,7 @@ func PacketLossInc(labels Labels, pkg int64) {
 		return
 	}
 	if lobbySessionTrackMetric != nil {
-		if metric, err := lobbySessionTrackMetric.tracks.packetLoss.GetMetricWith(toPromLabels(labels)); err != nil {
+		if metric, err := lobbySessionTrackMetric.tracks.packetLoss.GetMetricWith(toPromLabels(labels)); err == nil {
 			metric.Observe(float64(pkg))
 		}
 	}
@@ -191,7 +191,7 @@ func JitterInc(labels Labels, jitter float64) {
 	//	return
 	//}
 	if lobbySessionTrackMetric != nil {
-		if metric, err := lobbySessionTrackMetric.tracks.jitter.GetMetricWith(toPromLabels(labels)); err != nil {
+		if metric, err := lobbySessionTrackMetric.tracks.jitter.GetMetricWith(toPromLabels(labels)); err == nil {
 			metric.Observe(jitter)
 		}
 
@@ -208,7 +208,7 @@ func RttInc(labels Labels, rtt uint64) {
 		return
 	}
 	if lobbySessionTrackMetric != nil {
-		if metric, err := lobbySessionTrackMetric.tracks.rtt.GetMetricWith(toPromLabels(labels)); err != nil {
+		if metric, err := lobbySessionTrackMetric.tracks.rtt.GetMetricWith(toPromLabels(labels)); err == nil {
 			metric.Observe(float64(rtt))
 		}
 	}
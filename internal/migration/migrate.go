@@ -32,6 +32,10 @@ func Migrate(config *instance.FederationConfig, storage storage.Storage) error {
 		return fmt.Errorf("migrating the space schema: %w", err)
 	}
 
+	if err := migrateInstanceIds(db); err != nil {
+		return err
+	}
+
 	if db.Migrator().HasTable(&models.Actor{}) {
 		if err := db.First(&models.Actor{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
 			slog.Info("creating instance actor")
@@ -80,3 +84,21 @@ func buildTrustedInstanceAccount(db *gorm.DB, trustedInstance instance.TrustedIn
 	db.Create(trInstance)
 	return nil
 }
+
+// migrateInstanceIds replaces the legacy id of the instance accounts by the id derived from the actor id.
+// The lobby compares the id of an instance session with the instance ids in the path of a track to stop relay loops,
+// so the account has to carry the same id the other instances derive.
+func migrateInstanceIds(db *gorm.DB) error {
+	var accounts []auth.Account
+	if err := db.Where("uuid=?", auth.LegacyShigInstanceId.String()).Find(&accounts).Error; err != nil {
+		return fmt.Errorf("migration loading accounts with legacy instance id: %w", err)
+	}
+	for _, account := range accounts {
+		instanceId := auth.CreateShigInstanceId(account.User)
+		if err := db.Model(&account).Update("uuid", instanceId.String()).Error; err != nil {
+			return fmt.Errorf("migration updating instance id of %s: %w", account.User, err)
+		}
+		slog.Info("migrated instance id", "user", account.User, "instanceId", instanceId)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/shigde/sfu/internal/activitypub/instance"
+	"github.com/shigde/sfu/internal/auth"
+	"github.com/shigde/sfu/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMigrationConfig(t *testing.T) *instance.FederationConfig {
+	t.Helper()
+	instanceUrl, err := url.Parse("https://home.org")
+	assert.NoError(t, err)
+	return &instance.FederationConfig{
+		InstanceUrl:      instanceUrl,
+		InstanceUsername: "shig",
+		TrustedInstances: []instance.TrustedInstance{{Actor: "https://host.org/federation/accounts/shig", Name: "shig"}},
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("instance account gets the id derived from its actor id", func(t *testing.T) {
+		store := storage.NewTestStore()
+
+		assert.NoError(t, Migrate(testMigrationConfig(t), store))
+
+		var account auth.Account
+		assert.NoError(t, store.GetDatabase().Where("user=?", "shig@host.org").First(&account).Error)
+		assert.Equal(t, auth.CreateShigInstanceId("shig@host.org").String(), account.UUID)
+	})
+
+	t.Run("legacy instance id is replaced", func(t *testing.T) {
+		store := storage.NewTestStore()
+		config := testMigrationConfig(t)
+		assert.NoError(t, Migrate(config, store))
+		db := store.GetDatabase()
+		assert.NoError(t, db.Model(&auth.Account{}).Where("user=?", "shig@host.org").Update("uuid", auth.LegacyShigInstanceId.String()).Error)
+
+		assert.NoError(t, Migrate(config, store))
+
+		var account auth.Account
+		assert.NoError(t, db.Where("user=?", "shig@host.org").First(&account).Error)
+		assert.Equal(t, auth.CreateShigInstanceId("shig@host.org").String(), account.UUID)
+	})
+}
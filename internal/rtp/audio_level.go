@@ -0,0 +1,43 @@
+package rtp
+
+import (
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// AudioLevelDispatcher can be implemented additionally by a TrackDispatcher, to receive the audio levels of the ingress audio tracks.
+// The level is the ssrc-audio-level (RFC 6464) of a rtp packet, 0 is the loudest and 127 the quietest level (-dBov).
+type AudioLevelDispatcher interface {
+	DispatchAudioLevel(sessionId uuid.UUID, mediaStreamId string, level uint8)
+}
+
+// getAudioLevelExtensionId returns the negotiated id of the audio level header extension, 0 if it was not negotiated
+func getAudioLevelExtensionId(receiver *webrtc.RTPReceiver) uint8 {
+	if receiver == nil {
+		return 0
+	}
+	for _, ext := range receiver.GetParameters().HeaderExtensions {
+		if ext.URI == sdp.AudioLevelURI {
+			return uint8(ext.ID)
+		}
+	}
+	return 0
+}
+
+func readAudioLevel(packet []byte, extensionId uint8) (uint8, bool) {
+	header := &rtp.Header{}
+	if _, err := header.Unmarshal(packet); err != nil {
+		return 0, false
+	}
+	data := header.GetExtension(extensionId)
+	if data == nil {
+		return 0, false
+	}
+	ext := &rtp.AudioLevelExtension{}
+	if err := ext.Unmarshal(data); err != nil {
+		return 0, false
+	}
+	return ext.Level, true
+}
@@ -6,8 +6,105 @@ import (
 	"github.com/pion/webrtc/v3"
 )
 
+const (
+	// maximum number of pre-allocated slots per kind of an egress endpoint
+	maxEgressSlotPool = 32
+	// maximum size of the keyframe cache per video track
+	maxKeyframeCacheBytes = 16 << 20
+	// limits of the packets of a send queue
+	minSendQueuePackets = 16
+	maxSendQueuePackets = 4096
+	// limits of the packets of a retransmission buffer
+	minRetransmissionPackets = 64
+	maxRetransmissionPackets = 8192
+	// maximum loss in percent to start forwarding the redundancy
+	maxRedundancyLossThreshold = 100
+	// maximum loss in percent to drop temporal layers
+	maxSvcLossThreshold = 100
+)
+
 type RtpConfig struct {
-	ICEServer []ICEServer `mapstructure:"iceServer"`
+	ICEServer      []ICEServer    `mapstructure:"iceServer"`
+	EgressSlotPool EgressSlotPool `mapstructure:"egressSlotPool"`
+	KeyframeCache  KeyframeCache  `mapstructure:"keyframeCache"`
+	SendQueue      SendQueue      `mapstructure:"sendQueue"`
+	Retransmission Retransmission `mapstructure:"retransmission"`
+	Redundancy     Redundancy     `mapstructure:"redundancy"`
+	Svc            Svc            `mapstructure:"svc"`
+	Transcoding    Transcoding    `mapstructure:"transcoding"`
+}
+
+// EgressSlotPool pre-allocates audio and video slots for every egress endpoint.
+// New tracks are sent over the slots without renegotiation, 0 slots disable the pool.
+type EgressSlotPool struct {
+	Audio int `mapstructure:"audio"`
+	Video int `mapstructure:"video"`
+}
+
+func (p EgressSlotPool) enabled() bool {
+	return p.Audio > 0 || p.Video > 0
+}
+
+// KeyframeCache caches the packets since the last keyframe of every ingress video track (VP8 and H264),
+// so new viewers can start without waiting for the next keyframe. 0 bytes disable the cache.
+type KeyframeCache struct {
+	MaxBytes int `mapstructure:"maxBytes"`
+}
+
+// SendQueue gives every remote peer of an ingress track its own send queue, so a slow remote peer does not delay the others.
+// A remote peer that falls behind the queue continues with the last keyframe. 0 packets disable the send queues.
+type SendQueue struct {
+	Packets int `mapstructure:"packets"`
+}
+
+// Retransmission buffers the last packets of every ingress video track, the NACKs of the egress peers are answered
+// from the buffer and only forwarded to the ingress peer if a packet is not buffered. 0 packets disable the buffer.
+type Retransmission struct {
+	Packets int `mapstructure:"packets"`
+}
+
+// Redundancy negotiates Opus RED (RFC 2198) for audio and RED with ULPFEC for video. The redundancy is forwarded to
+// egress peers that negotiated it and have a loss of at least LossThreshold percent, for all others it is stripped.
+type Redundancy struct {
+	Audio         bool `mapstructure:"audio"`
+	Video         bool `mapstructure:"video"`
+	LossThreshold int  `mapstructure:"lossThreshold"`
+}
+
+func (r Redundancy) enabled() bool {
+	return r.Audio || r.Video
+}
+
+// Svc selects the temporal layers of VP8 and the spatial and temporal layers of VP9 and AV1 (dependency descriptor)
+// for every egress peer. The spatial layers follow the video quality of the subscription and the estimated bitrate
+// of the egress peer, the temporal layers are dropped while the loss reaches LossThreshold percent, 0 disables this.
+type Svc struct {
+	Enabled       bool `mapstructure:"enabled"`
+	LossThreshold int  `mapstructure:"lossThreshold"`
+}
+
+// Transcoding re-encodes video tracks with an external encoder process (ffmpeg) for subscribers that do not support
+// the codec of a track. A transcoder only runs while a subscriber of the transcoded track exists.
+type Transcoding struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Command is the path of the encoder process, default "ffmpeg"
+	Command string `mapstructure:"command"`
+	// Bitrate of the transcoded tracks in kbit/s, default 1500
+	Bitrate int `mapstructure:"bitrate"`
+}
+
+func (t Transcoding) command() string {
+	if t.Command == "" {
+		return defaultTranscodingCommand
+	}
+	return t.Command
+}
+
+func (t Transcoding) bitrate() int {
+	if t.Bitrate == 0 {
+		return defaultTranscodingBitrate
+	}
+	return t.Bitrate
 }
 
 type ICEServer struct {
@@ -46,6 +143,31 @@ func ValidateRtpConfig(config *RtpConfig) error {
 		}
 	}
 
+	if config.EgressSlotPool.Audio < 0 || config.EgressSlotPool.Audio > maxEgressSlotPool {
+		return fmt.Errorf("rtp.egressSlotPool.audio has to be between 0 and %d", maxEgressSlotPool)
+	}
+	if config.EgressSlotPool.Video < 0 || config.EgressSlotPool.Video > maxEgressSlotPool {
+		return fmt.Errorf("rtp.egressSlotPool.video has to be between 0 and %d", maxEgressSlotPool)
+	}
+	if config.KeyframeCache.MaxBytes < 0 || config.KeyframeCache.MaxBytes > maxKeyframeCacheBytes {
+		return fmt.Errorf("rtp.keyframeCache.maxBytes has to be between 0 and %d", maxKeyframeCacheBytes)
+	}
+	if packets := config.SendQueue.Packets; packets != 0 && (packets < minSendQueuePackets || packets > maxSendQueuePackets) {
+		return fmt.Errorf("rtp.sendQueue.packets has to be 0 or between %d and %d", minSendQueuePackets, maxSendQueuePackets)
+	}
+	if packets := config.Retransmission.Packets; packets != 0 && (packets < minRetransmissionPackets || packets > maxRetransmissionPackets) {
+		return fmt.Errorf("rtp.retransmission.packets has to be 0 or between %d and %d", minRetransmissionPackets, maxRetransmissionPackets)
+	}
+	if config.Redundancy.LossThreshold < 0 || config.Redundancy.LossThreshold > maxRedundancyLossThreshold {
+		return fmt.Errorf("rtp.redundancy.lossThreshold has to be between 0 and %d", maxRedundancyLossThreshold)
+	}
+	if config.Svc.LossThreshold < 0 || config.Svc.LossThreshold > maxSvcLossThreshold {
+		return fmt.Errorf("rtp.svc.lossThreshold has to be between 0 and %d", maxSvcLossThreshold)
+	}
+	if config.Transcoding.Bitrate < 0 {
+		return fmt.Errorf("rtp.transcoding.bitrate has to be 0 or positive")
+	}
+
 	return nil
 }
 
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/pion/dtls/v2"
+	"github.com/pion/rtcp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/shigde/sfu/internal/metric"
 	"github.com/shigde/sfu/internal/rtp/stats"
@@ -17,6 +22,8 @@ import (
 
 var ErrIceGatheringInterruption = errors.New("getting ice gathering interrupted")
 var ErrSessionClosed = errors.New("process interrupted because session closed")
+var ErrOfferCollision = errors.New("remote offer collides with the own offer and is ignored")
+var ErrNoPendingOffer = errors.New("no own offer is pending for the answer")
 
 type Endpoint struct {
 	sessionCxt             context.Context
@@ -31,6 +38,12 @@ type Endpoint struct {
 	closed                 chan struct{}
 	statsRegistry          *stats.Registry
 	iceState               webrtc.ICEConnectionState
+	slotMutex              sync.Mutex
+	videoSlots             []*trackSlot
+	audioSlots             []*trackSlot
+	slotRevision           uint64
+	// serializes the sdp exchange, an offer of the remote peer can collide with the own offer
+	negotiation sync.Mutex
 	// With Endpoint Optionals #######################################
 	onChannel           func(dc *webrtc.DataChannel)
 	onEstablished       func()
@@ -41,6 +54,33 @@ type Endpoint struct {
 	getCurrentTracksCbk func(ctx context.Context, sessionId uuid.UUID) ([]*TrackInfo, error)
 	initTracks          []*initTrack // deprecated
 	dispatcher          TrackDispatcher
+	slotPoolAudio       int
+	slotPoolVideo       int
+	onSlotMapping       func(mapping TrackSlotMapping)
+	keyframeCacheSize   int
+	sendQueueSize       int
+	retransmitSize      int
+	// the redundancy of RED tracks depends on the loss of the remote peer
+	redundancy              bool
+	redundancyLossThreshold int
+	// the layers of scalable video tracks depend on the video quality, the estimated bitrate and the loss of the remote peer
+	svc              bool
+	svcLossThreshold int
+	videoQuality     func(mediaStreamId string) VideoQuality
+	// video tracks with a codec the remote peer does not support are sent transcoded
+	transcoding *TranscodingPool
+	// the audience endpoint sends the main program instead of the tracks of the lobby
+	program *ProgramOutput
+	// the sent streams by ssrc, their sender reports carry the clock of the publisher
+	syncSources sync.Map
+	// on an offer collision the polite endpoint drops its own offer, the impolite endpoint ignores the remote offer
+	polite bool
+	// the offer of the polite endpoint that waits for the answer
+	pendingOffer *webrtc.SessionDescription
+	// a renegotiation that was requested while the negotiation was not stable, it runs when the negotiation is stable
+	pendingRenegotiation bool
+	// the last bitrate the remote peer estimated for the media of the egress endpoint
+	remoteEstimate atomic.Uint64
 }
 
 func newEndpoint(sessionCxt context.Context, sessionId string, liveStreamId string, endpointType EndpointType, options ...EndpointOption) *Endpoint {
@@ -93,11 +133,49 @@ func (c *Endpoint) GetLocalDescription(ctx context.Context) (*webrtc.SessionDesc
 		return nil, ErrIceGatheringInterruption
 	}
 }
+
+// SetAnswer sets the answer of the remote peer to the own offer. The polite endpoint sets its own offer together with
+// the answer. An answer to an offer that was dropped because of an offer collision finds no pending offer.
 func (c *Endpoint) SetAnswer(sdp *webrtc.SessionDescription) error {
-	return c.peerConnection.SetRemoteDescription(*sdp)
+	c.negotiation.Lock()
+	defer c.negotiation.Unlock()
+	if c.pendingOffer != nil {
+		offer := *c.pendingOffer
+		c.pendingOffer = nil
+		if err := c.peerConnection.SetLocalDescription(offer); err != nil {
+			return fmt.Errorf("set own offer: %w", err)
+		}
+	}
+	if c.peerConnection.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+		return ErrNoPendingOffer
+	}
+	// the remote tracks of an ingress endpoint that made the offer are described by the answer
+	if c.endpointType == IngressEndpoint {
+		if err := getIngressTrackSdpInfo(*sdp, uuid.MustParse(c.sessionId), c.trackSdpInfoRepository); err != nil {
+			return fmt.Errorf("parsing track info: %w", err)
+		}
+	}
+	if err := c.peerConnection.SetRemoteDescription(*sdp); err != nil {
+		return err
+	}
+	c.runPendingRenegotiation()
+	return nil
 }
 
+// SetNewOffer answers an offer of the remote peer. If the endpoint has sent an own offer in the meantime, the offers
+// collide (glare): the polite endpoint drops its own offer and answers, the impolite endpoint ignores the remote offer.
+// The polite endpoint offers its changes again as soon as the negotiation is stable.
 func (c *Endpoint) SetNewOffer(sdp *webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	c.negotiation.Lock()
+	defer c.negotiation.Unlock()
+	if c.pendingOffer != nil {
+		slog.Debug("rtp.endpoint: own offer dropped because of an offer collision", "sessionId", c.sessionId)
+		c.pendingOffer = nil
+		c.pendingRenegotiation = true
+	}
+	if c.peerConnection.SignalingState() != webrtc.SignalingStateStable {
+		return nil, ErrOfferCollision
+	}
 
 	err := getIngressTrackSdpInfo(*sdp, uuid.MustParse(c.sessionId), c.trackSdpInfoRepository)
 
@@ -112,9 +190,19 @@ func (c *Endpoint) SetNewOffer(sdp *webrtc.SessionDescription) (*webrtc.SessionD
 	if err = c.peerConnection.SetLocalDescription(answer); err != nil {
 		return nil, err
 	}
+	c.runPendingRenegotiation()
 	return &answer, nil
 }
 
+// runPendingRenegotiation offers the changes that were requested while the negotiation was not stable.
+// The caller holds the negotiation lock.
+func (c *Endpoint) runPendingRenegotiation() {
+	if c.pendingRenegotiation {
+		c.pendingRenegotiation = false
+		c.Renegotiate()
+	}
+}
+
 func (c *Endpoint) SetInitComplete() {
 	select {
 	case <-c.initComplete:
@@ -125,6 +213,12 @@ func (c *Endpoint) SetInitComplete() {
 	}
 }
 
+// IsConnected reports whether the endpoint is set up and its peer connection is connected,
+// pion reports a connected peer connection when ICE and DTLS are connected
+func (c *Endpoint) IsConnected() bool {
+	return c.IsInitComplete() && c.peerConnection != nil && c.peerConnection.ConnectionState() == webrtc.PeerConnectionStateConnected
+}
+
 func (c *Endpoint) IsInitComplete() bool {
 	select {
 	case <-c.initComplete:
@@ -146,7 +240,17 @@ func (c *Endpoint) hasTrack(track webrtc.TrackLocal) bool {
 			}
 		}
 	}
-	return false
+	return c.hasPoolSlot(track)
+}
+
+// HasTrack checks if the track is already sent over this endpoint, a transcoded track is sent instead of its source track
+func (c *Endpoint) HasTrack(track webrtc.TrackLocal) bool {
+	if c.transcoding != nil {
+		if transcoded, ok := c.transcoding.Lookup(track.ID(), c.sessionId); ok {
+			track = transcoded.GetTrackLocal()
+		}
+	}
+	return c.hasTrack(track)
 }
 
 func (c *Endpoint) getSender(track webrtc.TrackLocal) (*webrtc.RTPSender, bool) {
@@ -165,10 +269,20 @@ func (c *Endpoint) getSender(track webrtc.TrackLocal) (*webrtc.RTPSender, bool)
 func (c *Endpoint) AddTrack(ctx context.Context, info *TrackInfo) {
 	_, span := rtpTrace(ctx, "endpoint_add_track")
 	defer span.End()
+	if c.transcoding != nil {
+		if transcoded, ok := c.transcoding.Acquire(info, c.sessionId, c.acceptsCodec); ok {
+			span.AddEvent("Transcode Track", trace.WithAttributes(attribute.String("localTrack", info.GetTrackLocal().ID())))
+			info = transcoded
+		}
+	}
 	track := info.GetTrackLocal()
 	purpose := info.Purpose
 	slog.Debug("rtp.endpoint: add track", "streamId", track.StreamID(), "trackId", track.ID(), "kind", track.Kind(), "purpose", purpose)
 	if has := c.hasTrack(track); !has {
+		if c.bindToPoolSlot(info) {
+			span.AddEvent("Bind Track to Slot", trace.WithAttributes(attribute.String("localTrack", track.ID())))
+			return
+		}
 		slog.Debug("rtp.endpoint: add track to connection", "streamId", track.StreamID(), "trackId", track.ID(), "kind", track.Kind(), "purpose", purpose, "signalState", c.peerConnection.SignalingState().String())
 		var sender *webrtc.RTPSender
 		var err error
@@ -192,17 +306,18 @@ func (c *Endpoint) AddTrack(ctx context.Context, info *TrackInfo) {
 			}
 		}
 		c.trackSdpInfoRepository.Set(info.Id, &sdpTrack)
+		c.addSyncSource(sender, track)
+		if selector, ok := track.(svcSelector); ok && c.videoQuality != nil {
+			selector.setVideoQuality(c.videoQuality(track.StreamID()))
+		}
+
+		// the RTCP of every sender is read, at least the estimated bitrate of the remote peer is needed
+		target, _ := track.(retransmitter)
+		go c.readRtcp(sender, target, c.trackLabels(track, purpose))
 
 		// collect stats
 		if c.statsRegistry != nil {
-			labels := metric.Labels{
-				metric.Stream:       c.liveStreamId,
-				metric.MediaStream:  track.StreamID(),
-				metric.TrackId:      track.ID(),
-				metric.TrackKind:    track.Kind().String(),
-				metric.TrackPurpose: purpose.ToString(),
-				metric.Direction:    c.endpointType.ToString(),
-			}
+			labels := c.trackLabels(track, purpose)
 			for _, param := range sender.GetParameters().Encodings {
 				if err = c.statsRegistry.StartWorker(labels, param.SSRC); err != nil {
 					slog.Error("rtp.endpoint: start stats worker", "err", err, "ssrc", param.SSRC)
@@ -215,8 +330,17 @@ func (c *Endpoint) AddTrack(ctx context.Context, info *TrackInfo) {
 func (c *Endpoint) RemoveTrack(ctx context.Context, info *TrackInfo) {
 	_, span := rtpTrace(ctx, "endpoint_remove_track")
 	defer span.End()
+	if c.transcoding != nil {
+		if transcoded, ok := c.transcoding.Release(info.GetTrackLocal().ID(), c.sessionId); ok {
+			info = transcoded
+		}
+	}
 	track := info.GetTrackLocal()
 	slog.Debug("rtp.endpoint: remove track", "streamId", track.StreamID(), "trackId", track.ID(), "purpose", track.Kind())
+	if c.unbindFromPoolSlot(info) {
+		span.AddEvent("Release Slot of Track", trace.WithAttributes(attribute.String("localTrack", track.ID())))
+		return
+	}
 
 	if sender, has := c.getSender(track); has {
 		c.trackSdpInfoRepository.Delete(info.GetId())
@@ -225,6 +349,7 @@ func (c *Endpoint) RemoveTrack(ctx context.Context, info *TrackInfo) {
 			attribute.String("localTrack", track.ID())),
 		)
 		slog.Debug("rtp.endpoint: remove track from connection", "streamId", track.StreamID(), "trackId", track.ID(), "kind", track.Kind())
+		c.removeSyncSource(sender)
 		if err := c.peerConnection.RemoveTrack(sender); err != nil {
 			span.RecordError(err)
 			slog.Error("rtp.endpoint: remove track from connection", "err", err, "streamId", track.StreamID(), "trackId", track.ID(), "purpose", track.Kind())
@@ -238,6 +363,466 @@ func (c *Endpoint) RemoveTrack(ctx context.Context, info *TrackInfo) {
 	}
 }
 
+// RemoteEstimate returns the bitrate in bit/s the remote peer estimated for the media of the egress endpoint,
+// 0 as long as the remote peer has not sent an estimate
+func (c *Endpoint) RemoteEstimate() uint64 {
+	return c.remoteEstimate.Load()
+}
+
+// RequestBitrate asks the remote peer of the ingress endpoint to send its media with at most the bitrate in bit/s
+func (c *Endpoint) RequestBitrate(ctx context.Context, bitrate uint64) error {
+	_, span := rtpTrace(ctx, "endpoint_request_bitrate")
+	defer span.End()
+	span.SetAttributes(attribute.Int64("bitrate", int64(bitrate)))
+	pc := c.getPeerConnection()
+	if pc == nil {
+		return nil
+	}
+
+	ssrcs := make([]uint32, 0)
+	for _, receiver := range pc.GetReceivers() {
+		for _, track := range receiver.Tracks() {
+			if track.SSRC() != 0 {
+				ssrcs = append(ssrcs, uint32(track.SSRC()))
+			}
+		}
+	}
+	if len(ssrcs) == 0 {
+		return nil
+	}
+	if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: float32(bitrate), SSRCs: ssrcs}}); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("sending estimated maximum bitrate: %w", err)
+	}
+	return nil
+}
+
+// UpdateVideoQuality limits the layers of the sent scalable video tracks to the current video quality of their media stream
+func (c *Endpoint) UpdateVideoQuality(ctx context.Context) {
+	_, span := rtpTrace(ctx, "endpoint_update_video_quality")
+	defer span.End()
+	if c.videoQuality == nil || c.peerConnection == nil {
+		return
+	}
+	for _, sender := range c.peerConnection.GetSenders() {
+		if track := sender.Track(); track != nil {
+			if selector, ok := track.(svcSelector); ok {
+				selector.setVideoQuality(c.videoQuality(track.StreamID()))
+			}
+		}
+	}
+}
+
+// AssignVideoSlots shows the video tracks in the video slots of the egress endpoint, without renegotiation.
+// Tracks that are already shown keep their slot. Missing slots are allocated once, which needs a single renegotiation.
+// Slots without track are paused, slots of the slot pool that show a track are not touched.
+func (c *Endpoint) AssignVideoSlots(ctx context.Context, tracks []*TrackInfo) {
+	_, span := rtpTrace(ctx, "endpoint_assign_video_slots")
+	defer span.End()
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+	before := c.getSlotInfos()
+
+	wanted := make(map[string]bool, len(tracks))
+	for _, track := range tracks {
+		wanted[track.GetTrackLocal().ID()] = true
+	}
+
+	// keep the tracks that are already shown in their slot
+	free := make([]*trackSlot, 0, len(c.videoSlots))
+	for _, slot := range c.videoSlots {
+		source := slot.getSource()
+		if source != nil && !slot.managed {
+			continue
+		}
+		if source != nil && wanted[source.GetTrackLocal().ID()] {
+			delete(wanted, source.GetTrackLocal().ID())
+			continue
+		}
+		free = append(free, slot)
+	}
+
+	for _, track := range tracks {
+		if !wanted[track.GetTrackLocal().ID()] {
+			continue
+		}
+		slot, index := findSlotForCodec(free, track.GetTrack().Codec())
+		if slot == nil {
+			var err error
+			if slot, err = c.addSlot(track.GetTrack().Codec()); err != nil {
+				span.RecordError(err)
+				slog.Error("rtp.endpoint: add video slot", "err", err, "sessionId", c.sessionId)
+				continue
+			}
+			c.videoSlots = append(c.videoSlots, slot)
+		} else {
+			free = append(free[:index], free[index+1:]...)
+		}
+		slot.managed = true
+		if err := slot.bind(track); err != nil {
+			span.RecordError(err)
+			slog.Error("rtp.endpoint: bind track to video slot", "err", err, "sessionId", c.sessionId, "trackId", track.GetTrackLocal().ID())
+			slot.release()
+			slot.managed = false
+		}
+	}
+
+	for _, slot := range free {
+		if slot.getSource() != nil {
+			slot.release()
+		}
+		slot.managed = false
+	}
+
+	if !equalTrackSlotInfos(before, c.getSlotInfos()) {
+		c.notifySlotMapping()
+	}
+}
+
+// ReleaseVideoSlots pauses all video slots of the Last-N assignment, the slots stay allocated for a later use
+func (c *Endpoint) ReleaseVideoSlots(ctx context.Context) {
+	c.AssignVideoSlots(ctx, nil)
+}
+
+// setupSlotPool pre-allocates the slots of the slot pool. It has to be called before the first sdp exchange,
+// so the slots are part of the initial session description.
+func (c *Endpoint) setupSlotPool() error {
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+	for i := 0; i < c.slotPoolAudio; i++ {
+		slot, err := c.addSlot(slotPoolAudioCodec)
+		if err != nil {
+			return fmt.Errorf("adding audio slot to pool: %w", err)
+		}
+		c.audioSlots = append(c.audioSlots, slot)
+	}
+	for i := 0; i < c.slotPoolVideo; i++ {
+		slot, err := c.addSlot(slotPoolVideoCodec)
+		if err != nil {
+			return fmt.Errorf("adding video slot to pool: %w", err)
+		}
+		c.videoSlots = append(c.videoSlots, slot)
+	}
+	return nil
+}
+
+// setupProgram adds the tracks of the main program. Like the slot pool, it has to be called before the first sdp exchange.
+func (c *Endpoint) setupProgram() error {
+	for _, program := range c.program.tracks() {
+		local := program.newLocal()
+		sender, err := c.peerConnection.AddTrack(local)
+		if err != nil {
+			return fmt.Errorf("adding program track to connection: %w", err)
+		}
+		c.addSyncSource(sender, program.slot)
+		go c.readRtcp(sender, local, c.trackLabels(local, PurposeMain))
+	}
+	return nil
+}
+
+func (c *Endpoint) hasSlotPool() bool {
+	return c.slotPoolAudio > 0 || c.slotPoolVideo > 0
+}
+
+// bindToPoolSlot shows the track in a free slot of the slot pool, this only changes the slot mapping and needs no renegotiation.
+// It returns false if no free slot with the codec of the track exists.
+func (c *Endpoint) bindToPoolSlot(info *TrackInfo) bool {
+	if !c.hasSlotPool() {
+		return false
+	}
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+
+	slots := c.audioSlots
+	if info.GetTrackLocal().Kind() == webrtc.RTPCodecTypeVideo {
+		slots = c.videoSlots
+	}
+	for _, slot := range slots {
+		if slot.getSource() != nil || !slot.acceptsCodec(info.GetTrack().Codec()) {
+			continue
+		}
+		if err := slot.bind(info); err != nil {
+			slog.Error("rtp.endpoint: bind track to pool slot", "err", err, "sessionId", c.sessionId, "trackId", info.GetTrackLocal().ID())
+			return false
+		}
+		slot.managed = false
+		sdpTrack := info.TrackSdpInfo
+		sdpTrack.EgressTrackId = slot.getTrack().ID()
+		sdpTrack.EgressMid = c.getMid(slot.getTrack())
+		c.trackSdpInfoRepository.Set(info.Id, &sdpTrack)
+		c.notifySlotMapping()
+		return true
+	}
+	return false
+}
+
+// unbindFromPoolSlot pauses the slot of the slot pool that shows the track
+func (c *Endpoint) unbindFromPoolSlot(info *TrackInfo) bool {
+	if !c.hasSlotPool() {
+		return false
+	}
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+	slot := c.getPoolSlot(info.GetTrackLocal())
+	if slot == nil {
+		return false
+	}
+	slot.release()
+	c.trackSdpInfoRepository.Delete(info.GetId())
+	c.notifySlotMapping()
+	return true
+}
+
+func (c *Endpoint) hasPoolSlot(track webrtc.TrackLocal) bool {
+	if !c.hasSlotPool() {
+		return false
+	}
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+	return c.getPoolSlot(track) != nil
+}
+
+func (c *Endpoint) getPoolSlot(track webrtc.TrackLocal) *trackSlot {
+	for _, slots := range [][]*trackSlot{c.audioSlots, c.videoSlots} {
+		for _, slot := range slots {
+			if !slot.managed && slot.showsTrack(track) {
+				return slot
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Endpoint) addSlot(codec webrtc.RTPCodecCapability) (*trackSlot, error) {
+	slot, err := newTrackSlot(codec)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := c.peerConnection.AddTrack(slot.getTrack())
+	if err != nil {
+		return nil, fmt.Errorf("adding slot track to connection: %w", err)
+	}
+	c.addSyncSource(sender, slot)
+	go c.readRtcp(sender, slot, c.trackLabels(slot.getTrack(), PurposeGuest))
+	return slot, nil
+}
+
+func (c *Endpoint) addSyncSource(sender *webrtc.RTPSender, track any) {
+	source, ok := track.(syncSource)
+	if !ok {
+		return
+	}
+	for _, encoding := range sender.GetParameters().Encodings {
+		c.syncSources.Store(uint32(encoding.SSRC), source)
+	}
+}
+
+func (c *Endpoint) removeSyncSource(sender *webrtc.RTPSender) {
+	for _, encoding := range sender.GetParameters().Encodings {
+		c.syncSources.Delete(uint32(encoding.SSRC))
+	}
+}
+
+// getSyncSource returns the sent stream of the ssrc for its sender reports
+func (c *Endpoint) getSyncSource(ssrc uint32) (syncSource, bool) {
+	source, ok := c.syncSources.Load(ssrc)
+	if !ok {
+		return nil, false
+	}
+	return source.(syncSource), true
+}
+
+func (c *Endpoint) trackLabels(track webrtc.TrackLocal, purpose Purpose) metric.Labels {
+	return metric.Labels{
+		metric.Stream:       c.liveStreamId,
+		metric.MediaStream:  track.StreamID(),
+		metric.TrackId:      track.ID(),
+		metric.TrackKind:    track.Kind().String(),
+		metric.TrackPurpose: purpose.ToString(),
+		metric.Direction:    c.endpointType.ToString(),
+	}
+}
+
+// readRtcp answers the NACKs of the remote peer until the sender is stopped. The requested packets are counted as NACKs,
+// also without retransmission buffer, and the share of packets that could not be retransmitted from the buffer as packet loss.
+// The loss of the receiver reports switches the redundancy of RED tracks on or off and drops the temporal layers of
+// scalable video tracks, the estimated bitrate of the remote peer limits their layers.
+func (c *Endpoint) readRtcp(sender *webrtc.RTPSender, target retransmitter, labels metric.Labels) {
+	var ssrc webrtc.SSRC
+	labels[metric.Session] = c.sessionId
+	if encodings := sender.GetParameters().Encodings; len(encodings) > 0 {
+		ssrc = encodings[0].SSRC
+		labels[metric.SSRC] = stats.SSRCtoString(ssrc)
+	}
+	defer metric.NackDel(labels)
+	defer metric.PacketLossDel(labels)
+	redundancy, _ := target.(redundancyForwarder)
+	forwardRedundancy := true
+	selector, _ := target.(svcSelector)
+
+	var nacks uint32
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			switch report := packet.(type) {
+			case *rtcp.TransportLayerNack:
+				seqs := make([]uint16, 0)
+				for _, pair := range report.Nacks {
+					seqs = append(seqs, pair.PacketList()...)
+				}
+				if len(seqs) == 0 {
+					continue
+				}
+				nacks += uint32(len(seqs))
+				metric.NackInc(labels, nacks)
+				if c.retransmitSize == 0 || target == nil {
+					continue
+				}
+				recovered := target.retransmit(seqs)
+				metric.PacketLossInc(labels, int64(100*(len(seqs)-recovered)/len(seqs)))
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				c.remoteEstimate.Store(uint64(report.Bitrate))
+				if c.svc && selector != nil {
+					selector.setTargetBitrate(uint64(report.Bitrate))
+				}
+			case *rtcp.ReceiverReport:
+				for _, block := range report.Reports {
+					if webrtc.SSRC(block.SSRC) != ssrc {
+						continue
+					}
+					loss := int(block.FractionLost) * 100 / 256
+					if c.svc && c.svcLossThreshold > 0 && selector != nil {
+						selector.adaptToLoss(loss, c.svcLossThreshold)
+					}
+					if !c.redundancy || redundancy == nil {
+						continue
+					}
+					if next := redundancyDecision(forwardRedundancy, loss, c.redundancyLossThreshold); next != forwardRedundancy {
+						forwardRedundancy = next
+						redundancy.forwardRedundancy(forwardRedundancy)
+					}
+				}
+			}
+		}
+	}
+}
+
+// acceptsCodec checks if the remote peer supports the codec. Without remote description or without media section
+// of the kind of the codec, the codec is accepted, the remote peer decides later.
+func (c *Endpoint) acceptsCodec(codec webrtc.RTPCodecCapability) bool {
+	if c.peerConnection == nil {
+		return true
+	}
+	remote := c.peerConnection.RemoteDescription()
+	if remote == nil {
+		return true
+	}
+	desc, err := remote.Unmarshal()
+	if err != nil {
+		return true
+	}
+	return sdpAcceptsCodec(desc, codec)
+}
+
+func sdpAcceptsCodec(desc *sdp.SessionDescription, codec webrtc.RTPCodecCapability) bool {
+	kind, name, _ := strings.Cut(codec.MimeType, "/")
+	hasKind := false
+	for _, media := range desc.MediaDescriptions {
+		if !strings.EqualFold(media.MediaName.Media, kind) {
+			continue
+		}
+		hasKind = true
+		for _, attr := range media.Attributes {
+			if attr.Key != "rtpmap" {
+				continue
+			}
+			// a=rtpmap:<payload type> <encoding name>/<clock rate>[/<channels>]
+			_, encoding, _ := strings.Cut(attr.Value, " ")
+			if encodingName, _, _ := strings.Cut(encoding, "/"); strings.EqualFold(encodingName, name) {
+				return true
+			}
+		}
+	}
+	return !hasKind
+}
+
+func (c *Endpoint) getMid(track webrtc.TrackLocal) string {
+	for _, transceiver := range c.peerConnection.GetTransceivers() {
+		if sender := transceiver.Sender(); sender != nil && sender.Track() == track {
+			return transceiver.Mid()
+		}
+	}
+	return ""
+}
+
+// notifySlotMapping announces a changed slot mapping, the slot mutex has to be locked
+func (c *Endpoint) notifySlotMapping() {
+	c.slotRevision++
+	if c.onSlotMapping != nil {
+		c.onSlotMapping(TrackSlotMapping{Revision: c.slotRevision, Slots: c.getSlotInfos()})
+	}
+}
+
+func (c *Endpoint) getSlotInfos() []TrackSlotInfo {
+	infos := make([]TrackSlotInfo, 0, len(c.videoSlots)+len(c.audioSlots))
+	for _, slot := range c.videoSlots {
+		infos = append(infos, c.getSlotInfo(slot))
+	}
+	for _, slot := range c.audioSlots {
+		infos = append(infos, c.getSlotInfo(slot))
+	}
+	return infos
+}
+
+// getSlotInfo takes purpose and mute of the sent track, they change at runtime without a new source
+func (c *Endpoint) getSlotInfo(slot *trackSlot) TrackSlotInfo {
+	info := slot.getInfo()
+	if source := slot.getSource(); source != nil {
+		if sdpInfo, ok := c.trackSdpInfoRepository.Get(source.Id); ok {
+			info.Purpose, info.Mute = sdpInfo.Purpose, sdpInfo.Mute
+		}
+	}
+	return info
+}
+
+// notifySlotMappingOfTrack announces the slot mapping again, if a slot shows the track
+func (c *Endpoint) notifySlotMappingOfTrack(infoId uuid.UUID) {
+	c.slotMutex.Lock()
+	defer c.slotMutex.Unlock()
+	for _, slots := range [][]*trackSlot{c.videoSlots, c.audioSlots} {
+		for _, slot := range slots {
+			if source := slot.getSource(); source != nil && source.Id == infoId {
+				c.notifySlotMapping()
+				return
+			}
+		}
+	}
+}
+
+func findSlotForCodec(slots []*trackSlot, codec webrtc.RTPCodecCapability) (*trackSlot, int) {
+	for i, slot := range slots {
+		if slot.acceptsCodec(codec) {
+			return slot, i
+		}
+	}
+	return nil, -1
+}
+
+func equalTrackSlotInfos(a, b []TrackSlotInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Endpoint) SetIngressMute(ingressMid string, mute bool) (*TrackInfo, bool) {
 	if sdpInfo, ok := c.trackSdpInfoRepository.getTrackSdpInfoByIngressMid(ingressMid); ok {
 		sdpInfo.Mute = mute
@@ -249,11 +834,28 @@ func (c *Endpoint) SetIngressMute(ingressMid string, mute bool) (*TrackInfo, boo
 func (c *Endpoint) SetEgressMute(infoId uuid.UUID, mute bool) (*TrackInfo, bool) {
 	if sdpInfo, ok := c.trackSdpInfoRepository.Get(infoId); ok {
 		sdpInfo.Mute = mute
+		c.notifySlotMappingOfTrack(infoId)
+		return newTrackInfo(nil, *sdpInfo), true
+	}
+	return nil, false
+}
+
+// SetPurpose changes the purpose of a sent track, it reaches the client with the next offer or the slot mapping
+func (c *Endpoint) SetPurpose(infoId uuid.UUID, purpose Purpose) (*TrackInfo, bool) {
+	if sdpInfo, ok := c.trackSdpInfoRepository.Get(infoId); ok {
+		sdpInfo.Purpose = purpose
+		c.notifySlotMappingOfTrack(infoId)
 		return newTrackInfo(nil, *sdpInfo), true
 	}
 	return nil, false
 }
 
+// Renegotiate sends a new offer to the remote peer, so that changes of the track information (sdp "i=" line)
+// reach the client, even if no track was added or removed.
+func (c *Endpoint) Renegotiate() {
+	go c.doRenegotiation()
+}
+
 func (c *Endpoint) doRenegotiation() {
 	if c.onNegotiationNeeded == nil {
 		return
@@ -266,28 +868,62 @@ func (c *Endpoint) doRenegotiation() {
 
 	slog.Debug("rtp.establish_egress: sender OnNegotiationNeeded was triggered")
 
+	// while an offer is pending, the renegotiation waits for the answer
+	c.negotiation.Lock()
+	if c.peerConnection.SignalingState() != webrtc.SignalingStateStable || c.pendingOffer != nil {
+		c.pendingRenegotiation = true
+		c.negotiation.Unlock()
+		return
+	}
+	if c.polite {
+		c.assignPoliteMids()
+	}
 	offer, err := c.peerConnection.CreateOffer(nil)
 	if err != nil {
+		c.negotiation.Unlock()
 		slog.Error("rtp.establish_egress:: sender doRenegotiation", "err", err)
 		return
 	}
+	if c.polite {
+		// pion can not roll back a local offer, so the polite endpoint keeps its offer pending until the answer
+		// arrives. Dropping the pending offer is the rollback. The ice gathering is already complete on a renegotiation.
+		c.pendingOffer = &offer
+		c.negotiation.Unlock()
+		c.sendOffer(&offer)
+		return
+	}
 	gg := webrtc.GatheringCompletePromise(c.peerConnection.(*webrtc.PeerConnection))
 	_ = c.peerConnection.SetLocalDescription(offer)
+	c.negotiation.Unlock()
 	select {
 	case <-c.sessionCxt.Done():
 		return
 	case <-gg:
 	}
+	c.sendOffer(c.peerConnection.LocalDescription())
+}
 
+func (c *Endpoint) sendOffer(offer *webrtc.SessionDescription) {
 	// munge sdp
-	mungedOffer, err := setEgressTrackInfo(c.peerConnection.LocalDescription(), c.trackSdpInfoRepository)
+	mungedOffer, err := setEgressTrackInfo(offer, c.trackSdpInfoRepository)
 	if err != nil {
 		slog.Error("rtp.establish_egress:: sender doRenegotiation dc", "err", err)
+		return
 	}
 	slog.Debug("#### NegotiationNeeded", "offer", mungedOffer.SDP)
 	c.onNegotiationNeeded(*mungedOffer)
 }
 
+// assignPoliteMids gives the new transceivers of the polite endpoint mids of their own. Both peers count the mids of
+// their new transceivers up from the same value, so a dropped offer would leave mids that the remote offer uses as well.
+func (c *Endpoint) assignPoliteMids() {
+	for i, transceiver := range c.peerConnection.GetTransceivers() {
+		if transceiver.Mid() == "" {
+			_ = transceiver.SetMid(fmt.Sprintf("p%d", i))
+		}
+	}
+}
+
 func (c *Endpoint) onICEConnectionStateChange(state webrtc.ICEConnectionState) {
 	slog.Debug("rtp.endpoint: ice state:", "state", state, "sessionId", c.sessionId, "type", c.endpointType)
 
@@ -317,6 +953,16 @@ func (c *Endpoint) Destruct() error {
 		metric.GraphNodeDelete(metric.BuildNode(c.sessionId, c.liveStreamId, c.endpointType.ToString()))
 	}
 
+	c.slotMutex.Lock()
+	for _, slot := range append(c.videoSlots, c.audioSlots...) {
+		slot.release()
+	}
+	c.slotMutex.Unlock()
+
+	if c.transcoding != nil {
+		c.transcoding.ReleaseAll(c.sessionId)
+	}
+
 	if c.peerConnection == nil {
 		return nil
 	}
@@ -339,6 +985,7 @@ func (c *Endpoint) getPeerConnection() *webrtc.PeerConnection {
 
 type peerConnection interface {
 	LocalDescription() *webrtc.SessionDescription
+	RemoteDescription() *webrtc.SessionDescription
 	SetLocalDescription(desc webrtc.SessionDescription) error
 	SetRemoteDescription(desc webrtc.SessionDescription) error
 	GetSenders() (result []*webrtc.RTPSender)
@@ -347,6 +994,7 @@ type peerConnection interface {
 	RemoveTrack(sender *webrtc.RTPSender) error
 	OnTrack(f func(*webrtc.TrackRemote, *webrtc.RTPReceiver))
 	SignalingState() webrtc.SignalingState
+	ConnectionState() webrtc.PeerConnectionState
 	CreateOffer(options *webrtc.OfferOptions) (webrtc.SessionDescription, error)
 	CreateAnswer(options *webrtc.AnswerOptions) (webrtc.SessionDescription, error)
 	OnICEConnectionStateChange(f func(webrtc.ICEConnectionState))
@@ -0,0 +1,72 @@
+package rtp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+// testEstimateViewerSetup connects a remote peer that only receives, like a browser, with an egress endpoint of the engine
+func testEstimateViewerSetup(t *testing.T, engine *Engine) (*Endpoint, *webrtc.PeerConnection) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(telemetry.ContextWithSessionValue(context.Background(), uuid.NewString(), uuid.NewString(), uuid.NewString()))
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		cancel()
+		_ = pc.Close()
+	})
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		_, err = pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		assert.NoError(t, err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	gathered := webrtc.GatheringCompletePromise(pc)
+	assert.NoError(t, pc.SetLocalDescription(offer))
+	<-gathered
+
+	endpoint, err := engine.EstablishEndpoint(ctx, ctx, uuid.New(), uuid.New(), *pc.LocalDescription(), EgressEndpoint)
+	assert.NoError(t, err)
+	answer, err := endpoint.GetLocalDescription(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, pc.SetRemoteDescription(*answer))
+	return endpoint, pc
+}
+
+func TestEndpointRemoteEstimate(t *testing.T) {
+	t.Run("egress endpoint negotiates REMB instead of the transport-wide sequence numbers", func(t *testing.T) {
+		engine, _ := NewEngine(&RtpConfig{EgressSlotPool: EgressSlotPool{Audio: 1, Video: 1}})
+		endpoint, _ := testEstimateViewerSetup(t, engine)
+
+		answer := endpoint.getPeerConnection().LocalDescription().SDP
+
+		assert.Contains(t, answer, "goog-remb")
+		assert.False(t, strings.Contains(answer, sdp.TransportCCURI))
+	})
+
+	t.Run("estimate of the remote peer reaches the egress endpoint", func(t *testing.T) {
+		engine, _ := NewEngine(&RtpConfig{EgressSlotPool: EgressSlotPool{Audio: 1, Video: 1}})
+		endpoint, pc := testEstimateViewerSetup(t, engine)
+		ssrcs := make([]uint32, 0)
+		for _, sender := range endpoint.getPeerConnection().GetSenders() {
+			for _, encoding := range sender.GetParameters().Encodings {
+				ssrcs = append(ssrcs, uint32(encoding.SSRC))
+			}
+		}
+		assert.Eventually(t, func() bool { return endpoint.IsConnected() }, 10*time.Second, 20*time.Millisecond)
+
+		assert.Eventually(t, func() bool {
+			_ = pc.WriteRTCP([]rtcp.Packet{&rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: 750_000, SSRCs: ssrcs}})
+			return endpoint.RemoteEstimate() == 750_000
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+}
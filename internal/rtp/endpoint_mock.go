@@ -34,6 +34,9 @@ type mockPeerConnector struct {
 func (m *mockPeerConnector) LocalDescription() *webrtc.SessionDescription {
 	return m.SDP
 }
+func (m *mockPeerConnector) RemoteDescription() *webrtc.SessionDescription {
+	return nil
+}
 func (m *mockPeerConnector) SetLocalDescription(_ webrtc.SessionDescription) error { return nil }
 func (m *mockPeerConnector) SetRemoteDescription(_ webrtc.SessionDescription) error {
 	return nil
@@ -51,6 +54,9 @@ func (m *mockPeerConnector) RemoveTrack(_ *webrtc.RTPSender) error {
 func (m *mockPeerConnector) SignalingState() webrtc.SignalingState {
 	return webrtc.SignalingStateStable
 }
+func (m *mockPeerConnector) ConnectionState() webrtc.PeerConnectionState {
+	return webrtc.PeerConnectionStateConnected
+}
 func (m *mockPeerConnector) OnICEConnectionStateChange(f func(webrtc.ICEConnectionState)) {}
 func (m *mockPeerConnector) OnNegotiationNeeded(f func())                                 {}
 func (m *mockPeerConnector) CreateOffer(_ *webrtc.OfferOptions) (webrtc.SessionDescription, error) {
@@ -0,0 +1,235 @@
+package rtp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNegotiationPeer exchanges the sdp of an endpoint with a remote endpoint in order, like a signal channel
+type testNegotiationPeer struct {
+	endpoint *Endpoint
+	pc       *webrtc.PeerConnection
+	remote   *testNegotiationPeer
+	inbox    chan webrtc.SessionDescription
+	ignored  atomic.Int32
+	ctx      context.Context
+}
+
+func testNegotiationPeerSetup(t *testing.T, polite bool) *testNegotiationPeer {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		cancel()
+		_ = pc.Close()
+	})
+
+	peer := &testNegotiationPeer{pc: pc, inbox: make(chan webrtc.SessionDescription, 32)}
+	options := []EndpointOption{EndpointWithNegotiationNeededListener(func(offer webrtc.SessionDescription) {
+		peer.remote.inbox <- offer
+	})}
+	if polite {
+		options = append(options, EndpointWithPoliteNegotiation())
+	}
+	peer.endpoint = newEndpoint(ctx, uuid.NewString(), uuid.NewString(), EgressEndpoint, options...)
+	peer.endpoint.peerConnection = pc
+	// without a listener pion stops to trigger the negotiation, the first offer is made by hand
+	pc.OnNegotiationNeeded(func() {})
+	peer.endpoint.SetInitComplete()
+	peer.ctx = ctx
+	return peer
+}
+
+func testNegotiationSetup(t *testing.T) (*testNegotiationPeer, *testNegotiationPeer) {
+	t.Helper()
+	polite := testNegotiationPeerSetup(t, true)
+	impolite := testNegotiationPeerSetup(t, false)
+	polite.remote, impolite.remote = impolite, polite
+	return polite, impolite
+}
+
+// testNegotiationConnect establishes the connection of both peers, like the first offer of a session, and then lets
+// both endpoints renegotiate on their own
+func testNegotiationConnect(t *testing.T, polite *testNegotiationPeer, impolite *testNegotiationPeer) {
+	t.Helper()
+	_, err := polite.pc.CreateDataChannel("signal", nil)
+	assert.NoError(t, err)
+	offer, err := polite.pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	gathered := webrtc.GatheringCompletePromise(polite.pc)
+	assert.NoError(t, polite.pc.SetLocalDescription(offer))
+	<-gathered
+
+	assert.NoError(t, impolite.pc.SetRemoteDescription(*polite.pc.LocalDescription()))
+	answer, err := impolite.pc.CreateAnswer(nil)
+	assert.NoError(t, err)
+	gathered = webrtc.GatheringCompletePromise(impolite.pc)
+	assert.NoError(t, impolite.pc.SetLocalDescription(answer))
+	<-gathered
+	assert.NoError(t, polite.pc.SetRemoteDescription(*impolite.pc.LocalDescription()))
+
+	assert.Eventually(t, func() bool {
+		return polite.pc.ConnectionState() == webrtc.PeerConnectionStateConnected &&
+			impolite.pc.ConnectionState() == webrtc.PeerConnectionStateConnected
+	}, 10*time.Second, 20*time.Millisecond)
+
+	for _, peer := range []*testNegotiationPeer{polite, impolite} {
+		peer.pc.OnNegotiationNeeded(peer.endpoint.doRenegotiation)
+		go peer.run(peer.ctx)
+	}
+}
+
+func (p *testNegotiationPeer) run(ctx context.Context) {
+	for {
+		select {
+		case sdp := <-p.inbox:
+			switch sdp.Type {
+			case webrtc.SDPTypeOffer:
+				answer, err := p.endpoint.SetNewOffer(&sdp)
+				if errors.Is(err, ErrOfferCollision) {
+					p.ignored.Add(1)
+					continue
+				}
+				if err == nil {
+					p.remote.inbox <- *answer
+				}
+			case webrtc.SDPTypeAnswer:
+				_ = p.endpoint.SetAnswer(&sdp)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receivesAll reports whether the negotiation is stable and the remote peer knows all tracks of the peer
+func (p *testNegotiationPeer) receivesAll() bool {
+	if p.pc.SignalingState() != webrtc.SignalingStateStable || p.remote.pc.SignalingState() != webrtc.SignalingStateStable {
+		return false
+	}
+	remote := p.remote.pc.RemoteDescription()
+	if remote == nil {
+		return false
+	}
+	for _, sender := range p.pc.GetSenders() {
+		if track := sender.Track(); track != nil && !strings.Contains(remote.SDP, track.ID()) {
+			return false
+		}
+	}
+	return true
+}
+
+func testNegotiationTrack(t *testing.T, i int) *TrackInfo {
+	t.Helper()
+	if i%2 == 0 {
+		return testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+	}
+	return testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+}
+
+func testLocalOffer(t *testing.T, peer *testNegotiationPeer) webrtc.SessionDescription {
+	t.Helper()
+	_, err := peer.pc.AddTrack(testSlotSourceSetup(t, webrtc.MimeTypeOpus).GetTrack())
+	assert.NoError(t, err)
+	offer, err := peer.pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	return offer
+}
+
+func TestEndpointPerfectNegotiation(t *testing.T) {
+	t.Run("impolite endpoint ignores a colliding offer", func(t *testing.T) {
+		polite, impolite := testNegotiationSetup(t)
+		ownOffer := testLocalOffer(t, impolite)
+		assert.NoError(t, impolite.pc.SetLocalDescription(ownOffer))
+
+		_, err := impolite.endpoint.SetNewOffer(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testLocalOffer(t, polite).SDP})
+
+		assert.ErrorIs(t, err, ErrOfferCollision)
+		assert.Equal(t, webrtc.SignalingStateHaveLocalOffer, impolite.pc.SignalingState())
+	})
+
+	t.Run("polite endpoint drops its own offer", func(t *testing.T) {
+		polite, impolite := testNegotiationSetup(t)
+		_, err := polite.pc.AddTrack(testSlotSourceSetup(t, webrtc.MimeTypeVP8).GetTrack())
+		assert.NoError(t, err)
+		polite.endpoint.doRenegotiation()
+		ownOffer := <-impolite.inbox
+
+		answer, err := polite.endpoint.SetNewOffer(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testLocalOffer(t, impolite).SDP})
+
+		assert.NoError(t, err)
+		assert.Equal(t, webrtc.SDPTypeAnswer, answer.Type)
+		assert.Equal(t, webrtc.SignalingStateStable, polite.pc.SignalingState())
+		assert.ErrorIs(t, polite.endpoint.SetAnswer(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: ownOffer.SDP}), ErrNoPendingOffer)
+	})
+
+	t.Run("renegotiation during a pending offer runs after the answer", func(t *testing.T) {
+		polite, impolite := testNegotiationSetup(t)
+		_, err := polite.pc.AddTrack(testSlotSourceSetup(t, webrtc.MimeTypeVP8).GetTrack())
+		assert.NoError(t, err)
+		polite.endpoint.doRenegotiation()
+		ownOffer := <-impolite.inbox
+		polite.endpoint.doRenegotiation()
+		assert.Len(t, impolite.inbox, 0)
+
+		answer, err := impolite.endpoint.SetNewOffer(&ownOffer)
+		assert.NoError(t, err)
+		assert.NoError(t, polite.endpoint.SetAnswer(answer))
+
+		select {
+		case offer := <-impolite.inbox:
+			assert.Equal(t, webrtc.SDPTypeOffer, offer.Type)
+		case <-time.After(5 * time.Second):
+			t.Fatal("renegotiation was lost")
+		}
+	})
+
+	t.Run("answer without pending offer is ignored", func(t *testing.T) {
+		polite, _ := testNegotiationSetup(t)
+
+		err := polite.endpoint.SetAnswer(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "--a--"})
+
+		assert.ErrorIs(t, err, ErrNoPendingOffer)
+	})
+
+	t.Run("both endpoints change tracks at the same time", func(t *testing.T) {
+		polite, impolite := testNegotiationSetup(t)
+		testNegotiationConnect(t, polite, impolite)
+
+		for round := 0; round < 4; round++ {
+			var wg sync.WaitGroup
+			for _, peer := range []*testNegotiationPeer{polite, impolite} {
+				wg.Add(1)
+				go func(peer *testNegotiationPeer) {
+					defer wg.Done()
+					peer.endpoint.AddTrack(context.Background(), testNegotiationTrack(t, round))
+				}(peer)
+			}
+			wg.Wait()
+		}
+
+		assert.Eventually(t, func() bool { return polite.receivesAll() && impolite.receivesAll() }, 10*time.Second, 20*time.Millisecond)
+		assert.Len(t, polite.pc.GetSenders(), 4)
+		assert.Len(t, impolite.pc.GetSenders(), 4)
+	})
+	t.Run("endpoint is connected when ICE and DTLS are connected", func(t *testing.T) {
+		polite, impolite := testNegotiationSetup(t)
+		assert.False(t, polite.endpoint.IsConnected())
+
+		testNegotiationConnect(t, polite, impolite)
+
+		assert.Eventually(t, func() bool { return polite.endpoint.IsConnected() && impolite.endpoint.IsConnected() }, 5*time.Second, 20*time.Millisecond)
+		assert.NoError(t, impolite.pc.Close())
+		assert.False(t, impolite.endpoint.IsConnected())
+	})
+}
@@ -67,3 +67,89 @@ func EndpointWithTrackDispatcher(dispatcher TrackDispatcher) func(endpoint *Endp
 		endpoint.dispatcher = dispatcher
 	}
 }
+
+// EndpointWithSlotPool pre-allocates audio and video slots on an egress endpoint.
+// Tracks are shown in a free slot of the pool, so adding a track needs no renegotiation.
+func EndpointWithSlotPool(audioSlots int, videoSlots int) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.slotPoolAudio = audioSlots
+		endpoint.slotPoolVideo = videoSlots
+	}
+}
+
+func EndpointWithSlotMappingListener(onSlotMapping func(mapping TrackSlotMapping)) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.onSlotMapping = onSlotMapping
+	}
+}
+
+// EndpointWithKeyframeCache caches the packets since the last keyframe of every ingress video track,
+// new egress peers start with the cached keyframe. The size is the maximum size of the cache per track in bytes.
+func EndpointWithKeyframeCache(size int) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.keyframeCacheSize = size
+	}
+}
+
+// EndpointWithSendQueue gives every remote peer of the ingress tracks its own send queue with the given number of packets.
+// A remote peer with a congested connection drops packets, but does not delay the other remote peers.
+func EndpointWithSendQueue(packets int) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.sendQueueSize = packets
+	}
+}
+
+// EndpointWithRetransmission answers the NACKs of the remote peers from a retransmission buffer of the given number
+// of packets per ingress video track. Egress endpoints read the NACKs of their remote peer.
+func EndpointWithRetransmission(packets int) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.retransmitSize = packets
+	}
+}
+
+// EndpointWithRedundancy reads the loss of the remote peer of an egress endpoint. The redundancy of RED tracks is
+// forwarded as long as the loss in percent reaches the threshold and stripped below the half of the threshold.
+func EndpointWithRedundancy(lossThreshold int) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.redundancy = true
+		endpoint.redundancyLossThreshold = lossThreshold
+	}
+}
+
+// EndpointWithSvc reads the layers of the scalable video tracks of an ingress endpoint. Egress endpoints select
+// the layers for their remote peer, temporal layers are dropped while the loss in percent reaches the threshold.
+func EndpointWithSvc(lossThreshold int) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.svc = true
+		endpoint.svcLossThreshold = lossThreshold
+	}
+}
+
+// EndpointWithVideoQuality limits the spatial layers of the scalable video tracks to the video quality of their media stream
+func EndpointWithVideoQuality(videoQuality func(mediaStreamId string) VideoQuality) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.videoQuality = videoQuality
+	}
+}
+
+// EndpointWithTranscoding sends video tracks transcoded by the pool to a remote peer that does not support the codec of a track
+func EndpointWithTranscoding(pool *TranscodingPool) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.transcoding = pool
+	}
+}
+
+// EndpointWithProgram sends the main program instead of the tracks of the lobby, the endpoint needs no track list and no signalling
+func EndpointWithProgram(program *ProgramOutput) func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.program = program
+	}
+}
+
+// EndpointWithPoliteNegotiation makes the endpoint the polite peer of the perfect negotiation. On an offer collision
+// the polite endpoint drops its own offer and answers the remote offer. Only one of two peers can be polite.
+func EndpointWithPoliteNegotiation() func(endpoint *Endpoint) {
+	return func(endpoint *Endpoint) {
+		endpoint.polite = true
+	}
+}
@@ -8,19 +8,34 @@ import (
 	"github.com/pion/interceptor"
 	"github.com/pion/interceptor/pkg/intervalpli"
 	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/shigde/sfu/internal/static"
 	"golang.org/x/exp/slog"
 )
 
 type Engine struct {
-	config webrtc.Configuration
+	config         webrtc.Configuration
+	slotPool       EgressSlotPool
+	keyframeCache  KeyframeCache
+	sendQueue      SendQueue
+	retransmission Retransmission
+	redundancy     Redundancy
+	svc            Svc
+	transcoding    Transcoding
 }
 
 func NewEngine(rtpConfig *RtpConfig) (*Engine, error) {
 	config := rtpConfig.getWebrtcConf()
 	return &Engine{
-		config: config,
+		config:         config,
+		slotPool:       rtpConfig.EgressSlotPool,
+		keyframeCache:  rtpConfig.KeyframeCache,
+		sendQueue:      rtpConfig.SendQueue,
+		retransmission: rtpConfig.Retransmission,
+		redundancy:     rtpConfig.Redundancy,
+		svc:            rtpConfig.Svc,
+		transcoding:    rtpConfig.Transcoding,
 	}, nil
 }
 
@@ -35,6 +50,19 @@ func (e *Engine) createApi(apiOptions ...engineApiOption) (*engineApi, error) {
 	if err := m.RegisterDefaultCodecs(); err != nil {
 		return nil, fmt.Errorf("register  default codecs: %w ", err)
 	}
+	// The audio level of the ingress tracks is needed for the active speaker detection
+	if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, fmt.Errorf("register audio level header extension: %w ", err)
+	}
+	if err := registerRedundancyCodecs(m, api.redundancy.Audio, api.redundancy.Video); err != nil {
+		return nil, fmt.Errorf("register redundancy codecs: %w ", err)
+	}
+	// The layers of AV1 are described by the dependency descriptor
+	if api.svc {
+		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: DependencyDescriptorURI}, webrtc.RTPCodecTypeVideo); err != nil {
+			return nil, fmt.Errorf("register dependency descriptor header extension: %w ", err)
+		}
+	}
 
 	var statsInterceptorFactory *stats.InterceptorFactory
 	var err error
@@ -54,7 +82,7 @@ func (e *Engine) createApi(apiOptions ...engineApiOption) (*engineApi, error) {
 	i := &interceptor.Registry{}
 
 	// Use the default set of Interceptors
-	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+	if err := registerInterceptors(m, i, api); err != nil {
 		return nil, fmt.Errorf("register default interceptors: %w ", err)
 	}
 
@@ -76,11 +104,51 @@ func (e *Engine) createApi(apiOptions ...engineApiOption) (*engineApi, error) {
 }
 
 func (e *Engine) EstablishEndpoint(ctx context.Context, sessionCtx context.Context, sessionId uuid.UUID, liveStream uuid.UUID, offer webrtc.SessionDescription, endpointType EndpointType, options ...EndpointOption) (*Endpoint, error) {
-	return EstablishEndpoint(ctx, sessionCtx, e, sessionId, liveStream, offer, endpointType, options...)
+	return EstablishEndpoint(ctx, sessionCtx, e, sessionId, liveStream, offer, endpointType, e.withEndpointOptions(endpointType, options)...)
 }
 
+// OfferEndpoint creates an endpoint that makes the first offer, the answer of the remote peer is set with Endpoint.SetAnswer
 func (e *Engine) OfferEndpoint(ctx context.Context, sessionCtx context.Context, sessionId uuid.UUID, liveStream uuid.UUID, endpointType EndpointType, options ...EndpointOption) (*Endpoint, error) {
-	return nil, nil
+	return OfferEndpoint(ctx, sessionCtx, e, sessionId, liveStream, endpointType, e.withEndpointOptions(endpointType, options)...)
+}
+
+// withEndpointOptions adds the configured options of the engine, options of the caller are applied afterwards
+func (e *Engine) withEndpointOptions(endpointType EndpointType, options []EndpointOption) []EndpointOption {
+	if endpointType == EgressEndpoint {
+		options = e.withSlotPool(options)
+	}
+	if endpointType == IngressEndpoint && e.keyframeCache.MaxBytes > 0 {
+		options = append([]EndpointOption{EndpointWithKeyframeCache(e.keyframeCache.MaxBytes)}, options...)
+	}
+	if endpointType == IngressEndpoint && e.sendQueue.Packets > 0 {
+		options = append([]EndpointOption{EndpointWithSendQueue(e.sendQueue.Packets)}, options...)
+	}
+	if e.retransmission.Packets > 0 {
+		options = append([]EndpointOption{EndpointWithRetransmission(e.retransmission.Packets)}, options...)
+	}
+	if endpointType == EgressEndpoint && e.redundancy.enabled() {
+		options = append([]EndpointOption{EndpointWithRedundancy(e.redundancy.LossThreshold)}, options...)
+	}
+	if e.svc.Enabled {
+		options = append([]EndpointOption{EndpointWithSvc(e.svc.LossThreshold)}, options...)
+	}
+	return options
+}
+
+// NewTranscodingPool creates the transcoders of a lobby, it returns nil if transcoding is disabled
+func (e *Engine) NewTranscodingPool(ctx context.Context) *TranscodingPool {
+	if !e.transcoding.Enabled {
+		return nil
+	}
+	return newTranscodingPool(ctx, e.transcoding)
+}
+
+// withSlotPool adds the configured slot pool, options of the caller are applied afterwards and can override the pool
+func (e *Engine) withSlotPool(options []EndpointOption) []EndpointOption {
+	if !e.slotPool.enabled() {
+		return options
+	}
+	return append([]EndpointOption{EndpointWithSlotPool(e.slotPool.Audio, e.slotPool.Video)}, options...)
 }
 
 func creatDC(pc *webrtc.PeerConnection, onChannel func(dc *webrtc.DataChannel)) error {
@@ -112,7 +180,7 @@ func (e *Engine) EstablishIngressEndpoint(ctx context.Context, sessionId uuid.UU
 // EstablishEgressEndpoint
 // Deprecated: Because the Endpoint API is getting simpler
 func (e *Engine) EstablishEgressEndpoint(ctx context.Context, sessionId uuid.UUID, liveStream uuid.UUID, options ...EndpointOption) (*Endpoint, error) {
-	return EstablishEgressEndpoint(ctx, e, sessionId, liveStream, options...)
+	return EstablishEgressEndpoint(ctx, e, sessionId, liveStream, e.withSlotPool(options)...)
 }
 
 // EstablishStaticEgressEndpoint
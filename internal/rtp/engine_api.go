@@ -1,13 +1,21 @@
 package rtp
 
 import (
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/interceptor/pkg/report"
 	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/webrtc/v3"
 )
 
 type engineApi struct {
 	*webrtc.API
-	onStatsGetter func(getter stats.Getter)
+	onStatsGetter     func(getter stats.Getter)
+	sfuRetransmission bool
+	redundancy        Redundancy
+	getSyncSource     func(ssrc uint32) (syncSource, bool)
+	svc               bool
+	remb              bool
 }
 
 type engineApiOption func(enginApi *engineApi)
@@ -17,3 +25,68 @@ func withOnStatsGetter(onStatsGetter func(getter stats.Getter)) func(api *engine
 		api.onStatsGetter = onStatsGetter
 	}
 }
+
+// withSfuRetransmission leaves the NACK responder out, the endpoint answers the NACKs itself
+func withSfuRetransmission(enabled bool) func(api *engineApi) {
+	return func(api *engineApi) {
+		api.sfuRetransmission = enabled
+	}
+}
+
+// withRedundancy negotiates the redundancy codecs
+func withRedundancy(redundancy Redundancy) func(api *engineApi) {
+	return func(api *engineApi) {
+		api.redundancy = redundancy
+	}
+}
+
+// withSyncSource provides the clock of the publisher for the sender reports of the sent streams
+func withSyncSource(getSyncSource func(ssrc uint32) (syncSource, bool)) func(api *engineApi) {
+	return func(api *engineApi) {
+		api.getSyncSource = getSyncSource
+	}
+}
+
+// withSvc negotiates the dependency descriptor of AV1
+func withSvc(enabled bool) func(api *engineApi) {
+	return func(api *engineApi) {
+		api.svc = enabled
+	}
+}
+
+// withRemb lets the remote peer estimate the bandwidth of the received media with REMB. The transport-wide sequence
+// numbers are left out, a browser that receives packets without them estimates the bandwidth itself and sends REMB.
+// An endpoint that only sends needs no transport-cc feedback anyway.
+func withRemb(enabled bool) func(api *engineApi) {
+	return func(api *engineApi) {
+		api.remb = enabled
+	}
+}
+
+// registerInterceptors registers the default interceptors of pion, but the sender reports carry the clock of the publisher.
+// The NACK responder is left out, if the endpoint answers the NACKs itself.
+func registerInterceptors(m *webrtc.MediaEngine, i *interceptor.Registry, api *engineApi) error {
+	if api.sfuRetransmission {
+		generator, err := nack.NewGeneratorInterceptor()
+		if err != nil {
+			return err
+		}
+		m.RegisterFeedback(webrtc.RTCPFeedback{Type: "nack"}, webrtc.RTPCodecTypeVideo)
+		m.RegisterFeedback(webrtc.RTCPFeedback{Type: "nack", Parameter: "pli"}, webrtc.RTPCodecTypeVideo)
+		i.Add(generator)
+	} else if err := webrtc.ConfigureNack(m, i); err != nil {
+		return err
+	}
+
+	receiverReports, err := report.NewReceiverInterceptor()
+	if err != nil {
+		return err
+	}
+	i.Add(receiverReports)
+	i.Add(newSenderReportFactory(api.getSyncSource))
+	if api.remb {
+		// the video codecs of pion already offer goog-remb
+		return nil
+	}
+	return webrtc.ConfigureTWCCSender(m, i)
+}
@@ -36,6 +36,9 @@ func EstablishEgressEndpoint(sessionCxt context.Context, e *Engine, sessionId uu
 	}
 	endpoint.peerConnection = peerConnection
 	endpoint.peerConnection.OnICEConnectionStateChange(endpoint.onICEConnectionStateChange)
+	if err = endpoint.setupSlotPool(); err != nil {
+		return nil, fmt.Errorf("setup slot pool: %w", err)
+	}
 
 	initComplete := make(chan struct{})
 
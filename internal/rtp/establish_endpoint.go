@@ -32,6 +32,10 @@ func EstablishEndpoint(ctx context.Context, sessionCxt context.Context, e *Engin
 		}
 
 		endpoint.receiver = newReceiver(sessionCxt, sessionId, liveStream, endpoint.dispatcher, endpoint.trackSdpInfoRepository)
+		endpoint.receiver.keyframeCacheSize = endpoint.keyframeCacheSize
+		endpoint.receiver.sendQueueSize = endpoint.sendQueueSize
+		endpoint.receiver.retransmitSize = endpoint.retransmitSize
+		endpoint.receiver.svc = endpoint.svc
 	}
 
 	// Setup stats
@@ -44,7 +48,7 @@ func EstablishEndpoint(ctx context.Context, sessionCxt context.Context, e *Engin
 		endpoint.statsRegistry = statsRegistry
 	})
 
-	api, err := e.createApi(withStatsGetter)
+	api, err := e.createApi(withStatsGetter, withSfuRetransmission(endpoint.retransmitSize > 0), withRedundancy(e.redundancy), withSyncSource(endpoint.getSyncSource), withSvc(endpoint.svc), withRemb(endpointType == EgressEndpoint))
 	if err != nil {
 		return nil, telemetry.RecordErrorf(span, "creating api", err)
 	}
@@ -60,6 +64,14 @@ func EstablishEndpoint(ctx context.Context, sessionCxt context.Context, e *Engin
 
 	// sending tracks only for needed egress
 	if endpointType == EgressEndpoint {
+		// the slots of the pool and the program tracks have to match the media sections of the offer
+		if endpoint.program != nil {
+			if err := endpoint.setupProgram(); err != nil {
+				return nil, telemetry.RecordErrorf(span, "setup program", err)
+			}
+		} else if err := endpoint.setupSlotPool(); err != nil {
+			return nil, telemetry.RecordErrorf(span, "setup slot pool", err)
+		}
 		setupOnNegotiationNeeded(sessionCxt, endpoint, sessionId, liveStream)
 	}
 
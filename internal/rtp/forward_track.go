@@ -0,0 +1,214 @@
+package rtp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// forwardTrack is the local track of an ingress track as it is added to a peer connection or a slot.
+// Every forwardTrack is bound once and sends the features of the ingress track to this binding:
+// the own send queue of the packet fanout, the keyframe cache, the retransmission of lost packets, the redundancy
+// and the layers of scalable video.
+type forwardTrack struct {
+	*webrtc.TrackLocalStaticRTP
+	keyframeCache *keyframeCache
+	fanout        *packetFanout
+	retransmits   *retransmitBuffer
+	redundancy    *redundancyCodecs
+	clock         *trackClock
+	svc           *svcCodec
+
+	mu               sync.Mutex
+	writer           webrtc.TrackLocalWriter
+	ssrc             uint32
+	payloadType      uint8
+	subscriber       *fanoutSubscriber
+	redundancyWriter *redundancyWriter
+	svcWriter        *svcWriter
+	// the video quality can be set before the binding exists
+	videoQuality    VideoQuality
+	hasVideoQuality bool
+}
+
+func (t *forwardTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	var redundancyCtx *redundancyContext
+	var redundancyCodec webrtc.RTPCodecParameters
+	if t.redundancy != nil {
+		var err error
+		if redundancyCtx, redundancyCodec, err = t.redundancy.bind(ctx, t.Codec()); err != nil {
+			return redundancyCodec, err
+		}
+		ctx = redundancyCtx
+	}
+	var svcCtx *svcContext
+	if t.svc != nil {
+		historySize := 0
+		if t.retransmits != nil {
+			historySize = t.retransmits.size()
+		}
+		svcCtx = &svcContext{TrackLocalContext: ctx, writer: t.svc.newWriter(ctx.WriteStream(), historySize)}
+		ctx = svcCtx
+		t.mu.Lock()
+		if t.hasVideoQuality {
+			svcCtx.writer.setMaxSpatialLayer(svcSpatialLayer(t.videoQuality))
+		}
+		t.mu.Unlock()
+	}
+
+	codec, err := t.bind(ctx)
+	if err != nil {
+		return codec, err
+	}
+	if svcCtx != nil {
+		t.mu.Lock()
+		t.svcWriter = svcCtx.writer
+		t.mu.Unlock()
+	}
+	if redundancyCtx != nil {
+		t.mu.Lock()
+		t.redundancyWriter = redundancyCtx.writer
+		t.mu.Unlock()
+		return redundancyCodec, nil
+	}
+	return codec, nil
+}
+
+func (t *forwardTrack) bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	if t.fanout != nil {
+		codec, err := findBindingCodec(t.Codec(), ctx.CodecParameters())
+		if err != nil {
+			return codec, err
+		}
+		subscriber, err := t.fanout.subscribe(ctx.ID(), ctx.SSRC(), codec.PayloadType, ctx.WriteStream())
+		if err != nil {
+			return codec, err
+		}
+		t.setBinding(ctx, codec, subscriber)
+		return codec, nil
+	}
+
+	bindCtx := ctx
+	if t.keyframeCache != nil {
+		bindCtx = &keyframeCacheContext{
+			TrackLocalContext: ctx,
+			writer:            &keyframeCacheWriter{TrackLocalWriter: ctx.WriteStream(), cache: t.keyframeCache},
+		}
+	}
+	codec, err := t.TrackLocalStaticRTP.Bind(bindCtx)
+	if err == nil {
+		t.setBinding(ctx, codec, nil)
+	}
+	return codec, err
+}
+
+func (t *forwardTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.Lock()
+	t.writer, t.subscriber, t.redundancyWriter, t.svcWriter = nil, nil, nil, nil
+	t.mu.Unlock()
+	if t.fanout != nil {
+		if !t.fanout.unsubscribe(ctx.ID()) {
+			return webrtc.ErrUnbindFailed
+		}
+		return nil
+	}
+	return t.TrackLocalStaticRTP.Unbind(ctx)
+}
+
+func (t *forwardTrack) setBinding(ctx webrtc.TrackLocalContext, codec webrtc.RTPCodecParameters, subscriber *fanoutSubscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writer = ctx.WriteStream()
+	t.ssrc = uint32(ctx.SSRC())
+	t.payloadType = uint8(codec.PayloadType)
+	t.subscriber = subscriber
+}
+
+// retransmit answers a NACK of the bound egress peer from the retransmission buffer of the ingress track
+func (t *forwardTrack) retransmit(seqs []uint16) int {
+	t.mu.Lock()
+	writer, ssrc, payloadType, svcWriter := t.writer, t.ssrc, t.payloadType, t.svcWriter
+	t.mu.Unlock()
+	if t.retransmits == nil || writer == nil {
+		return 0
+	}
+	return retransmitPackets(t.retransmits, seqs, t.originalSeq, func(packet *rtp.Packet) error {
+		packet.SSRC = ssrc
+		packet.PayloadType = payloadType
+		var err error
+		if svcWriter != nil {
+			_, err = svcWriter.writeRetransmission(&packet.Header, packet.Payload)
+		} else {
+			_, err = writer.WriteRTP(&packet.Header, packet.Payload)
+		}
+		return err
+	})
+}
+
+// originalSeq maps a sequence number sent to the binding to the sequence number of the ingress track
+func (t *forwardTrack) originalSeq(seq uint16) (uint16, bool) {
+	t.mu.Lock()
+	subscriber, svcWriter := t.subscriber, t.svcWriter
+	t.mu.Unlock()
+	if svcWriter != nil {
+		var ok bool
+		if seq, ok = svcWriter.originalSeq(seq); !ok {
+			return 0, false
+		}
+	}
+	if subscriber == nil {
+		return seq, true
+	}
+	return subscriber.originalSeq(seq)
+}
+
+// forwardRedundancy switches the redundancy of a RED track for the bound egress peer on or off
+func (t *forwardTrack) forwardRedundancy(enabled bool) {
+	t.mu.Lock()
+	writer := t.redundancyWriter
+	t.mu.Unlock()
+	if writer != nil {
+		writer.forwardRedundancy(enabled)
+	}
+}
+
+// syncClock returns the clock of the publisher, the timestamps of the ingress track are forwarded unchanged
+func (t *forwardTrack) syncClock(now time.Time) (uint64, uint32, bool) {
+	if t.clock == nil {
+		return 0, 0, false
+	}
+	return t.clock.at(now)
+}
+
+// setVideoQuality limits the spatial layers of a scalable video track to the video quality the remote peer subscribed
+func (t *forwardTrack) setVideoQuality(quality VideoQuality) {
+	t.mu.Lock()
+	t.videoQuality, t.hasVideoQuality = quality, true
+	writer := t.svcWriter
+	t.mu.Unlock()
+	if writer != nil {
+		writer.setMaxSpatialLayer(svcSpatialLayer(quality))
+	}
+}
+
+// setTargetBitrate limits the layers of a scalable video track to the estimated bitrate of the remote peer
+func (t *forwardTrack) setTargetBitrate(bitrate uint64) {
+	if writer := t.getSvcWriter(); writer != nil {
+		writer.setTargetBitrate(bitrate)
+	}
+}
+
+// adaptToLoss drops or adds temporal layers of a scalable video track depending on the loss of the remote peer
+func (t *forwardTrack) adaptToLoss(loss int, threshold int) {
+	if writer := t.getSvcWriter(); writer != nil {
+		writer.adaptToLoss(loss, threshold)
+	}
+}
+
+func (t *forwardTrack) getSvcWriter() *svcWriter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.svcWriter
+}
@@ -0,0 +1,183 @@
+package rtp
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+)
+
+// keyframeCache holds the packets of a video track since the last keyframe, the group of pictures.
+// Every new binding of the track receives the cached packets before the live packets, so a new viewer
+// can start decoding immediately instead of waiting for the next keyframe.
+// The cache is bounded by size, a group of pictures that does not fit is dropped until the next keyframe.
+type keyframeCache struct {
+	mu         sync.RWMutex
+	maxSize    int
+	isKeyframe func(payload []byte) bool
+	packets    [][]byte
+	size       int
+	timestamp  uint32
+	// no keyframe since the start or the last overflow
+	waiting bool
+}
+
+// newKeyframeCache returns nil if the keyframes of the codec can not be detected
+func newKeyframeCache(codec webrtc.RTPCodecCapability, maxSize int) *keyframeCache {
+	isKeyframe := keyframeDetector(codec)
+	if isKeyframe == nil {
+		return nil
+	}
+	return &keyframeCache{maxSize: maxSize, isKeyframe: isKeyframe, waiting: true}
+}
+
+// add caches a raw rtp packet, it has to be called before the packet is written to the track
+func (c *keyframeCache) add(raw []byte) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(raw); err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a keyframe can start with several packets of the same timestamp, like the parameter sets of H264
+	if c.isKeyframe(packet.Payload) && (c.waiting || packet.Timestamp != c.timestamp) {
+		c.packets = c.packets[:0]
+		c.size = 0
+		c.timestamp = packet.Timestamp
+		c.waiting = false
+	}
+	if c.waiting {
+		return
+	}
+	if c.size+len(raw) > c.maxSize {
+		c.packets = nil
+		c.size = 0
+		c.waiting = true
+		return
+	}
+	c.packets = append(c.packets, append([]byte(nil), raw...))
+	c.size += len(raw)
+}
+
+// snapshot returns the cached packets, the packets are not changed after they are cached
+func (c *keyframeCache) snapshot() [][]byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.waiting {
+		return nil
+	}
+	return append([][]byte(nil), c.packets...)
+}
+
+type keyframeCacheContext struct {
+	webrtc.TrackLocalContext
+	writer *keyframeCacheWriter
+}
+
+func (c *keyframeCacheContext) WriteStream() webrtc.TrackLocalWriter {
+	return c.writer
+}
+
+// keyframeCacheWriter sends the cached packets in front of the first live packet of a binding.
+// The cached packets keep their sequence numbers, so they continue seamlessly with the live packets.
+// Slots rewrite the sequence numbers and timestamps of the cached packets like the ones of the live packets.
+// The track is written by a single media writer, that's why the writer itself is not synchronized.
+type keyframeCacheWriter struct {
+	webrtc.TrackLocalWriter
+	cache   *keyframeCache
+	flushed bool
+}
+
+func (w *keyframeCacheWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	if !w.flushed {
+		if ready, err := w.flush(header); !ready || err != nil {
+			return 0, err
+		}
+	}
+	return w.TrackLocalWriter.WriteRTP(header, payload)
+}
+
+// flush writes the cached packets before the live packet. A binding is not ready as long as the connection
+// is not established, pion drops the packets without error and with 0 written bytes in this case.
+func (w *keyframeCacheWriter) flush(live *rtp.Header) (bool, error) {
+	for i, raw := range w.cache.snapshot() {
+		packet := &rtp.Packet{}
+		if err := packet.Unmarshal(raw); err != nil {
+			continue
+		}
+		// the live packet is the last cached packet
+		if packet.SequenceNumber == live.SequenceNumber {
+			break
+		}
+		packet.SSRC = live.SSRC
+		packet.PayloadType = live.PayloadType
+		n, err := w.TrackLocalWriter.WriteRTP(&packet.Header, packet.Payload)
+		if err != nil {
+			return false, err
+		}
+		if i == 0 && n == 0 {
+			return false, nil
+		}
+	}
+	w.flushed = true
+	return true, nil
+}
+
+// keyframeDetector returns the keyframe detection of the codec, nil if the keyframes of the codec can not be detected
+func keyframeDetector(codec webrtc.RTPCodecCapability) func(payload []byte) bool {
+	switch {
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8):
+		return isVp8Keyframe
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264):
+		return isH264Keyframe
+	default:
+		return nil
+	}
+}
+
+// isVp8Keyframe checks if a packet is the start of a VP8 keyframe
+func isVp8Keyframe(payload []byte) bool {
+	vp8 := &codecs.VP8Packet{}
+	if _, err := vp8.Unmarshal(payload); err != nil {
+		return false
+	}
+	return vp8.S == 1 && vp8.PID == 0 && len(vp8.Payload) > 0 && vp8.Payload[0]&0x01 == 0
+}
+
+// NAL unit types of H264 (RFC 6184)
+const (
+	h264NaluIdr  = 5
+	h264NaluSps  = 7
+	h264NaluStap = 24
+	h264NaluFuA  = 28
+)
+
+// isH264Keyframe checks if a packet starts an IDR picture or carries the sequence parameter set in front of it
+func isH264Keyframe(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	switch naluType := payload[0] & 0x1F; naluType {
+	case h264NaluIdr, h264NaluSps:
+		return true
+	case h264NaluStap:
+		for offset := 1; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			offset += 2
+			if size == 0 || offset+size > len(payload) {
+				return false
+			}
+			if t := payload[offset] & 0x1F; t == h264NaluIdr || t == h264NaluSps {
+				return true
+			}
+			offset += size
+		}
+	case h264NaluFuA:
+		// start bit of the fragment and type of the fragmented unit
+		return payload[1]&0x80 != 0 && payload[1]&0x1F == h264NaluIdr
+	}
+	return false
+}
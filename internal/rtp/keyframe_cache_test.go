@@ -0,0 +1,119 @@
+package rtp
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testVp8Keyframe     = []byte{0x10, 0x00, 0x9d}
+	testVp8Continuation = []byte{0x00, 0x9d, 0x9d}
+	testVp8Interframe   = []byte{0x10, 0x01, 0x9d}
+)
+
+func testKeyframeCachePacket(t *testing.T, seq uint16, ts uint32, payload []byte) []byte {
+	t.Helper()
+	raw, err := (&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: ts}, Payload: payload}).Marshal()
+	assert.NoError(t, err)
+	return raw
+}
+
+type testRecordingWriter struct {
+	sequenceNumbers []uint16
+}
+
+func (w *testRecordingWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.sequenceNumbers = append(w.sequenceNumbers, header.SequenceNumber)
+	return len(payload), nil
+}
+
+func (w *testRecordingWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func TestKeyframeCache(t *testing.T) {
+	codec := webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}
+
+	t.Run("cache starts with the last keyframe", func(t *testing.T) {
+		cache := newKeyframeCache(codec, 1000)
+		cache.add(testKeyframeCachePacket(t, 1, 100, testVp8Interframe))
+		assert.Empty(t, cache.snapshot())
+
+		cache.add(testKeyframeCachePacket(t, 2, 200, testVp8Keyframe))
+		cache.add(testKeyframeCachePacket(t, 3, 200, testVp8Continuation))
+		cache.add(testKeyframeCachePacket(t, 4, 300, testVp8Interframe))
+		assert.Len(t, cache.snapshot(), 3)
+
+		cache.add(testKeyframeCachePacket(t, 5, 400, testVp8Keyframe))
+		assert.Len(t, cache.snapshot(), 1)
+	})
+
+	t.Run("cache is dropped if it exceeds its size", func(t *testing.T) {
+		packetSize := len(testKeyframeCachePacket(t, 1, 100, testVp8Keyframe))
+		cache := newKeyframeCache(codec, 2*packetSize)
+		cache.add(testKeyframeCachePacket(t, 1, 100, testVp8Keyframe))
+		cache.add(testKeyframeCachePacket(t, 2, 200, testVp8Interframe))
+		cache.add(testKeyframeCachePacket(t, 3, 300, testVp8Interframe))
+		assert.Empty(t, cache.snapshot())
+
+		cache.add(testKeyframeCachePacket(t, 4, 400, testVp8Interframe))
+		assert.Empty(t, cache.snapshot())
+		cache.add(testKeyframeCachePacket(t, 5, 500, testVp8Keyframe))
+		assert.Len(t, cache.snapshot(), 1)
+	})
+
+	t.Run("no cache for codecs without keyframe detection", func(t *testing.T) {
+		assert.Nil(t, newKeyframeCache(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9}, 1000))
+	})
+
+	t.Run("new binding receives the cached packets before the live packets", func(t *testing.T) {
+		cache := newKeyframeCache(codec, 1000)
+		local, err := webrtc.NewTrackLocalStaticRTP(codec, uuid.NewString(), uuid.NewString())
+		assert.NoError(t, err)
+		info := newTrackInfo(local, *newTrackSdpInfo(uuid.New()))
+		info.keyframeCache = cache
+		for seq, payload := range [][]byte{testVp8Keyframe, testVp8Interframe} {
+			raw := testKeyframeCachePacket(t, uint16(10+seq), uint32(100*seq), payload)
+			cache.add(raw)
+			_, _ = local.Write(raw)
+		}
+
+		writer := &testRecordingWriter{}
+		_, err = info.GetTrackLocal().Bind(&baseTrackLocalContext{
+			id:          uuid.NewString(),
+			params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: codec}}},
+			ssrc:        1,
+			writeStream: writer,
+		})
+		assert.NoError(t, err)
+		raw := testKeyframeCachePacket(t, 12, 300, testVp8Interframe)
+		cache.add(raw)
+		_, err = local.Write(raw)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []uint16{10, 11, 12}, writer.sequenceNumbers)
+	})
+}
+
+func TestIsH264Keyframe(t *testing.T) {
+	t.Run("IDR and sequence parameter set are keyframes", func(t *testing.T) {
+		assert.True(t, isH264Keyframe([]byte{0x65, 0x88}))
+		assert.True(t, isH264Keyframe([]byte{0x67, 0x42}))
+		assert.False(t, isH264Keyframe([]byte{0x41, 0x9a}))
+	})
+
+	t.Run("aggregated parameter sets are a keyframe", func(t *testing.T) {
+		assert.True(t, isH264Keyframe([]byte{0x78, 0x00, 0x02, 0x67, 0x42, 0x00, 0x02, 0x68, 0xce}))
+		assert.False(t, isH264Keyframe([]byte{0x78, 0x00, 0x02, 0x41, 0x9a}))
+	})
+
+	t.Run("only the first fragment of an IDR is a keyframe", func(t *testing.T) {
+		assert.True(t, isH264Keyframe([]byte{0x7c, 0x85, 0x88}))
+		assert.False(t, isH264Keyframe([]byte{0x7c, 0x05, 0x88}))
+		assert.False(t, isH264Keyframe([]byte{0x7c, 0x81, 0x88}))
+	})
+}
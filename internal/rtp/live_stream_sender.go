@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/interceptor"
@@ -15,11 +18,12 @@ import (
 )
 
 type LiveStreamSender struct {
-	ctx          context.Context
-	mu           sync.RWMutex
-	id           uuid.UUID
-	audio, video *UdpConnection
-	stopRunning  func()
+	ctx           context.Context
+	mu            sync.RWMutex
+	id            uuid.UUID
+	audio, video  *UdpConnection
+	stopRunning   func()
+	activeSpeaker string // media stream id of the dominant speaker in the lobby
 }
 
 func NewLiveStreamSender(lobbyContext context.Context, id uuid.UUID) (*LiveStreamSender, error) {
@@ -63,10 +67,40 @@ func (f *LiveStreamSender) Run() {
 	}
 
 	f.log("running")
-	select {
-	case <-f.ctx.Done():
+	ticker := time.NewTicker(senderReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.ctx.Done():
+			f.log("quit")
+			return
+		case now := <-ticker.C:
+			f.sendReports(now)
+		}
+	}
+}
+
+// sendReports sends the sender reports with the clock of the publishers, so the muxer keeps audio and video in sync
+func (f *LiveStreamSender) sendReports(now time.Time) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, udp := range []*UdpConnection{f.audio, f.video} {
+		if udp.reports == nil || udp.rtcpConn == nil {
+			continue
+		}
+		raw, err := udp.reports.report(now, udp.sync).Marshal()
+		if err != nil {
+			continue
+		}
+		if _, err = udp.rtcpConn.Write(raw); err != nil && !isConnectionRefused(err) {
+			slog.Debug("forwarder: sending sender report", "err", err, "forwarderID", f.id.String(), "port", udp.port+1)
+		}
 	}
-	f.log("quit")
+}
+
+// isConnectionRefused reports whether the muxer does not listen yet, a UDP write then fails with ECONNREFUSED
+func isConnectionRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
 }
 
 func (f *LiveStreamSender) Stop() {
@@ -84,6 +118,10 @@ func (f *LiveStreamSender) connect(udp *UdpConnection, laddr *net.UDPAddr) error
 	if udp.conn, err = net.DialUDP("udp", laddr, raddr); err != nil {
 		return fmt.Errorf("dealing udp port: %w", err)
 	}
+	rtcpAddr := &net.UDPAddr{IP: raddr.IP, Port: raddr.Port + 1}
+	if udp.rtcpConn, err = net.DialUDP("udp", laddr, rtcpAddr); err != nil {
+		return fmt.Errorf("dealing rtcp udp port: %w", err)
+	}
 
 	f.log(fmt.Sprintf("connected to port %d", udp.port))
 	return err
@@ -102,6 +140,13 @@ func (f *LiveStreamSender) close() error {
 			return fmt.Errorf("closing video udp port: %w", err)
 		}
 	}
+	for _, udp := range []*UdpConnection{f.audio, f.video} {
+		if udp.rtcpConn != nil {
+			if err := udp.rtcpConn.Close(); err != nil {
+				return fmt.Errorf("closing rtcp udp port %d: %w", udp.port+1, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -142,8 +187,7 @@ func (f *LiveStreamSender) writeTrack(udp *UdpConnection, track *webrtc.TrackRem
 					// That's why, for this particular example, the user first needs to provide the answer
 					// to the browser then open the third party application. Therefore we must not kill
 					// the forward on "connection refused" errors
-					var opError *net.OpError
-					if errors.As(writeErr, &opError) && opError.Err.Error() == "write: connection refused" {
+					if isConnectionRefused(writeErr) {
 						continue
 					}
 					return fmt.Errorf("writing pkg: %w", writeErr)
@@ -180,6 +224,8 @@ func (f *LiveStreamSender) AddTrack(track webrtc.TrackLocal) {
 				PayloadType:        111,
 			},
 		}
+		f.audio.reports = newSenderReportStream(uint32(binding.ssrc), 48000)
+		f.audio.sync, _ = track.(syncSource)
 		binding.writeStream = newLiveStreamWriter(f.ctx, uuid.NewString(), f.audio)
 	}
 	if track.Kind() == webrtc.RTPCodecTypeVideo {
@@ -197,6 +243,8 @@ func (f *LiveStreamSender) AddTrack(track webrtc.TrackLocal) {
 				PayloadType: 96,
 			},
 		}
+		f.video.reports = newSenderReportStream(uint32(binding.ssrc), 90000)
+		f.video.sync, _ = track.(syncSource)
 		binding.writeStream = newLiveStreamWriter(f.ctx, uuid.NewString(), f.video)
 	}
 
@@ -205,10 +253,30 @@ func (f *LiveStreamSender) AddTrack(track webrtc.TrackLocal) {
 	}
 }
 
+// AcceptsCodec checks if the muxer of the live stream can read the codec, it reads Opus and VP8
+func (f *LiveStreamSender) AcceptsCodec(codec webrtc.RTPCodecCapability) bool {
+	return strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus) || strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8)
+}
+
 func (f *LiveStreamSender) RemoveTrack(_ webrtc.TrackLocal) {
 
 }
 
+// SetActiveSpeaker is called by the lobby when the dominant speaker changes, an empty id means nobody is speaking
+func (f *LiveStreamSender) SetActiveSpeaker(mediaStreamId string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	slog.Debug("forwarder: set active speaker", "forwarderId", f.id, "mediaStreamId", mediaStreamId)
+	f.activeSpeaker = mediaStreamId
+}
+
+// ActiveSpeaker returns the media stream of the dominant speaker, so that the live output can arrange a speaker layout
+func (f *LiveStreamSender) ActiveSpeaker() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.activeSpeaker
+}
+
 // later -- > put in other file
 type baseTrackLocalContext struct {
 	id              string
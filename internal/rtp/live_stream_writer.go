@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/pion/rtp"
 	"golang.org/x/exp/slog"
@@ -13,18 +14,20 @@ import (
 type liveStreamWriter struct {
 	ctx context.Context
 	sync.Mutex
-	id   string
-	udp  *UdpConnection
-	stop func()
+	id      string
+	udp     *UdpConnection
+	reports *senderReportStream
+	stop    func()
 }
 
 func newLiveStreamWriter(parent context.Context, id string, udp *UdpConnection) *liveStreamWriter {
 	ctx, stop := context.WithCancel(parent)
 	return &liveStreamWriter{
-		ctx:  ctx,
-		id:   id,
-		udp:  udp,
-		stop: stop,
+		ctx:     ctx,
+		id:      id,
+		udp:     udp,
+		reports: udp.reports,
+		stop:    stop,
 	}
 }
 
@@ -70,6 +73,9 @@ func (w *liveStreamWriter) WriteRTP(header *rtp.Header, payload []byte) (int, er
 		return 0, err
 	}
 
+	if w.reports != nil {
+		w.reports.processRTP(time.Now(), header, payload)
+	}
 	n, writeErr := w.udp.conn.Write(pkg)
 	if writeErr != nil {
 		// For this particular example, third party applications usually timeout after a short
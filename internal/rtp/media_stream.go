@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -24,6 +25,12 @@ type mediaStream struct {
 	audioWriter, videoWriter *mediaWriter
 	purpose                  Purpose
 	dispatcher               TrackDispatcher
+	keyframeCacheSize        int
+	videoKeyframeCache       *keyframeCache
+	sendQueueSize            int
+	audioFanout, videoFanout *packetFanout
+	retransmitSize           int
+	videoRetransmits         *retransmitBuffer
 }
 
 func newMediaStream(sessionCxt context.Context, remoteId string, sessionId uuid.UUID, dispatcher TrackDispatcher, purpose Purpose) *mediaStream {
@@ -37,7 +44,7 @@ func newMediaStream(sessionCxt context.Context, remoteId string, sessionId uuid.
 	}
 }
 
-func (s *mediaStream) writeAudioRtp(ctx context.Context, track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) error {
+func (s *mediaStream) writeAudioRtp(ctx context.Context, track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) error {
 	slog.Debug("rtp.mediaStream: write audio track", "streamId", s.id, "remoteTrackId", track.ID(), "purpose", s.purpose.ToString())
 	ctx, span := otel.Tracer(tracerName).Start(ctx, "rtp.ingress: write_audio_rtp")
 	defer span.End()
@@ -47,6 +54,18 @@ func (s *mediaStream) writeAudioRtp(ctx context.Context, track *webrtc.TrackRemo
 	}
 	s.audioTrack = audio
 	s.audioWriter = newMediaWriter(s.sessionCxt, s.audioTrack.ID())
+	if s.sendQueueSize > 0 {
+		s.audioFanout = newPacketFanout(audio.Codec(), s.sendQueueSize)
+		s.audioWriter.withFanout(s.audioFanout)
+	}
+	if levelDispatcher, ok := s.dispatcher.(AudioLevelDispatcher); ok {
+		if extensionId := getAudioLevelExtensionId(receiver); extensionId != 0 {
+			mediaStreamId := s.audioTrack.StreamID()
+			s.audioWriter.withAudioLevel(extensionId, func(level uint8) {
+				levelDispatcher.DispatchAudioLevel(s.sessionId, mediaStreamId, level)
+			})
+		}
+	}
 
 	// start local audio track
 	go func() {
@@ -73,7 +92,7 @@ func (s *mediaStream) writeAudioRtp(ctx context.Context, track *webrtc.TrackRemo
 	return nil
 }
 
-func (s *mediaStream) writeVideoRtp(ctx context.Context, track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) error {
+func (s *mediaStream) writeVideoRtp(ctx context.Context, track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) error {
 	slog.Debug("rtp.ingress: write video track", "streamId", s.id, "remoteTrackId", track.ID(), "purpose", s.purpose.ToString())
 	_, span := otel.Tracer(tracerName).Start(ctx, "rtp.mediaStream: write_video_rtp")
 	defer span.End()
@@ -85,6 +104,21 @@ func (s *mediaStream) writeVideoRtp(ctx context.Context, track *webrtc.TrackRemo
 
 	s.videoTrack = video
 	s.videoWriter = newMediaWriter(s.sessionCxt, s.videoTrack.ID())
+	if s.sendQueueSize > 0 {
+		// the ring buffer of the send queues replaces the keyframe cache
+		s.videoFanout = newPacketFanout(video.Codec(), s.sendQueueSize)
+		s.videoFanout.startWithKeyframe = s.keyframeCacheSize > 0
+		s.videoWriter.withFanout(s.videoFanout)
+	} else if s.keyframeCacheSize > 0 {
+		if cache := newKeyframeCache(video.Codec(), s.keyframeCacheSize); cache != nil {
+			s.videoKeyframeCache = cache
+			s.videoWriter.withKeyframeCache(cache)
+		}
+	}
+	if s.retransmitSize > 0 {
+		s.videoRetransmits = newRetransmitBuffer(s.retransmitSize, requestFromIngress(track, receiver))
+		s.videoWriter.withRetransmitBuffer(s.videoRetransmits)
+	}
 
 	// start local video track
 	go func() {
@@ -139,6 +173,22 @@ func (s *mediaStream) getVideoTrack() *webrtc.TrackLocalStaticRTP {
 	return s.videoTrack
 }
 
+func (s *mediaStream) getVideoKeyframeCache() *keyframeCache {
+	return s.videoKeyframeCache
+}
+
+func (s *mediaStream) getVideoFanout() *packetFanout {
+	return s.videoFanout
+}
+
+func (s *mediaStream) getVideoRetransmits() *retransmitBuffer {
+	return s.videoRetransmits
+}
+
+func (s *mediaStream) getAudioFanout() *packetFanout {
+	return s.audioFanout
+}
+
 func (s *mediaStream) getAudioTrack() *webrtc.TrackLocalStaticRTP {
 	return s.audioTrack
 }
@@ -154,3 +204,29 @@ func (s *mediaStream) setVideoSdpInfo(info TrackSdpInfo) {
 func (s *mediaStream) setAudioSdpInfo(info TrackSdpInfo) {
 	s.audioInfo = info
 }
+
+// requestFromIngress forwards the lost packets of the egress peers, which are not buffered anymore, as NACK to the ingress peer
+func requestFromIngress(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) func(seqs []uint16) {
+	return func(seqs []uint16) {
+		if receiver == nil || receiver.Transport() == nil {
+			return
+		}
+		nack := &rtcp.TransportLayerNack{MediaSSRC: uint32(track.SSRC()), Nacks: rtcp.NackPairsFromSequenceNumbers(seqs)}
+		if _, err := receiver.Transport().WriteRTCP([]rtcp.Packet{nack}); err != nil {
+			slog.Debug("rtp.mediaStream: forwarding nack to ingress", "trackId", track.ID(), "err", err)
+		}
+	}
+}
+
+// keyframeFromIngress sends a PLI to the ingress peer, so that it sends a keyframe of the track
+func keyframeFromIngress(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) func() {
+	return func() {
+		if receiver == nil || receiver.Transport() == nil {
+			return
+		}
+		pli := &rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}
+		if _, err := receiver.Transport().WriteRTCP([]rtcp.Packet{pli}); err != nil {
+			slog.Debug("rtp.mediaStream: sending pli to ingress", "trackId", track.ID(), "err", err)
+		}
+	}
+}
@@ -11,9 +11,14 @@ import (
 )
 
 type mediaWriter struct {
-	id         string
-	sessionCxt context.Context
-	quit       chan struct{}
+	id            string
+	sessionCxt    context.Context
+	quit          chan struct{}
+	audioLevelId  uint8
+	onAudioLevel  func(level uint8)
+	keyframeCache *keyframeCache
+	fanout        *packetFanout
+	retransmits   *retransmitBuffer
 }
 
 func newMediaWriter(sessionCxt context.Context, id string) *mediaWriter {
@@ -24,9 +29,33 @@ func newMediaWriter(sessionCxt context.Context, id string) *mediaWriter {
 	}
 }
 
+// withAudioLevel reads the audio level header extension of every packet before it is written
+func (w *mediaWriter) withAudioLevel(extensionId uint8, onAudioLevel func(level uint8)) {
+	w.audioLevelId = extensionId
+	w.onAudioLevel = onAudioLevel
+}
+
+// withKeyframeCache caches every packet since the last keyframe before it is written
+func (w *mediaWriter) withKeyframeCache(cache *keyframeCache) {
+	w.keyframeCache = cache
+}
+
+// withFanout stores every packet in the send queue of the subscribers, the queue is closed when the writer stops
+func (w *mediaWriter) withFanout(fanout *packetFanout) {
+	w.fanout = fanout
+}
+
+// withRetransmitBuffer buffers every packet for the retransmission to the egress peers
+func (w *mediaWriter) withRetransmitBuffer(buffer *retransmitBuffer) {
+	w.retransmits = buffer
+}
+
 func (w *mediaWriter) writeRtp(remoteTrack *webrtc.TrackRemote, localTrack *webrtc.TrackLocalStaticRTP) error {
 	rtpBuf := make([]byte, rtpBufferSize)
 	slog.Debug("rtp.mediaWriter write RTP", "track id", w.id)
+	if w.fanout != nil {
+		defer w.fanout.close()
+	}
 	for {
 		select {
 		case <-w.sessionCxt.Done():
@@ -47,6 +76,20 @@ func (w *mediaWriter) writeRtp(remoteTrack *webrtc.TrackRemote, localTrack *webr
 				slog.Error("rtp.mediaWriter reading rtp buffer", "track id", w.id)
 				return fmt.Errorf("reading rtp buffer: %w", err)
 			}
+			if w.audioLevelId != 0 {
+				if level, ok := readAudioLevel(rtpBuf[:i], w.audioLevelId); ok {
+					w.onAudioLevel(level)
+				}
+			}
+			if w.keyframeCache != nil {
+				w.keyframeCache.add(rtpBuf[:i])
+			}
+			if w.retransmits != nil {
+				w.retransmits.add(rtpBuf[:i])
+			}
+			if w.fanout != nil {
+				w.fanout.write(rtpBuf[:i])
+			}
 			// ErrClosedPipe means we don't have any subscribers, this is ok if no peers have connected yet
 			if _, err := localTrack.Write(rtpBuf[:i]); err != nil {
 				// stop reading because writing error
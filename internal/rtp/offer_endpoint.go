@@ -0,0 +1,107 @@
+package rtp
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/metric"
+	rtpStats "github.com/shigde/sfu/internal/rtp/stats"
+	"github.com/shigde/sfu/internal/telemetry"
+)
+
+// OfferEndpoint creates an endpoint that makes the first offer of the connection, like a server that connects to
+// another server. An ingress endpoint offers to receive one audio and one video track, an egress endpoint offers the
+// current tracks of the lobby. The answer of the remote peer is set by Endpoint.SetAnswer.
+func OfferEndpoint(ctx context.Context, sessionCxt context.Context, e *Engine, sessionId uuid.UUID, liveStream uuid.UUID, endpointType EndpointType, options ...EndpointOption) (*Endpoint, error) {
+	_, span := newTraceSpan(ctx, sessionCxt, "rtp: offer_endpoint")
+	defer span.End()
+	metric.GraphNodeUpdate(metric.BuildNode(sessionId.String(), liveStream.String(), endpointType.ToString()))
+
+	endpoint := newEndpoint(sessionCxt, sessionId.String(), liveStream.String(), endpointType, options...)
+
+	// special setup for ingress, the track infos of the remote peer are part of its answer
+	if endpointType == IngressEndpoint {
+		if endpoint.dispatcher == nil {
+			return nil, telemetry.RecordErrorf(span, "setup ingress endpoint", errors.New("no track dispatcher found"))
+		}
+
+		endpoint.receiver = newReceiver(sessionCxt, sessionId, liveStream, endpoint.dispatcher, endpoint.trackSdpInfoRepository)
+		endpoint.receiver.keyframeCacheSize = endpoint.keyframeCacheSize
+		endpoint.receiver.sendQueueSize = endpoint.sendQueueSize
+		endpoint.receiver.retransmitSize = endpoint.retransmitSize
+		endpoint.receiver.svc = endpoint.svc
+	}
+
+	withStatsGetter := withOnStatsGetter(func(getter stats.Getter) {
+		statsRegistry := rtpStats.NewRegistry(sessionId.String(), getter)
+		if endpoint.receiver != nil {
+			endpoint.receiver.statsRegistry = statsRegistry
+		}
+		endpoint.statsRegistry = statsRegistry
+	})
+
+	api, err := e.createApi(withStatsGetter, withSfuRetransmission(endpoint.retransmitSize > 0), withRedundancy(e.redundancy), withSyncSource(endpoint.getSyncSource), withSvc(endpoint.svc), withRemb(endpointType == EgressEndpoint))
+	if err != nil {
+		return nil, telemetry.RecordErrorf(span, "creating api", err)
+	}
+
+	if endpoint.peerConnection, err = api.NewPeerConnection(e.config); err != nil {
+		return nil, telemetry.RecordErrorf(span, "create  peer connection", err)
+	}
+	// Without a listener pion stops to trigger the negotiation for good. The tracks of the first offer trigger it
+	// before the answer, so the listener of the egress endpoint is set after the offer.
+	endpoint.peerConnection.OnNegotiationNeeded(func() {})
+
+	if endpoint.receiver != nil {
+		endpoint.peerConnection.OnTrack(endpoint.receiver.onTrack)
+		for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+			if _, err = endpoint.getPeerConnection().AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+				return nil, telemetry.RecordErrorf(span, "add receiving transceiver", err)
+			}
+		}
+	}
+
+	if endpointType == EgressEndpoint {
+		if endpoint.program != nil {
+			if err := endpoint.setupProgram(); err != nil {
+				return nil, telemetry.RecordErrorf(span, "setup program", err)
+			}
+		} else if err := endpoint.setupSlotPool(); err != nil {
+			return nil, telemetry.RecordErrorf(span, "setup slot pool", err)
+		}
+		if endpoint.getCurrentTracksCbk != nil {
+			tracksList, err := endpoint.getCurrentTracksCbk(ctx, sessionId)
+			if err != nil {
+				return nil, telemetry.RecordErrorf(span, "get current tracks", err)
+			}
+			for _, trackInfo := range tracksList {
+				endpoint.AddTrack(ctx, trackInfo)
+			}
+		}
+	}
+
+	endpoint.peerConnection.OnICEConnectionStateChange(endpoint.onICEConnectionStateChange)
+	if endpoint.onChannel != nil {
+		if err := creatDC(endpoint.getPeerConnection(), endpoint.onChannel); err != nil {
+			return nil, telemetry.RecordErrorf(span, "create data channel", err)
+		}
+	}
+
+	offer, err := endpoint.peerConnection.CreateOffer(nil)
+	if err != nil {
+		return nil, telemetry.RecordErrorf(span, "create offer", err)
+	}
+	endpoint.gatherComplete = webrtc.GatheringCompletePromise(endpoint.getPeerConnection())
+	if err = endpoint.peerConnection.SetLocalDescription(offer); err != nil {
+		return nil, telemetry.RecordErrorf(span, "setup offer", err)
+	}
+
+	// the tracks added until the answer are offered by a renegotiation
+	if endpointType == EgressEndpoint {
+		setupOnNegotiationNeeded(sessionCxt, endpoint, sessionId, liveStream)
+	}
+	return endpoint, nil
+}
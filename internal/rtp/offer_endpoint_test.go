@@ -0,0 +1,139 @@
+package rtp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+type testOfferDispatcher struct {
+	added chan *TrackInfo
+}
+
+func (d *testOfferDispatcher) DispatchAddTrack(_ context.Context, track *TrackInfo) {
+	d.added <- track
+}
+
+func (d *testOfferDispatcher) DispatchRemoveTrack(_ context.Context, _ *TrackInfo) {}
+
+func testOfferSessionContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(telemetry.ContextWithSessionValue(context.Background(), uuid.NewString(), uuid.NewString(), uuid.NewString()))
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func testOfferEndpointSetup(t *testing.T, endpointType EndpointType, options ...EndpointOption) (*Endpoint, *webrtc.SessionDescription) {
+	t.Helper()
+	ctx := testOfferSessionContext(t)
+	endpoint, err := (&Engine{}).OfferEndpoint(ctx, ctx, uuid.New(), uuid.New(), endpointType, options...)
+	assert.NoError(t, err)
+	offer, err := endpoint.GetLocalDescription(ctx)
+	assert.NoError(t, err)
+	return endpoint, offer
+}
+
+// testOfferClient answers the offer like the other server
+func testOfferClient(t *testing.T, offer *webrtc.SessionDescription, tracks ...webrtc.TrackLocal) (*webrtc.PeerConnection, *webrtc.SessionDescription) {
+	t.Helper()
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	assert.NoError(t, client.SetRemoteDescription(*offer))
+	for _, track := range tracks {
+		_, err = client.AddTrack(track)
+		assert.NoError(t, err)
+	}
+	answer, err := client.CreateAnswer(nil)
+	assert.NoError(t, err)
+	gathered := webrtc.GatheringCompletePromise(client)
+	assert.NoError(t, client.SetLocalDescription(answer))
+	<-gathered
+	return client, client.LocalDescription()
+}
+
+func TestOfferEndpoint(t *testing.T) {
+	t.Run("ingress endpoint needs a track dispatcher", func(t *testing.T) {
+		ctx := testOfferSessionContext(t)
+
+		_, err := (&Engine{}).OfferEndpoint(ctx, ctx, uuid.New(), uuid.New(), IngressEndpoint)
+
+		assert.ErrorContains(t, err, "no track dispatcher found")
+	})
+
+	t.Run("ingress endpoint receives the tracks of the answer", func(t *testing.T) {
+		dispatcher := &testOfferDispatcher{added: make(chan *TrackInfo, 2)}
+		endpoint, offer := testOfferEndpointSetup(t, IngressEndpoint, EndpointWithTrackDispatcher(dispatcher))
+		assert.Equal(t, 2, strings.Count(offer.SDP, "a=recvonly"))
+
+		audio, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "stream")
+		assert.NoError(t, err)
+		video, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "stream")
+		assert.NoError(t, err)
+		_, answer := testOfferClient(t, offer, audio, video)
+		assert.NoError(t, endpoint.SetAnswer(answer))
+
+		received := make(map[string]bool)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		timeout := time.After(10 * time.Second)
+		for seq := uint16(0); len(received) < 2; seq++ {
+			select {
+			case track := <-dispatcher.added:
+				received[track.GetTrackLocal().Kind().String()] = true
+			case <-ticker.C:
+				packet := &rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960}, Payload: []byte{0x01}}
+				_ = audio.WriteRTP(packet)
+				_ = video.WriteRTP(packet)
+			case <-timeout:
+				t.Fatalf("received tracks: %v", received)
+			}
+		}
+		assert.True(t, received["audio"])
+		assert.True(t, received["video"])
+	})
+
+	t.Run("egress endpoint offers the current tracks", func(t *testing.T) {
+		tracks := []*TrackInfo{testSlotSourceSetup(t, webrtc.MimeTypeOpus), testSlotSourceSetup(t, webrtc.MimeTypeVP8)}
+		endpoint, offer := testOfferEndpointSetup(t, EgressEndpoint, EndpointWithGetCurrentTrackCbk(func(_ context.Context, _ uuid.UUID) ([]*TrackInfo, error) {
+			return tracks, nil
+		}))
+		for _, track := range tracks {
+			assert.Contains(t, offer.SDP, track.GetTrackLocal().ID())
+		}
+
+		client, answer := testOfferClient(t, offer)
+		assert.NoError(t, endpoint.SetAnswer(answer))
+
+		assert.Equal(t, webrtc.SignalingStateStable, endpoint.peerConnection.SignalingState())
+		assert.Equal(t, webrtc.SignalingStateStable, client.SignalingState())
+		for _, track := range tracks {
+			assert.True(t, endpoint.HasTrack(track.GetTrackLocal()))
+		}
+	})
+
+	t.Run("offer the data channel", func(t *testing.T) {
+		channels := make(chan *webrtc.DataChannel, 1)
+		_, offer := testOfferEndpointSetup(t, EgressEndpoint, EndpointWithDataChannel(func(dc *webrtc.DataChannel) {
+			channels <- dc
+		}))
+
+		assert.Contains(t, offer.SDP, "m=application")
+		assert.Equal(t, "data", (<-channels).Label())
+	})
+
+	t.Run("answer without offer is ignored", func(t *testing.T) {
+		endpoint, offer := testOfferEndpointSetup(t, EgressEndpoint, EndpointWithDataChannel(func(_ *webrtc.DataChannel) {}))
+		_, answer := testOfferClient(t, offer)
+		assert.NoError(t, endpoint.SetAnswer(answer))
+
+		assert.ErrorIs(t, endpoint.SetAnswer(answer), ErrNoPendingOffer)
+	})
+}
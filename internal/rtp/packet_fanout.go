@@ -0,0 +1,305 @@
+package rtp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"golang.org/x/exp/slog"
+)
+
+var ErrFanoutClosed = errors.New("packet fanout of the track is closed")
+
+// every subscriber reads the packets into its own buffer, the buffers are reused by later subscribers
+var fanoutBufferPool = sync.Pool{New: func() any {
+	buf := make([]byte, rtpBufferSize)
+	return &buf
+}}
+
+// packetFanout decouples the media writer of a track from the remote peers of the track.
+// The media writer stores every packet once in a ring buffer, and every subscriber reads the ring buffer
+// with its own goroutine. A slow subscriber falls behind and drops packets, but it never delays the
+// media writer or the other subscribers.
+type packetFanout struct {
+	mu          sync.RWMutex
+	slots       []fanoutSlot
+	head        uint64 // absolute index of the next packet
+	keyframe    uint64 // absolute index of the last keyframe start plus one, 0 if there is none
+	isKeyframe  func(payload []byte) bool
+	subscribers []*fanoutSubscriber
+	closed      bool
+	// new subscribers start with the last keyframe in the ring buffer instead of the next live packet
+	startWithKeyframe bool
+}
+
+type fanoutSlot struct {
+	buf      []byte
+	size     int
+	keyframe bool
+}
+
+func newPacketFanout(codec webrtc.RTPCodecCapability, size int) *packetFanout {
+	slots := make([]fanoutSlot, size)
+	for i := range slots {
+		slots[i].buf = make([]byte, rtpBufferSize)
+	}
+	return &packetFanout{slots: slots, isKeyframe: keyframeDetector(codec)}
+}
+
+// write stores a raw rtp packet and wakes up the subscribers, it is only called by the media writer of the track
+func (f *packetFanout) write(raw []byte) {
+	keyframe := false
+	if f.isKeyframe != nil {
+		if offset, ok := rtpPayloadOffset(raw); ok {
+			keyframe = f.isKeyframe(raw[offset:])
+		}
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	slot := &f.slots[f.head%uint64(len(f.slots))]
+	slot.size = copy(slot.buf, raw)
+	slot.keyframe = keyframe
+	if keyframe {
+		f.keyframe = f.head + 1
+	}
+	f.head++
+	for _, subscriber := range f.subscribers {
+		select {
+		case subscriber.wake <- struct{}{}:
+		default:
+		}
+	}
+	f.mu.Unlock()
+}
+
+// subscribe starts the send queue of a binding, a closed fanout has no packets anymore and returns an error
+func (f *packetFanout) subscribe(id string, ssrc webrtc.SSRC, payloadType webrtc.PayloadType, writer webrtc.TrackLocalWriter) (*fanoutSubscriber, error) {
+	subscriber := &fanoutSubscriber{
+		id:          id,
+		fanout:      f,
+		writer:      writer,
+		ssrc:        uint32(ssrc),
+		payloadType: uint8(payloadType),
+		wake:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, ErrFanoutClosed
+	}
+	subscriber.cursor = f.startPosition()
+	f.subscribers = append(f.subscribers, subscriber)
+	go subscriber.run()
+	return subscriber, nil
+}
+
+func (f *packetFanout) unsubscribe(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, subscriber := range f.subscribers {
+		if subscriber.id == id {
+			f.subscribers = append(f.subscribers[:i], f.subscribers[i+1:]...)
+			close(subscriber.quit)
+			return true
+		}
+	}
+	return false
+}
+
+// close stops all subscribers, it is called when the media writer of the track stops
+func (f *packetFanout) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for _, subscriber := range f.subscribers {
+		close(subscriber.quit)
+	}
+	f.subscribers = nil
+}
+
+// startPosition is the position of a subscriber that starts or restarts, the fanout has to be locked
+func (f *packetFanout) startPosition() uint64 {
+	if f.startWithKeyframe {
+		if position, ok := f.keyframePosition(); ok {
+			return position
+		}
+	}
+	return f.head
+}
+
+// keyframePosition returns the position of the last keyframe if it is still in the ring buffer, the fanout has to be locked
+func (f *packetFanout) keyframePosition() (uint64, bool) {
+	if f.keyframe == 0 || f.head-(f.keyframe-1) > uint64(len(f.slots)) {
+		return 0, false
+	}
+	return f.keyframe - 1, true
+}
+
+// fanoutSubscriber sends the packets of the ring buffer to one binding of the track
+type fanoutSubscriber struct {
+	id          string
+	fanout      *packetFanout
+	writer      webrtc.TrackLocalWriter
+	ssrc        uint32
+	payloadType uint8
+	wake        chan struct{}
+	quit        chan struct{}
+	// the fields below are only used by the goroutine of the subscriber
+	cursor uint64
+	// dropped packets are removed from the sequence numbers, so the remote peer does not see them as lost
+	seqOffset       uint16
+	waitForKeyframe bool
+	started         bool
+	buf             []byte
+	packet          rtp.Packet
+	// maps the sent sequence numbers back to the ones of the ingress track for retransmissions
+	seqMu       sync.Mutex
+	sentOffset  uint16 // offset of the packets since offsetStart
+	prevOffset  uint16 // offset of the packets before offsetStart
+	offsetStart uint16
+}
+
+func (s *fanoutSubscriber) run() {
+	bufPtr := fanoutBufferPool.Get().(*[]byte)
+	defer fanoutBufferPool.Put(bufPtr)
+	s.buf = *bufPtr
+	for {
+		for s.next() {
+		}
+		select {
+		case <-s.wake:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// next sends the next packet of the ring buffer, it returns false if there is no packet to send
+func (s *fanoutSubscriber) next() bool {
+	select {
+	case <-s.quit:
+		return false
+	default:
+	}
+
+	f := s.fanout
+	f.mu.RLock()
+	if s.cursor == f.head {
+		f.mu.RUnlock()
+		return false
+	}
+	if f.head-s.cursor > uint64(len(f.slots)) {
+		s.skip()
+	}
+	slot := &f.slots[s.cursor%uint64(len(f.slots))]
+	size := copy(s.buf, slot.buf[:slot.size])
+	keyframe := slot.keyframe
+	s.cursor++
+	f.mu.RUnlock()
+
+	if s.waitForKeyframe {
+		if !keyframe {
+			s.seqOffset++
+			return true
+		}
+		s.waitForKeyframe = false
+	}
+
+	if err := s.packet.Unmarshal(s.buf[:size]); err != nil {
+		return true
+	}
+	s.packet.SSRC = s.ssrc
+	s.packet.PayloadType = s.payloadType
+	s.packet.SequenceNumber -= s.seqOffset
+	if s.seqOffset != s.sentOffset {
+		s.seqMu.Lock()
+		s.prevOffset, s.sentOffset, s.offsetStart = s.sentOffset, s.seqOffset, s.packet.SequenceNumber
+		s.seqMu.Unlock()
+	}
+	n, err := s.writer.WriteRTP(&s.packet.Header, s.packet.Payload)
+	if err != nil {
+		slog.Debug("rtp.packetFanout: write packet to subscriber", "err", err, "subscriber", s.id)
+		return true
+	}
+	// the binding is not ready until the connection is established, the packets are dropped until then
+	if !s.started && n == 0 {
+		f.mu.RLock()
+		s.cursor = f.startPosition()
+		f.mu.RUnlock()
+		return false
+	}
+	s.started = true
+	return true
+}
+
+// originalSeq returns the sequence number of the ingress track for a sequence number sent to the subscriber
+func (s *fanoutSubscriber) originalSeq(seq uint16) (uint16, bool) {
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+	if int16(seq-s.offsetStart) < 0 {
+		return seq + s.prevOffset, true
+	}
+	return seq + s.sentOffset, true
+}
+
+// skip is the drop policy of a subscriber that fell behind the ring buffer, the fanout has to be locked.
+// Video continues with the last keyframe or waits for the next one, other tracks continue with the latest packet.
+func (s *fanoutSubscriber) skip() {
+	f := s.fanout
+	position := f.head - 1
+	if f.isKeyframe != nil {
+		var ok bool
+		if position, ok = f.keyframePosition(); !ok {
+			position = f.head
+			s.waitForKeyframe = true
+		}
+	}
+	// the arguments of the log would allocate with every skip, even if debug logging is disabled
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		slog.Debug("rtp.packetFanout: subscriber fell behind and drops packets", "subscriber", s.id, "dropped", position-s.cursor)
+	}
+	s.seqOffset += uint16(position - s.cursor)
+	s.cursor = position
+}
+
+// findBindingCodec selects the codec of a binding like the static tracks of pion, first with and then without fmtp line
+func findBindingCodec(codec webrtc.RTPCodecCapability, params []webrtc.RTPCodecParameters) (webrtc.RTPCodecParameters, error) {
+	for _, param := range params {
+		if strings.EqualFold(param.MimeType, codec.MimeType) && param.SDPFmtpLine == codec.SDPFmtpLine {
+			return param, nil
+		}
+	}
+	for _, param := range params {
+		if strings.EqualFold(param.MimeType, codec.MimeType) {
+			return param, nil
+		}
+	}
+	return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+}
+
+// rtpPayloadOffset returns the start of the payload of a raw rtp packet without parsing the whole header
+func rtpPayloadOffset(raw []byte) (int, bool) {
+	if len(raw) < 12 {
+		return 0, false
+	}
+	offset := 12 + 4*int(raw[0]&0x0F)
+	if raw[0]&0x10 != 0 {
+		if len(raw) < offset+4 {
+			return 0, false
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(raw[offset+2:offset+4]))
+	}
+	if offset > len(raw) {
+		return 0, false
+	}
+	return offset, true
+}
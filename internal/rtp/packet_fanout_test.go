@@ -0,0 +1,243 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFanoutWriter records the packets of a subscriber, the first packet can block the subscriber
+type testFanoutWriter struct {
+	mu      sync.Mutex
+	headers []rtp.Header
+	gate    chan struct{}
+}
+
+func (w *testFanoutWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.mu.Lock()
+	w.headers = append(w.headers, *header)
+	gate := w.gate
+	w.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	return len(payload), nil
+}
+
+func (w *testFanoutWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *testFanoutWriter) sequenceNumbers() []uint16 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seqs := make([]uint16, 0, len(w.headers))
+	for _, header := range w.headers {
+		seqs = append(seqs, header.SequenceNumber)
+	}
+	return seqs
+}
+
+func (w *testFanoutWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.headers)
+}
+
+func TestPacketFanout(t *testing.T) {
+	codec := webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}
+
+	t.Run("subscribers receive the packets with the ssrc of their binding", func(t *testing.T) {
+		fanout := newPacketFanout(codec, 16)
+		defer fanout.close()
+		first, second := &testFanoutWriter{}, &testFanoutWriter{}
+		fanout.subscribe("first", 1, 96, first)
+		fanout.subscribe("second", 2, 97, second)
+
+		for seq := uint16(10); seq < 13; seq++ {
+			fanout.write(testKeyframeCachePacket(t, seq, 0, testVp8Interframe))
+		}
+
+		assert.Eventually(t, func() bool { return first.count() == 3 && second.count() == 3 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []uint16{10, 11, 12}, first.sequenceNumbers())
+		assert.Equal(t, uint32(2), second.headers[0].SSRC)
+		assert.Equal(t, uint8(97), second.headers[0].PayloadType)
+	})
+
+	t.Run("slow subscriber continues with the last keyframe and does not block others", func(t *testing.T) {
+		fanout := newPacketFanout(codec, 16)
+		defer fanout.close()
+		slow := &testFanoutWriter{gate: make(chan struct{})}
+		fast := &testFanoutWriter{}
+		subscriber, _ := fanout.subscribe("slow", 1, 96, slow)
+		fanout.subscribe("fast", 2, 96, fast)
+
+		fanout.write(testKeyframeCachePacket(t, 0, 0, testVp8Keyframe))
+		assert.Eventually(t, func() bool { return slow.count() == 1 }, time.Second, 10*time.Millisecond)
+		for seq := uint16(1); seq < 40; seq++ {
+			payload := testVp8Interframe
+			if seq == 30 {
+				payload = testVp8Keyframe
+			}
+			fanout.write(testKeyframeCachePacket(t, seq, uint32(seq), payload))
+			// the fast subscriber keeps up, while the slow subscriber is blocked
+			assert.Eventually(t, func() bool { return fast.count() == int(seq)+1 }, time.Second, time.Millisecond)
+		}
+
+		slow.mu.Lock()
+		gate := slow.gate
+		slow.gate = nil
+		slow.mu.Unlock()
+		close(gate)
+		assert.Eventually(t, func() bool { return slow.count() == 11 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, slow.sequenceNumbers())
+		assert.Equal(t, uint32(30), slow.headers[1].Timestamp)
+		// the sent sequence numbers are mapped back for retransmissions
+		original, _ := subscriber.originalSeq(1)
+		assert.Equal(t, uint16(30), original)
+		original, _ = subscriber.originalSeq(0)
+		assert.Equal(t, uint16(0), original)
+	})
+
+	t.Run("new subscriber starts with the last keyframe", func(t *testing.T) {
+		fanout := newPacketFanout(codec, 16)
+		defer fanout.close()
+		fanout.startWithKeyframe = true
+		fanout.write(testKeyframeCachePacket(t, 5, 0, testVp8Keyframe))
+		fanout.write(testKeyframeCachePacket(t, 6, 0, testVp8Continuation))
+		writer := &testFanoutWriter{}
+
+		fanout.subscribe("viewer", 1, 96, writer)
+		fanout.write(testKeyframeCachePacket(t, 7, 100, testVp8Interframe))
+
+		assert.Eventually(t, func() bool { return writer.count() == 3 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []uint16{5, 6, 7}, writer.sequenceNumbers())
+	})
+
+	t.Run("unsubscribed subscriber receives nothing", func(t *testing.T) {
+		fanout := newPacketFanout(codec, 16)
+		defer fanout.close()
+		writer := &testFanoutWriter{}
+		fanout.subscribe("viewer", 1, 96, writer)
+
+		assert.True(t, fanout.unsubscribe("viewer"))
+		fanout.write(testKeyframeCachePacket(t, 1, 0, testVp8Interframe))
+
+		assert.Never(t, func() bool { return writer.count() > 0 }, 50*time.Millisecond, 10*time.Millisecond)
+		assert.False(t, fanout.unsubscribe("viewer"))
+	})
+
+	t.Run("closed fanout rejects subscribers", func(t *testing.T) {
+		fanout := newPacketFanout(codec, 16)
+		fanout.close()
+
+		_, err := fanout.subscribe("viewer", 1, 96, &testFanoutWriter{})
+		assert.ErrorIs(t, err, ErrFanoutClosed)
+
+		track, err := webrtc.NewTrackLocalStaticRTP(codec, uuid.NewString(), uuid.NewString())
+		assert.NoError(t, err)
+		forward := &forwardTrack{TrackLocalStaticRTP: track, fanout: fanout}
+		params := webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: codec, PayloadType: 96}}}
+		_, err = forward.Bind(&baseTrackLocalContext{id: uuid.NewString(), params: params, ssrc: 1, writeStream: &testFanoutWriter{}})
+		assert.ErrorIs(t, err, ErrFanoutClosed)
+	})
+}
+
+// benchmarkWriter remembers the timestamp of the last packet, the benchmark waits until every subscriber sent the last packet
+type benchmarkWriter struct {
+	last atomic.Uint32
+	slow bool
+}
+
+func (w *benchmarkWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	if w.slow {
+		// simulates a viewer with a congested connection
+		time.Sleep(50 * time.Microsecond)
+	}
+	w.last.Store(header.Timestamp)
+	return len(payload), nil
+}
+
+func (w *benchmarkWriter) Write(b []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(b); err != nil {
+		return 0, err
+	}
+	return w.WriteRTP(&packet.Header, packet.Payload)
+}
+
+// Benchmark_Fanout measures the time and the allocations to forward the packets to all subscribers.
+// With static tracks the media writer writes to every subscriber, with send queues it only stores the packet once and
+// the goroutines of the subscribers send it. The time includes the goroutines of the subscribers, until every subscriber
+// sent the last packet. Every packet is a keyframe, so a subscriber that falls behind continues with the latest packet.
+// go test -v -run=^$ -bench=Benchmark_Fanout -benchmem ./internal/rtp/
+func Benchmark_Fanout(b *testing.B) {
+	codec := webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}
+	payload := make([]byte, 1100)
+	payload[0] = 0x10 // start of a VP8 partition, the frame tag marks a keyframe
+	packet, _ := (&rtp.Packet{Header: rtp.Header{Version: 2}, Payload: payload}).Marshal()
+	params := webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: codec, PayloadType: 96}}}
+
+	newWriters := func(subscribers int, slow bool) []*benchmarkWriter {
+		writers := make([]*benchmarkWriter, subscribers)
+		for i := range writers {
+			writers[i] = &benchmarkWriter{slow: slow && i == 0}
+		}
+		return writers
+	}
+	// the timestamp counts the packets, the timestamps are not changed by the subscribers
+	writePackets := func(b *testing.B, write func(raw []byte)) {
+		for n := 1; n <= b.N; n++ {
+			binary.BigEndian.PutUint32(packet[4:8], uint32(n))
+			write(packet)
+		}
+	}
+	waitForSubscribers := func(b *testing.B, writers []*benchmarkWriter) {
+		for _, writer := range writers {
+			for writer.last.Load() != uint32(b.N) {
+				runtime.Gosched()
+			}
+		}
+	}
+
+	for _, subscribers := range []int{100, 250} {
+		for _, slow := range []bool{false, true} {
+			name := "subscribers"
+			if slow {
+				name = "subscribers_one_slow"
+			}
+			b.Run("static_track_"+name+"_"+strconv.Itoa(subscribers), func(b *testing.B) {
+				writers := newWriters(subscribers, slow)
+				track, _ := webrtc.NewTrackLocalStaticRTP(codec, uuid.NewString(), uuid.NewString())
+				for i, writer := range writers {
+					_, _ = track.Bind(&baseTrackLocalContext{id: uuid.NewString(), params: params, ssrc: webrtc.SSRC(i), writeStream: writer})
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				writePackets(b, func(raw []byte) { _, _ = track.Write(raw) })
+				waitForSubscribers(b, writers)
+			})
+			b.Run("send_queue_"+name+"_"+strconv.Itoa(subscribers), func(b *testing.B) {
+				writers := newWriters(subscribers, slow)
+				fanout := newPacketFanout(codec, 512)
+				defer fanout.close()
+				for i, writer := range writers {
+					_, _ = fanout.subscribe(uuid.NewString(), webrtc.SSRC(i), 96, writer)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				writePackets(b, fanout.write)
+				waitForSubscribers(b, writers)
+			})
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package rtp
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// packets of the send queue of every audience viewer
+const programQueuePackets = 512
+
+// ProgramOutput is the main program of a lobby: one audio and one video track that follow the main tracks of the lobby.
+// Every audience endpoint sends the same two tracks, so a change of the main tracks needs no renegotiation and
+// no signalling. The packets of the program are stored once, and every audience endpoint reads them with its own send
+// queue, so a slow viewer never delays the others.
+type ProgramOutput struct {
+	audio *programTrack
+	video *programTrack
+}
+
+// programTrack is a slot that writes its packets to the send queues of the audience
+type programTrack struct {
+	slot   *trackSlot
+	fanout *packetFanout
+	feed   *baseTrackLocalContext
+}
+
+func NewProgramOutput() (*ProgramOutput, error) {
+	streamId := "program-" + uuid.NewString()
+	audio, err := newProgramTrack(slotPoolAudioCodec, streamId)
+	if err != nil {
+		return nil, fmt.Errorf("creating audio track of program: %w", err)
+	}
+	video, err := newProgramTrack(slotPoolVideoCodec, streamId)
+	if err != nil {
+		return nil, fmt.Errorf("creating video track of program: %w", err)
+	}
+	return &ProgramOutput{audio: audio, video: video}, nil
+}
+
+func newProgramTrack(codec webrtc.RTPCodecCapability, streamId string) (*programTrack, error) {
+	slot, err := newTrackSlotWithStream(codec, streamId)
+	if err != nil {
+		return nil, err
+	}
+	fanout := newPacketFanout(codec, programQueuePackets)
+	// viewers that join later start with the last keyframe
+	fanout.startWithKeyframe = true
+	feed := &baseTrackLocalContext{
+		id:          uuid.NewString(),
+		params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: codec}}},
+		writeStream: &fanoutFeed{fanout: fanout, buf: make([]byte, rtpBufferSize)},
+	}
+	if _, err = slot.getTrack().Bind(feed); err != nil {
+		return nil, fmt.Errorf("binding send queue to program track: %w", err)
+	}
+	return &programTrack{slot: slot, fanout: fanout, feed: feed}, nil
+}
+
+// Show switches the program track of the kind of the track to the track
+func (p *ProgramOutput) Show(track *TrackInfo) error {
+	return p.trackOfKind(track).slot.bind(track)
+}
+
+// Hide pauses the program track of the kind of the track, if the track is shown. It returns false if the track was not shown.
+func (p *ProgramOutput) Hide(track *TrackInfo) bool {
+	if !p.Shows(track) {
+		return false
+	}
+	p.trackOfKind(track).slot.release()
+	return true
+}
+
+// Shows reports whether the program shows the track
+func (p *ProgramOutput) Shows(track *TrackInfo) bool {
+	return p.trackOfKind(track).slot.showsTrack(track.GetTrackLocal())
+}
+
+// AcceptsCodec reports whether the program can show tracks with the codec without transcoding
+func (p *ProgramOutput) AcceptsCodec(codec webrtc.RTPCodecCapability) bool {
+	return p.audio.slot.acceptsCodec(codec) || p.video.slot.acceptsCodec(codec)
+}
+
+// Close pauses the program and stops the send queues of all viewers
+func (p *ProgramOutput) Close() {
+	for _, program := range p.tracks() {
+		program.slot.release()
+		_ = program.slot.getTrack().Unbind(program.feed)
+		program.fanout.close()
+	}
+}
+
+func (p *ProgramOutput) trackOfKind(track *TrackInfo) *programTrack {
+	if track.GetTrackLocal().Kind() == webrtc.RTPCodecTypeVideo {
+		return p.video
+	}
+	return p.audio
+}
+
+func (p *ProgramOutput) tracks() []*programTrack {
+	return []*programTrack{p.audio, p.video}
+}
+
+// newLocal returns the local track of one viewer, it is bound once and reads its own send queue
+func (t *programTrack) newLocal() *forwardTrack {
+	return &forwardTrack{TrackLocalStaticRTP: t.slot.getTrack(), fanout: t.fanout}
+}
+
+// fanoutFeed writes the packets of a program track to the send queues of the viewers
+type fanoutFeed struct {
+	mu     sync.Mutex
+	fanout *packetFanout
+	buf    []byte
+}
+
+func (w *fanoutFeed) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := header.MarshalTo(w.buf)
+	if err != nil {
+		return 0, err
+	}
+	n += copy(w.buf[n:], payload)
+	w.fanout.write(w.buf[:n])
+	return len(payload), nil
+}
+
+func (w *fanoutFeed) Write(b []byte) (int, error) {
+	w.fanout.write(b)
+	return len(b), nil
+}
@@ -0,0 +1,250 @@
+package rtp
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+func testProgramViewer(t testing.TB, track *programTrack, writer webrtc.TrackLocalWriter) *forwardTrack {
+	t.Helper()
+	local := track.newLocal()
+	_, err := local.Bind(&baseTrackLocalContext{
+		id:          uuid.NewString(),
+		params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: local.Codec(), PayloadType: 111}}},
+		ssrc:        1,
+		writeStream: writer,
+	})
+	assert.NoError(t, err)
+	return local
+}
+
+func TestProgramOutput(t *testing.T) {
+	t.Run("send the shown track to all viewers", func(t *testing.T) {
+		program, err := NewProgramOutput()
+		assert.NoError(t, err)
+		defer program.Close()
+		first := &testFanoutWriter{}
+		second := &testFanoutWriter{}
+		testProgramViewer(t, program.audio, first)
+		testProgramViewer(t, program.audio, second)
+		source := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+
+		assert.NoError(t, program.Show(source))
+		testSlotWrite(t, source, 10, 100)
+
+		assert.Eventually(t, func() bool { return len(first.sequenceNumbers()) == 1 && len(second.sequenceNumbers()) == 1 }, time.Second, 10*time.Millisecond)
+		first.mu.Lock()
+		defer first.mu.Unlock()
+		assert.Equal(t, uint8(111), first.headers[0].PayloadType)
+		assert.Equal(t, uint32(1), first.headers[0].SSRC)
+	})
+
+	t.Run("follow the main track without gaps in the sequence", func(t *testing.T) {
+		program, err := NewProgramOutput()
+		assert.NoError(t, err)
+		defer program.Close()
+		viewer := &testFanoutWriter{}
+		testProgramViewer(t, program.audio, viewer)
+		first := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+		second := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+
+		assert.NoError(t, program.Show(first))
+		testSlotWrite(t, first, 10, 100)
+		assert.NoError(t, program.Show(second))
+		testSlotWrite(t, first, 11, 200)
+		testSlotWrite(t, second, 500, 9000)
+
+		assert.Eventually(t, func() bool { return len(viewer.sequenceNumbers()) == 2 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, []uint16{10, 11}, viewer.sequenceNumbers())
+	})
+
+	t.Run("hide only the shown track", func(t *testing.T) {
+		program, err := NewProgramOutput()
+		assert.NoError(t, err)
+		defer program.Close()
+		shown := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		other := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		assert.NoError(t, program.Show(shown))
+
+		assert.False(t, program.Hide(other))
+		assert.Same(t, shown, program.video.slot.getSource())
+		assert.True(t, program.Hide(shown))
+		assert.Nil(t, program.video.slot.getSource())
+	})
+
+	t.Run("reject tracks with other codecs", func(t *testing.T) {
+		program, err := NewProgramOutput()
+		assert.NoError(t, err)
+		defer program.Close()
+
+		assert.ErrorIs(t, program.Show(testSlotSourceSetup(t, webrtc.MimeTypeH264)), ErrSlotCodecMismatch)
+		assert.False(t, program.AcceptsCodec(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}))
+		assert.True(t, program.AcceptsCodec(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}))
+	})
+}
+
+// programBenchmarkAudience counts the viewers that received the packet of the current round
+type programBenchmarkAudience struct {
+	mu       sync.Mutex
+	round    uint32
+	received int
+	viewers  int
+	tracks   atomic.Int32
+	done     chan struct{}
+}
+
+func (a *programBenchmarkAudience) next(round uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.round = round
+	a.received = 0
+}
+
+func (a *programBenchmarkAudience) receive(packet *rtp.Packet) {
+	if len(packet.Payload) < 4 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if binary.BigEndian.Uint32(packet.Payload) != a.round {
+		return
+	}
+	if a.received++; a.received == a.viewers {
+		a.done <- struct{}{}
+	}
+}
+
+// programBenchmarkApi creates the peer connections of the viewers. The viewers only gather IPv4 host candidates and
+// wait longer for the connectivity checks, so hundreds of connections fit into one process.
+func programBenchmarkApi() *webrtc.API {
+	settings := webrtc.SettingEngine{}
+	settings.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	settings.SetInterfaceFilter(func(name string) bool { return name != "lo" })
+	settings.SetICETimeouts(30*time.Second, time.Minute, 2*time.Second)
+	media := &webrtc.MediaEngine{}
+	_ = media.RegisterDefaultCodecs()
+	registry := &interceptor.Registry{}
+	_ = webrtc.RegisterDefaultInterceptors(media, registry)
+	return webrtc.NewAPI(webrtc.WithSettingEngine(settings), webrtc.WithMediaEngine(media), webrtc.WithInterceptorRegistry(registry))
+}
+
+// programBenchmarkViewerSetup connects a remote peer with a real audience egress endpoint of the engine
+func programBenchmarkViewerSetup(b *testing.B, ctx context.Context, engine *Engine, api *webrtc.API, program *ProgramOutput, audience *programBenchmarkAudience) {
+	b.Helper()
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(b, err)
+	b.Cleanup(func() { _ = pc.Close() })
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		_, err = pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		assert.NoError(b, err)
+	}
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if track.Kind() != webrtc.RTPCodecTypeAudio {
+			return
+		}
+		audience.tracks.Add(1)
+		for {
+			packet, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			audience.receive(packet)
+		}
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(b, err)
+	gathered := webrtc.GatheringCompletePromise(pc)
+	assert.NoError(b, pc.SetLocalDescription(offer))
+	<-gathered
+
+	endpoint, err := engine.EstablishEndpoint(ctx, ctx, uuid.New(), uuid.New(), *pc.LocalDescription(), EgressEndpoint, EndpointWithProgram(program))
+	assert.NoError(b, err)
+	answer, err := endpoint.GetLocalDescription(ctx)
+	assert.NoError(b, err)
+	assert.NoError(b, pc.SetRemoteDescription(*answer))
+
+	// the viewers connect one after another, the connectivity checks of hundreds of viewers at the same time time out
+	deadline := time.Now().Add(10 * time.Second)
+	for pc.ConnectionState() != webrtc.PeerConnectionStateConnected {
+		if time.Now().After(deadline) {
+			b.Fatalf("viewer is not connected: %s", pc.ConnectionState())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Benchmark_ProgramOutput measures the time until one packet of the main track reaches all audience viewers.
+// Every viewer is a remote peer connected to its own egress endpoint, so the send queues, the interceptors and the
+// transport of the endpoints are part of the measurement. Packets that do not reach all viewers within a second are
+// reported as lost. The remote peers of the viewers run in the same process, so they share the CPU with the endpoints.
+// go test -v -run=^$ -bench=Benchmark_ProgramOutput -benchmem ./internal/rtp/
+func Benchmark_ProgramOutput(b *testing.B) {
+	for _, viewers := range []int{500, 1000} {
+		b.Run("viewers_"+strconv.Itoa(viewers), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(telemetry.ContextWithSessionValue(context.Background(), uuid.NewString(), uuid.NewString(), uuid.NewString()))
+			defer cancel()
+			engine, _ := NewEngine(&RtpConfig{})
+			program, _ := NewProgramOutput()
+			defer program.Close()
+			audience := &programBenchmarkAudience{viewers: viewers, done: make(chan struct{}, 1)}
+			api := programBenchmarkApi()
+			for i := 0; i < viewers; i++ {
+				programBenchmarkViewerSetup(b, ctx, engine, api, program, audience)
+			}
+			track, _ := webrtc.NewTrackLocalStaticRTP(slotPoolAudioCodec, uuid.NewString(), uuid.NewString())
+			source := newTrackInfo(track, *newTrackSdpInfo(uuid.New()))
+			_ = program.Show(source)
+			packet := &rtp.Packet{Header: rtp.Header{Version: 2}, Payload: make([]byte, 160)}
+			write := func(round uint32) {
+				binary.BigEndian.PutUint32(packet.Payload, round)
+				packet.SequenceNumber++
+				packet.Timestamp += 960
+				_ = source.GetTrack().WriteRTP(packet)
+			}
+
+			// the remote tracks of the viewers start with the first packet after the connection is established
+			audience.next(math.MaxUint32)
+			deadline := time.Now().Add(30 * time.Second)
+			for int(audience.tracks.Load()) < viewers {
+				if time.Now().After(deadline) {
+					b.Fatalf("only %d of %d viewers receive the program", audience.tracks.Load(), viewers)
+				}
+				write(math.MaxUint32)
+				time.Sleep(20 * time.Millisecond)
+			}
+			select {
+			case <-audience.done:
+			default:
+			}
+
+			lost := 0
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				audience.next(uint32(n))
+				write(uint32(n))
+				select {
+				case <-audience.done:
+				case <-time.After(time.Second):
+					lost++
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(lost)/float64(b.N), "lost/op")
+		})
+	}
+}
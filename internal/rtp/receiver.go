@@ -23,6 +23,14 @@ type receiver struct {
 	dispatcher    TrackDispatcher
 	trackSdpInfos *trackSdpInfoRepository
 	statsRegistry *stats.Registry
+	// maximum size of the keyframe cache of a video track, 0 disables the cache
+	keyframeCacheSize int
+	// packets of the send queue of a track, 0 disables the send queues
+	sendQueueSize int
+	// packets of the retransmission buffer of a video track, 0 disables the buffer
+	retransmitSize int
+	// the layers of scalable video tracks are selected for every egress peer
+	svc bool
 }
 
 func newReceiver(sessionCxt context.Context, sessionId uuid.UUID, liveStream uuid.UUID, d TrackDispatcher, trackSdpInfos *trackSdpInfoRepository) *receiver {
@@ -79,6 +87,7 @@ func (r *receiver) onTrack(remoteTrack *webrtc.TrackRemote, rtpReceiver *webrtc.
 			return
 		}
 		trackInfo = newTrackInfo(stream.getAudioTrack(), *trackSdpInfo)
+		trackInfo.fanout = stream.getAudioFanout()
 	}
 
 	if strings.HasPrefix(remoteTrack.Codec().RTPCodecCapability.MimeType, "video") {
@@ -91,6 +100,22 @@ func (r *receiver) onTrack(remoteTrack *webrtc.TrackRemote, rtpReceiver *webrtc.
 		}
 
 		trackInfo = newTrackInfo(stream.getVideoTrack(), *trackSdpInfo)
+		trackInfo.keyframeCache = stream.getVideoKeyframeCache()
+		trackInfo.fanout = stream.getVideoFanout()
+		trackInfo.retransmits = stream.getVideoRetransmits()
+		trackInfo.keyframeRequest = keyframeFromIngress(remoteTrack, rtpReceiver)
+		if r.svc {
+			trackInfo.svc = newSvcCodec(remoteTrack.Codec().RTPCodecCapability, rtpReceiver.GetParameters().HeaderExtensions)
+		}
+	}
+
+	// the sender reports of the publisher keep audio and video in sync on the egress side
+	trackInfo.clock = newTrackClock(remoteTrack.Codec().ClockRate)
+	go readSenderReports(rtpReceiver, remoteTrack.SSRC(), trackInfo.clock)
+
+	// the blocks of RED are mapped with the codecs of the ingress peer
+	if isRedundancyCodec(remoteTrack.Codec().RTPCodecCapability) {
+		trackInfo.redundancy = newRedundancyCodecs(rtpReceiver.GetParameters().Codecs)
 	}
 
 	slog.Debug("rtp.receiver: info track", "streamId", trackInfo.GetTrackLocal().StreamID(), "track", trackInfo.GetTrackLocal().ID(), "kind", trackInfo.GetTrackLocal().Kind(), "purpose", trackInfo.Purpose.ToString())
@@ -114,6 +139,9 @@ func (r *receiver) getStream(sessionCxt context.Context, sessionId uuid.UUID, st
 	stream, ok := r.streams[streamId]
 	if !ok {
 		stream = newMediaStream(sessionCxt, streamId, sessionId, r.dispatcher, sdpInfo.Purpose)
+		stream.keyframeCacheSize = r.keyframeCacheSize
+		stream.sendQueueSize = r.sendQueueSize
+		stream.retransmitSize = r.retransmitSize
 		r.streams[streamId] = stream
 	}
 
@@ -0,0 +1,239 @@
+package rtp
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// MimeTypeAudioRed is the redundant audio encoding (RFC 2198) that carries the last Opus frames in every packet
+	MimeTypeAudioRed = "audio/red"
+	// MimeTypeVideoRed encapsulates the video packets and the ULPFEC packets of a video track
+	MimeTypeVideoRed = "video/red"
+	// MimeTypeUlpFec is the forward error correction of video tracks (RFC 5109), it is sent inside of video/red
+	MimeTypeUlpFec = "video/ulpfec"
+)
+
+// payload types of the redundancy codecs as offered by the browsers
+const (
+	audioRedPayloadType = 63
+	videoRedPayloadType = 116
+	ulpFecPayloadType   = 117
+)
+
+// padding of a stripped FEC packet, the remote peer discards the packet without gap in the sequence numbers
+var redundancyPadding = []byte{0x00, 0x00, 0x00, 0x04}
+
+// registerRedundancyCodecs negotiates RED for audio and RED with ULPFEC for video, Opus itself is registered with in-band FEC
+func registerRedundancyCodecs(m *webrtc.MediaEngine, audio bool, video bool) error {
+	if audio {
+		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeAudioRed, ClockRate: 48000, Channels: 2, SDPFmtpLine: "111/111"},
+			PayloadType:        audioRedPayloadType,
+		}, webrtc.RTPCodecTypeAudio); err != nil {
+			return err
+		}
+	}
+	if video {
+		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeVideoRed, ClockRate: 90000},
+			PayloadType:        videoRedPayloadType,
+		}, webrtc.RTPCodecTypeVideo); err != nil {
+			return err
+		}
+		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeUlpFec, ClockRate: 90000},
+			PayloadType:        ulpFecPayloadType,
+		}, webrtc.RTPCodecTypeVideo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isRedundancyCodec(codec webrtc.RTPCodecCapability) bool {
+	return strings.EqualFold(codec.MimeType, MimeTypeAudioRed) || strings.EqualFold(codec.MimeType, MimeTypeVideoRed)
+}
+
+// redundancyCodecs are the codecs negotiated by the ingress peer of a RED track. They are needed to map the payload types
+// of the encapsulated blocks to the payload types of every egress peer.
+type redundancyCodecs struct {
+	codecs []webrtc.RTPCodecParameters
+}
+
+func newRedundancyCodecs(codecs []webrtc.RTPCodecParameters) *redundancyCodecs {
+	return &redundancyCodecs{codecs: codecs}
+}
+
+// bind creates the context of one binding and returns the codec the binding sends. An egress peer that negotiated RED
+// receives the redundancy, for all other egress peers the redundancy is stripped and only the primary encoding is sent.
+func (r *redundancyCodecs) bind(ctx webrtc.TrackLocalContext, codec webrtc.RTPCodecCapability) (*redundancyContext, webrtc.RTPCodecParameters, error) {
+	params := ctx.CodecParameters()
+	writer := &redundancyWriter{TrackLocalWriter: ctx.WriteStream(), blockTypes: make(map[uint8]uint8), fecTypes: make(map[uint8]bool)}
+	var primary *webrtc.RTPCodecParameters
+	for _, ingress := range r.codecs {
+		if strings.EqualFold(ingress.MimeType, MimeTypeUlpFec) {
+			writer.fecTypes[uint8(ingress.PayloadType)] = true
+		}
+		if isRedundancyCodec(ingress.RTPCodecCapability) {
+			continue
+		}
+		if egress, err := findBindingCodec(ingress.RTPCodecCapability, params); err == nil {
+			writer.blockTypes[uint8(ingress.PayloadType)] = uint8(egress.PayloadType)
+			if primary == nil && !writer.fecTypes[uint8(ingress.PayloadType)] {
+				primary = &egress
+			}
+		}
+	}
+	if primary == nil {
+		return nil, webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+	}
+	writer.primaryType = uint8(primary.PayloadType)
+
+	binding, err := findBindingCodec(codec, params)
+	if err == nil {
+		writer.redType = uint8(binding.PayloadType)
+		writer.forward.Store(true)
+		return &redundancyContext{TrackLocalContext: ctx, codec: binding, writer: writer}, binding, nil
+	}
+	// the local track binds with RED and the primary payload type, the writer replaces the payload type of every packet
+	binding = webrtc.RTPCodecParameters{RTPCodecCapability: codec, PayloadType: primary.PayloadType}
+	return &redundancyContext{TrackLocalContext: ctx, codec: binding, writer: writer}, *primary, nil
+}
+
+// redundancyContext offers the local track only the RED codec of the binding and writes over the redundancy writer
+type redundancyContext struct {
+	webrtc.TrackLocalContext
+	codec  webrtc.RTPCodecParameters
+	writer *redundancyWriter
+}
+
+func (c *redundancyContext) CodecParameters() []webrtc.RTPCodecParameters {
+	return []webrtc.RTPCodecParameters{c.codec}
+}
+
+func (c *redundancyContext) WriteStream() webrtc.TrackLocalWriter {
+	return c.writer
+}
+
+// redundancyWriter forwards or strips the redundancy of a RED packet for one binding.
+// The packets are written by the media writer, the send queue and the retransmissions, so the writer keeps no buffer.
+type redundancyWriter struct {
+	webrtc.TrackLocalWriter
+	// payload type of RED of the binding, 0 if the egress peer did not negotiate RED
+	redType uint8
+	// payload type of the primary encoding of the binding
+	primaryType uint8
+	// payload types of the encapsulated blocks mapped from the ingress peer to the binding
+	blockTypes map[uint8]uint8
+	// payload types of the FEC blocks of the ingress peer
+	fecTypes map[uint8]bool
+	forward  atomic.Bool
+}
+
+// forwardRedundancy switches the redundancy of the binding on or off, it is ignored if the binding did not negotiate RED
+func (w *redundancyWriter) forwardRedundancy(enabled bool) {
+	w.forward.Store(enabled && w.redType != 0)
+}
+
+func (w *redundancyWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	if w.forward.Load() {
+		if n, ok, err := w.writeRed(header, payload); ok {
+			return n, err
+		}
+	}
+	return w.writePrimary(header, payload)
+}
+
+// writeRed sends the RED packet with the payload types of the binding, it fails if a block is unknown to the binding
+func (w *redundancyWriter) writeRed(header *rtp.Header, payload []byte) (int, bool, error) {
+	bufPtr := fanoutBufferPool.Get().(*[]byte)
+	defer fanoutBufferPool.Put(bufPtr)
+	red := (*bufPtr)[:copy(*bufPtr, payload)]
+	for offset := 0; offset < len(red); offset += 4 {
+		blockType, ok := w.blockTypes[red[offset]&0x7F]
+		if !ok {
+			return 0, false, nil
+		}
+		last := red[offset]&0x80 == 0
+		red[offset] = red[offset]&0x80 | blockType
+		if last {
+			packet := *header
+			packet.PayloadType = w.redType
+			n, err := w.TrackLocalWriter.WriteRTP(&packet, red)
+			return n, true, err
+		}
+	}
+	return 0, false, nil
+}
+
+// writePrimary sends only the primary block, a FEC block is replaced by padding to keep the sequence numbers
+func (w *redundancyWriter) writePrimary(header *rtp.Header, payload []byte) (int, error) {
+	blockType, primary, ok := redPrimaryBlock(payload)
+	if !ok {
+		return 0, nil
+	}
+	packet := *header
+	packet.PayloadType = w.primaryType
+	if w.fecTypes[blockType] {
+		packet.Padding = true
+		return w.TrackLocalWriter.WriteRTP(&packet, redundancyPadding)
+	}
+	if egressType, ok := w.blockTypes[blockType]; ok {
+		packet.PayloadType = egressType
+	}
+	return w.TrackLocalWriter.WriteRTP(&packet, primary)
+}
+
+func (w *redundancyWriter) Write(b []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(b); err != nil {
+		return 0, err
+	}
+	return w.WriteRTP(&packet.Header, packet.Payload)
+}
+
+// redPrimaryBlock returns the payload type and the data of the primary block of a RED payload (RFC 2198).
+// The redundant blocks have a 4 byte header with the length of the block, the primary block is the last one with a 1 byte header.
+func redPrimaryBlock(payload []byte) (uint8, []byte, bool) {
+	offset, redundant := 0, 0
+	for {
+		if offset >= len(payload) {
+			return 0, nil, false
+		}
+		if payload[offset]&0x80 == 0 {
+			break
+		}
+		if offset+4 > len(payload) {
+			return 0, nil, false
+		}
+		redundant += int(payload[offset+2]&0x03)<<8 | int(payload[offset+3])
+		offset += 4
+	}
+	blockType := payload[offset] & 0x7F
+	start := offset + 1 + redundant
+	if start > len(payload) {
+		return 0, nil, false
+	}
+	return blockType, payload[start:], true
+}
+
+// redundancyForwarder is a sent track, whose redundancy can be switched on or off depending on the loss of the remote peer
+type redundancyForwarder interface {
+	forwardRedundancy(enabled bool)
+}
+
+// redundancyDecision forwards the redundancy as long as the loss in percent reaches the threshold,
+// below the half of the threshold the redundancy is stripped again
+func redundancyDecision(forward bool, loss int, threshold int) bool {
+	if loss >= threshold {
+		return true
+	}
+	if loss < threshold/2 {
+		return false
+	}
+	return forward
+}
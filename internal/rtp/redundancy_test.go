@@ -0,0 +1,145 @@
+package rtp
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testRedCodec  = webrtc.RTPCodecCapability{MimeType: MimeTypeAudioRed, ClockRate: 48000, Channels: 2, SDPFmtpLine: "111/111"}
+	testOpusCodec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}
+)
+
+// testRedPayload encodes one redundant block and the primary block (RFC 2198)
+func testRedPayload(redundantType uint8, redundant []byte, primaryType uint8, primary []byte) []byte {
+	payload := []byte{0x80 | redundantType, 0x00, byte(len(redundant) >> 8 & 0x03), byte(len(redundant))}
+	payload = append(payload, primaryType)
+	payload = append(payload, redundant...)
+	return append(payload, primary...)
+}
+
+type testPacketWriter struct {
+	packets []rtp.Packet
+}
+
+func (w *testPacketWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.packets = append(w.packets, rtp.Packet{Header: *header, Payload: append([]byte(nil), payload...)})
+	return len(payload), nil
+}
+
+func (w *testPacketWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func testRedundancySetup(t *testing.T, codecs ...webrtc.RTPCodecParameters) (*TrackInfo, *forwardTrack, *testPacketWriter) {
+	t.Helper()
+	track, err := webrtc.NewTrackLocalStaticRTP(testRedCodec, uuid.NewString(), uuid.NewString())
+	assert.NoError(t, err)
+	info := newTrackInfo(track, *newTrackSdpInfo(uuid.New()))
+	info.redundancy = newRedundancyCodecs([]webrtc.RTPCodecParameters{
+		{RTPCodecCapability: testOpusCodec, PayloadType: 111},
+		{RTPCodecCapability: testRedCodec, PayloadType: 63},
+	})
+	local := info.GetTrackLocal().(*forwardTrack)
+	writer := &testPacketWriter{}
+	_, err = local.Bind(&baseTrackLocalContext{id: uuid.NewString(), params: webrtc.RTPParameters{Codecs: codecs}, ssrc: 1, writeStream: writer})
+	assert.NoError(t, err)
+	return info, local, writer
+}
+
+func TestRedundancy(t *testing.T) {
+	t.Run("read primary block", func(t *testing.T) {
+		blockType, primary, ok := redPrimaryBlock(testRedPayload(111, []byte{1, 2, 3}, 111, []byte{4, 5}))
+
+		assert.True(t, ok)
+		assert.Equal(t, uint8(111), blockType)
+		assert.Equal(t, []byte{4, 5}, primary)
+	})
+
+	t.Run("reject truncated payload", func(t *testing.T) {
+		_, _, ok := redPrimaryBlock([]byte{0x80 | 111, 0x00, 0x00})
+		assert.False(t, ok)
+	})
+
+	t.Run("forward redundancy with the payload types of the binding", func(t *testing.T) {
+		info, _, writer := testRedundancySetup(t,
+			webrtc.RTPCodecParameters{RTPCodecCapability: testOpusCodec, PayloadType: 109},
+			webrtc.RTPCodecParameters{RTPCodecCapability: testRedCodec, PayloadType: 100},
+		)
+
+		err := info.GetTrack().WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: 7}, Payload: testRedPayload(111, []byte{1}, 111, []byte{2})})
+
+		assert.NoError(t, err)
+		assert.Len(t, writer.packets, 1)
+		assert.Equal(t, uint8(100), writer.packets[0].PayloadType)
+		assert.Equal(t, testRedPayload(109, []byte{1}, 109, []byte{2}), writer.packets[0].Payload)
+	})
+
+	t.Run("strip redundancy for binding without red", func(t *testing.T) {
+		info, _, writer := testRedundancySetup(t, webrtc.RTPCodecParameters{RTPCodecCapability: testOpusCodec, PayloadType: 109})
+
+		err := info.GetTrack().WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: 7}, Payload: testRedPayload(111, []byte{1}, 111, []byte{2})})
+
+		assert.NoError(t, err)
+		assert.Len(t, writer.packets, 1)
+		assert.Equal(t, uint8(109), writer.packets[0].PayloadType)
+		assert.Equal(t, []byte{2}, writer.packets[0].Payload)
+	})
+
+	t.Run("strip redundancy of binding without loss", func(t *testing.T) {
+		info, local, writer := testRedundancySetup(t,
+			webrtc.RTPCodecParameters{RTPCodecCapability: testOpusCodec, PayloadType: 109},
+			webrtc.RTPCodecParameters{RTPCodecCapability: testRedCodec, PayloadType: 100},
+		)
+
+		local.forwardRedundancy(false)
+		err := info.GetTrack().WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: 7}, Payload: testRedPayload(111, []byte{1}, 111, []byte{2})})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(109), writer.packets[0].PayloadType)
+		assert.Equal(t, []byte{2}, writer.packets[0].Payload)
+	})
+
+	t.Run("replace stripped fec packet by padding", func(t *testing.T) {
+		writer := &testPacketWriter{}
+		fec := &redundancyWriter{TrackLocalWriter: writer, primaryType: 96, blockTypes: map[uint8]uint8{96: 96}, fecTypes: map[uint8]bool{117: true}}
+
+		_, err := fec.WriteRTP(&rtp.Header{Version: 2, SequenceNumber: 3}, []byte{117, 0xAA})
+
+		assert.NoError(t, err)
+		assert.True(t, writer.packets[0].Padding)
+		assert.Equal(t, uint8(96), writer.packets[0].PayloadType)
+		assert.Equal(t, uint16(3), writer.packets[0].SequenceNumber)
+	})
+
+	t.Run("negotiate redundancy codecs", func(t *testing.T) {
+		api, err := (&Engine{}).createApi(withRedundancy(Redundancy{Audio: true, Video: true}))
+		assert.NoError(t, err)
+		pc, err := api.NewPeerConnection(webrtc.Configuration{})
+		assert.NoError(t, err)
+		defer pc.Close()
+		_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio)
+		assert.NoError(t, err)
+		_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo)
+		assert.NoError(t, err)
+
+		offer, err := pc.CreateOffer(nil)
+
+		assert.NoError(t, err)
+		assert.Contains(t, offer.SDP, "red/48000/2")
+		assert.Contains(t, offer.SDP, "red/90000")
+		assert.Contains(t, offer.SDP, "ulpfec/90000")
+		assert.Contains(t, offer.SDP, "useinbandfec=1")
+	})
+
+	t.Run("decide by loss with hysteresis", func(t *testing.T) {
+		assert.True(t, redundancyDecision(false, 5, 5))
+		assert.True(t, redundancyDecision(true, 3, 5))
+		assert.False(t, redundancyDecision(false, 3, 5))
+		assert.False(t, redundancyDecision(true, 1, 5))
+	})
+}
@@ -0,0 +1,139 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/pion/rtp"
+)
+
+// retransmitBuffer holds the last packets of a forwarded track, so the NACKs of all egress peers of the track
+// are answered by the SFU. Only the sequence numbers that are not buffered anymore are requested from the ingress peer.
+type retransmitBuffer struct {
+	mu    sync.RWMutex
+	slots []retransmitSlot
+	// requests the packets from the ingress peer of the track
+	requestUpstream func(seqs []uint16)
+}
+
+type retransmitSlot struct {
+	buf   []byte
+	size  int
+	seq   uint16
+	valid bool
+}
+
+func newRetransmitBuffer(size int, requestUpstream func(seqs []uint16)) *retransmitBuffer {
+	slots := make([]retransmitSlot, size)
+	for i := range slots {
+		slots[i].buf = make([]byte, rtpBufferSize)
+	}
+	return &retransmitBuffer{slots: slots, requestUpstream: requestUpstream}
+}
+
+// add buffers a raw rtp packet of the ingress track
+func (b *retransmitBuffer) add(raw []byte) {
+	if len(raw) < 12 {
+		return
+	}
+	seq := binary.BigEndian.Uint16(raw[2:4])
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	slot := &b.slots[int(seq)%len(b.slots)]
+	slot.size = copy(slot.buf, raw)
+	slot.seq = seq
+	slot.valid = true
+}
+
+// read copies the buffered packet with the sequence number into buf
+func (b *retransmitBuffer) read(seq uint16, buf []byte) (int, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	slot := &b.slots[int(seq)%len(b.slots)]
+	if !slot.valid || slot.seq != seq {
+		return 0, false
+	}
+	return copy(buf, slot.buf[:slot.size]), true
+}
+
+// size is the number of buffered packets
+func (b *retransmitBuffer) size() int {
+	return len(b.slots)
+}
+
+func (b *retransmitBuffer) forwardUpstream(seqs []uint16) {
+	if len(seqs) > 0 && b.requestUpstream != nil {
+		b.requestUpstream(seqs)
+	}
+}
+
+// seqHistory maps the sequence numbers sent to a binding back to the sequence numbers before the packets were dropped.
+// It has the size of the retransmission buffer, older packets can not be retransmitted anyway.
+// The history is guarded by its owner.
+type seqHistory struct {
+	entries []seqHistoryEntry
+}
+
+type seqHistoryEntry struct {
+	sent, original uint16
+	valid          bool
+}
+
+func newSeqHistory(size int) *seqHistory {
+	return &seqHistory{entries: make([]seqHistoryEntry, size)}
+}
+
+func (h *seqHistory) add(sent uint16, original uint16) {
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[int(sent)%len(h.entries)] = seqHistoryEntry{sent: sent, original: original, valid: true}
+}
+
+// original returns false if the sequence number was not sent or is not in the history anymore
+func (h *seqHistory) original(sent uint16) (uint16, bool) {
+	if len(h.entries) == 0 {
+		return 0, false
+	}
+	entry := h.entries[int(sent)%len(h.entries)]
+	if !entry.valid || entry.sent != sent {
+		return 0, false
+	}
+	return entry.original, true
+}
+
+// retransmitter answers the NACKs of an egress peer, the sequence numbers are the ones the egress peer has received.
+// It returns the number of retransmitted packets.
+type retransmitter interface {
+	retransmit(seqs []uint16) int
+}
+
+// retransmitPackets writes the buffered packets with the egress sequence numbers and requests the missing ones upstream.
+// originalSeq maps an egress sequence number to the sequence number of the ingress track.
+func retransmitPackets(buffer *retransmitBuffer, seqs []uint16, originalSeq func(seq uint16) (uint16, bool), write func(packet *rtp.Packet) error) int {
+	bufPtr := fanoutBufferPool.Get().(*[]byte)
+	defer fanoutBufferPool.Put(bufPtr)
+	missing := make([]uint16, 0)
+	recovered := 0
+	packet := &rtp.Packet{}
+	for _, seq := range seqs {
+		original, ok := originalSeq(seq)
+		if !ok {
+			continue
+		}
+		size, ok := buffer.read(original, *bufPtr)
+		if !ok {
+			missing = append(missing, original)
+			continue
+		}
+		if err := packet.Unmarshal((*bufPtr)[:size]); err != nil {
+			continue
+		}
+		packet.SequenceNumber = seq
+		if err := write(packet); err == nil {
+			recovered++
+		}
+	}
+	buffer.forwardUpstream(missing)
+	return recovered
+}
@@ -0,0 +1,130 @@
+package rtp
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRetransmitSourceWrite(t *testing.T, source *TrackInfo, seq uint16, ts uint32) {
+	t.Helper()
+	raw := testKeyframeCachePacket(t, seq, ts, []byte{0x01})
+	source.retransmits.add(raw)
+	_, err := source.GetTrack().Write(raw)
+	assert.NoError(t, err)
+}
+
+func TestRetransmitBuffer(t *testing.T) {
+	t.Run("read buffered packet", func(t *testing.T) {
+		buffer := newRetransmitBuffer(8, nil)
+		buffer.add(testKeyframeCachePacket(t, 10, 100, []byte{0x01}))
+
+		buf := make([]byte, rtpBufferSize)
+		_, ok := buffer.read(10, buf)
+		assert.True(t, ok)
+		_, ok = buffer.read(11, buf)
+		assert.False(t, ok)
+	})
+
+	t.Run("overwritten packet is not buffered anymore", func(t *testing.T) {
+		buffer := newRetransmitBuffer(8, nil)
+		buffer.add(testKeyframeCachePacket(t, 10, 100, []byte{0x01}))
+		buffer.add(testKeyframeCachePacket(t, 18, 200, []byte{0x01}))
+
+		_, ok := buffer.read(10, make([]byte, rtpBufferSize))
+		assert.False(t, ok)
+	})
+
+	t.Run("answer nack of egress peer and request missing packets upstream", func(t *testing.T) {
+		var upstream []uint16
+		source := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		source.retransmits = newRetransmitBuffer(8, func(seqs []uint16) {
+			upstream = append(upstream, seqs...)
+		})
+		track := source.GetTrackLocal()
+		writer := &testRecordingWriter{}
+		_, err := track.Bind(&baseTrackLocalContext{
+			id:          uuid.NewString(),
+			params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: source.GetTrack().Codec()}}},
+			ssrc:        1,
+			writeStream: writer,
+		})
+		assert.NoError(t, err)
+		testRetransmitSourceWrite(t, source, 20, 100)
+		testRetransmitSourceWrite(t, source, 21, 200)
+
+		recovered := track.(retransmitter).retransmit([]uint16{19, 21})
+
+		assert.Equal(t, 1, recovered)
+		assert.Equal(t, []uint16{20, 21, 21}, writer.sequenceNumbers)
+		assert.Equal(t, []uint16{19}, upstream)
+	})
+
+	t.Run("slot answers nack with the sequence numbers of the slot", func(t *testing.T) {
+		slot, err := newTrackSlot(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus})
+		assert.NoError(t, err)
+		writer := &testRecordingWriter{}
+		_, err = slot.getTrack().Bind(&baseTrackLocalContext{
+			id:          uuid.NewString(),
+			params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: slot.getTrack().Codec()}}},
+			ssrc:        1,
+			writeStream: writer,
+		})
+		assert.NoError(t, err)
+		first := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+		first.retransmits = newRetransmitBuffer(8, nil)
+		second := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+		second.retransmits = newRetransmitBuffer(8, nil)
+
+		assert.NoError(t, slot.bind(first))
+		testRetransmitSourceWrite(t, first, 100, 1000)
+		assert.NoError(t, slot.bind(second))
+		testRetransmitSourceWrite(t, second, 5000, 9)
+		testRetransmitSourceWrite(t, second, 5001, 969)
+
+		// the packet of the previous source can not be retransmitted
+		recovered := slot.retransmit([]uint16{100, 102})
+
+		assert.Equal(t, 1, recovered)
+		assert.Equal(t, []uint16{100, 101, 102, 102}, writer.sequenceNumbers)
+	})
+
+	t.Run("scalable video retransmits the original packet of a sent sequence number", func(t *testing.T) {
+		var upstream []uint16
+		source := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		source.retransmits = newRetransmitBuffer(8, func(seqs []uint16) {
+			upstream = append(upstream, seqs...)
+		})
+		source.svc = newSvcCodec(source.GetTrack().Codec(), nil)
+		track := source.GetTrackLocal().(*forwardTrack)
+		packets := &testPacketWriter{}
+		_, err := track.Bind(&baseTrackLocalContext{
+			id:          uuid.NewString(),
+			params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: source.GetTrack().Codec()}}},
+			ssrc:        1,
+			writeStream: packets,
+		})
+		assert.NoError(t, err)
+		track.getSvcWriter().maxTemporal = 0
+
+		// every second picture is in temporal layer 1 and dropped, so the offset changes with every sent packet
+		for i := uint16(0); i < 6; i++ {
+			raw := testKeyframeCachePacket(t, 100+i, uint32(i)*3000, testVP8Payload(10+i, uint8(i%2), true, i == 0))
+			source.retransmits.add(raw)
+			_, err = source.GetTrack().Write(raw)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, []uint16{100, 101, 102}, testSentSequenceNumbers(packets.packets))
+
+		// 90 was never sent to the binding
+		recovered := track.retransmit([]uint16{101, 90})
+
+		assert.Equal(t, 1, recovered)
+		assert.Empty(t, upstream)
+		retransmitted := packets.packets[len(packets.packets)-1]
+		assert.Equal(t, uint16(101), retransmitted.SequenceNumber)
+		assert.Equal(t, []uint16{10, 11, 12, 11}, testSentPictureIds(t, packets.packets))
+	})
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/pion/webrtc/v3"
 )
 
+// sdpAttributePath carries the origin instance of a track followed by the instances that relayed it
+const sdpAttributePath = "x-shig-path"
+
 func getIngressTrackSdpInfo(sdp webrtc.SessionDescription, sessionId uuid.UUID, rep *trackSdpInfoRepository) error {
 	sdpObj, err := sdp.Unmarshal()
 	if err != nil {
@@ -26,6 +29,9 @@ func getIngressTrackSdpInfo(sdp webrtc.SessionDescription, sessionId uuid.UUID,
 		}
 
 		parseSdpInformation(infoString, trackSdpInfo)
+		if path, found := desc.Attribute(sdpAttributePath); found {
+			parseSdpPath(path, trackSdpInfo)
+		}
 
 		if msid, fund := desc.Attribute("msid"); fund {
 			if idList := strings.SplitAfter(msid, " "); len(idList) == 2 {
@@ -39,6 +45,16 @@ func getIngressTrackSdpInfo(sdp webrtc.SessionDescription, sessionId uuid.UUID,
 }
 
 func MarkStreamAsMain(sdpOrigin *webrtc.SessionDescription, streamID string) (*webrtc.SessionDescription, error) {
+	return markStreamPurpose(sdpOrigin, streamID, PurposeMain)
+}
+
+// MarkStreamAsScreen marks all tracks of a media stream as screen share, so that the server and
+// the other clients do not handle it as camera.
+func MarkStreamAsScreen(sdpOrigin *webrtc.SessionDescription, streamID string) (*webrtc.SessionDescription, error) {
+	return markStreamPurpose(sdpOrigin, streamID, PurposeScreen)
+}
+
+func markStreamPurpose(sdpOrigin *webrtc.SessionDescription, streamID string, purpose Purpose) (*webrtc.SessionDescription, error) {
 	sdpObj, err := sdpOrigin.Unmarshal()
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal sdp: %w", err)
@@ -50,7 +66,10 @@ func MarkStreamAsMain(sdpOrigin *webrtc.SessionDescription, streamID string) (*w
 		}
 		msid, fund := desc.Attribute("msid")
 		if fund && strings.Contains(msid, streamID) {
-			info := sdp.Information(fmt.Sprintf("%d", PurposeMain))
+			info := buildSdpInformation(&TrackSdpInfo{
+				Purpose: purpose,
+				Info:    buildInfoLabel(purpose, desc.MediaName.Media),
+			})
 			desc.MediaTitle = &info
 		}
 	}
@@ -82,6 +101,9 @@ func setEgressTrackInfo(sdpOrigin *webrtc.SessionDescription, repo *trackSdpInfo
 				if sdpInfo, ok := repo.getSdpInfoByEgressTrackId(egressTrackId); ok {
 					info := buildSdpInformation(sdpInfo)
 					desc.MediaTitle = &info
+					if sdpInfo.Origin != uuid.Nil {
+						desc.WithValueAttribute(sdpAttributePath, buildSdpPath(sdpInfo))
+					}
 					if mid, fundMid := desc.Attribute("mid"); fundMid {
 						sdpInfo.EgressMid = mid
 					}
@@ -107,6 +129,8 @@ func parseSdpInformation(infoString string, trackSdpInfo *TrackSdpInfo) {
 			trackSdpInfo.Purpose = PurposeGuest
 		case "2":
 			trackSdpInfo.Purpose = PurposeMain
+		case "3":
+			trackSdpInfo.Purpose = PurposeScreen
 		default:
 			trackSdpInfo.Purpose = PurposeGuest
 		}
@@ -123,6 +147,31 @@ func parseSdpInformation(infoString string, trackSdpInfo *TrackSdpInfo) {
 	}
 }
 
+func parseSdpPath(path string, trackSdpInfo *TrackSdpInfo) {
+	instances := make([]uuid.UUID, 0)
+	for _, field := range strings.Fields(path) {
+		instanceId, err := uuid.Parse(field)
+		if err != nil {
+			return
+		}
+		instances = append(instances, instanceId)
+	}
+	if len(instances) == 0 {
+		return
+	}
+	trackSdpInfo.Origin = instances[0]
+	trackSdpInfo.Path = instances[1:]
+}
+
+func buildSdpPath(trackSdpInfo *TrackSdpInfo) string {
+	instances := make([]string, 0, len(trackSdpInfo.Path)+1)
+	instances = append(instances, trackSdpInfo.Origin.String())
+	for _, instanceId := range trackSdpInfo.Path {
+		instances = append(instances, instanceId.String())
+	}
+	return strings.Join(instances, " ")
+}
+
 func buildSdpInformation(trackSdpInfo *TrackSdpInfo) sdp.Information {
 	muted := "2"
 	if trackSdpInfo.Mute {
@@ -130,3 +179,15 @@ func buildSdpInformation(trackSdpInfo *TrackSdpInfo) sdp.Information {
 	}
 	return sdp.Information(fmt.Sprintf("%d %s %s", trackSdpInfo.Purpose, muted, trackSdpInfo.Info))
 }
+
+// buildInfoLabel builds the human-readable part of the sdp information like "Main-Video"
+func buildInfoLabel(purpose Purpose, media string) string {
+	label := purpose.ToString()
+	if len(label) > 0 {
+		label = strings.ToUpper(label[:1]) + label[1:]
+	}
+	if len(media) > 0 {
+		media = strings.ToUpper(media[:1]) + media[1:]
+	}
+	return label + "-" + media
+}
@@ -114,6 +114,28 @@ func TestSDP(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("set stream as screen stream", func(t *testing.T) {
+		streamID := "b9a4ca87-1c7b-40a3-9400-a6012c725faa"
+		offer := &webrtc.SessionDescription{
+			Type: webrtc.SDPTypeOffer,
+			SDP:  pionSdpOfferWithoutLiveStream,
+		}
+		newOffer, err := MarkStreamAsScreen(offer, streamID)
+		assert.NoError(t, err)
+
+		repo := newTrackSdpInfoRepository()
+		err = getIngressTrackSdpInfo(*newOffer, uuid.New(), repo)
+		assert.NoError(t, err)
+		screenTracks := 0
+		for _, info := range repo.getTrackSdpInfos() {
+			if info.Purpose == PurposeScreen {
+				screenTracks++
+				assert.Contains(t, info.Info, "Screen-")
+			}
+		}
+		assert.Greater(t, screenTracks, 0)
+	})
+
 	t.Run("munge offer with track info list", func(t *testing.T) {
 		t.Skip("skipping testing")
 		repo := testTrackInfoRepositorySetup(t)
@@ -127,6 +149,43 @@ func TestSDP(t *testing.T) {
 	})
 }
 
+func TestSDP_Path(t *testing.T) {
+	origin, relay := uuid.New(), uuid.New()
+
+	t.Run("path of a relayed track is sent to the next instance", func(t *testing.T) {
+		repo := testTrackInfoRepositorySetup(t)
+		info, _ := repo.getSdpInfoByEgressTrackId("1f02c330-c5c6-4607-b584-dfd68bbe90b1")
+		info.Origin = origin
+		info.Path = []uuid.UUID{relay}
+		offer, err := setEgressTrackInfo(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: pionOfferWithSecsMedia}, repo)
+		assert.NoError(t, err)
+
+		received := newTrackSdpInfoRepository()
+		assert.NoError(t, getIngressTrackSdpInfo(*offer, uuid.New(), received))
+
+		relayed, found := received.getSdpInfoByIngressTrackId("1f02c330-c5c6-4607-b584-dfd68bbe90b1")
+		assert.True(t, found)
+		assert.Equal(t, origin, relayed.Origin)
+		assert.Equal(t, []uuid.UUID{relay}, relayed.Path)
+		untagged, found := received.getSdpInfoByIngressTrackId("c8337113-3c48-43c2-9ecd-ce2b2b109154")
+		assert.True(t, found)
+		assert.Equal(t, uuid.Nil, untagged.Origin)
+	})
+
+	t.Run("relayed track passed through the instances of its path", func(t *testing.T) {
+		info := &TrackSdpInfo{}
+		info.RelayedBy(origin)
+		info.RelayedBy(relay)
+		info.RelayedBy(relay)
+
+		assert.Equal(t, origin, info.Origin)
+		assert.Equal(t, []uuid.UUID{relay}, info.Path)
+		assert.True(t, info.PassedThrough(origin))
+		assert.True(t, info.PassedThrough(relay))
+		assert.False(t, info.PassedThrough(uuid.New()))
+	})
+}
+
 func testTrackInfoRepositorySetup(t *testing.T) *trackSdpInfoRepository {
 	t.Helper()
 	repo := newTrackSdpInfoRepository()
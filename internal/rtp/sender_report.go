@@ -0,0 +1,229 @@
+package rtp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"golang.org/x/exp/slog"
+)
+
+const senderReportInterval = time.Second
+
+// seconds between the ntp epoch (1900) and the unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// trackClock maps the rtp timestamps of an ingress track to the wall clock of the publisher.
+// The mapping is taken from the sender reports of the publisher, audio and video of a publisher share the wall clock.
+type trackClock struct {
+	mu        sync.RWMutex
+	clockRate uint32
+	ntpTime   uint64
+	rtpTime   uint32
+	received  time.Time
+	valid     bool
+}
+
+func newTrackClock(clockRate uint32) *trackClock {
+	return &trackClock{clockRate: clockRate}
+}
+
+func (c *trackClock) update(report *rtcp.SenderReport, received time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ntpTime = report.NTPTime
+	c.rtpTime = report.RTPTime
+	c.received = received
+	c.valid = true
+}
+
+// at returns the wall clock of the publisher and the matching rtp timestamp at the local time now
+func (c *trackClock) at(now time.Time) (uint64, uint32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.valid {
+		return 0, 0, false
+	}
+	elapsed := now.Sub(c.received)
+	return c.ntpTime + durationToNtp(elapsed), c.rtpTime + uint32(elapsed.Seconds()*float64(c.clockRate)), true
+}
+
+// readSenderReports reads the RTCP of an ingress track until the track is closed and keeps the clock of the publisher
+func readSenderReports(receiver *webrtc.RTPReceiver, ssrc webrtc.SSRC, clock *trackClock) {
+	for {
+		packets, _, err := receiver.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			if report, ok := packet.(*rtcp.SenderReport); ok && webrtc.SSRC(report.SSRC) == ssrc {
+				clock.update(report, time.Now())
+			}
+		}
+	}
+}
+
+// syncSource provides the wall clock of the publisher in the rtp timestamps of a sent stream,
+// so the sender reports of the stream keep audio and video of the publisher in sync
+type syncSource interface {
+	syncClock(now time.Time) (uint64, uint32, bool)
+}
+
+// senderReportStream counts the packets of a sent stream for its sender reports
+type senderReportStream struct {
+	mu        sync.Mutex
+	ssrc      uint32
+	clockRate float64
+	lastRtp   uint32
+	lastTime  time.Time
+	lastSeq   uint16
+	packets   uint32
+	octets    uint32
+}
+
+func newSenderReportStream(ssrc uint32, clockRate uint32) *senderReportStream {
+	return &senderReportStream{ssrc: ssrc, clockRate: float64(clockRate)}
+}
+
+func (s *senderReportStream) processRTP(now time.Time, header *rtp.Header, payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if diff := header.SequenceNumber - s.lastSeq; s.packets == 0 || (diff > 0 && diff < 1<<15) {
+		s.lastSeq = header.SequenceNumber
+		s.lastRtp = header.Timestamp
+		s.lastTime = now
+	}
+	s.packets++
+	s.octets += uint32(len(payload))
+}
+
+// report creates the sender report with the clock of the publisher.
+// Without sender reports of the publisher, the local clock is mapped to the last sent packet.
+func (s *senderReportStream) report(now time.Time, source syncSource) *rtcp.SenderReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := &rtcp.SenderReport{
+		SSRC:        s.ssrc,
+		NTPTime:     toNtpTime(now),
+		RTPTime:     s.lastRtp + uint32(now.Sub(s.lastTime).Seconds()*s.clockRate),
+		PacketCount: s.packets,
+		OctetCount:  s.octets,
+	}
+	if source != nil {
+		if ntpTime, rtpTime, ok := source.syncClock(now); ok {
+			report.NTPTime, report.RTPTime = ntpTime, rtpTime
+		}
+	}
+	return report
+}
+
+// senderReportFactory replaces the sender reports of pion, the reports of the sent streams carry the clock of the publisher
+type senderReportFactory struct {
+	getSyncSource func(ssrc uint32) (syncSource, bool)
+}
+
+func newSenderReportFactory(getSyncSource func(ssrc uint32) (syncSource, bool)) *senderReportFactory {
+	return &senderReportFactory{getSyncSource: getSyncSource}
+}
+
+func (f *senderReportFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return &senderReportInterceptor{
+		interval:      senderReportInterval,
+		getSyncSource: f.getSyncSource,
+		close:         make(chan struct{}),
+	}, nil
+}
+
+type senderReportInterceptor struct {
+	interceptor.NoOp
+	interval      time.Duration
+	getSyncSource func(ssrc uint32) (syncSource, bool)
+	streams       sync.Map
+	mu            sync.Mutex
+	wg            sync.WaitGroup
+	close         chan struct{}
+}
+
+func (i *senderReportInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.isClosed() {
+		return writer
+	}
+	i.wg.Add(1)
+	go i.loop(writer)
+	return writer
+}
+
+func (i *senderReportInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	stream := newSenderReportStream(info.SSRC, info.ClockRate)
+	i.streams.Store(info.SSRC, stream)
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		stream.processRTP(time.Now(), header, payload)
+		return writer.Write(header, payload, attributes)
+	})
+}
+
+func (i *senderReportInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
+	i.streams.Delete(info.SSRC)
+}
+
+func (i *senderReportInterceptor) Close() error {
+	defer i.wg.Wait()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.isClosed() {
+		close(i.close)
+	}
+	return nil
+}
+
+func (i *senderReportInterceptor) isClosed() bool {
+	select {
+	case <-i.close:
+		return true
+	default:
+		return false
+	}
+}
+
+func (i *senderReportInterceptor) loop(writer interceptor.RTCPWriter) {
+	defer i.wg.Done()
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			i.streams.Range(func(key, value any) bool {
+				stream := value.(*senderReportStream)
+				var source syncSource
+				if i.getSyncSource != nil {
+					source, _ = i.getSyncSource(stream.ssrc)
+				}
+				if _, err := writer.Write([]rtcp.Packet{stream.report(now, source)}, interceptor.Attributes{}); err != nil {
+					slog.Debug("rtp.senderReport: sending sender report", "ssrc", stream.ssrc, "err", err)
+				}
+				return true
+			})
+		case <-i.close:
+			return
+		}
+	}
+}
+
+func toNtpTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix()) + ntpEpochOffset
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+func durationToNtp(d time.Duration) uint64 {
+	if d < 0 {
+		return 0
+	}
+	seconds, fraction := uint64(d/time.Second), uint64(d%time.Second)
+	return seconds<<32 | fraction<<32/uint64(time.Second)
+}
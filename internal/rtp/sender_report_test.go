@@ -0,0 +1,121 @@
+package rtp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSyncSource struct {
+	ntpTime uint64
+	rtpTime uint32
+}
+
+func (s *testSyncSource) syncClock(_ time.Time) (uint64, uint32, bool) {
+	return s.ntpTime, s.rtpTime, true
+}
+
+func TestSenderReport(t *testing.T) {
+	t.Run("convert time to ntp", func(t *testing.T) {
+		now := time.Unix(1, int64(time.Second/2))
+
+		assert.Equal(t, uint64(ntpEpochOffset+1)<<32|1<<31, toNtpTime(now))
+		assert.Equal(t, uint64(5)<<32|1<<31, durationToNtp(5*time.Second+time.Second/2))
+		assert.Equal(t, uint64(0), durationToNtp(-time.Second))
+	})
+
+	t.Run("extrapolate clock of publisher", func(t *testing.T) {
+		received := time.Now()
+		clock := newTrackClock(48000)
+		_, _, ok := clock.at(received)
+		assert.False(t, ok)
+
+		clock.update(&rtcp.SenderReport{NTPTime: 10 << 32, RTPTime: 1000}, received)
+		ntpTime, rtpTime, ok := clock.at(received.Add(2 * time.Second))
+
+		assert.True(t, ok)
+		assert.Equal(t, uint64(12)<<32, ntpTime)
+		assert.Equal(t, uint32(1000+2*48000), rtpTime)
+	})
+
+	t.Run("report clock of publisher", func(t *testing.T) {
+		now := time.Now()
+		stream := newSenderReportStream(1, 90000)
+		stream.processRTP(now, &rtp.Header{SequenceNumber: 1, Timestamp: 500}, []byte{1, 2, 3})
+
+		report := stream.report(now, &testSyncSource{ntpTime: 42 << 32, rtpTime: 7000})
+
+		assert.Equal(t, uint32(1), report.SSRC)
+		assert.Equal(t, uint64(42)<<32, report.NTPTime)
+		assert.Equal(t, uint32(7000), report.RTPTime)
+		assert.Equal(t, uint32(1), report.PacketCount)
+		assert.Equal(t, uint32(3), report.OctetCount)
+	})
+
+	t.Run("report local clock without clock of publisher", func(t *testing.T) {
+		now := time.Now()
+		stream := newSenderReportStream(1, 90000)
+		stream.processRTP(now, &rtp.Header{SequenceNumber: 1, Timestamp: 500}, []byte{1})
+		// out of order packet does not move the clock back
+		stream.processRTP(now, &rtp.Header{SequenceNumber: 0, Timestamp: 100}, []byte{1})
+
+		report := stream.report(now.Add(time.Second), nil)
+
+		assert.Equal(t, toNtpTime(now.Add(time.Second)), report.NTPTime)
+		assert.Equal(t, uint32(500+90000), report.RTPTime)
+		assert.Equal(t, uint32(2), report.PacketCount)
+	})
+
+	t.Run("slot reports clock of current source in timestamps of the slot", func(t *testing.T) {
+		now := time.Now()
+		slot, err := newTrackSlot(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus})
+		assert.NoError(t, err)
+		first := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+		first.clock = newTrackClock(48000)
+		first.clock.update(&rtcp.SenderReport{NTPTime: 10 << 32, RTPTime: 1000}, now)
+		second := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+		second.clock = newTrackClock(48000)
+		second.clock.update(&rtcp.SenderReport{NTPTime: 20 << 32, RTPTime: 9}, now)
+
+		assert.NoError(t, slot.bind(first))
+		testSlotWrite(t, first, 100, 1000)
+		ntpTime, rtpTime, ok := slot.syncClock(now)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(10)<<32, ntpTime)
+		assert.Equal(t, uint32(1000), rtpTime)
+
+		assert.NoError(t, slot.bind(second))
+		_, _, ok = slot.syncClock(now)
+		assert.False(t, ok)
+
+		testSlotWrite(t, second, 5000, 9)
+		ntpTime, rtpTime, ok = slot.syncClock(now)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(20)<<32, ntpTime)
+		assert.Equal(t, uint32(1000+slotAudioTimestampGap), rtpTime)
+	})
+
+	t.Run("reports to a muxer that does not listen yet are refused", func(t *testing.T) {
+		listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.NoError(t, err)
+		addr := listener.LocalAddr().(*net.UDPAddr)
+		assert.NoError(t, listener.Close())
+		conn, err := net.DialUDP("udp", nil, addr)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		var writeErr error
+		assert.Eventually(t, func() bool {
+			_, writeErr = conn.Write([]byte{0})
+			return writeErr != nil
+		}, time.Second, 10*time.Millisecond)
+		assert.True(t, isConnectionRefused(writeErr))
+		assert.False(t, isConnectionRefused(errors.New("write: connection refused")))
+	})
+}
@@ -0,0 +1,593 @@
+package rtp
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// DependencyDescriptorURI is the header extension of AV1 that describes the layers of a frame and its dependencies
+const DependencyDescriptorURI = "https://aomediacodec.github.io/av1-rtp-spec/#dependency-descriptor-rtp-header-extension"
+
+const (
+	// spatial and temporal ids are 3 bit in VP9, the other codecs have less layers
+	svcMaxLayers = 8
+	// the bitrate of the layers is measured over this window
+	svcBitrateWindow = time.Second
+	// sent picture ids of the last pictures, they are needed to rewrite retransmissions and reference differences
+	svcPictureHistory = 256
+)
+
+// svcLayer is the spatial and the temporal layer of a video frame
+type svcLayer struct {
+	spatial  uint8
+	temporal uint8
+}
+
+// svcFrame describes the packet of a video frame as read from the payload descriptor or the dependency descriptor
+type svcFrame struct {
+	layer      svcLayer
+	keyframe   bool
+	frameStart bool
+	frameEnd   bool
+	// the temporal layer of the frame can be switched on with this frame
+	temporalSwitch bool
+	// the spatial layer of the frame can be switched on with this frame
+	spatialSwitch bool
+	// position of the picture id in the payload
+	hasPictureId    bool
+	pictureId       uint16
+	pictureIdOffset int
+	pictureIdLong   bool
+	// positions of the reference differences of VP9 in flexible mode
+	pDiffOffsets [3]int
+	pDiffCount   int
+}
+
+func (f *svcFrame) pictureIdMask() uint16 {
+	if f.pictureIdLong {
+		return 0x7FFF
+	}
+	return 0x7F
+}
+
+// readPictureId reads the picture id of VP8 and VP9, it is 7 or 15 bit long depending on the M bit
+func (f *svcFrame) readPictureId(payload []byte, offset int) (int, bool) {
+	if offset >= len(payload) {
+		return 0, false
+	}
+	f.hasPictureId = true
+	f.pictureIdOffset = offset
+	if payload[offset]&0x80 == 0 {
+		f.pictureId = uint16(payload[offset])
+		return offset + 1, true
+	}
+	if offset+1 >= len(payload) {
+		return 0, false
+	}
+	f.pictureIdLong = true
+	f.pictureId = uint16(payload[offset]&0x7F)<<8 | uint16(payload[offset+1])
+	return offset + 2, true
+}
+
+// parseVP8Frame reads the payload descriptor of VP8 with the temporal layer (RFC 7741)
+func parseVP8Frame(payload []byte) (svcFrame, bool) {
+	frame := svcFrame{}
+	if len(payload) < 1 {
+		return frame, false
+	}
+	frame.frameStart = payload[0]&0x10 != 0 && payload[0]&0x07 == 0
+	offset := 1
+	layerSync := false
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return frame, false
+		}
+		extension := payload[1]
+		offset = 2
+		var ok bool
+		if extension&0x80 != 0 {
+			if offset, ok = frame.readPictureId(payload, offset); !ok {
+				return frame, false
+			}
+		}
+		// TL0PICIDX is only incremented by the base layer, which is always sent
+		if extension&0x40 != 0 {
+			offset++
+		}
+		if extension&0x30 != 0 {
+			if offset >= len(payload) {
+				return frame, false
+			}
+			if extension&0x20 != 0 {
+				frame.layer.temporal = payload[offset] >> 6
+				layerSync = payload[offset]&0x20 != 0
+			}
+			offset++
+		}
+	}
+	if offset >= len(payload) {
+		return frame, false
+	}
+	frame.keyframe = frame.frameStart && payload[offset]&0x01 == 0
+	frame.temporalSwitch = frame.layer.temporal == 0 || layerSync || frame.keyframe
+	frame.spatialSwitch = true
+	return frame, true
+}
+
+// parseVP9Frame reads the payload descriptor of VP9 with the spatial and temporal layer (RFC 9628)
+func parseVP9Frame(payload []byte) (svcFrame, bool) {
+	frame := svcFrame{}
+	if len(payload) < 1 {
+		return frame, false
+	}
+	descriptor := payload[0]
+	interPicture := descriptor&0x40 != 0
+	flexible := descriptor&0x10 != 0
+	frame.frameStart = descriptor&0x08 != 0
+	frame.frameEnd = descriptor&0x04 != 0
+	offset := 1
+	var ok bool
+	if descriptor&0x80 != 0 {
+		if offset, ok = frame.readPictureId(payload, offset); !ok {
+			return frame, false
+		}
+	}
+	switchingUp := true
+	if descriptor&0x20 != 0 {
+		if offset >= len(payload) {
+			return frame, false
+		}
+		frame.layer.temporal = payload[offset] >> 5
+		switchingUp = payload[offset]&0x10 != 0
+		frame.layer.spatial = payload[offset] >> 1 & 0x07
+		offset++
+		if !flexible {
+			offset++
+		}
+	}
+	if flexible && interPicture {
+		for frame.pDiffCount < len(frame.pDiffOffsets) {
+			if offset >= len(payload) {
+				return frame, false
+			}
+			frame.pDiffOffsets[frame.pDiffCount] = offset
+			frame.pDiffCount++
+			offset++
+			if payload[offset-1]&0x01 == 0 {
+				break
+			}
+		}
+	}
+	frame.keyframe = !interPicture && frame.frameStart && frame.layer.spatial == 0
+	frame.temporalSwitch = frame.layer.temporal == 0 || switchingUp || !interPicture
+	// a frame without inter-picture prediction only depends on the lower spatial layers of the same picture
+	frame.spatialSwitch = !interPicture
+	return frame, true
+}
+
+// av1Template is a frame template of the dependency descriptor
+type av1Template struct {
+	layer svcLayer
+	// the template is a switch point for one of the decode targets
+	switchPoint bool
+}
+
+// av1Structure is the template dependency structure of the dependency descriptor, it is sent with the keyframes
+type av1Structure struct {
+	templateIdOffset uint8
+	templates        []av1Template
+}
+
+// parseAV1Frame reads the dependency descriptor of AV1 (AV1 RTP specification, appendix A).
+// The structure of the last keyframe is needed to know the layers of the following frames.
+func parseAV1Frame(descriptor []byte, structure *av1Structure) (svcFrame, bool) {
+	frame := svcFrame{}
+	if len(descriptor) < 3 {
+		return frame, false
+	}
+	frame.frameStart = descriptor[0]&0x80 != 0
+	frame.frameEnd = descriptor[0]&0x40 != 0
+	templateId := descriptor[0] & 0x3F
+	if len(descriptor) > 3 {
+		reader := &bitReader{data: descriptor[3:]}
+		flags, ok := reader.read(5)
+		if !ok {
+			return frame, false
+		}
+		if flags&0x10 != 0 {
+			if !structure.read(reader) {
+				return frame, false
+			}
+			frame.keyframe = frame.frameStart
+		}
+	}
+	index := int(templateId+64-structure.templateIdOffset) % 64
+	if index >= len(structure.templates) {
+		return frame, false
+	}
+	template := structure.templates[index]
+	frame.layer = template.layer
+	frame.keyframe = frame.keyframe && frame.layer.spatial == 0
+	frame.temporalSwitch = template.switchPoint || frame.keyframe
+	frame.spatialSwitch = template.switchPoint || frame.keyframe
+	return frame, true
+}
+
+// read reads the layers and the decode target indications of the templates
+func (s *av1Structure) read(reader *bitReader) bool {
+	offset, ok := reader.read(6)
+	if !ok {
+		return false
+	}
+	decodeTargets, ok := reader.read(5)
+	if !ok {
+		return false
+	}
+	templates := make([]av1Template, 0, 8)
+	layer := svcLayer{}
+	for {
+		if layer.spatial >= svcMaxLayers || layer.temporal >= svcMaxLayers {
+			return false
+		}
+		templates = append(templates, av1Template{layer: layer})
+		next, ok := reader.read(2)
+		if !ok {
+			return false
+		}
+		if next == 3 {
+			break
+		}
+		switch next {
+		case 1:
+			layer.temporal++
+		case 2:
+			layer.temporal = 0
+			layer.spatial++
+		}
+	}
+	for i := range templates {
+		for target := uint32(0); target <= decodeTargets; target++ {
+			indication, ok := reader.read(2)
+			if !ok {
+				return false
+			}
+			// decode target indication "switch"
+			if indication == 2 {
+				templates[i].switchPoint = true
+			}
+		}
+	}
+	s.templateIdOffset = uint8(offset)
+	s.templates = templates
+	return true
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(bits int) (uint32, bool) {
+	var value uint32
+	for i := 0; i < bits; i++ {
+		if r.pos/8 >= len(r.data) {
+			return 0, false
+		}
+		value = value<<1 | uint32(r.data[r.pos/8]>>(7-r.pos%8)&0x01)
+		r.pos++
+	}
+	return value, true
+}
+
+// svcCodec is the scalable video codec of an ingress track. The layers of VP8 and VP9 are read from the payload descriptor,
+// the layers of AV1 from the dependency descriptor header extension.
+type svcCodec struct {
+	mimeType               string
+	dependencyDescriptorID uint8
+}
+
+// newSvcCodec returns nil for codecs without layers and for AV1 without dependency descriptor
+func newSvcCodec(codec webrtc.RTPCodecCapability, extensions []webrtc.RTPHeaderExtensionParameter) *svcCodec {
+	switch {
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8), strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP9):
+		return &svcCodec{mimeType: strings.ToLower(codec.MimeType)}
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeAV1):
+		for _, extension := range extensions {
+			if extension.URI == DependencyDescriptorURI {
+				return &svcCodec{mimeType: strings.ToLower(codec.MimeType), dependencyDescriptorID: uint8(extension.ID)}
+			}
+		}
+	}
+	return nil
+}
+
+// newWriter selects the layers for a binding, the history of the sent sequence numbers has the size of the retransmission buffer
+func (c *svcCodec) newWriter(writer webrtc.TrackLocalWriter, historySize int) *svcWriter {
+	w := &svcWriter{TrackLocalWriter: writer, maxSpatial: svcMaxLayers - 1, maxTemporal: svcMaxLayers - 1, sent: newSeqHistory(historySize)}
+	switch c.mimeType {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		w.parse = func(_ *rtp.Header, payload []byte) (svcFrame, bool) { return parseVP8Frame(payload) }
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		w.parse = func(_ *rtp.Header, payload []byte) (svcFrame, bool) { return parseVP9Frame(payload) }
+	default:
+		structure := &av1Structure{}
+		w.parse = func(header *rtp.Header, _ []byte) (svcFrame, bool) {
+			return parseAV1Frame(header.GetExtension(c.dependencyDescriptorID), structure)
+		}
+	}
+	return w
+}
+
+// svcContext offers the local track the layer selection as writer of the binding
+type svcContext struct {
+	webrtc.TrackLocalContext
+	writer *svcWriter
+}
+
+func (c *svcContext) WriteStream() webrtc.TrackLocalWriter {
+	return c.writer
+}
+
+type svcPicture struct {
+	original uint16
+	sent     uint16
+	valid    bool
+}
+
+// svcWriter selects the layers of a scalable video track for one binding. The layers are limited by the video quality of
+// the subscription, the estimated bitrate and the loss of the remote peer. Higher layers are dropped immediately, but only
+// switched on at frames that do not depend on missing frames. The dropped packets and pictures are removed from the
+// sequence numbers and picture ids, so the decoder of the remote peer does not see them as lost.
+// Frame numbers of AV1 are not rewritten, the dependency descriptor lets the decoder skip the missing frames.
+type svcWriter struct {
+	webrtc.TrackLocalWriter
+	parse func(header *rtp.Header, payload []byte) (svcFrame, bool)
+
+	mu          sync.Mutex
+	maxSpatial  uint8
+	maxTemporal uint8
+	bitrate     uint64
+	current     svcLayer
+	started     bool
+	// dropped packets are removed from the sequence numbers, the history maps the sent ones back for retransmissions
+	seqOffset uint16
+	sent      *seqHistory
+	// dropped pictures
+	pictureOffset uint16
+	lastPicture   uint16
+	pictureSeen   bool
+	pictures      [svcPictureHistory]svcPicture
+	// bitrate of the layers in bit per second
+	windowStart  time.Time
+	layerBytes   [svcMaxLayers][svcMaxLayers]uint64
+	layerBitrate [svcMaxLayers][svcMaxLayers]uint64
+}
+
+func (w *svcWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	// packets without layer information are forwarded
+	frame, ok := w.parse(header, payload)
+
+	w.mu.Lock()
+	if ok && !w.forward(frame, len(payload)) {
+		w.seqOffset++
+		w.mu.Unlock()
+		return len(payload), nil
+	}
+	packet := *header
+	packet.SequenceNumber -= w.seqOffset
+	w.sent.add(packet.SequenceNumber, header.SequenceNumber)
+	if !ok {
+		w.mu.Unlock()
+		return w.TrackLocalWriter.WriteRTP(&packet, payload)
+	}
+	sentPicture := (frame.pictureId - w.pictureOffset) & frame.pictureIdMask()
+	if frame.hasPictureId {
+		w.pictures[frame.pictureId%svcPictureHistory] = svcPicture{original: frame.pictureId, sent: sentPicture, valid: true}
+	}
+	current := w.current
+	w.mu.Unlock()
+
+	return w.write(&packet, payload, frame, sentPicture, current)
+}
+
+// forward selects the layers and decides if the packet is sent to the binding, the writer has to be locked
+func (w *svcWriter) forward(frame svcFrame, size int) bool {
+	w.measure(time.Now(), frame.layer, size)
+	if !w.started || frame.frameStart {
+		w.switchLayers(frame)
+	}
+	if frame.hasPictureId && (!w.pictureSeen || frame.pictureId != w.lastPicture) {
+		w.pictureSeen, w.lastPicture = true, frame.pictureId
+		// all frames of a picture share the temporal layer
+		if frame.layer.temporal > w.current.temporal {
+			w.pictureOffset++
+		}
+	}
+	return frame.layer.spatial <= w.current.spatial && frame.layer.temporal <= w.current.temporal
+}
+
+// writeRetransmission writes a buffered packet again, the packet has the sequence number of the binding already
+func (w *svcWriter) writeRetransmission(header *rtp.Header, payload []byte) (int, error) {
+	frame, ok := w.parse(header, payload)
+	if !ok {
+		return w.TrackLocalWriter.WriteRTP(header, payload)
+	}
+	w.mu.Lock()
+	sentPicture := (frame.pictureId - w.pictureOffset) & frame.pictureIdMask()
+	if picture := w.pictures[frame.pictureId%svcPictureHistory]; picture.valid && picture.original == frame.pictureId {
+		sentPicture = picture.sent
+	}
+	current := w.current
+	w.mu.Unlock()
+	return w.write(header, payload, frame, sentPicture, current)
+}
+
+// write rewrites the picture ids and the end of the picture in a copy of the payload, the payload is shared by all bindings
+func (w *svcWriter) write(header *rtp.Header, payload []byte, frame svcFrame, sentPicture uint16, current svcLayer) (int, error) {
+	// the last forwarded spatial layer ends the picture
+	header.Marker = header.Marker || (frame.frameEnd && frame.layer.spatial >= current.spatial)
+	if !frame.hasPictureId || sentPicture == frame.pictureId {
+		return w.TrackLocalWriter.WriteRTP(header, payload)
+	}
+
+	bufPtr := fanoutBufferPool.Get().(*[]byte)
+	defer fanoutBufferPool.Put(bufPtr)
+	rewritten := (*bufPtr)[:copy(*bufPtr, payload)]
+	if frame.pictureIdLong {
+		rewritten[frame.pictureIdOffset] = 0x80 | byte(sentPicture>>8)
+		rewritten[frame.pictureIdOffset+1] = byte(sentPicture)
+	} else {
+		rewritten[frame.pictureIdOffset] = byte(sentPicture)
+	}
+	w.mu.Lock()
+	for i := 0; i < frame.pDiffCount; i++ {
+		offset := frame.pDiffOffsets[i]
+		reference := (frame.pictureId - uint16(rewritten[offset]>>1)) & frame.pictureIdMask()
+		if picture := w.pictures[reference%svcPictureHistory]; picture.valid && picture.original == reference {
+			if diff := (sentPicture - picture.sent) & frame.pictureIdMask(); diff > 0 && diff < 0x80 {
+				rewritten[offset] = byte(diff)<<1 | rewritten[offset]&0x01
+			}
+		}
+	}
+	w.mu.Unlock()
+	return w.TrackLocalWriter.WriteRTP(header, rewritten)
+}
+
+func (w *svcWriter) Write(b []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(b); err != nil {
+		return 0, err
+	}
+	return w.WriteRTP(&packet.Header, packet.Payload)
+}
+
+// switchLayers switches the layers at the start of a frame, the writer has to be locked
+func (w *svcWriter) switchLayers(frame svcFrame) {
+	target := w.target()
+	if !w.started || frame.keyframe {
+		w.started = true
+		w.current = target
+		return
+	}
+	if target.spatial < w.current.spatial {
+		w.current.spatial = target.spatial
+	} else if frame.layer.spatial > w.current.spatial && frame.layer.spatial <= target.spatial && frame.spatialSwitch {
+		w.current.spatial = frame.layer.spatial
+	}
+	if target.temporal < w.current.temporal {
+		w.current.temporal = target.temporal
+	} else if frame.layer.temporal > w.current.temporal && frame.layer.temporal <= target.temporal && frame.temporalSwitch {
+		w.current.temporal = frame.layer.temporal
+	}
+}
+
+// target are the highest layers the binding should receive, the writer has to be locked
+func (w *svcWriter) target() svcLayer {
+	target := svcLayer{spatial: w.maxSpatial, temporal: w.maxTemporal}
+	if fit, ok := w.fitBitrate(); ok {
+		target.spatial = min(target.spatial, fit.spatial)
+		target.temporal = min(target.temporal, fit.temporal)
+	}
+	return target
+}
+
+// fitBitrate returns the highest layers whose measured bitrate fits the estimated bitrate of the remote peer.
+// The spatial layer is reduced before the temporal layer, a lower frame rate is better than a lower resolution.
+func (w *svcWriter) fitBitrate() (svcLayer, bool) {
+	if w.bitrate == 0 {
+		return svcLayer{}, false
+	}
+	measured := false
+	for spatial := svcMaxLayers - 1; spatial >= 0; spatial-- {
+		for temporal := svcMaxLayers - 1; temporal >= 0; temporal-- {
+			bitrate := uint64(0)
+			for s := 0; s <= spatial; s++ {
+				for t := 0; t <= temporal; t++ {
+					bitrate += w.layerBitrate[s][t]
+				}
+			}
+			measured = measured || bitrate > 0
+			if measured && bitrate <= w.bitrate {
+				return svcLayer{spatial: uint8(spatial), temporal: uint8(temporal)}, true
+			}
+		}
+	}
+	return svcLayer{}, measured
+}
+
+// measure adds the packet to the bitrate of its layer, the writer has to be locked
+func (w *svcWriter) measure(now time.Time, layer svcLayer, size int) {
+	if elapsed := now.Sub(w.windowStart); elapsed >= svcBitrateWindow {
+		for s := range w.layerBytes {
+			for t := range w.layerBytes[s] {
+				w.layerBitrate[s][t] = w.layerBytes[s][t] * 8 * uint64(time.Second) / uint64(elapsed)
+				w.layerBytes[s][t] = 0
+			}
+		}
+		w.windowStart = now
+	}
+	if layer.spatial < svcMaxLayers && layer.temporal < svcMaxLayers {
+		w.layerBytes[layer.spatial][layer.temporal] += uint64(size)
+	}
+}
+
+// originalSeq maps a sequence number sent to the binding to the sequence number before the layer selection.
+// It returns false if the packet is older than the history.
+func (w *svcWriter) originalSeq(seq uint16) (uint16, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sent.original(seq)
+}
+
+func (w *svcWriter) setMaxSpatialLayer(layer uint8) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxSpatial = layer
+}
+
+func (w *svcWriter) setTargetBitrate(bitrate uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.bitrate = bitrate
+}
+
+func (w *svcWriter) adaptToLoss(loss int, threshold int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxTemporal = svcTemporalDecision(w.maxTemporal, w.current.temporal, loss, threshold)
+}
+
+// svcSelector is a sent track, whose layers are selected for the remote peer
+type svcSelector interface {
+	setVideoQuality(quality VideoQuality)
+	setTargetBitrate(bitrate uint64)
+	adaptToLoss(loss int, threshold int)
+}
+
+// svcSpatialLayer is the highest spatial layer of a video quality
+func svcSpatialLayer(quality VideoQuality) uint8 {
+	switch quality {
+	case VideoQuality_LOW:
+		return 0
+	case VideoQuality_MEDIUM:
+		return 1
+	default:
+		return svcMaxLayers - 1
+	}
+}
+
+// svcTemporalDecision drops the highest sent temporal layer as long as the loss in percent reaches the threshold,
+// below the half of the threshold the temporal layers are switched on again one by one
+func svcTemporalDecision(maxTemporal uint8, current uint8, loss int, threshold int) uint8 {
+	if loss >= threshold {
+		return max(current, 1) - 1
+	}
+	if loss < threshold/2 && maxTemporal < svcMaxLayers-1 {
+		return maxTemporal + 1
+	}
+	return maxTemporal
+}
@@ -0,0 +1,197 @@
+package rtp
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// testVP8Payload encodes a payload descriptor with long picture id and temporal layer (RFC 7741)
+func testVP8Payload(pictureId uint16, temporal uint8, layerSync bool, keyframe bool) []byte {
+	tid := temporal << 6
+	if layerSync {
+		tid |= 0x20
+	}
+	frame := byte(0x01)
+	if keyframe {
+		frame = 0x00
+	}
+	return []byte{0x90, 0xA0, 0x80 | byte(pictureId>>8), byte(pictureId), tid, frame}
+}
+
+// testVP9Payload encodes a payload descriptor in non-flexible mode with long picture id and layers (RFC 9628)
+func testVP9Payload(pictureId uint16, spatial uint8, temporal uint8, interPicture bool) []byte {
+	descriptor := byte(0xAC)
+	if interPicture {
+		descriptor |= 0x40
+	}
+	return []byte{descriptor, 0x80 | byte(pictureId>>8), byte(pictureId), temporal<<5 | spatial<<1, 0x00, 0x01}
+}
+
+func testSvcWrite(t *testing.T, writer *svcWriter, seq uint16, payload []byte) {
+	t.Helper()
+	_, err := writer.WriteRTP(&rtp.Header{Version: 2, SequenceNumber: seq}, payload)
+	assert.NoError(t, err)
+}
+
+func testSentPictureIds(t *testing.T, packets []rtp.Packet) []uint16 {
+	t.Helper()
+	ids := make([]uint16, 0, len(packets))
+	for _, packet := range packets {
+		frame, ok := parseVP8Frame(packet.Payload)
+		assert.True(t, ok)
+		ids = append(ids, frame.pictureId)
+	}
+	return ids
+}
+
+func testSentSequenceNumbers(packets []rtp.Packet) []uint16 {
+	seqs := make([]uint16, 0, len(packets))
+	for _, packet := range packets {
+		seqs = append(seqs, packet.SequenceNumber)
+	}
+	return seqs
+}
+
+func TestSvc(t *testing.T) {
+	t.Run("parse temporal layer of vp8", func(t *testing.T) {
+		frame, ok := parseVP8Frame(testVP8Payload(300, 2, true, false))
+
+		assert.True(t, ok)
+		assert.Equal(t, svcLayer{temporal: 2}, frame.layer)
+		assert.Equal(t, uint16(300), frame.pictureId)
+		assert.True(t, frame.pictureIdLong)
+		assert.True(t, frame.temporalSwitch)
+		assert.False(t, frame.keyframe)
+	})
+
+	t.Run("parse layers of vp9", func(t *testing.T) {
+		frame, ok := parseVP9Frame(testVP9Payload(7, 1, 2, true))
+
+		assert.True(t, ok)
+		assert.Equal(t, svcLayer{spatial: 1, temporal: 2}, frame.layer)
+		assert.Equal(t, uint16(7), frame.pictureId)
+		assert.True(t, frame.frameStart)
+		assert.True(t, frame.frameEnd)
+		assert.False(t, frame.spatialSwitch)
+	})
+
+	t.Run("parse layers of av1 from the structure of the dependency descriptor", func(t *testing.T) {
+		structure := &av1Structure{}
+		// two templates (S0T0 switch, S0T1 discardable) with one decode target
+		keyframe, ok := parseAV1Frame([]byte{0xC0, 0x00, 0x01, 0x80, 0x00, 0x79}, structure)
+		assert.True(t, ok)
+		assert.True(t, keyframe.keyframe)
+		assert.Len(t, structure.templates, 2)
+
+		frame, ok := parseAV1Frame([]byte{0xC1, 0x00, 0x02}, structure)
+
+		assert.True(t, ok)
+		assert.Equal(t, svcLayer{temporal: 1}, frame.layer)
+		assert.False(t, frame.temporalSwitch)
+	})
+
+	t.Run("drop temporal layer without gaps in sequence numbers and picture ids", func(t *testing.T) {
+		packets := &testPacketWriter{}
+		writer := (&svcCodec{mimeType: "video/vp8"}).newWriter(packets, 8)
+		writer.maxTemporal = 0
+
+		testSvcWrite(t, writer, 1, testVP8Payload(10, 0, false, true))
+		testSvcWrite(t, writer, 2, testVP8Payload(11, 1, true, false))
+		testSvcWrite(t, writer, 3, testVP8Payload(12, 0, false, false))
+
+		assert.Equal(t, []uint16{1, 2}, testSentSequenceNumbers(packets.packets))
+		assert.Equal(t, []uint16{10, 11}, testSentPictureIds(t, packets.packets))
+		original, ok := writer.originalSeq(2)
+		assert.True(t, ok)
+		assert.Equal(t, uint16(3), original)
+		original, ok = writer.originalSeq(1)
+		assert.True(t, ok)
+		assert.Equal(t, uint16(1), original)
+	})
+
+	t.Run("switch temporal layer on at layer sync", func(t *testing.T) {
+		packets := &testPacketWriter{}
+		writer := (&svcCodec{mimeType: "video/vp8"}).newWriter(packets, 8)
+		writer.maxTemporal = 0
+		testSvcWrite(t, writer, 1, testVP8Payload(10, 0, false, true))
+		testSvcWrite(t, writer, 2, testVP8Payload(11, 1, true, false))
+
+		writer.maxTemporal = svcMaxLayers - 1
+		testSvcWrite(t, writer, 3, testVP8Payload(12, 1, false, false))
+		testSvcWrite(t, writer, 4, testVP8Payload(13, 0, false, false))
+		testSvcWrite(t, writer, 5, testVP8Payload(14, 1, true, false))
+
+		assert.Equal(t, []uint16{1, 2, 3}, testSentSequenceNumbers(packets.packets))
+		assert.Equal(t, []uint16{10, 11, 12}, testSentPictureIds(t, packets.packets))
+	})
+
+	t.Run("end picture with the highest sent spatial layer", func(t *testing.T) {
+		packets := &testPacketWriter{}
+		writer := (&svcCodec{mimeType: "video/vp9"}).newWriter(packets, 8)
+		writer.maxSpatial = 0
+
+		testSvcWrite(t, writer, 1, testVP9Payload(1, 0, 0, false))
+		testSvcWrite(t, writer, 2, testVP9Payload(1, 1, 0, false))
+
+		assert.Len(t, packets.packets, 1)
+		assert.True(t, packets.packets[0].Marker)
+	})
+
+	t.Run("retransmit with sent picture id", func(t *testing.T) {
+		packets := &testPacketWriter{}
+		writer := (&svcCodec{mimeType: "video/vp8"}).newWriter(packets, 8)
+		writer.maxTemporal = 0
+		testSvcWrite(t, writer, 1, testVP8Payload(10, 0, false, true))
+		testSvcWrite(t, writer, 2, testVP8Payload(11, 1, true, false))
+		testSvcWrite(t, writer, 3, testVP8Payload(12, 0, false, false))
+
+		_, err := writer.writeRetransmission(&rtp.Header{Version: 2, SequenceNumber: 2}, testVP8Payload(12, 0, false, false))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []uint16{10, 11, 11}, testSentPictureIds(t, packets.packets))
+	})
+
+	t.Run("fit layers to the estimated bitrate", func(t *testing.T) {
+		writer := (&svcCodec{mimeType: "video/vp9"}).newWriter(&testPacketWriter{}, 8)
+		writer.layerBitrate[0][0] = 100_000
+		writer.layerBitrate[0][1] = 50_000
+		writer.layerBitrate[1][0] = 300_000
+
+		writer.bitrate = 200_000
+		assert.Equal(t, svcLayer{spatial: 0, temporal: svcMaxLayers - 1}, writer.target())
+		writer.bitrate = 120_000
+		assert.Equal(t, svcLayer{}, writer.target())
+		writer.bitrate = 0
+		assert.Equal(t, svcLayer{spatial: svcMaxLayers - 1, temporal: svcMaxLayers - 1}, writer.target())
+	})
+
+	t.Run("apply video quality set before the binding", func(t *testing.T) {
+		track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9}, uuid.NewString(), uuid.NewString())
+		assert.NoError(t, err)
+		info := newTrackInfo(track, *newTrackSdpInfo(uuid.New()))
+		info.svc = newSvcCodec(track.Codec(), nil)
+		local := info.GetTrackLocal().(*forwardTrack)
+
+		local.setVideoQuality(VideoQuality_LOW)
+		_, err = local.Bind(&baseTrackLocalContext{
+			id:          uuid.NewString(),
+			params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: track.Codec()}}},
+			ssrc:        1,
+			writeStream: &testPacketWriter{},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(0), local.getSvcWriter().maxSpatial)
+	})
+
+	t.Run("drop temporal layers by loss with hysteresis", func(t *testing.T) {
+		assert.Equal(t, uint8(1), svcTemporalDecision(7, 2, 10, 10))
+		assert.Equal(t, uint8(0), svcTemporalDecision(1, 0, 10, 10))
+		assert.Equal(t, uint8(1), svcTemporalDecision(1, 1, 7, 10))
+		assert.Equal(t, uint8(2), svcTemporalDecision(1, 1, 2, 10))
+	})
+}
@@ -7,7 +7,15 @@ import (
 
 type TrackInfo struct {
 	TrackSdpInfo
-	Track *webrtc.TrackLocalStaticRTP
+	Track         *webrtc.TrackLocalStaticRTP
+	keyframeCache *keyframeCache
+	fanout        *packetFanout
+	retransmits   *retransmitBuffer
+	redundancy    *redundancyCodecs
+	clock         *trackClock
+	svc           *svcCodec
+	// asks the ingress peer of the track for a keyframe
+	keyframeRequest func()
 }
 
 func newTrackInfo(track *webrtc.TrackLocalStaticRTP, sdpInfo TrackSdpInfo) *TrackInfo {
@@ -25,6 +33,13 @@ func (t *TrackInfo) GetPurpose() Purpose {
 	return t.Purpose
 }
 
+// WithPurpose returns a copy of the track with another purpose, the copy sends the same media
+func (t *TrackInfo) WithPurpose(purpose Purpose) *TrackInfo {
+	info := *t
+	info.Purpose = purpose
+	return &info
+}
+
 func (t *TrackInfo) GetSessionId() uuid.UUID {
 	return t.SessionId
 }
@@ -33,7 +48,15 @@ func (t *TrackInfo) GetTrack() *webrtc.TrackLocalStaticRTP {
 	return t.Track
 }
 
+// GetTrackLocal returns the track as it is sent to the remote peers. With packet fanout every remote peer
+// has its own send queue, with keyframe cache new remote peers receive the last keyframe first and
+// with retransmission buffer the lost packets of the remote peers are sent again. The redundancy of RED tracks is only
+// sent to remote peers that negotiated RED. The clock of the publisher is used for the sender reports of the remote peers.
+// The layers of scalable video are selected for every remote peer.
 func (t *TrackInfo) GetTrackLocal() webrtc.TrackLocal {
+	if t.Track != nil && (t.fanout != nil || t.keyframeCache != nil || t.retransmits != nil || t.redundancy != nil || t.clock != nil || t.svc != nil) {
+		return &forwardTrack{TrackLocalStaticRTP: t.Track, fanout: t.fanout, keyframeCache: t.keyframeCache, retransmits: t.retransmits, redundancy: t.redundancy, clock: t.clock, svc: t.svc}
+	}
 	return t.Track
 }
 
@@ -50,3 +73,10 @@ func (t *TrackInfo) GetEgressMid() string {
 func (t *TrackInfo) SetMute(mute bool) {
 	t.Mute = mute
 }
+
+// requestKeyframe asks the ingress peer of the track for a keyframe, tracks without ingress peer ignore the request
+func (t *TrackInfo) requestKeyframe() {
+	if t.keyframeRequest != nil {
+		t.keyframeRequest()
+	}
+}
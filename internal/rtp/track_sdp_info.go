@@ -1,9 +1,14 @@
 package rtp
 
 import (
+	"errors"
+	"slices"
+
 	"github.com/google/uuid"
 )
 
+var ErrUnknownPurpose = errors.New("unknown track purpose")
+
 type TrackSdpInfo struct {
 	Id uuid.UUID
 	// source ----------
@@ -15,16 +20,39 @@ type TrackSdpInfo struct {
 	EgressMid     string
 	EgressTrackId string
 
+	// federation ----
+	// Origin is the instance the track was published on, Path are the instances that relayed the track since then
+	Origin uuid.UUID
+	Path   []uuid.UUID
+
 	Purpose Purpose
 	Mute    bool
 	Info    string
 }
 
+// PassedThrough checks if the track was published on or relayed by the instance
+func (i *TrackSdpInfo) PassedThrough(instanceId uuid.UUID) bool {
+	return i.Origin == instanceId || slices.Contains(i.Path, instanceId)
+}
+
+// RelayedBy adds the instance the track was received from to the path.
+// A track without origin comes from an instance that does not tag its tracks, so it was published there.
+func (i *TrackSdpInfo) RelayedBy(instanceId uuid.UUID) {
+	if i.Origin == uuid.Nil {
+		i.Origin = instanceId
+		return
+	}
+	if !i.PassedThrough(instanceId) {
+		i.Path = append(slices.Clone(i.Path), instanceId)
+	}
+}
+
 type Purpose int
 
 const (
 	PurposeGuest Purpose = iota + 1
 	PurposeMain
+	PurposeScreen
 )
 
 func (p Purpose) ToString() string {
@@ -33,11 +61,38 @@ func (p Purpose) ToString() string {
 		return "guest"
 	case PurposeMain:
 		return "main"
+	case PurposeScreen:
+		return "screen"
 	default:
 		return "guest"
 	}
 }
 
+// Priority orders tracks when a session receives the current tracks of a lobby, higher comes first.
+func (p Purpose) Priority() int {
+	switch p {
+	case PurposeScreen:
+		return 3
+	case PurposeMain:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func ParsePurpose(purpose string) (Purpose, error) {
+	switch purpose {
+	case "guest":
+		return PurposeGuest, nil
+	case "main":
+		return PurposeMain, nil
+	case "screen":
+		return PurposeScreen, nil
+	default:
+		return 0, ErrUnknownPurpose
+	}
+}
+
 func newTrackSdpInfo(sessionId uuid.UUID) *TrackSdpInfo {
 	id := uuid.New()
 	return &TrackSdpInfo{Id: id, SessionId: sessionId, Purpose: PurposeGuest, Mute: false, Info: "Guest"}
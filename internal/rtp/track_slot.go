@@ -0,0 +1,279 @@
+package rtp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+var ErrSlotCodecMismatch = errors.New("source codec does not match the codec of the slot")
+
+// timestamp gap between the last packet of the previous source and the first packet of the next source
+const (
+	slotVideoTimestampGap = 3000 // one frame at 30 fps with a 90 kHz clock
+	slotAudioTimestampGap = 960  // 20 ms at 48 kHz
+)
+
+// codecs of the pre-allocated slots of the slot pool, sources with other codecs are sent without slot
+var (
+	slotPoolAudioCodec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}
+	slotPoolVideoCodec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}
+)
+
+// TrackSlotMapping is the complete slot mapping of an endpoint. The revision increases with every change,
+// so the remote peer can ignore mappings that arrive out of order.
+type TrackSlotMapping struct {
+	Revision uint64
+	Slots    []TrackSlotInfo
+}
+
+// TrackSlotInfo maps the local track of a slot to the media stream it currently shows.
+// An empty media stream id means that the slot is paused.
+type TrackSlotInfo struct {
+	TrackId       string
+	Kind          string
+	MediaStreamId string
+	Purpose       Purpose
+	Mute          bool
+}
+
+// trackSlot is a pre-allocated egress track. It sends its own local track, so the source media stream can be switched
+// without a renegotiation. The slot rewrites the sequence numbers and timestamps of the source packets,
+// so the remote peer receives one continuous stream. A slot without source is paused and sends nothing.
+type trackSlot struct {
+	mu      sync.Mutex
+	track   *webrtc.TrackLocalStaticRTP
+	source  *TrackInfo
+	binding *baseTrackLocalContext
+	// the local track of the source that is bound to the slot, it's needed to unbind the source again
+	sourceLocal webrtc.TrackLocal
+	// increased with every source switch, packets of an old source are dropped
+	generation uint64
+	// the next packet starts a new source and the offsets must be recalculated
+	rebase    bool
+	started   bool
+	seqOffset uint16
+	tsOffset  uint32
+	// first sequence number sent from the current source, older packets can not be retransmitted
+	sourceStartSeq  uint16
+	lastSeq         uint16
+	lastTs          uint32
+	waitForKeyframe bool
+	isVideo         bool
+	// keyframe detection of the codec, nil if the keyframes of the codec can not be detected
+	isKeyframe func(payload []byte) bool
+	// the slot is filled by the Last-N assignment and not by the slot pool, guarded by the slot mutex of the endpoint
+	managed bool
+}
+
+func newTrackSlot(codec webrtc.RTPCodecCapability) (*trackSlot, error) {
+	kind := strings.Split(codec.MimeType, "/")[0]
+	return newTrackSlotWithStream(codec, kind+"-slot-"+uuid.NewString())
+}
+
+// newTrackSlotWithStream creates a slot whose local track belongs to the given media stream
+func newTrackSlotWithStream(codec webrtc.RTPCodecCapability, streamId string) (*trackSlot, error) {
+	track, err := webrtc.NewTrackLocalStaticRTP(codec, uuid.NewString(), streamId)
+	if err != nil {
+		return nil, fmt.Errorf("creating local track of slot: %w", err)
+	}
+	return &trackSlot{
+		track:      track,
+		isVideo:    track.Kind() == webrtc.RTPCodecTypeVideo,
+		isKeyframe: keyframeDetector(codec),
+	}, nil
+}
+
+// bind switches the slot to a new source track, the previous source is released.
+// The source track calls the slot while it is locked itself, that's why the slot is never locked during (un)binding.
+func (s *trackSlot) bind(source *TrackInfo) error {
+	if !s.acceptsCodec(source.GetTrack().Codec()) {
+		return ErrSlotCodecMismatch
+	}
+
+	sourceLocal := source.GetTrackLocal()
+	s.mu.Lock()
+	oldLocal, oldBinding := s.sourceLocal, s.binding
+	s.generation++
+	generation := s.generation
+	binding := &baseTrackLocalContext{
+		id:   uuid.NewString(),
+		ssrc: webrtc.SSRC(generation),
+		params: webrtc.RTPParameters{
+			Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: source.GetTrack().Codec()}},
+		},
+		writeStream: &slotWriter{slot: s, generation: generation},
+	}
+	s.source = source
+	s.sourceLocal = sourceLocal
+	s.binding = binding
+	s.rebase = true
+	// a decoder can only continue with the new source after a keyframe
+	s.waitForKeyframe = s.isKeyframe != nil
+	s.mu.Unlock()
+
+	unbindSource(oldLocal, oldBinding)
+	if _, err := sourceLocal.Bind(binding); err != nil {
+		s.mu.Lock()
+		if s.generation == generation {
+			s.source, s.sourceLocal, s.binding = nil, nil, nil
+		}
+		s.mu.Unlock()
+		return fmt.Errorf("binding source to slot: %w", err)
+	}
+	// the next keyframe of the source could be seconds away
+	if s.isVideo {
+		source.requestKeyframe()
+	}
+	return nil
+}
+
+// release pauses the slot
+func (s *trackSlot) release() {
+	s.mu.Lock()
+	oldLocal, oldBinding := s.sourceLocal, s.binding
+	s.source, s.sourceLocal, s.binding = nil, nil, nil
+	s.generation++
+	s.mu.Unlock()
+	unbindSource(oldLocal, oldBinding)
+}
+
+func unbindSource(sourceLocal webrtc.TrackLocal, binding *baseTrackLocalContext) {
+	if sourceLocal != nil && binding != nil {
+		_ = sourceLocal.Unbind(binding)
+	}
+}
+
+func (s *trackSlot) getSource() *TrackInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source
+}
+
+func (s *trackSlot) getTrack() *webrtc.TrackLocalStaticRTP {
+	return s.track
+}
+
+func (s *trackSlot) acceptsCodec(codec webrtc.RTPCodecCapability) bool {
+	return strings.EqualFold(s.track.Codec().MimeType, codec.MimeType)
+}
+
+func (s *trackSlot) showsTrack(track webrtc.TrackLocal) bool {
+	source := s.getSource()
+	return source != nil && source.GetTrackLocal().ID() == track.ID()
+}
+
+func (s *trackSlot) getInfo() TrackSlotInfo {
+	info := TrackSlotInfo{TrackId: s.track.ID(), Kind: s.track.Kind().String()}
+	if source := s.getSource(); source != nil {
+		info.MediaStreamId = source.GetTrackLocal().StreamID()
+		info.Purpose = source.Purpose
+		info.Mute = source.Mute
+	}
+	return info
+}
+
+func (s *trackSlot) write(generation uint64, header *rtp.Header, payload []byte) (int, error) {
+	s.mu.Lock()
+	if generation != s.generation {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	if s.waitForKeyframe {
+		if !s.isKeyframe(payload) {
+			s.mu.Unlock()
+			return 0, nil
+		}
+		s.waitForKeyframe = false
+	}
+	if s.rebase {
+		s.rebaseOffsets(header)
+		s.sourceStartSeq = header.SequenceNumber + s.seqOffset
+	}
+	// copy the header, because the source shares it with all its bindings
+	packet := &rtp.Packet{Header: header.Clone(), Payload: payload}
+	packet.SequenceNumber = header.SequenceNumber + s.seqOffset
+	packet.Timestamp = header.Timestamp + s.tsOffset
+	s.lastSeq = packet.SequenceNumber
+	s.lastTs = packet.Timestamp
+	s.mu.Unlock()
+
+	if err := s.track.WriteRTP(packet); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+func (s *trackSlot) rebaseOffsets(header *rtp.Header) {
+	s.rebase = false
+	if !s.started {
+		s.started = true
+		return
+	}
+	gap := uint32(slotAudioTimestampGap)
+	if s.isVideo {
+		gap = slotVideoTimestampGap
+	}
+	s.seqOffset = s.lastSeq + 1 - header.SequenceNumber
+	s.tsOffset = s.lastTs + gap - header.Timestamp
+}
+
+// retransmit answers a NACK of the remote peer with the buffered packets of the current source
+func (s *trackSlot) retransmit(seqs []uint16) int {
+	s.mu.Lock()
+	forward, _ := s.sourceLocal.(*forwardTrack)
+	seqOffset, tsOffset, startSeq := s.seqOffset, s.tsOffset, s.sourceStartSeq
+	valid := s.started && !s.rebase && !s.waitForKeyframe
+	s.mu.Unlock()
+	if !valid || forward == nil || forward.retransmits == nil {
+		return 0
+	}
+
+	originalSeq := func(seq uint16) (uint16, bool) {
+		if int16(seq-startSeq) < 0 {
+			return 0, false
+		}
+		return forward.originalSeq(seq - seqOffset)
+	}
+	return retransmitPackets(forward.retransmits, seqs, originalSeq, func(packet *rtp.Packet) error {
+		packet.Timestamp += tsOffset
+		return s.track.WriteRTP(packet)
+	})
+}
+
+// syncClock returns the clock of the current source in the timestamps of the slot. Until the first packet of a new source
+// is sent, the offset is unknown and the sender report falls back to the last sent packet.
+func (s *trackSlot) syncClock(now time.Time) (uint64, uint32, bool) {
+	s.mu.Lock()
+	source, tsOffset, valid := s.source, s.tsOffset, s.started && !s.rebase
+	s.mu.Unlock()
+	if !valid || source == nil || source.clock == nil {
+		return 0, 0, false
+	}
+	ntpTime, rtpTime, ok := source.clock.at(now)
+	return ntpTime, rtpTime + tsOffset, ok
+}
+
+// slotWriter receives the packets of a source track and writes them to the slot
+type slotWriter struct {
+	slot       *trackSlot
+	generation uint64
+}
+
+func (w *slotWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	return w.slot.write(w.generation, header, payload)
+}
+
+func (w *slotWriter) Write(b []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(b); err != nil {
+		return 0, err
+	}
+	return w.WriteRTP(&packet.Header, packet.Payload)
+}
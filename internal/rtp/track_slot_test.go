@@ -0,0 +1,179 @@
+package rtp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSlotSourceSetup(t *testing.T, mimeType string) *TrackInfo {
+	t.Helper()
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: mimeType}, uuid.NewString(), uuid.NewString())
+	assert.NoError(t, err)
+	return newTrackInfo(track, *newTrackSdpInfo(uuid.New()))
+}
+
+func testSlotWrite(t *testing.T, source *TrackInfo, seq uint16, ts uint32) {
+	t.Helper()
+	err := source.GetTrack().WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: ts}, Payload: []byte{0x01}})
+	assert.NoError(t, err)
+}
+
+func TestTrackSlot(t *testing.T) {
+	t.Run("switch source without gaps in sequence and timestamp", func(t *testing.T) {
+		slot, err := newTrackSlot(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus})
+		assert.NoError(t, err)
+		first := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+		second := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+
+		assert.NoError(t, slot.bind(first))
+		testSlotWrite(t, first, 100, 1000)
+		assert.Equal(t, uint16(100), slot.lastSeq)
+		assert.Equal(t, uint32(1000), slot.lastTs)
+
+		assert.NoError(t, slot.bind(second))
+		testSlotWrite(t, first, 101, 1960)
+		testSlotWrite(t, second, 5000, 9)
+		assert.Equal(t, uint16(101), slot.lastSeq)
+		assert.Equal(t, uint32(1000+slotAudioTimestampGap), slot.lastTs)
+		assert.Equal(t, second.GetTrackLocal().StreamID(), slot.getInfo().MediaStreamId)
+	})
+
+	t.Run("released slot is paused", func(t *testing.T) {
+		slot, err := newTrackSlot(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus})
+		assert.NoError(t, err)
+		source := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+		assert.NoError(t, slot.bind(source))
+
+		slot.release()
+		testSlotWrite(t, source, 100, 1000)
+
+		assert.False(t, slot.started)
+		assert.Empty(t, slot.getInfo().MediaStreamId)
+	})
+
+	t.Run("reject source with other codec", func(t *testing.T) {
+		slot, err := newTrackSlot(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8})
+		assert.NoError(t, err)
+		source := testSlotSourceSetup(t, webrtc.MimeTypeH264)
+
+		assert.ErrorIs(t, slot.bind(source), ErrSlotCodecMismatch)
+	})
+
+	t.Run("video source is forwarded from a keyframe on", func(t *testing.T) {
+		slot, err := newTrackSlot(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264})
+		assert.NoError(t, err)
+		source := testSlotSourceSetup(t, webrtc.MimeTypeH264)
+		assert.NoError(t, slot.bind(source))
+
+		err = source.GetTrack().WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: 100}, Payload: []byte{0x41, 0x9a}})
+		assert.NoError(t, err)
+		assert.False(t, slot.started)
+
+		err = source.GetTrack().WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: 101}, Payload: []byte{0x65, 0x88}})
+		assert.NoError(t, err)
+		assert.True(t, slot.started)
+		assert.Equal(t, uint16(101), slot.lastSeq)
+	})
+
+	t.Run("binding a video source requests a keyframe", func(t *testing.T) {
+		slot, err := newTrackSlot(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8})
+		assert.NoError(t, err)
+		first := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		second := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		requests := 0
+		first.keyframeRequest = func() { requests++ }
+		second.keyframeRequest = func() { requests++ }
+
+		assert.NoError(t, slot.bind(first))
+		assert.NoError(t, slot.bind(second))
+
+		assert.Equal(t, 2, requests)
+	})
+}
+
+func testSlotPoolEndpointSetup(t *testing.T, onSlotMapping func(TrackSlotMapping)) *Endpoint {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	endpoint := newEndpoint(ctx, uuid.NewString(), uuid.NewString(), EgressEndpoint, EndpointWithSlotPool(1, 1), EndpointWithSlotMappingListener(onSlotMapping))
+	endpoint.peerConnection = pc
+	assert.NoError(t, endpoint.setupSlotPool())
+	return endpoint
+}
+
+func TestEndpointSlotPool(t *testing.T) {
+	t.Run("tracks are shown in the slots of the pool", func(t *testing.T) {
+		var mapping TrackSlotMapping
+		endpoint := testSlotPoolEndpointSetup(t, func(m TrackSlotMapping) { mapping = m })
+		senders := len(endpoint.peerConnection.GetSenders())
+		video := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		audio := testSlotSourceSetup(t, webrtc.MimeTypeOpus)
+
+		endpoint.AddTrack(context.Background(), video)
+		endpoint.AddTrack(context.Background(), audio)
+
+		assert.Len(t, endpoint.peerConnection.GetSenders(), senders)
+		assert.True(t, endpoint.HasTrack(video.GetTrackLocal()))
+		assert.Equal(t, uint64(2), mapping.Revision)
+		assert.Equal(t, video.GetTrackLocal().StreamID(), mapping.Slots[0].MediaStreamId)
+		assert.Equal(t, audio.GetTrackLocal().StreamID(), mapping.Slots[1].MediaStreamId)
+	})
+
+	t.Run("slot mapping carries purpose and mute of the shown track", func(t *testing.T) {
+		var mapping TrackSlotMapping
+		endpoint := testSlotPoolEndpointSetup(t, func(m TrackSlotMapping) { mapping = m })
+		video := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		video.Purpose = PurposeMain
+		endpoint.AddTrack(context.Background(), video)
+		assert.Equal(t, PurposeMain, mapping.Slots[0].Purpose)
+		assert.False(t, mapping.Slots[0].Mute)
+
+		_, ok := endpoint.SetEgressMute(video.GetId(), true)
+		assert.True(t, ok)
+		assert.True(t, mapping.Slots[0].Mute)
+
+		_, ok = endpoint.SetPurpose(video.GetId(), PurposeScreen)
+		assert.True(t, ok)
+		assert.Equal(t, PurposeScreen, mapping.Slots[0].Purpose)
+		assert.Equal(t, uint64(3), mapping.Revision)
+	})
+
+	t.Run("removed track pauses its slot", func(t *testing.T) {
+		var mapping TrackSlotMapping
+		endpoint := testSlotPoolEndpointSetup(t, func(m TrackSlotMapping) { mapping = m })
+		video := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		endpoint.AddTrack(context.Background(), video)
+
+		endpoint.RemoveTrack(context.Background(), video)
+
+		assert.False(t, endpoint.HasTrack(video.GetTrackLocal()))
+		assert.Empty(t, mapping.Slots[0].MediaStreamId)
+	})
+
+	t.Run("track is added to the connection if no slot is free", func(t *testing.T) {
+		endpoint := testSlotPoolEndpointSetup(t, nil)
+		senders := len(endpoint.peerConnection.GetSenders())
+		endpoint.AddTrack(context.Background(), testSlotSourceSetup(t, webrtc.MimeTypeVP8))
+
+		endpoint.AddTrack(context.Background(), testSlotSourceSetup(t, webrtc.MimeTypeVP8))
+
+		assert.Len(t, endpoint.peerConnection.GetSenders(), senders+1)
+	})
+
+	t.Run("Last-N does not take the slots of the pool", func(t *testing.T) {
+		endpoint := testSlotPoolEndpointSetup(t, nil)
+		pooled := testSlotSourceSetup(t, webrtc.MimeTypeVP8)
+		endpoint.AddTrack(context.Background(), pooled)
+
+		endpoint.ReleaseVideoSlots(context.Background())
+
+		assert.True(t, endpoint.HasTrack(pooled.GetTrackLocal()))
+	})
+}
@@ -0,0 +1,376 @@
+package rtp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// payload type of the rtp streams between the transcoder and the encoder process
+	transcoderPayloadType = 96
+	transcoderPacketSize  = 1200
+	// the encoder process is restarted with an exponential backoff
+	transcoderRestartDelay    = time.Second
+	transcoderMaxRestartDelay = 30 * time.Second
+	// keyframe interval of the encoder in frames, new viewers of a transcoded track wait at most this long
+	transcoderKeyframeInterval = 60
+	defaultTranscodingCommand  = "ffmpeg"
+	defaultTranscodingBitrate  = 1500
+)
+
+// transcodingCodecs are the codecs a video track can be transcoded to, in the order of preference
+var transcodingCodecs = []webrtc.RTPCodecCapability{
+	{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+	{MimeType: webrtc.MimeTypeH264, ClockRate: 90000, SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"},
+}
+
+// runEncoder runs the encoder process until it exits or the context is done, the input sdp is passed to stdin
+type runEncoder func(ctx context.Context, command string, sdp string, args []string) error
+
+func runEncoderProcess(ctx context.Context, command string, sdp string, args []string) error {
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = strings.NewReader(sdp)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("running %s: %w: %s", command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// transcoder re-encodes a video track to another codec with an external encoder process.
+// The packets of the source track are sent over RTP to the encoder process, the encoded packets are received over RTP
+// and written to the transcoded track. The encoder process is restarted until the transcoder is stopped.
+type transcoder struct {
+	ctx         context.Context
+	stop        context.CancelFunc
+	config      Transcoding
+	run         runEncoder
+	source      *TrackInfo
+	sourceTrack webrtc.TrackLocal
+	binding     *baseTrackLocalContext
+	codec       webrtc.RTPCodecCapability
+	info        *TrackInfo
+	input       *UdpConnection
+	output      *net.UDPConn
+	subscribers map[string]struct{}
+	wg          sync.WaitGroup
+}
+
+func newTranscoder(ctx context.Context, config Transcoding, run runEncoder, source *TrackInfo, codec webrtc.RTPCodecCapability) (*transcoder, error) {
+	sourceTrack := source.GetTrackLocal()
+	track, err := webrtc.NewTrackLocalStaticRTP(codec, fmt.Sprintf("%s-%s", sourceTrack.ID(), codecName(codec)), sourceTrack.StreamID())
+	if err != nil {
+		return nil, fmt.Errorf("creating transcoded track: %w", err)
+	}
+	ctx, stop := context.WithCancel(ctx)
+	return &transcoder{
+		ctx:         ctx,
+		stop:        stop,
+		config:      config,
+		run:         run,
+		source:      source,
+		sourceTrack: sourceTrack,
+		codec:       codec,
+		info:        newTrackInfo(track, source.TrackSdpInfo),
+		subscribers: make(map[string]struct{}),
+	}, nil
+}
+
+// start binds the source track to the input of the encoder process and starts the supervised encoder process
+func (t *transcoder) start() error {
+	var err error
+	localhost := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	if t.output, err = net.ListenUDP("udp", localhost); err != nil {
+		t.stop()
+		return fmt.Errorf("listening for encoded packets: %w", err)
+	}
+	inputPort, err := freeUdpPort(localhost)
+	if err != nil {
+		t.stop()
+		t.release()
+		return err
+	}
+	t.input = &UdpConnection{port: inputPort, payloadType: transcoderPayloadType}
+	if t.input.conn, err = net.DialUDP("udp", nil, &net.UDPAddr{IP: localhost.IP, Port: inputPort}); err != nil {
+		t.stop()
+		t.release()
+		return fmt.Errorf("dialing encoder input: %w", err)
+	}
+
+	t.binding = &baseTrackLocalContext{
+		id: uuid.NewString(),
+		params: webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{
+			{RTPCodecCapability: t.source.GetTrack().Codec(), PayloadType: transcoderPayloadType},
+		}},
+		ssrc:        webrtc.SSRC(3450704233),
+		writeStream: newLiveStreamWriter(t.ctx, uuid.NewString(), t.input),
+	}
+	if _, err = t.sourceTrack.Bind(t.binding); err != nil {
+		t.binding = nil
+		t.stop()
+		t.release()
+		return fmt.Errorf("binding source track: %w", err)
+	}
+
+	context.AfterFunc(t.ctx, t.release)
+	t.wg.Add(2)
+	go t.readOutput()
+	go t.supervise()
+	return nil
+}
+
+// supervise restarts the encoder process until the transcoder is stopped
+func (t *transcoder) supervise() {
+	defer t.wg.Done()
+	delay := transcoderRestartDelay
+	for {
+		started := time.Now()
+		err := t.run(t.ctx, t.config.command(), t.sdp(), t.args())
+		if t.ctx.Err() != nil {
+			return
+		}
+		slog.Warn("rtp.transcoder: encoder process stopped, restart", "err", err, "trackId", t.sourceTrack.ID(), "codec", t.codec.MimeType, "delay", delay)
+		// a process that was running for a while starts over with the shortest delay
+		if time.Since(started) > transcoderMaxRestartDelay {
+			delay = transcoderRestartDelay
+		}
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, transcoderMaxRestartDelay)
+	}
+}
+
+// readOutput writes the encoded packets of the encoder process to the transcoded track
+func (t *transcoder) readOutput() {
+	defer t.wg.Done()
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := t.output.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if _, err = t.info.Track.Write(buf[:n]); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Debug("rtp.transcoder: writing encoded packet", "err", err, "trackId", t.sourceTrack.ID())
+		}
+	}
+}
+
+// close stops the encoder process, the connections are released when the context of the transcoder is done
+func (t *transcoder) close() {
+	t.stop()
+	t.wg.Wait()
+}
+
+func (t *transcoder) release() {
+	if t.binding != nil {
+		if err := t.sourceTrack.Unbind(t.binding); err != nil {
+			slog.Debug("rtp.transcoder: unbinding source track", "err", err, "trackId", t.sourceTrack.ID())
+		}
+	}
+	if t.input != nil && t.input.conn != nil {
+		_ = t.input.conn.Close()
+	}
+	if t.output != nil {
+		_ = t.output.Close()
+	}
+}
+
+// sdp describes the rtp stream of the source track for the encoder process
+func (t *transcoder) sdp() string {
+	codec := t.source.GetTrack().Codec()
+	var sdp strings.Builder
+	sdp.WriteString("v=0\r\n")
+	sdp.WriteString("o=- 0 0 IN IP4 127.0.0.1\r\n")
+	sdp.WriteString("s=Shig Transcoder\r\n")
+	sdp.WriteString("c=IN IP4 127.0.0.1\r\n")
+	sdp.WriteString("t=0 0\r\n")
+	sdp.WriteString(fmt.Sprintf("m=video %d RTP/AVP %d\r\n", t.input.port, transcoderPayloadType))
+	sdp.WriteString(fmt.Sprintf("a=rtpmap:%d %s/%d\r\n", transcoderPayloadType, codecName(codec), codec.ClockRate))
+	if codec.SDPFmtpLine != "" {
+		sdp.WriteString(fmt.Sprintf("a=fmtp:%d %s\r\n", transcoderPayloadType, codec.SDPFmtpLine))
+	}
+	return sdp.String()
+}
+
+// args are the arguments of the encoder process, it reads the sdp from stdin and sends the encoded packets to the output port
+func (t *transcoder) args() []string {
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-protocol_whitelist", "pipe,udp,rtp",
+		"-f", "sdp", "-i", "pipe:0",
+		"-an",
+	}
+	switch strings.ToLower(t.codec.MimeType) {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		args = append(args, "-c:v", "libx264", "-preset", "ultrafast", "-tune", "zerolatency", "-profile:v", "baseline", "-pix_fmt", "yuv420p")
+	default:
+		args = append(args, "-c:v", "libvpx", "-deadline", "realtime", "-cpu-used", "8", "-error-resilient", "1", "-auto-alt-ref", "0")
+	}
+	return append(args,
+		"-b:v", fmt.Sprintf("%dk", t.config.bitrate()),
+		"-g", fmt.Sprint(transcoderKeyframeInterval),
+		"-f", "rtp", "-payload_type", fmt.Sprint(transcoderPayloadType),
+		fmt.Sprintf("rtp://127.0.0.1:%d?pkt_size=%d", t.output.LocalAddr().(*net.UDPAddr).Port, transcoderPacketSize),
+	)
+}
+
+func codecName(codec webrtc.RTPCodecCapability) string {
+	_, name, _ := strings.Cut(codec.MimeType, "/")
+	return name
+}
+
+// freeUdpPort finds a free port for the encoder process to listen on
+func freeUdpPort(addr *net.UDPAddr) (int, error) {
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return 0, fmt.Errorf("finding free udp port: %w", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port, nil
+}
+
+// TranscodingPool transcodes video tracks for subscribers that do not support the codec of a track.
+// A transcoder runs only as long as a subscriber of the transcoded track exists, subscribers of the same codec share it.
+type TranscodingPool struct {
+	ctx         context.Context
+	config      Transcoding
+	run         runEncoder
+	mu          sync.Mutex
+	transcoders map[string][]*transcoder // source track id --> transcoders of the track
+}
+
+func newTranscodingPool(ctx context.Context, config Transcoding) *TranscodingPool {
+	return &TranscodingPool{
+		ctx:         ctx,
+		config:      config,
+		run:         runEncoderProcess,
+		transcoders: make(map[string][]*transcoder),
+	}
+}
+
+// Acquire returns the track transcoded to the first codec the subscriber accepts. It returns false if the subscriber
+// accepts the codec of the source track, if the source track is no video track or if no transcoder can be started.
+func (p *TranscodingPool) Acquire(source *TrackInfo, subscriber string, accepts func(codec webrtc.RTPCodecCapability) bool) (*TrackInfo, bool) {
+	if source.GetTrack() == nil || source.GetTrack().Kind() != webrtc.RTPCodecTypeVideo || accepts(source.GetTrack().Codec()) {
+		return nil, false
+	}
+	sourceId := source.GetTrackLocal().ID()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.lookup(sourceId, subscriber); ok {
+		return t.info, true
+	}
+	for _, codec := range transcodingCodecs {
+		if !accepts(codec) {
+			continue
+		}
+		t := p.find(sourceId, codec)
+		if t == nil {
+			var err error
+			if t, err = newTranscoder(p.ctx, p.config, p.run, source, codec); err == nil {
+				err = t.start()
+			}
+			if err != nil {
+				slog.Error("rtp.transcodingPool: start transcoder", "err", err, "trackId", sourceId, "codec", codec.MimeType)
+				return nil, false
+			}
+			slog.Info("rtp.transcodingPool: started transcoder", "trackId", sourceId, "codec", codec.MimeType)
+			p.transcoders[sourceId] = append(p.transcoders[sourceId], t)
+		}
+		t.subscribers[subscriber] = struct{}{}
+		return t.info, true
+	}
+	return nil, false
+}
+
+// Lookup returns the transcoded track the subscriber receives instead of the source track
+func (p *TranscodingPool) Lookup(sourceTrackId string, subscriber string) (*TrackInfo, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.lookup(sourceTrackId, subscriber); ok {
+		return t.info, true
+	}
+	return nil, false
+}
+
+// Release returns the transcoded track of the subscriber, the transcoder is stopped if it has no subscribers left
+func (p *TranscodingPool) Release(sourceTrackId string, subscriber string) (*TrackInfo, bool) {
+	p.mu.Lock()
+	t, ok := p.lookup(sourceTrackId, subscriber)
+	if !ok {
+		p.mu.Unlock()
+		return nil, false
+	}
+	delete(t.subscribers, subscriber)
+	stopped := len(t.subscribers) == 0
+	if stopped {
+		p.remove(sourceTrackId, t)
+	}
+	p.mu.Unlock()
+
+	if stopped {
+		slog.Info("rtp.transcodingPool: stop transcoder", "trackId", sourceTrackId, "codec", t.codec.MimeType)
+		t.close()
+	}
+	return t.info, true
+}
+
+// ReleaseAll releases all transcoded tracks of the subscriber
+func (p *TranscodingPool) ReleaseAll(subscriber string) {
+	p.mu.Lock()
+	sourceIds := make([]string, 0)
+	for sourceId := range p.transcoders {
+		if _, ok := p.lookup(sourceId, subscriber); ok {
+			sourceIds = append(sourceIds, sourceId)
+		}
+	}
+	p.mu.Unlock()
+	for _, sourceId := range sourceIds {
+		p.Release(sourceId, subscriber)
+	}
+}
+
+func (p *TranscodingPool) lookup(sourceId string, subscriber string) (*transcoder, bool) {
+	for _, t := range p.transcoders[sourceId] {
+		if _, ok := t.subscribers[subscriber]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (p *TranscodingPool) find(sourceId string, codec webrtc.RTPCodecCapability) *transcoder {
+	for _, t := range p.transcoders[sourceId] {
+		if strings.EqualFold(t.codec.MimeType, codec.MimeType) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (p *TranscodingPool) remove(sourceId string, t *transcoder) {
+	transcoders := p.transcoders[sourceId]
+	for i, other := range transcoders {
+		if other == t {
+			transcoders = append(transcoders[:i], transcoders[i+1:]...)
+			break
+		}
+	}
+	if len(transcoders) == 0 {
+		delete(p.transcoders, sourceId)
+		return
+	}
+	p.transcoders[sourceId] = transcoders
+}
@@ -0,0 +1,162 @@
+package rtp
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+var testH264Codec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000, SDPFmtpLine: "packetization-mode=1;profile-level-id=42e01f"}
+
+func testTranscodingSetup(t *testing.T) (*TranscodingPool, *TrackInfo, *atomic.Int32) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	runs := &atomic.Int32{}
+	pool := newTranscodingPool(ctx, Transcoding{Enabled: true})
+	pool.run = func(ctx context.Context, _ string, _ string, _ []string) error {
+		runs.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	track, err := webrtc.NewTrackLocalStaticRTP(testH264Codec, uuid.NewString(), uuid.NewString())
+	assert.NoError(t, err)
+	return pool, newTrackInfo(track, *newTrackSdpInfo(uuid.New())), runs
+}
+
+func acceptsVP8(codec webrtc.RTPCodecCapability) bool {
+	return codec.MimeType == webrtc.MimeTypeVP8
+}
+
+func TestTranscoder(t *testing.T) {
+	t.Run("describe source track and encoder arguments", func(t *testing.T) {
+		pool, source, _ := testTranscodingSetup(t)
+		transcoded, ok := pool.Acquire(source, "a", acceptsVP8)
+		assert.True(t, ok)
+		transcoder, _ := pool.lookup(source.GetTrackLocal().ID(), "a")
+
+		assert.Contains(t, transcoder.sdp(), "a=rtpmap:96 H264/90000\r\n")
+		assert.Contains(t, transcoder.sdp(), "a=fmtp:96 packetization-mode=1;profile-level-id=42e01f\r\n")
+		assert.Contains(t, transcoder.args(), "libvpx")
+		assert.Contains(t, transcoder.args(), "1500k")
+		assert.Equal(t, webrtc.MimeTypeVP8, transcoded.GetTrack().Codec().MimeType)
+		assert.Equal(t, source.GetId(), transcoded.GetId())
+		assert.Equal(t, source.GetTrackLocal().StreamID(), transcoded.GetTrackLocal().StreamID())
+	})
+
+	t.Run("keep source track for subscribers that accept its codec", func(t *testing.T) {
+		pool, source, runs := testTranscodingSetup(t)
+
+		_, ok := pool.Acquire(source, "a", func(webrtc.RTPCodecCapability) bool { return true })
+
+		assert.False(t, ok)
+		assert.Equal(t, int32(0), runs.Load())
+	})
+
+	t.Run("share transcoder and stop it without subscribers", func(t *testing.T) {
+		pool, source, runs := testTranscodingSetup(t)
+		first, ok := pool.Acquire(source, "a", acceptsVP8)
+		assert.True(t, ok)
+		second, ok := pool.Acquire(source, "b", acceptsVP8)
+		assert.True(t, ok)
+		assert.Same(t, first, second)
+		assert.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+		_, ok = pool.Release(source.GetTrackLocal().ID(), "a")
+		assert.True(t, ok)
+		_, ok = pool.Lookup(source.GetTrackLocal().ID(), "b")
+		assert.True(t, ok)
+
+		pool.ReleaseAll("b")
+		assert.Empty(t, pool.transcoders)
+		_, ok = pool.Release(source.GetTrackLocal().ID(), "b")
+		assert.False(t, ok)
+	})
+
+	t.Run("restart stopped encoder process", func(t *testing.T) {
+		pool, source, _ := testTranscodingSetup(t)
+		runs := &atomic.Int32{}
+		pool.run = func(_ context.Context, _ string, _ string, _ []string) error {
+			runs.Add(1)
+			return nil
+		}
+		_, ok := pool.Acquire(source, "a", acceptsVP8)
+		assert.True(t, ok)
+
+		assert.Eventually(t, func() bool { return runs.Load() == 2 }, 3*transcoderRestartDelay, 10*time.Millisecond)
+		pool.Release(source.GetTrackLocal().ID(), "a")
+	})
+
+	t.Run("relay source packets to the encoder and encoded packets to the transcoded track", func(t *testing.T) {
+		pool, source, _ := testTranscodingSetup(t)
+		transcoded, ok := pool.Acquire(source, "a", acceptsVP8)
+		assert.True(t, ok)
+		transcoder, _ := pool.lookup(source.GetTrackLocal().ID(), "a")
+		encoder, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: transcoder.input.port})
+		assert.NoError(t, err)
+		defer encoder.Close()
+		viewer := &testChanWriter{packets: make(chan rtp.Packet, 1)}
+		_, err = transcoded.GetTrack().Bind(&baseTrackLocalContext{
+			id:          uuid.NewString(),
+			params:      webrtc.RTPParameters{Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: transcodingCodecs[0], PayloadType: 100}}},
+			ssrc:        1,
+			writeStream: viewer,
+		})
+		assert.NoError(t, err)
+
+		assert.NoError(t, source.GetTrack().WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: 1}, Payload: []byte{1}}))
+		buf := make([]byte, rtpBufferSize)
+		assert.NoError(t, encoder.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := encoder.Read(buf)
+		assert.NoError(t, err)
+		received := &rtp.Packet{}
+		assert.NoError(t, received.Unmarshal(buf[:n]))
+		assert.Equal(t, uint8(transcoderPayloadType), received.PayloadType)
+
+		raw, err := (&rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: transcoderPayloadType, SequenceNumber: 5}, Payload: []byte{2}}).Marshal()
+		assert.NoError(t, err)
+		_, err = encoder.WriteTo(raw, transcoder.output.LocalAddr())
+		assert.NoError(t, err)
+
+		select {
+		case packet := <-viewer.packets:
+			assert.Equal(t, uint8(100), packet.PayloadType)
+			assert.Equal(t, []byte{2}, packet.Payload)
+		case <-time.After(time.Second):
+			t.Fatal("encoded packet not relayed")
+		}
+		pool.Release(source.GetTrackLocal().ID(), "a")
+	})
+
+	t.Run("accept codecs of the remote description", func(t *testing.T) {
+		desc := &sdp.SessionDescription{MediaDescriptions: []*sdp.MediaDescription{{
+			MediaName:  sdp.MediaName{Media: "video"},
+			Attributes: []sdp.Attribute{{Key: "rtpmap", Value: "96 VP8/90000"}},
+		}}}
+
+		assert.True(t, sdpAcceptsCodec(desc, transcodingCodecs[0]))
+		assert.False(t, sdpAcceptsCodec(desc, testH264Codec))
+		assert.True(t, sdpAcceptsCodec(desc, testOpusCodec))
+	})
+}
+
+type testChanWriter struct {
+	packets chan rtp.Packet
+}
+
+func (w *testChanWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.packets <- rtp.Packet{Header: *header, Payload: append([]byte(nil), payload...)}
+	return len(payload), nil
+}
+
+func (w *testChanWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
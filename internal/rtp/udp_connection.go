@@ -6,6 +6,10 @@ type UdpConnection struct {
 	conn        *net.UDPConn
 	port        int
 	payloadType uint8
+	// the sender reports are sent to the next port, like the muxers expect it (RFC 3550)
+	rtcpConn *net.UDPConn
+	reports  *senderReportStream
+	sync     syncSource
 }
 
 type UdpShare struct {
@@ -1,5 +1,12 @@
 package rtp
 
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnknownVideoQuality = errors.New("unknown video quality")
+
 type VideoQuality int32
 
 const (
@@ -24,3 +31,21 @@ var (
 		"OFF":    3,
 	}
 )
+
+func (q VideoQuality) ToString() string {
+	if name, ok := VideoQuality_name[int32(q)]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// ParseVideoQuality parses names like "LOW" or "high". Without quality the highest quality is used.
+func ParseVideoQuality(quality string) (VideoQuality, error) {
+	if len(quality) == 0 {
+		return VideoQuality_HIGH, nil
+	}
+	if value, ok := VideoQuality_value[strings.ToUpper(quality)]; ok {
+		return VideoQuality(value), nil
+	}
+	return VideoQuality_OFF, ErrUnknownVideoQuality
+}
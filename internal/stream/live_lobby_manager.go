@@ -5,13 +5,25 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/lobby/federation"
 	"github.com/shigde/sfu/internal/lobby/resources"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/pkg/message"
 )
 
 type liveLobbyManager interface {
 	NewIngressResource(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, offer *webrtc.SessionDescription, option ...resources.Option) (*resources.WebRTC, error)
 	NewEgressResource(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, offer *webrtc.SessionDescription, option ...resources.Option) (*resources.WebRTC, error)
+	NewViewerResource(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, offer *webrtc.SessionDescription, option ...resources.Option) (*resources.WebRTC, error)
+	NewAudienceResource(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, offer *webrtc.SessionDescription) (*resources.WebRTC, error)
+	RemoveAudienceResource(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, viewerId uuid.UUID) (bool, error)
 	LeaveLobby(ctx context.Context, lobbyId uuid.UUID, userId uuid.UUID) (bool, error)
+	ChangeMediaStreamPurpose(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, mediaStreamId string, purpose rtp.Purpose) error
+	Subscribe(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, mediaStreamIds []string, maxQuality rtp.VideoQuality) error
+	Unsubscribe(ctx context.Context, lobbyId uuid.UUID, user uuid.UUID, mediaStreamIds []string) error
+	GetChatHistory(ctx context.Context, lobbyId uuid.UUID) ([]*message.Chat, error)
+	SetLastN(ctx context.Context, lobbyId uuid.UUID, lastN int) error
+	GetFederationStatus(ctx context.Context, lobbyId uuid.UUID) (*federation.ConnectorStatus, error)
 
 	// Live Stream Publishing API
 
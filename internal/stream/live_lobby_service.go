@@ -6,6 +6,9 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/internal/lobby/federation"
+	"github.com/shigde/sfu/internal/rtp"
+	"github.com/shigde/sfu/pkg/message"
 )
 
 type LiveLobbyService struct {
@@ -36,6 +39,37 @@ func (s *LiveLobbyService) CreateLobbyEgressEndpoint(ctx context.Context, sdp *w
 	return resource.SDP, resource.Id, nil
 }
 
+// CreateLobbyViewerEndpoint creates a session that only receives the live stream, the viewer needs no ingress endpoint
+func (s *LiveLobbyService) CreateLobbyViewerEndpoint(ctx context.Context, sdp *webrtc.SessionDescription, stream *LiveStream, userId uuid.UUID) (*webrtc.SessionDescription, string, error) {
+	resource, err := s.lobbyManager.NewViewerResource(ctx, stream.Lobby.UUID, userId, sdp)
+	if err != nil {
+		return nil, "---", fmt.Errorf("accessing lobby: %w", err)
+	}
+	return resource.SDP, resource.Id, nil
+}
+
+// CreateLobbyAudienceEndpoint adds a viewer to the audience of the lobby, the viewer only receives the main program
+func (s *LiveLobbyService) CreateLobbyAudienceEndpoint(ctx context.Context, sdp *webrtc.SessionDescription, stream *LiveStream, userId uuid.UUID) (*webrtc.SessionDescription, string, error) {
+	resource, err := s.lobbyManager.NewAudienceResource(ctx, stream.Lobby.UUID, userId, sdp)
+	if err != nil {
+		return nil, "---", fmt.Errorf("accessing lobby: %w", err)
+	}
+	return resource.SDP, resource.Id, nil
+}
+
+// LeaveLobbyAudience removes a viewer from the audience of the lobby, it returns false if the viewer is unknown
+func (s *LiveLobbyService) LeaveLobbyAudience(ctx context.Context, stream *LiveStream, userId uuid.UUID, resourceId string) (bool, error) {
+	viewerId, err := uuid.Parse(resourceId)
+	if err != nil {
+		return false, fmt.Errorf("parsing resource id: %w", err)
+	}
+	left, err := s.lobbyManager.RemoveAudienceResource(ctx, stream.Lobby.UUID, userId, viewerId)
+	if err != nil {
+		return false, fmt.Errorf("leave lobby audience: %w", err)
+	}
+	return left, nil
+}
+
 func (s *LiveLobbyService) LeaveLobby(ctx context.Context, stream *LiveStream, userId uuid.UUID) (bool, error) {
 	left, err := s.lobbyManager.LeaveLobby(ctx, stream.Lobby.UUID, userId)
 	if err != nil {
@@ -44,6 +78,58 @@ func (s *LiveLobbyService) LeaveLobby(ctx context.Context, stream *LiveStream, u
 	return left, nil
 }
 
+func (s *LiveLobbyService) ChangeMediaStreamPurpose(ctx context.Context, stream *LiveStream, streamPurpose *MediaStreamPurpose, userId uuid.UUID) error {
+	purpose, err := rtp.ParsePurpose(streamPurpose.Purpose)
+	if err != nil {
+		return fmt.Errorf("parsing purpose: %w", err)
+	}
+	if err := s.lobbyManager.ChangeMediaStreamPurpose(ctx, stream.Lobby.UUID, userId, streamPurpose.MediaStreamId, purpose); err != nil {
+		return fmt.Errorf("change media stream purpose: %w", err)
+	}
+	return nil
+}
+
+func (s *LiveLobbyService) Subscribe(ctx context.Context, stream *LiveStream, subscription *MediaStreamSubscription, userId uuid.UUID) error {
+	maxQuality, err := rtp.ParseVideoQuality(subscription.MaxQuality)
+	if err != nil {
+		return fmt.Errorf("parsing max quality: %w", err)
+	}
+	if err := s.lobbyManager.Subscribe(ctx, stream.Lobby.UUID, userId, subscription.MediaStreamIds, maxQuality); err != nil {
+		return fmt.Errorf("subscribe media streams: %w", err)
+	}
+	return nil
+}
+
+func (s *LiveLobbyService) Unsubscribe(ctx context.Context, stream *LiveStream, subscription *MediaStreamSubscription, userId uuid.UUID) error {
+	if err := s.lobbyManager.Unsubscribe(ctx, stream.Lobby.UUID, userId, subscription.MediaStreamIds); err != nil {
+		return fmt.Errorf("unsubscribe media streams: %w", err)
+	}
+	return nil
+}
+
+func (s *LiveLobbyService) GetChatHistory(ctx context.Context, stream *LiveStream) ([]*message.Chat, error) {
+	chatList, err := s.lobbyManager.GetChatHistory(ctx, stream.Lobby.UUID)
+	if err != nil {
+		return nil, fmt.Errorf("get chat history: %w", err)
+	}
+	return chatList, nil
+}
+
+func (s *LiveLobbyService) GetFederationStatus(ctx context.Context, stream *LiveStream) (*federation.ConnectorStatus, error) {
+	status, err := s.lobbyManager.GetFederationStatus(ctx, stream.Lobby.UUID)
+	if err != nil {
+		return nil, fmt.Errorf("get federation status: %w", err)
+	}
+	return status, nil
+}
+
+func (s *LiveLobbyService) SetLastN(ctx context.Context, stream *LiveStream, lobbyLastN *LobbyLastN) error {
+	if err := s.lobbyManager.SetLastN(ctx, stream.Lobby.UUID, lobbyLastN.LastN); err != nil {
+		return fmt.Errorf("set last-n: %w", err)
+	}
+	return nil
+}
+
 func (s *LiveLobbyService) StartLiveStream(ctx context.Context, stream *LiveStream, streamInfo *LiveStreamInfo, userId uuid.UUID) error {
 	if err := s.lobbyManager.StartLiveStream(ctx, stream.Lobby.UUID, streamInfo.StreamKey, streamInfo.RtmpUrl, userId); err != nil {
 		return fmt.Errorf("start live stream: %w", err)
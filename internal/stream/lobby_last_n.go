@@ -0,0 +1,6 @@
+package stream
+
+// LobbyLastN limits the video of the lobby participants to the N most recently active speakers, 0 disables Last-N
+type LobbyLastN struct {
+	LastN int `json:"lastN"`
+}
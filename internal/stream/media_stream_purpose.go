@@ -0,0 +1,6 @@
+package stream
+
+type MediaStreamPurpose struct {
+	MediaStreamId string `json:"mediaStreamId"`
+	Purpose       string `json:"purpose"`
+}
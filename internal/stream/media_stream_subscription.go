@@ -0,0 +1,6 @@
+package stream
+
+type MediaStreamSubscription struct {
+	MediaStreamIds []string `json:"mediaStreamIds"`
+	MaxQuality     string   `json:"maxQuality,omitempty"`
+}
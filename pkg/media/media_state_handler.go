@@ -22,6 +22,11 @@ func (h *MediaStateHandler) OnChannel(dc *webrtc.DataChannel) {
 		dc.OnMessage(h.messenger.OnMessages)
 		slog.Debug("messenger: sender is open")
 		go func() {
+			if byteMsg, err := h.messenger.hello(); err == nil {
+				if err := dc.Send(byteMsg); err != nil {
+					slog.Error("lobby.messenger: send hello", "err", err)
+				}
+			}
 			for {
 				slog.Debug("lobby.messenger: sending worker running")
 				select {
@@ -45,4 +50,6 @@ func (h *MediaStateHandler) Close() {
 		close(h.quit)
 		<-h.quit
 	}
+	// without the sending worker the messenger cannot send offers again
+	h.messenger.Close()
 }
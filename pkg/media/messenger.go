@@ -1,9 +1,11 @@
 package media
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
@@ -11,11 +13,53 @@ import (
 	"golang.org/x/exp/slog"
 )
 
+// The data channel of the signalling may lose messages. So an offer is sent again until the server answers or
+// acknowledges its id, like the server does with its own offers.
+var (
+	ackTimeout      = 3 * time.Second
+	maxSendAttempts = 4
+)
+
+// receivedTypes are the message types the messenger understands, the server learns them by the hello
+var receivedTypes = []message.MsgType{
+	message.OfferMsg,
+	message.AnswerMsg,
+	message.MuteMsg,
+	message.MetadataMsg,
+	message.ChatMsg,
+	message.AppMsg,
+	message.ActiveSpeakerMsg,
+	message.TrackSlotsMsg,
+	message.AckMsg,
+	message.HelloMsg,
+}
+
 type Messenger struct {
 	locker       sync.RWMutex
 	observerList map[uuid.UUID]msgObserver
 	QueueChan    chan []byte
 	quit         chan struct{}
+	// revision of the last track slot mapping, older mappings are dropped
+	trackSlotsRevision atomic.Uint64
+	protocol           atomic.Pointer[message.Protocol]
+	ackLocker          sync.Mutex
+	ackTimeout         time.Duration
+	unacked            map[uint32]*unackedMsg
+	lastOffer          *receivedOffer
+}
+
+// unackedMsg is a sent offer that waits for its answer or acknowledgement
+type unackedMsg struct {
+	data     []byte
+	attempts int
+	timer    *time.Timer
+}
+
+// receivedOffer is the last offer of the server, a repeated offer gets the same answer again
+type receivedOffer struct {
+	id     uint32
+	number uint32
+	answer []byte
 }
 
 func NewMessenger() *Messenger {
@@ -24,7 +68,10 @@ func NewMessenger() *Messenger {
 		observerList: make(map[uuid.UUID]msgObserver),
 		QueueChan:    make(chan []byte),
 		quit:         make(chan struct{}),
+		ackTimeout:   ackTimeout,
+		unacked:      make(map[uint32]*unackedMsg),
 	}
+	m.protocol.Store(message.LegacyProtocol())
 	return m
 }
 
@@ -33,6 +80,7 @@ func (m *Messenger) OnMessages(dcMsg webrtc.DataChannelMessage) {
 		channelMsg, err := message.Unmarshal(dcMsg.Data)
 		if err != nil {
 			slog.Error("messenger: unmarshal message ([]byte)", "length", len(dcMsg.Data))
+			return
 		}
 		m.notifyAll(channelMsg)
 	}
@@ -41,32 +89,72 @@ func (m *Messenger) OnMessages(dcMsg webrtc.DataChannelMessage) {
 func (m *Messenger) notifyAll(msg *message.ChannelMsg) {
 	switch msg.Type {
 	case message.AnswerMsg:
-		m.handleAnswerMsg(msg)
+		m.acknowledge(msg.Id)
+		notify(m, msg, func(o msgObserver, answer *message.Sdp) { o.OnAnswer(answer.SDP, msg.Id, answer.Number) })
 	case message.OfferMsg:
 		m.handleOfferMsg(msg)
 	case message.MuteMsg:
-		m.handleMuteMsg(msg)
+		notify(m, msg, msgObserver.OnMute)
+	case message.MetadataMsg:
+		notify(m, msg, func(o msgObserver, metadata *message.Metadata) {
+			if o, ok := o.(metadataObserver); ok {
+				o.OnMetadata(metadata)
+			}
+		})
+	case message.ChatMsg:
+		notify(m, msg, func(o msgObserver, chat *message.Chat) {
+			if o, ok := o.(chatObserver); ok {
+				o.OnChat(chat)
+			}
+		})
+	case message.AppMsg:
+		notify(m, msg, func(o msgObserver, appMessage *message.AppMessage) {
+			if o, ok := o.(appMessageObserver); ok {
+				o.OnAppMessage(appMessage)
+			}
+		})
+	case message.ActiveSpeakerMsg:
+		notify(m, msg, func(o msgObserver, activeSpeaker *message.ActiveSpeaker) {
+			if o, ok := o.(activeSpeakerObserver); ok {
+				o.OnActiveSpeaker(activeSpeaker)
+			}
+		})
+	case message.TrackSlotsMsg:
+		m.handleTrackSlotsMsg(msg)
+	case message.AckMsg:
+		m.acknowledge(msg.Id)
+	case message.HelloMsg:
+		m.handleHelloMsg(msg)
 	default:
 		slog.Error("messenger: unknown msg type", "err", fmt.Sprintf("unknown msg type: %d", msg.Type))
 	}
 }
 
-func (m *Messenger) handleAnswerMsg(msg *message.ChannelMsg) {
-	answer, err := m.unmarshalSdp(msg)
+// notify converts the data of the message to its type and passes it to every observer
+func notify[T any](m *Messenger, msg *message.ChannelMsg, deliver func(observer msgObserver, data *T)) {
+	data, err := message.DataOf[T](msg)
 	if err != nil {
-		slog.Error("messenger: handleAnswerMsg", "err", err)
+		slog.Error("messenger: unmarshal message", "err", err)
+		return
 	}
 	m.locker.RLock()
 	defer m.locker.RUnlock()
 	for _, observer := range m.observerList {
-		observer.OnAnswer(answer.SDP, msg.Id, answer.Number)
+		deliver(observer, data)
 	}
 }
 
+// handleOfferMsg passes a new offer of the server to the observers. An offer whose number is not newer than the last
+// offer is dropped, a repeated offer that is already answered gets the answer again.
 func (m *Messenger) handleOfferMsg(msg *message.ChannelMsg) {
-	offer, err := m.unmarshalSdp(msg)
+	offer, err := message.DataOf[message.Sdp](msg)
 	if err != nil {
 		slog.Error("messenger: handleOfferMsg", "err", err)
+		return
+	}
+	if !m.isNewOffer(msg.Id, offer.Number) {
+		slog.Debug("messenger: drop offer that is not newer", "id", msg.Id, "number", offer.Number)
+		return
 	}
 	m.locker.RLock()
 	defer m.locker.RUnlock()
@@ -75,18 +163,143 @@ func (m *Messenger) handleOfferMsg(msg *message.ChannelMsg) {
 	}
 }
 
-func (m *Messenger) handleMuteMsg(msg *message.ChannelMsg) {
-	mute, err := m.unmarshalMute(msg)
+// isNewOffer reports whether the number of the offer is newer than the number of the last offer
+func (m *Messenger) isNewOffer(id uint32, number uint32) bool {
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	if m.lastOffer == nil || number > m.lastOffer.number {
+		m.lastOffer = &receivedOffer{id: id, number: number}
+		return true
+	}
+	switch {
+	case m.lastOffer.id == id && m.lastOffer.number == number:
+		// the server has lost the answer
+		if m.lastOffer.answer != nil {
+			go m.enqueue(m.lastOffer.answer)
+		}
+	default:
+		// an outdated offer gets no answer, the server stops sending it again
+		go func() {
+			if err := m.SendAck(id); err != nil {
+				slog.Error("messenger: acknowledge outdated offer", "err", err, "id", id)
+			}
+		}()
+	}
+	return false
+}
+
+func (m *Messenger) handleTrackSlotsMsg(msg *message.ChannelMsg) {
+	trackSlots, err := message.DataOf[message.TrackSlots](msg)
 	if err != nil {
-		slog.Error("messenger: handleMuteMsg", "err", err)
+		slog.Error("messenger: handleTrackSlotsMsg", "err", err)
+		return
+	}
+	if revision := m.trackSlotsRevision.Load(); trackSlots.Revision < revision {
+		slog.Debug("messenger: drop outdated track slots", "revision", trackSlots.Revision, "current", revision)
+		return
 	}
+	m.trackSlotsRevision.Store(trackSlots.Revision)
 	m.locker.RLock()
 	defer m.locker.RUnlock()
 	for _, observer := range m.observerList {
-		observer.OnMute(mute)
+		if o, ok := observer.(trackSlotsObserver); ok {
+			o.OnTrackSlots(trackSlots)
+		}
+	}
+}
+
+// handleHelloMsg negotiates the protocol with the hello of the server
+func (m *Messenger) handleHelloMsg(msg *message.ChannelMsg) {
+	hello, err := message.DataOf[message.Hello](msg)
+	if err != nil {
+		slog.Error("messenger: handleHelloMsg", "err", err)
+		return
+	}
+	protocol := message.NewHello(receivedTypes...).Negotiate(hello)
+	m.protocol.Store(protocol)
+	slog.Debug("messenger: protocol negotiated", "version", protocol.Version(), "encoding", protocol.Encoding())
+}
+
+// hello is the first message when the channel opens. It is always JSON, an old server ignores it.
+func (m *Messenger) hello() ([]byte, error) {
+	byteMsg, err := message.Marshal(&message.ChannelMsg{Type: message.HelloMsg, Data: message.NewHello(receivedTypes...)})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling hello message: %w", err)
+	}
+	return byteMsg, nil
+}
+
+// send encodes the message with the negotiated protocol and queues it, a message type the server does not know is
+// skipped
+func (m *Messenger) send(channelMsg *message.ChannelMsg) error {
+	byteMsg, err := m.protocol.Load().Marshal(channelMsg)
+	if errors.Is(err, message.ErrMsgTypeNotSupported) {
+		slog.Debug("messenger: skip message type", "type", channelMsg.Type)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.enqueue(byteMsg)
+	return nil
+}
+
+func (m *Messenger) enqueue(byteMsg []byte) {
+	select {
+	case <-m.quit:
+	default:
+		select {
+		case m.QueueChan <- byteMsg:
+		case <-m.quit:
+		}
 	}
 }
 
+// awaitAck sends the offer again, until the server answers or acknowledges the id or the attempts are exhausted
+func (m *Messenger) awaitAck(id uint32, byteMsg []byte) {
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	if msg, ok := m.unacked[id]; ok {
+		msg.timer.Stop()
+	}
+	msg := &unackedMsg{data: byteMsg, attempts: 1}
+	msg.timer = time.AfterFunc(m.ackTimeout, func() { m.resend(id) })
+	m.unacked[id] = msg
+}
+
+func (m *Messenger) resend(id uint32) {
+	m.ackLocker.Lock()
+	msg, ok := m.unacked[id]
+	if !ok {
+		m.ackLocker.Unlock()
+		return
+	}
+	if msg.attempts >= maxSendAttempts {
+		delete(m.unacked, id)
+		m.ackLocker.Unlock()
+		slog.Error("messenger: offer was never acknowledged", "id", id, "attempts", msg.attempts)
+		return
+	}
+	msg.attempts++
+	attempt := msg.attempts
+	msg.timer.Reset(m.ackTimeout)
+	m.ackLocker.Unlock()
+
+	slog.Warn("messenger: send unacknowledged offer again", "id", id, "attempt", attempt)
+	m.enqueue(msg.data)
+}
+
+func (m *Messenger) acknowledge(id uint32) {
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	if msg, ok := m.unacked[id]; ok {
+		msg.timer.Stop()
+		delete(m.unacked, id)
+	}
+}
+
+// SendSDP sends an offer until the server answers or acknowledges the id. An answer refers to the id of the offer of the
+// server, if the server sends the offer again, it gets this answer again.
 func (m *Messenger) SendSDP(sdp *webrtc.SessionDescription, id uint32, number uint32) (uint32, error) {
 	sdpMsg := &message.Sdp{
 		SDP:    sdp,
@@ -107,47 +320,70 @@ func (m *Messenger) SendSDP(sdp *webrtc.SessionDescription, id uint32, number ui
 		Data: sdpMsg,
 	}
 
-	byteMsg, err := message.Marshal(channelMsg)
+	byteMsg, err := m.protocol.Load().Marshal(channelMsg)
 	if err != nil {
 		return id, fmt.Errorf("marshaling offer message (msgId %d offer %d): %w", id, number, err)
 	}
 
-	select {
-	case <-m.quit:
-	default:
-		select {
-		case m.QueueChan <- byteMsg:
-			slog.Debug("lobby.messenger: offer is send", "number", number)
-		case <-m.quit:
+	switch msgTye {
+	case message.OfferMsg:
+		m.awaitAck(id, byteMsg)
+	case message.AnswerMsg:
+		m.ackLocker.Lock()
+		if m.lastOffer != nil && m.lastOffer.id == id {
+			m.lastOffer.answer = byteMsg
 		}
+		m.ackLocker.Unlock()
 	}
-
+	m.enqueue(byteMsg)
+	slog.Debug("lobby.messenger: offer is send", "number", number)
 	return id, nil
 }
 
+// SendAck acknowledges an offer of the server without an answer, so the server stops sending it again
+func (m *Messenger) SendAck(id uint32) error {
+	if err := m.send(&message.ChannelMsg{Id: id, Type: message.AckMsg}); err != nil {
+		return fmt.Errorf("marshaling ack message (msgId %d): %w", id, err)
+	}
+	return nil
+}
+
 func (m *Messenger) SendMute(mute *message.Mute) error {
+	return m.sendData(message.MuteMsg, mute)
+}
 
-	channelMsg := &message.ChannelMsg{
-		Id:   123,
-		Type: message.MuteMsg,
-		Data: mute,
-	}
+func (m *Messenger) SendMetadata(metadata *message.Metadata) error {
+	return m.sendData(message.MetadataMsg, metadata)
+}
 
-	byteMsg, err := message.Marshal(channelMsg)
-	if err != nil {
-		return fmt.Errorf("marshaling mute message: %w", err)
-	}
+func (m *Messenger) SendChat(text string) error {
+	return m.sendData(message.ChatMsg, &message.Chat{Text: text})
+}
 
-	select {
-	case <-m.quit:
-	default:
-		select {
-		case m.QueueChan <- byteMsg:
-			slog.Debug("lobby.messenger: mute is send")
-		case <-m.quit:
-		}
-	}
+func (m *Messenger) SendAppMessage(appMessage *message.AppMessage) error {
+	return m.sendData(message.AppMsg, appMessage)
+}
 
+// SendSubscribe selects media streams to receive, after the first subscription only selected media streams are sent.
+func (m *Messenger) SendSubscribe(subscription *message.Subscription) error {
+	return m.sendData(message.SubscribeMsg, subscription)
+}
+
+func (m *Messenger) SendUnsubscribe(subscription *message.Subscription) error {
+	return m.sendData(message.UnsubscribeMsg, subscription)
+}
+
+// SendLastN limits the received video to the count most recently active speakers
+func (m *Messenger) SendLastN(count int) error {
+	return m.sendData(message.LastNMsg, &message.LastN{Count: count})
+}
+
+// sendData sends a message without id, the server does not answer it
+func (m *Messenger) sendData(msgType message.MsgType, data any) error {
+	if err := m.send(&message.ChannelMsg{Type: msgType, Data: data}); err != nil {
+		return fmt.Errorf("marshaling %s message: %w", msgType, err)
+	}
+	slog.Debug("lobby.messenger: message is send", "type", msgType)
 	return nil
 }
 
@@ -159,6 +395,21 @@ func (m *Messenger) Register(o msgObserver) {
 	}
 }
 
+// Close stops sending offers again and drops the queued messages
+func (m *Messenger) Close() {
+	select {
+	case <-m.quit:
+	default:
+		close(m.quit)
+	}
+	m.ackLocker.Lock()
+	defer m.ackLocker.Unlock()
+	for id, msg := range m.unacked {
+		msg.timer.Stop()
+		delete(m.unacked, id)
+	}
+}
+
 func (m *Messenger) Deregister(o msgObserver) {
 	m.locker.Lock()
 	defer m.locker.Unlock()
@@ -166,27 +417,3 @@ func (m *Messenger) Deregister(o msgObserver) {
 		delete(m.observerList, o.GetId())
 	}
 }
-
-func (m *Messenger) unmarshalSdp(msg *message.ChannelMsg) (*message.Sdp, error) {
-	jsonStr, err := json.Marshal(msg.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal message: %w", err)
-	}
-	sdp, err := message.SdpUnmarshal(jsonStr)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal sdp of mesge: %w", err)
-	}
-	return sdp, nil
-}
-
-func (m *Messenger) unmarshalMute(msg *message.ChannelMsg) (*message.Mute, error) {
-	jsonStr, err := json.Marshal(msg.Data)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal message: %w", err)
-	}
-	mute, err := message.MuteUnmarshal(jsonStr)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal mute of message: %w", err)
-	}
-	return mute, nil
-}
@@ -0,0 +1,142 @@
+package media
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"github.com/shigde/sfu/pkg/message"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testOffer  = &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "--o--"}
+	testAnswer = &webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "--a--"}
+)
+
+type testMsgObserver struct {
+	id      uuid.UUID
+	onOffer func(sdp *webrtc.SessionDescription, responseId uint32, responseMsgNumber uint32)
+}
+
+func (o *testMsgObserver) OnOffer(sdp *webrtc.SessionDescription, responseId uint32, responseMsgNumber uint32) {
+	if o.onOffer != nil {
+		o.onOffer(sdp, responseId, responseMsgNumber)
+	}
+}
+func (o *testMsgObserver) OnAnswer(_ *webrtc.SessionDescription, _ uint32, _ uint32) {}
+func (o *testMsgObserver) OnMute(_ *message.Mute)                                    {}
+func (o *testMsgObserver) GetId() uuid.UUID {
+	return o.id
+}
+
+func testMessengerSetup(t *testing.T) (*Messenger, *testMsgObserver) {
+	t.Helper()
+	m := NewMessenger()
+	m.ackTimeout = 10 * time.Millisecond
+	o := &testMsgObserver{id: uuid.New()}
+	m.Register(o)
+	t.Cleanup(m.Close)
+	return m, o
+}
+
+func testServerMsg(t *testing.T, id uint32, msgType message.MsgType, data any) webrtc.DataChannelMessage {
+	t.Helper()
+	raw, err := message.Marshal(&message.ChannelMsg{Id: id, Type: msgType, Data: data})
+	assert.NoError(t, err)
+	return webrtc.DataChannelMessage{Data: raw}
+}
+
+func testSentMsg(t *testing.T, m *Messenger) *message.ChannelMsg {
+	t.Helper()
+	select {
+	case raw := <-m.QueueChan:
+		msg, err := message.Unmarshal(raw)
+		assert.NoError(t, err)
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message was sent")
+		return nil
+	}
+}
+
+func testNoMessage(t *testing.T, m *Messenger) {
+	t.Helper()
+	select {
+	case raw := <-m.QueueChan:
+		t.Errorf("unexpected message: %s", raw)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMessenger(t *testing.T) {
+	t.Run("send offer again until it is answered", func(t *testing.T) {
+		m, _ := testMessengerSetup(t)
+		go func() { _, _ = m.SendSDP(testOffer, 7, 1) }()
+
+		first := testSentMsg(t, m)
+		second := testSentMsg(t, m)
+		assert.Equal(t, message.OfferMsg, first.Type)
+		assert.Equal(t, first, second)
+
+		m.OnMessages(testServerMsg(t, 7, message.AnswerMsg, &message.Sdp{SDP: testAnswer, Number: 1}))
+		testNoMessage(t, m)
+	})
+
+	t.Run("stop sending offer when it is acknowledged", func(t *testing.T) {
+		m, _ := testMessengerSetup(t)
+		go func() { _, _ = m.SendSDP(testOffer, 7, 1) }()
+		testSentMsg(t, m)
+
+		m.OnMessages(testServerMsg(t, 7, message.AckMsg, nil))
+		testNoMessage(t, m)
+	})
+
+	t.Run("give up sending an offer that is never acknowledged", func(t *testing.T) {
+		m, _ := testMessengerSetup(t)
+		go func() { _, _ = m.SendSDP(testOffer, 7, 1) }()
+
+		for attempt := 0; attempt < maxSendAttempts; attempt++ {
+			msg := testSentMsg(t, m)
+			assert.Equal(t, message.OfferMsg, msg.Type)
+			assert.Equal(t, uint32(7), msg.Id)
+		}
+		testNoMessage(t, m)
+	})
+
+	t.Run("answer a repeated offer again", func(t *testing.T) {
+		m, o := testMessengerSetup(t)
+		var offers atomic.Int32
+		o.onOffer = func(_ *webrtc.SessionDescription, responseId uint32, number uint32) {
+			offers.Add(1)
+			_, _ = m.SendSDP(testAnswer, responseId, number)
+		}
+		offer := testServerMsg(t, 3, message.OfferMsg, &message.Sdp{SDP: testOffer, Number: 2})
+
+		go m.OnMessages(offer)
+		answer := testSentMsg(t, m)
+		go m.OnMessages(offer)
+
+		assert.Equal(t, message.AnswerMsg, answer.Type)
+		assert.Equal(t, answer, testSentMsg(t, m))
+		assert.Equal(t, int32(1), offers.Load())
+	})
+
+	t.Run("acknowledge an outdated offer", func(t *testing.T) {
+		m, o := testMessengerSetup(t)
+		var offers atomic.Int32
+		o.onOffer = func(_ *webrtc.SessionDescription, _ uint32, _ uint32) {
+			offers.Add(1)
+		}
+
+		m.OnMessages(testServerMsg(t, 3, message.OfferMsg, &message.Sdp{SDP: testOffer, Number: 2}))
+		m.OnMessages(testServerMsg(t, 4, message.OfferMsg, &message.Sdp{SDP: testOffer, Number: 1}))
+
+		ack := testSentMsg(t, m)
+		assert.Equal(t, message.AckMsg, ack.Type)
+		assert.Equal(t, uint32(4), ack.Id)
+		assert.Equal(t, int32(1), offers.Load())
+	})
+}
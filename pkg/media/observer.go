@@ -13,3 +13,28 @@ type msgObserver interface {
 	OnMute(mute *message.Mute)
 	GetId() uuid.UUID
 }
+
+// metadataObserver can be implemented additionally by an observer, to receive the participant metadata of the media streams.
+type metadataObserver interface {
+	OnMetadata(metadata *message.Metadata)
+}
+
+// chatObserver can be implemented additionally by an observer, to receive the chat messages of the lobby.
+type chatObserver interface {
+	OnChat(chat *message.Chat)
+}
+
+// appMessageObserver can be implemented additionally by an observer, to receive the app messages of the lobby.
+type appMessageObserver interface {
+	OnAppMessage(appMessage *message.AppMessage)
+}
+
+// activeSpeakerObserver can be implemented additionally by an observer, to receive the dominant speaker of the lobby.
+type activeSpeakerObserver interface {
+	OnActiveSpeaker(activeSpeaker *message.ActiveSpeaker)
+}
+
+// trackSlotsObserver can be implemented additionally by an observer, to know which media stream a received track shows.
+type trackSlotsObserver interface {
+	OnTrackSlots(trackSlots *message.TrackSlots)
+}
@@ -0,0 +1,20 @@
+package message
+
+import "encoding/json"
+
+// AppMessage is a small application defined JSON payload like an emoji reaction, a poll vote or a production cue.
+// The namespace identifies the kind of the payload, so that clients can dispatch it to the right component.
+type AppMessage struct {
+	Namespace string          `json:"namespace"`
+	Payload   json.RawMessage `json:"payload"`
+	Target    *AppTarget      `json:"target,omitempty"`
+	Sender    string          `json:"sender,omitempty"` // set by the server
+	Count     uint32          `json:"count,omitempty"`  // set by the server if messages were aggregated
+}
+
+// AppTarget restricts the receivers of an AppMessage. Without target, the message is sent to all participants.
+// The role is one of host, guest, viewer or instance, the server assigns it to the participants.
+type AppTarget struct {
+	Role string `json:"role,omitempty"`
+	User string `json:"user,omitempty"`
+}
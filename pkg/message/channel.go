@@ -1,7 +1,12 @@
 package message
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
 )
 
 type ChannelMsg struct {
@@ -15,10 +20,60 @@ const (
 	OfferMsg MsgType = iota + 1
 	AnswerMsg
 	MuteMsg
+	MetadataMsg
+	ChatMsg
+	AppMsg
+	SubscribeMsg
+	UnsubscribeMsg
+	ActiveSpeakerMsg
+	LastNMsg
+	TrackSlotsMsg
+	AckMsg
+	HelloMsg
+	EstimateMsg
 )
 
+var msgTypeNames = map[MsgType]string{
+	OfferMsg:         "offer",
+	AnswerMsg:        "answer",
+	MuteMsg:          "mute",
+	MetadataMsg:      "metadata",
+	ChatMsg:          "chat",
+	AppMsg:           "app",
+	SubscribeMsg:     "subscribe",
+	UnsubscribeMsg:   "unsubscribe",
+	ActiveSpeakerMsg: "active speaker",
+	LastNMsg:         "last-n",
+	TrackSlotsMsg:    "track slots",
+	AckMsg:           "ack",
+	HelloMsg:         "hello",
+	EstimateMsg:      "estimate",
+}
+
+func (t MsgType) String() string {
+	if name, ok := msgTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(t))
+}
+
+// cborDecMode decodes maps like encoding/json, so the data of a message can be converted to its type in the same way
+var cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+
+// utf8Bom is the byte order mark some JSON encoders put in front of a message
+var utf8Bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Unmarshal decodes a JSON or CBOR message. A JSON message is an object, it may start with whitespace or a byte order
+// mark. A CBOR message is a map, it never starts with '{', whitespace or a byte order mark.
 func Unmarshal(rawChannelMsg []byte) (*ChannelMsg, error) {
 	var newChannelMsg ChannelMsg
+	rawChannelMsg = bytes.TrimPrefix(rawChannelMsg, utf8Bom)
+	if start := bytes.TrimLeft(rawChannelMsg, " \t\r\n"); len(start) > 0 && start[0] != '{' {
+		if err := cborDecMode.Unmarshal(rawChannelMsg, &newChannelMsg); err != nil {
+			return nil, err
+		}
+		return &newChannelMsg, nil
+	}
 	if err := json.Unmarshal(rawChannelMsg, &newChannelMsg); err != nil {
 		return nil, err
 	}
@@ -33,3 +88,17 @@ func Marshal(channelMsg *ChannelMsg) ([]byte, error) {
 	}
 	return data, nil
 }
+
+// DataOf converts the data of a received message to its type. A decoded message holds its data as generic map, so the
+// data takes the way over JSON.
+func DataOf[T any](channelMsg *ChannelMsg) (*T, error) {
+	jsonData, err := json.Marshal(channelMsg.Data)
+	if err != nil {
+		return nil, fmt.Errorf("marshal data of %s message: %w", channelMsg.Type, err)
+	}
+	var data T
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, fmt.Errorf("unmarshal data of %s message: %w", channelMsg.Type, err)
+	}
+	return &data, nil
+}
@@ -0,0 +1,49 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshal(t *testing.T) {
+	chat := &ChannelMsg{Id: 7, Type: ChatMsg, Data: &Chat{Text: "hello"}}
+
+	t.Run("decode json and cbor of peers with different versions on the same channel", func(t *testing.T) {
+		legacy, err := LegacyProtocol().Marshal(chat)
+		assert.NoError(t, err)
+		current, err := NewHello(ChatMsg).Negotiate(NewHello(ChatMsg)).Marshal(chat)
+		assert.NoError(t, err)
+		assert.NotEqual(t, byte('{'), current[0])
+
+		for _, raw := range [][]byte{legacy, current} {
+			msg, err := Unmarshal(raw)
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(7), msg.Id)
+			assert.Equal(t, ChatMsg, msg.Type)
+			data, err := DataOf[Chat](msg)
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", data.Text)
+		}
+	})
+
+	t.Run("decode json with leading whitespace or byte order mark", func(t *testing.T) {
+		raw, err := Marshal(chat)
+		assert.NoError(t, err)
+
+		for _, prefix := range []string{" ", "\n", "\r\n\t", "\xEF\xBB\xBF", "\xEF\xBB\xBF\n"} {
+			msg, err := Unmarshal(append([]byte(prefix), raw...))
+			assert.NoError(t, err, "prefix %q", prefix)
+			if assert.NotNil(t, msg) {
+				assert.Equal(t, ChatMsg, msg.Type)
+			}
+		}
+	})
+
+	t.Run("reject broken messages", func(t *testing.T) {
+		_, err := Unmarshal([]byte(`--no json--`))
+		assert.Error(t, err)
+		_, err = Unmarshal([]byte(` {"id":`))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,12 @@
+package message
+
+import "time"
+
+// Chat is a text message of a lobby participant.
+// The server sets the id, the user and the time, a client only needs to send the text.
+type Chat struct {
+	Id   string    `json:"id"`
+	User string    `json:"user"`
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+}
@@ -0,0 +1,10 @@
+package message
+
+// Estimate is the bitrate in bit/s an instance can forward to its receivers, sent to the instance it receives the media
+// from. Hops counts the links the estimate covers. Trace carries the trace context of the sending instance, so the
+// feedback of all instances of a chain belongs to one trace.
+type Estimate struct {
+	Bitrate uint64            `json:"bitrate"`
+	Hops    int               `json:"hops"`
+	Trace   map[string]string `json:"trace,omitempty"`
+}
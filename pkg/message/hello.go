@@ -0,0 +1,137 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// ProtocolVersion is the version of the data channel protocol. Version 1 is the protocol without hello, it only knows
+// JSON and the remote peer has to ignore unknown message types.
+const (
+	LegacyProtocolVersion uint32 = 1
+	ProtocolVersion       uint32 = 2
+)
+
+var ErrMsgTypeNotSupported = errors.New("message type is not supported by the remote peer")
+
+type Encoding string
+
+const (
+	JsonEncoding Encoding = "json"
+	CborEncoding Encoding = "cbor"
+)
+
+// Hello is the first message of a peer when the data channel opens. The encodings are ordered by preference and the
+// types are the message types the peer understands. A hello is always sent as JSON, so every peer can read it.
+type Hello struct {
+	Version   uint32     `json:"version"`
+	Encodings []Encoding `json:"encodings"`
+	Types     []MsgType  `json:"types"`
+}
+
+func NewHello(types ...MsgType) *Hello {
+	return &Hello{
+		Version:   ProtocolVersion,
+		Encodings: []Encoding{CborEncoding, JsonEncoding},
+		Types:     types,
+	}
+}
+
+// Negotiate returns the protocol to talk with the remote peer. It uses the lowest version of both peers and the first
+// own encoding the remote peer knows.
+func (h *Hello) Negotiate(remote *Hello) *Protocol {
+	protocol := &Protocol{version: min(h.Version, remote.Version), encoding: JsonEncoding, types: remote.Types}
+	if protocol.version < ProtocolVersion {
+		return LegacyProtocol()
+	}
+	for _, encoding := range h.Encodings {
+		if slices.Contains(remote.Encodings, encoding) {
+			protocol.encoding = encoding
+			break
+		}
+	}
+	return protocol
+}
+
+// Protocol is the negotiated protocol of a data channel, it encodes the messages for the remote peer.
+type Protocol struct {
+	version  uint32
+	encoding Encoding
+	types    []MsgType
+}
+
+// LegacyProtocol is the protocol of a remote peer without hello, it sends JSON and all message types
+func LegacyProtocol() *Protocol {
+	return &Protocol{version: LegacyProtocolVersion, encoding: JsonEncoding}
+}
+
+func (p *Protocol) Version() uint32 {
+	return p.version
+}
+
+func (p *Protocol) Encoding() Encoding {
+	return p.encoding
+}
+
+// Supports reports whether the remote peer understands the message type. The signalling is understood by every peer.
+func (p *Protocol) Supports(msgType MsgType) bool {
+	switch msgType {
+	case OfferMsg, AnswerMsg, AckMsg, HelloMsg:
+		return true
+	}
+	return p.version < ProtocolVersion || slices.Contains(p.types, msgType)
+}
+
+func (p *Protocol) Marshal(channelMsg *ChannelMsg) ([]byte, error) {
+	if !p.Supports(channelMsg.Type) {
+		return nil, ErrMsgTypeNotSupported
+	}
+	if p.encoding == CborEncoding {
+		return marshalCbor(channelMsg)
+	}
+	return Marshal(channelMsg)
+}
+
+// marshalCbor encodes the data like JSON first, because the sdp types only know their JSON representation
+func marshalCbor(channelMsg *ChannelMsg) ([]byte, error) {
+	data, err := json.Marshal(channelMsg.Data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var plainData interface{}
+	if err = decoder.Decode(&plainData); err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(&ChannelMsg{Id: channelMsg.Id, Type: channelMsg.Type, Data: withNumbers(plainData)})
+}
+
+// withNumbers replaces the JSON numbers by integers, large ids and revisions would lose precision as float
+func withNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = withNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withNumbers(item)
+		}
+	}
+	return value
+}
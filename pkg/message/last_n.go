@@ -0,0 +1,7 @@
+package message
+
+// LastN limits the video of a client to the N most recently active speakers, the audio is always received.
+// A count of 0 disables Last-N for the client, a negative count uses the setting of the lobby.
+type LastN struct {
+	Count int `json:"count"`
+}
@@ -0,0 +1,11 @@
+package message
+
+// Metadata describes the participant behind a media stream, so that clients can label the media tiles.
+type Metadata struct {
+	MediaStreamId string `json:"mediaStreamId"`
+	DisplayName   string `json:"displayName"`
+	AvatarUrl     string `json:"avatarUrl,omitempty"`
+	ActorIri      string `json:"actorIri,omitempty"`
+	Role          string `json:"role,omitempty"` // set by the server
+	HandRaised    bool   `json:"handRaised"`
+}
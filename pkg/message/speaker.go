@@ -0,0 +1,7 @@
+package message
+
+// ActiveSpeaker announces the dominant speaker of the lobby.
+// An empty media stream id means that the last speaker has left the lobby.
+type ActiveSpeaker struct {
+	MediaStreamId string `json:"mediaStreamId"`
+}
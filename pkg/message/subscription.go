@@ -0,0 +1,8 @@
+package message
+
+// Subscription selects the media streams a client wants to receive (SubscribeMsg) or no longer wants to
+// receive (UnsubscribeMsg). MaxQuality limits the video quality: LOW, MEDIUM, HIGH or OFF for audio only.
+type Subscription struct {
+	MediaStreamIds []string `json:"mediaStreamIds"`
+	MaxQuality     string   `json:"maxQuality,omitempty"`
+}
@@ -0,0 +1,19 @@
+package message
+
+// TrackSlot maps a pre-allocated egress track of the client to the media stream it currently shows.
+// The track id is the id of the received track, an empty media stream id means that the slot is paused.
+// Purpose and mute belong to the shown media stream, a slot shows no sdp "i=" line of its own.
+type TrackSlot struct {
+	TrackId       string `json:"trackId"`
+	Kind          string `json:"kind"`
+	MediaStreamId string `json:"mediaStreamId"`
+	Purpose       string `json:"purpose,omitempty"`
+	Mute          bool   `json:"mute"`
+}
+
+// TrackSlots is the complete slot mapping of a client, it is sent every time the mapping changes.
+// The revision increases with every change, a mapping with a lower revision than the last one is outdated.
+type TrackSlots struct {
+	Revision uint64       `json:"revision"`
+	Slots    []*TrackSlot `json:"slots"`
+}